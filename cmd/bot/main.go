@@ -11,6 +11,7 @@ import (
 
 	"github.com/applejobs/telegram-remote-controller/config"
 	"github.com/applejobs/telegram-remote-controller/internal/bot"
+	"github.com/applejobs/telegram-remote-controller/internal/outbox"
 )
 
 func main() {
@@ -30,18 +31,74 @@ func main() {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	// Create bot (handler will be set after)
+	// Create bot (handler is set once it exists)
 	telegramBot, err := bot.New(cfg.TelegramBotToken, nil)
 	if err != nil {
 		log.Fatalf("Failed to create bot: %v", err)
 	}
 
+	// Queue outgoing messages so rate limits and outages don't lose them
+	if err := telegramBot.EnableOutbox(bot.DefaultOutboxPath, outbox.Options{MaxAge: cfg.OutboxMaxAge}); err != nil {
+		log.Printf("Warning: outbox unavailable, messages are sent without retry: %v", err)
+	}
+	defer telegramBot.CloseOutbox()
+
 	// Create main handler with auth
-	handler := bot.NewMainHandler(telegramBot, allowedUsers)
+	opts := bot.DefaultHandlerOptions()
+	if cfg.AliasesFile != "" {
+		opts.CatalogPath = cfg.AliasesFile
+	}
+	if cfg.RoutingFile != "" {
+		opts.RoutingPath = cfg.RoutingFile
+	}
+	if cfg.TemplatesFile != "" {
+		opts.TemplatesPath = cfg.TemplatesFile
+	}
+	if cfg.PrefsFile != "" {
+		opts.PrefsPath = cfg.PrefsFile
+	}
+	if cfg.LanguagesFile != "" {
+		opts.LanguagesPath = cfg.LanguagesFile
+	}
+	if cfg.IDEProfilesFile != "" {
+		opts.ProfilesPath = cfg.IDEProfilesFile
+	}
+	opts.AdminChatID = cfg.AdminChatID
+	opts.DocumentThreshold = cfg.DocumentThreshold
+	opts.PreviewLines = cfg.PreviewLines
+
+	// Sign buttons with a stable secret so they survive restarts
+	opts.CallbackSecret = []byte(cfg.CallbackSecret)
+	if cfg.CallbackSecret == "" {
+		opts.CallbackSecret = []byte(cfg.TelegramBotToken)
+	}
+	opts.CallbackTTL = cfg.CallbackTTL
+
+	handler := bot.NewMainHandlerWithOptions(telegramBot, allowedUsers, opts)
+	for _, id := range parseUserIDs("ADMIN_USER_ID") {
+		handler.Auth.AddAdmin(id)
+	}
+
+	telegramBot.SetHandler(handler)
+	telegramBot.StallTimeout = cfg.StallTimeout
+	telegramBot.Workers = cfg.Workers
+	telegramBot.UpdateTimeout = cfg.UpdateTimeout
+
+	// Remember handled updates so a restart never runs a command twice
+	updates, err := bot.OpenUpdateLog(bot.DefaultUpdateLogPath, bot.DefaultUpdateLogSize)
+	if err != nil {
+		log.Printf("Warning: update log unavailable, updates may be replayed: %v", err)
+	} else {
+		telegramBot.Updates = updates
+	}
 
-	// Recreate bot with handler
-	telegramBot, _ = bot.New(cfg.TelegramBotToken, handler)
-	handler.Bot = telegramBot
+	// Show the commands in Telegram's menu
+	if err := handler.PublishCommands(); err != nil {
+		log.Printf("Warning: failed to set the command menu: %v", err)
+	}
+
+	// Resume queued jobs and pending responses now that everything is set up
+	handler.Start()
 
 	// Handle shutdown signals
 	sigCh := make(chan os.Signal, 1)
@@ -54,8 +111,18 @@ func main() {
 	}()
 
 	// Start bot
-	log.Println("Bot is running. Press Ctrl+C to stop.")
-	if err := telegramBot.Start(ctx); err != nil {
+	log.Printf("Bot is running in %s mode. Press Ctrl+C to stop.", cfg.UpdateMode)
+	if cfg.UpdateMode == config.ModeWebhook {
+		err = telegramBot.StartWebhook(ctx, bot.WebhookOptions{
+			URL:    cfg.WebhookURL,
+			Listen: cfg.WebhookListen,
+			Path:   cfg.WebhookPath,
+			Secret: cfg.WebhookSecret,
+		})
+	} else {
+		err = telegramBot.Start(ctx)
+	}
+	if err != nil {
 		log.Printf("Bot stopped: %v", err)
 	}
 
@@ -71,8 +138,13 @@ func parseAllowedUsers() []int64 {
 		return nil
 	}
 
+	return parseUserIDs("ALLOWED_USER_ID")
+}
+
+// parseUserIDs parses a comma-separated list of user IDs from the environment
+func parseUserIDs(key string) []int64 {
 	var users []int64
-	for _, s := range strings.Split(env, ",") {
+	for _, s := range strings.Split(os.Getenv(key), ",") {
 		s = strings.TrimSpace(s)
 		if id, err := strconv.ParseInt(s, 10, 64); err == nil {
 			users = append(users, id)
@@ -2,12 +2,99 @@ package config
 
 import (
 	"os"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/applejobs/telegram-remote-controller/internal/bot"
+	"github.com/applejobs/telegram-remote-controller/internal/callback"
+	"github.com/applejobs/telegram-remote-controller/internal/outbox"
+)
+
+// Defaults of the settings below, kept by the packages that apply them
+const (
+	DefaultDocumentThreshold = bot.DefaultDocumentThreshold
+	DefaultPreviewLines      = bot.DefaultPreviewLines
+	DefaultCallbackTTL       = callback.DefaultTTL
+	DefaultStallTimeout      = bot.DefaultStallTimeout
+	DefaultWorkers           = bot.DefaultWorkers
+	DefaultUpdateTimeout     = bot.DefaultUpdateTimeout
+	DefaultOutboxMaxAge      = outbox.DefaultMaxAge
+)
+
+// Update modes
+const (
+	ModePolling = "polling"
+	ModeWebhook = "webhook"
+)
+
+// Defaults for webhook mode
+const (
+	DefaultWebhookListen = ":8443"
+	DefaultWebhookPath   = "/telegram/webhook"
 )
 
 // Config holds application configuration
 type Config struct {
 	TelegramBotToken string
 	AllowedUsers     []int64
+	AdminChatID      int64 // Receives responses that match no run
+
+	// Responses longer than DocumentThreshold (UTF-16 units) are sent as a
+	// .md document with a preview of the first PreviewLines lines
+	DocumentThreshold int
+	PreviewLines      int
+
+	// CallbackSecret signs inline button data; the bot token is used when empty.
+	// Buttons stop working after CallbackTTL.
+	CallbackSecret string
+	CallbackTTL    time.Duration
+
+	// UpdateMode is "polling" (default) or "webhook". In webhook mode the bot
+	// listens on WebhookListen at WebhookPath and registers WebhookURL, the
+	// public address that reaches it, with Telegram. Requests must carry
+	// WebhookSecret in the X-Telegram-Bot-Api-Secret-Token header.
+	UpdateMode    string
+	WebhookURL    string
+	WebhookListen string
+	WebhookPath   string
+	WebhookSecret string
+
+	// StallTimeout is how long polling may go without a completed
+	// getUpdates before the API client is re-created
+	StallTimeout time.Duration
+
+	// Workers bounds how many updates are handled at once; updates from
+	// one chat still run in order. Each may take up to UpdateTimeout,
+	// after which its context is cancelled; it keeps its worker until
+	// the handler returns.
+	Workers       int
+	UpdateTimeout time.Duration
+
+	// OutboxMaxAge is how long an outgoing message that could not be
+	// delivered keeps being retried, across restarts, before it is dropped
+	OutboxMaxAge time.Duration
+
+	// AliasesFile is the JSON catalog of model and app aliases; empty uses the default path
+	AliasesFile string
+
+	// RoutingFile holds the rules that pick a model for prompts without -m;
+	// empty uses the default path
+	RoutingFile string
+
+	// TemplatesFile keeps the /tpl templates; empty uses the default path
+	TemplatesFile string
+
+	// PrefsFile keeps each user's /settings; empty uses the default path
+	PrefsFile string
+
+	// LanguagesFile holds the languages picked with /lang before PrefsFile
+	// existed; they are imported once. Empty uses the default path.
+	LanguagesFile string
+
+	// IDEProfilesFile describes how to drive each IDE for /ide; empty uses
+	// the default path
+	IDEProfilesFile string
 }
 
 // Load loads configuration from environment variables
@@ -15,6 +102,34 @@ func Load() *Config {
 	return &Config{
 		TelegramBotToken: os.Getenv("TELEGRAM_BOT_TOKEN"),
 		AllowedUsers:     []int64{}, // Will be populated from config file
+		AdminChatID:      envInt64("ADMIN_CHAT_ID"),
+
+		DocumentThreshold: envInt("RESPONSE_DOCUMENT_THRESHOLD", DefaultDocumentThreshold),
+		PreviewLines:      envInt("RESPONSE_PREVIEW_LINES", DefaultPreviewLines),
+
+		CallbackSecret: os.Getenv("CALLBACK_SECRET"),
+		CallbackTTL:    envDuration("CALLBACK_TTL", DefaultCallbackTTL),
+
+		UpdateMode:    envString("UPDATE_MODE", ModePolling),
+		WebhookURL:    os.Getenv("WEBHOOK_URL"),
+		WebhookListen: envString("WEBHOOK_LISTEN", DefaultWebhookListen),
+		WebhookPath:   envString("WEBHOOK_PATH", DefaultWebhookPath),
+		WebhookSecret: os.Getenv("WEBHOOK_SECRET"),
+
+		StallTimeout: envDuration("POLL_STALL_TIMEOUT", DefaultStallTimeout),
+
+		Workers:       envInt("WORKERS", DefaultWorkers),
+		UpdateTimeout: envDuration("UPDATE_TIMEOUT", DefaultUpdateTimeout),
+
+		OutboxMaxAge: envDuration("OUTBOX_MAX_AGE", DefaultOutboxMaxAge),
+
+		AliasesFile:   os.Getenv("ALIASES_FILE"),
+		RoutingFile:   os.Getenv("ROUTING_FILE"),
+		TemplatesFile: os.Getenv("TEMPLATES_FILE"),
+		PrefsFile:     os.Getenv("PREFS_FILE"),
+		LanguagesFile: os.Getenv("LANGUAGES_FILE"),
+
+		IDEProfilesFile: os.Getenv("IDE_PROFILES_FILE"),
 	}
 }
 
@@ -23,12 +138,70 @@ func (c *Config) Validate() error {
 	if c.TelegramBotToken == "" {
 		return ErrMissingToken
 	}
+
+	switch c.UpdateMode {
+	case ModePolling:
+	case ModeWebhook:
+		if c.WebhookURL == "" {
+			return ErrMissingWebhookURL
+		}
+		if !webhookSecretPattern.MatchString(c.WebhookSecret) {
+			return ErrInvalidWebhookSecret
+		}
+	default:
+		return ErrInvalidUpdateMode
+	}
 	return nil
 }
 
+// webhookSecretPattern is what Telegram accepts as a webhook secret token
+var webhookSecretPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,256}$`)
+
+// envString reads an environment variable, returning def when unset
+func envString(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
+
+// envInt64 reads an integer environment variable, returning 0 when unset or invalid
+func envInt64(key string) int64 {
+	v, err := strconv.ParseInt(os.Getenv(key), 10, 64)
+	if err != nil {
+		return 0
+	}
+	return v
+}
+
+// envInt reads an integer environment variable, returning def when unset or invalid
+func envInt(key string, def int) int {
+	v, err := strconv.Atoi(os.Getenv(key))
+	if err != nil || v <= 0 {
+		return def
+	}
+	return v
+}
+
+// envDuration reads a duration such as "24h", returning def when unset or invalid
+func envDuration(key string, def time.Duration) time.Duration {
+	v, err := time.ParseDuration(os.Getenv(key))
+	if err != nil || v <= 0 {
+		return def
+	}
+	return v
+}
+
 // ErrMissingToken is returned when TELEGRAM_BOT_TOKEN is not set
 var ErrMissingToken = configError("TELEGRAM_BOT_TOKEN environment variable is not set")
 
+// Webhook mode errors
+var (
+	ErrInvalidUpdateMode    = configError("UPDATE_MODE must be polling or webhook")
+	ErrMissingWebhookURL    = configError("WEBHOOK_URL is required in webhook mode")
+	ErrInvalidWebhookSecret = configError("WEBHOOK_SECRET must be 1-256 characters of A-Z, a-z, 0-9, _ or -")
+)
+
 type configError string
 
 func (e configError) Error() string {
@@ -3,6 +3,7 @@ package config
 import (
 	"os"
 	"testing"
+	"time"
 )
 
 func TestLoadConfig(t *testing.T) {
@@ -31,3 +32,62 @@ func TestValidateWithoutToken(t *testing.T) {
 		t.Error("Validate() should fail without token")
 	}
 }
+
+func TestLoadAdminChatID(t *testing.T) {
+	os.Setenv("ADMIN_CHAT_ID", "-100123")
+	defer os.Unsetenv("ADMIN_CHAT_ID")
+
+	cfg := Load()
+	if cfg.AdminChatID != -100123 {
+		t.Errorf("Expected AdminChatID -100123, got %d", cfg.AdminChatID)
+	}
+}
+
+func TestLoadResponseLimits(t *testing.T) {
+	cfg := Load()
+	if cfg.DocumentThreshold != DefaultDocumentThreshold || cfg.PreviewLines != DefaultPreviewLines {
+		t.Errorf("Expected defaults, got %d/%d", cfg.DocumentThreshold, cfg.PreviewLines)
+	}
+
+	os.Setenv("RESPONSE_DOCUMENT_THRESHOLD", "2000")
+	defer os.Unsetenv("RESPONSE_DOCUMENT_THRESHOLD")
+
+	cfg = Load()
+	if cfg.DocumentThreshold != 2000 {
+		t.Errorf("Expected DocumentThreshold 2000, got %d", cfg.DocumentThreshold)
+	}
+}
+
+func TestLoadCallbackTTL(t *testing.T) {
+	if cfg := Load(); cfg.CallbackTTL != DefaultCallbackTTL {
+		t.Errorf("Expected default TTL, got %v", cfg.CallbackTTL)
+	}
+
+	os.Setenv("CALLBACK_TTL", "36h")
+	defer os.Unsetenv("CALLBACK_TTL")
+
+	if cfg := Load(); cfg.CallbackTTL != 36*time.Hour {
+		t.Errorf("Expected 36h, got %v", cfg.CallbackTTL)
+	}
+}
+
+func TestValidateWebhookMode(t *testing.T) {
+	tests := []struct {
+		name     string
+		cfg      Config
+		expected error
+	}{
+		{"polling", Config{TelegramBotToken: "t", UpdateMode: ModePolling}, nil},
+		{"webhook", Config{TelegramBotToken: "t", UpdateMode: ModeWebhook, WebhookURL: "https://x/hook", WebhookSecret: "s3cr-et_"}, nil},
+		{"missing url", Config{TelegramBotToken: "t", UpdateMode: ModeWebhook, WebhookSecret: "s"}, ErrMissingWebhookURL},
+		{"missing secret", Config{TelegramBotToken: "t", UpdateMode: ModeWebhook, WebhookURL: "https://x/hook"}, ErrInvalidWebhookSecret},
+		{"bad secret", Config{TelegramBotToken: "t", UpdateMode: ModeWebhook, WebhookURL: "https://x/hook", WebhookSecret: "a b"}, ErrInvalidWebhookSecret},
+		{"unknown mode", Config{TelegramBotToken: "t", UpdateMode: "push"}, ErrInvalidUpdateMode},
+	}
+
+	for _, tt := range tests {
+		if err := tt.cfg.Validate(); err != tt.expected {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.expected, err)
+		}
+	}
+}
@@ -2,4 +2,4 @@ module github.com/applejobs/telegram-remote-controller
 
 go 1.25.6
 
-require github.com/go-telegram-bot-api/telegram-bot-api/v5 v5.5.1 // indirect
+require github.com/go-telegram-bot-api/telegram-bot-api/v5 v5.5.1
@@ -15,12 +15,14 @@ type Authenticator interface {
 type Whitelist struct {
 	mu           sync.RWMutex
 	allowedUsers map[int64]bool
+	admins       map[int64]bool
 }
 
 // NewWhitelist creates a new Whitelist authenticator
 func NewWhitelist(userIDs []int64) *Whitelist {
 	w := &Whitelist{
 		allowedUsers: make(map[int64]bool),
+		admins:       make(map[int64]bool),
 	}
 	for _, id := range userIDs {
 		w.allowedUsers[id] = true
@@ -65,5 +67,22 @@ func (w *Whitelist) RemoveUser(userID int64) {
 	w.mu.Lock()
 	defer w.mu.Unlock()
 	delete(w.allowedUsers, userID)
+	delete(w.admins, userID)
 	log.Printf("Removed user %d from whitelist", userID)
 }
+
+// AddAdmin allows a user and lets them run admin commands
+func (w *Whitelist) AddAdmin(userID int64) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.allowedUsers[userID] = true
+	w.admins[userID] = true
+	log.Printf("Added admin %d", userID)
+}
+
+// IsAdmin checks if the user may run admin commands
+func (w *Whitelist) IsAdmin(userID int64) bool {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	return w.admins[userID]
+}
@@ -63,6 +63,23 @@ func TestAddRemoveUser(t *testing.T) {
 	}
 }
 
+func TestAdmins(t *testing.T) {
+	w := NewWhitelist([]int64{123})
+	if w.IsAdmin(123) {
+		t.Error("Allowed users should not be admins by default")
+	}
+
+	w.AddAdmin(456)
+	if !w.IsAdmin(456) || !w.IsAuthorized(456) {
+		t.Error("Admin 456 should be an authorized admin")
+	}
+
+	w.RemoveUser(456)
+	if w.IsAdmin(456) {
+		t.Error("Removed user should no longer be an admin")
+	}
+}
+
 func TestEmptyWhitelist(t *testing.T) {
 	w := NewWhitelist([]int64{})
 
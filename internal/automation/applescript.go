@@ -0,0 +1,145 @@
+package automation
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Expr is an AppleScript expression. Text from outside the program is only
+// ever a String, so it is quoted and cannot change what a script does.
+type Expr interface {
+	Source() string
+}
+
+// String is a string literal
+type String string
+
+// Source quotes the string. Backslashes and quotes are escaped, and line
+// breaks and tabs are joined in as constants so the literal stays on one line.
+func (s String) Source() string {
+	var parts []string
+	var sb strings.Builder
+	flush := func() {
+		if sb.Len() > 0 {
+			parts = append(parts, `"`+sb.String()+`"`)
+			sb.Reset()
+		}
+	}
+	for _, r := range string(s) {
+		switch r {
+		case '\\', '"':
+			sb.WriteRune('\\')
+			sb.WriteRune(r)
+		case '\n':
+			flush()
+			parts = append(parts, "linefeed")
+		case '\r':
+			flush()
+			parts = append(parts, "return")
+		case '\t':
+			flush()
+			parts = append(parts, "tab")
+		default:
+			sb.WriteRune(r)
+		}
+	}
+	flush()
+	if len(parts) == 0 {
+		return `""`
+	}
+	return strings.Join(parts, " & ")
+}
+
+// Raw is AppleScript written in this program, such as a variable or a
+// keyword. It must never hold text from outside.
+type Raw string
+
+// Source returns the code as is
+func (r Raw) Source() string { return string(r) }
+
+// Number is a numeric literal
+type Number float64
+
+// Source formats the number
+func (n Number) Source() string { return strconv.FormatFloat(float64(n), 'f', -1, 64) }
+
+// List is a list literal, e.g. {command down, shift down}
+type List []Expr
+
+// Source joins the items in braces
+func (l List) Source() string {
+	items := make([]string, len(l))
+	for i, item := range l {
+		items[i] = item.Source()
+	}
+	return "{" + strings.Join(items, ", ") + "}"
+}
+
+// App refers to an application by name: application "Antigravity"
+func App(name string) Expr {
+	return Raw("application " + String(name).Source())
+}
+
+// Stmt is one statement or block of a script
+type Stmt interface {
+	write(sb *strings.Builder, depth int)
+}
+
+// line is a single statement
+type line string
+
+func (l line) write(sb *strings.Builder, depth int) {
+	sb.WriteString(strings.Repeat("\t", depth) + string(l) + "\n")
+}
+
+// block is a statement with a body, such as tell ... end tell
+type block struct {
+	head, tail string
+	body       []Stmt
+}
+
+func (b block) write(sb *strings.Builder, depth int) {
+	line(b.head).write(sb, depth)
+	for _, stmt := range b.body {
+		stmt.write(sb, depth+1)
+	}
+	line(b.tail).write(sb, depth)
+}
+
+// Cmd is a statement: format is code written in this program, and each %s
+// is filled in with an expression, e.g. Cmd("keystroke %s", String(text))
+func Cmd(format string, args ...Expr) Stmt {
+	sources := make([]any, len(args))
+	for i, arg := range args {
+		sources[i] = arg.Source()
+	}
+	return line(fmt.Sprintf(format, sources...))
+}
+
+// Tell sends the body to target: tell <target> ... end tell
+func Tell(target Expr, body ...Stmt) Stmt {
+	return block{head: "tell " + target.Source(), tail: "end tell", body: body}
+}
+
+// RepeatWith runs the body for each item: repeat with <name> in <list>
+func RepeatWith(name Raw, list Expr, body ...Stmt) Stmt {
+	return block{head: "repeat with " + name.Source() + " in (" + list.Source() + ")", tail: "end repeat", body: body}
+}
+
+// Script is an AppleScript program
+type Script []Stmt
+
+// String renders the script, indenting blocks with tabs
+func (s Script) String() string {
+	var sb strings.Builder
+	for _, stmt := range s {
+		stmt.write(&sb, 0)
+	}
+	return sb.String()
+}
+
+// Run runs the script with osascript and returns its output
+func (s Script) Run() (string, error) {
+	return RunScript(s.String())
+}
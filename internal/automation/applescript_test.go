@@ -0,0 +1,90 @@
+package automation
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite golden files")
+
+// TestGolden compares every script the package runs with its golden file in
+// testdata. Run with -update to rewrite them.
+func TestGolden(t *testing.T) {
+	tests := []struct {
+		name   string
+		script func() (Script, error)
+	}{
+		{"open_app", func() (Script, error) { return openAppScript(`Evil" to quit`), nil }},
+		{"is_running", func() (Script, error) { return isAppRunningScript(`My "App" \ 2`), nil }},
+		{"type_text", func() (Script, error) { return typeTextScript("say \"hi\" \\ then\nnext line\ttab"), nil }},
+		{"type_char", func() (Script, error) { return typeCharScript('"', 50), nil }},
+		{"press_named_key", func() (Script, error) { return pressKeyScript("return", "command") }},
+		{"press_character", func() (Script, error) { return pressKeyScript("l", "command", "shift") }},
+		{"press_key_code", func() (Script, error) { return pressKeyCodeScript(20, "command", "shift") }},
+		{"press_digit", func() (Script, error) { return pressKeyScript("1", "command") }},
+		{"press_percent", func() (Script, error) { return pressKeyScript("%") }},
+		{"set_clipboard", func() (Script, error) {
+			return setClipboardScript(`" & (do shell script "rm -rf ~") & "`), nil
+		}},
+		{"list_windows", func() (Script, error) { return listWindowsScript(), nil }},
+	}
+	for _, tt := range tests {
+		golden := filepath.Join("testdata", tt.name+".applescript")
+		t.Run(tt.name, func(t *testing.T) {
+			script, err := tt.script()
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := script.String()
+			if *update {
+				if err := os.WriteFile(golden, []byte(got), 0644); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatalf("Missing golden file (run go test -update): %v", err)
+			}
+			if got != string(want) {
+				t.Errorf("Script differs from %s\n--- got ---\n%s\n--- want ---\n%s", golden, got, want)
+			}
+		})
+	}
+}
+
+func TestStringSource(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"", `""`},
+		{"plain", `"plain"`},
+		{`say "hi"`, `"say \"hi\""`},
+		{`C:\dir\`, `"C:\\dir\\"`},
+		{"a\nb", `"a" & linefeed & "b"`},
+		{"\r\n", `return & linefeed`},
+		{"col\t", `"col" & tab`},
+		{"你好 🎉", `"你好 🎉"`},
+	}
+	for _, tt := range tests {
+		if got := String(tt.text).Source(); got != tt.want {
+			t.Errorf("String(%q).Source() = %s, want %s", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestPressKeyRejectsUnknownModifiers(t *testing.T) {
+	if _, err := pressKeyScript("a", `command down} & "`); err == nil {
+		t.Error("Unknown modifiers should be rejected")
+	}
+}
+
+func TestPressKeyRejectsUnknownKeys(t *testing.T) {
+	if _, err := pressKeyScript("F13", "command"); err == nil {
+		t.Error("A key that is neither named nor one character should be rejected")
+	}
+}
@@ -0,0 +1,44 @@
+package automation
+
+import "runtime"
+
+// Modifier is a key held down in a key chord
+type Modifier string
+
+const (
+	Command Modifier = "command" // Ctrl on Linux, so shortcuts carry over
+	Shift   Modifier = "shift"
+	Option  Modifier = "option" // Alt on Linux
+	Control Modifier = "control"
+)
+
+// Window is an open window of an application
+type Window struct {
+	App   string
+	Title string
+}
+
+// Automator drives the desktop: apps, the keyboard and the clipboard.
+// OpenWorkspace opens a folder in an app, the way "Open Folder" would.
+// Keys are named as in PressKey ("return", "tab", "escape", ...) or are a
+// single character, digits included, which means the key that types it.
+type Automator interface {
+	Activate(app string) error
+	IsRunning(app string) (bool, error)
+	OpenWorkspace(app, path string) error
+	Type(text string) error
+	KeyChord(key string, modifiers ...Modifier) error
+	GetClipboard() (string, error)
+	SetClipboard(text string) error
+	Paste() error
+	ListWindows() ([]Window, error)
+}
+
+// New returns the Automator for this platform: osascript on macOS and
+// xdotool with the clipboard tools on Linux
+func New() Automator {
+	if runtime.GOOS == "linux" {
+		return NewLinux()
+	}
+	return OSAScript{}
+}
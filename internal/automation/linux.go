@@ -0,0 +1,194 @@
+package automation
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// Linux is the Automator for X11 desktops. It drives windows and the
+// keyboard with xdotool and lists them with wmctrl; the clipboard goes
+// through wl-copy/wl-paste under Wayland and xclip otherwise. Under
+// Wayland, xdotool only reaches apps running on XWayland.
+type Linux struct {
+	wayland bool
+
+	// run executes a command with stdin and returns its trimmed output
+	run func(stdin, name string, args ...string) (string, error)
+
+	// lookPath finds a command, like exec.LookPath
+	lookPath func(name string) (string, error)
+}
+
+var _ Automator = (*Linux)(nil)
+
+// NewLinux returns a Linux automator for the current session
+func NewLinux() *Linux {
+	return &Linux{
+		wayland:  os.Getenv("WAYLAND_DISPLAY") != "",
+		run:      runCommand,
+		lookPath: exec.LookPath,
+	}
+}
+
+// runCommand runs a tool, reporting its stderr on failure
+func runCommand(stdin, name string, args ...string) (string, error) {
+	cmd := exec.Command(name, args...)
+	if stdin != "" {
+		cmd.Stdin = strings.NewReader(stdin)
+	}
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("%s error: %w, stderr: %s", name, err, stderr.String())
+	}
+	return strings.TrimSpace(stdout.String()), nil
+}
+
+// linuxKeys maps the key names PressKey understands to X keysyms
+var linuxKeys = map[string]string{
+	"return":    "Return",
+	"enter":     "Return",
+	"tab":       "Tab",
+	"escape":    "Escape",
+	"space":     "space",
+	"delete":    "BackSpace",
+	"backspace": "BackSpace",
+	"up":        "Up",
+	"down":      "Down",
+	"left":      "Left",
+	"right":     "Right",
+}
+
+// linuxCLIs are the launchers of apps whose command is not their name
+// lowercased, e.g. "Cursor" is "cursor"
+var linuxCLIs = map[string]string{
+	"visual studio code": "code",
+}
+
+// linuxModifiers maps modifiers to xdotool's names
+var linuxModifiers = map[Modifier]string{
+	Command: "ctrl",
+	Shift:   "shift",
+	Option:  "alt",
+	Control: "ctrl",
+}
+
+// Activate raises the first visible window whose class matches app
+func (l *Linux) Activate(app string) error {
+	if _, err := l.run("", "xdotool", "search", "--onlyvisible", "--class", app, "windowactivate", "--sync"); err != nil {
+		return fmt.Errorf("failed to activate %s: %w", app, err)
+	}
+	return nil
+}
+
+// IsRunning reports whether app has a window; xdotool fails when a search
+// finds nothing
+func (l *Linux) IsRunning(app string) (bool, error) {
+	out, err := l.run("", "xdotool", "search", "--class", app)
+	if err != nil {
+		return false, nil
+	}
+	return out != "", nil
+}
+
+// OpenWorkspace opens a folder with the app's command line launcher, or
+// with the default file manager through xdg-open when it has none
+func (l *Linux) OpenWorkspace(app, path string) error {
+	cli, ok := linuxCLIs[strings.ToLower(app)]
+	if !ok {
+		cli = strings.ToLower(strings.ReplaceAll(app, " ", "-"))
+	}
+	if _, err := l.lookPath(cli); err != nil {
+		cli = "xdg-open"
+	}
+	_, err := l.run("", cli, path)
+	return err
+}
+
+// Type types text into the focused window
+func (l *Linux) Type(text string) error {
+	_, err := l.run("", "xdotool", "type", "--clearmodifiers", "--", text)
+	return err
+}
+
+// KeyChord presses a key while holding modifiers, e.g. "ctrl+shift+l"
+func (l *Linux) KeyChord(key string, modifiers ...Modifier) error {
+	_, err := l.run("", "xdotool", "key", "--clearmodifiers", linuxChord(key, modifiers))
+	return err
+}
+
+// linuxChord spells a key chord the way xdotool expects
+func linuxChord(key string, modifiers []Modifier) string {
+	if sym, ok := linuxKeys[strings.ToLower(key)]; ok {
+		key = sym
+	}
+	var parts []string
+	for _, m := range modifiers {
+		name, ok := linuxModifiers[m]
+		if !ok {
+			name = string(m)
+		}
+		parts = append(parts, name)
+	}
+	return strings.Join(append(parts, key), "+")
+}
+
+// GetClipboard returns the clipboard text
+func (l *Linux) GetClipboard() (string, error) {
+	if l.wayland {
+		return l.run("", "wl-paste", "--no-newline")
+	}
+	return l.run("", "xclip", "-selection", "clipboard", "-out")
+}
+
+// SetClipboard replaces the clipboard text
+func (l *Linux) SetClipboard(text string) error {
+	var err error
+	if l.wayland {
+		_, err = l.run(text, "wl-copy")
+	} else {
+		_, err = l.run(text, "xclip", "-selection", "clipboard", "-in")
+	}
+	return err
+}
+
+// Paste presses Ctrl+V
+func (l *Linux) Paste() error {
+	return l.KeyChord("v", Command)
+}
+
+// ListWindows returns the windows the window manager knows about
+func (l *Linux) ListWindows() ([]Window, error) {
+	out, err := l.run("", "wmctrl", "-l", "-x")
+	if err != nil {
+		return nil, err
+	}
+	return parseWmctrl(out), nil
+}
+
+// parseWmctrl reads `wmctrl -l -x` lines: id, desktop, instance.Class,
+// host and the title
+func parseWmctrl(out string) []Window {
+	var windows []Window
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 4 {
+			continue
+		}
+		app := fields[2]
+		if _, class, ok := strings.Cut(app, "."); ok {
+			app = class
+		}
+		title := ""
+		if len(fields) > 4 {
+			title = strings.Join(fields[4:], " ")
+		}
+		windows = append(windows, Window{App: app, Title: title})
+	}
+	return windows
+}
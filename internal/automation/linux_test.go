@@ -0,0 +1,92 @@
+package automation
+
+import (
+	"os/exec"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// fakeLinux records the commands a Linux automator runs
+func fakeLinux(wayland bool, output string) (*Linux, *[]string) {
+	var commands []string
+	l := &Linux{
+		wayland: wayland,
+		run: func(stdin, name string, args ...string) (string, error) {
+			command := strings.Join(append([]string{name}, args...), " ")
+			if stdin != "" {
+				command += " < " + stdin
+			}
+			commands = append(commands, command)
+			return output, nil
+		},
+		lookPath: func(name string) (string, error) {
+			if name == "code" || name == "cursor" {
+				return "/usr/bin/" + name, nil
+			}
+			return "", exec.ErrNotFound
+		},
+	}
+	return l, &commands
+}
+
+func TestLinuxCommands(t *testing.T) {
+	tests := []struct {
+		name    string
+		wayland bool
+		run     func(l *Linux) error
+		want    string
+	}{
+		{"activate", false, func(l *Linux) error { return l.Activate("code") }, "xdotool search --onlyvisible --class code windowactivate --sync"},
+		{"open workspace", false, func(l *Linux) error { return l.OpenWorkspace("Visual Studio Code", "/src/app") }, "code /src/app"},
+		{"open workspace by name", false, func(l *Linux) error { return l.OpenWorkspace("Cursor", "/src/app") }, "cursor /src/app"},
+		{"open workspace without cli", false, func(l *Linux) error { return l.OpenWorkspace("Antigravity", "/src/app") }, "xdg-open /src/app"},
+		{"type", false, func(l *Linux) error { return l.Type("-n hi") }, "xdotool type --clearmodifiers -- -n hi"},
+		{"chord", false, func(l *Linux) error { return l.KeyChord("l", Command, Shift) }, "xdotool key --clearmodifiers ctrl+shift+l"},
+		{"named key", false, func(l *Linux) error { return l.KeyChord("Return", Option) }, "xdotool key --clearmodifiers alt+Return"},
+		{"paste", false, func(l *Linux) error { return l.Paste() }, "xdotool key --clearmodifiers ctrl+v"},
+		{"set clipboard", false, func(l *Linux) error { return l.SetClipboard("hi") }, "xclip -selection clipboard -in < hi"},
+		{"set wayland clipboard", true, func(l *Linux) error { return l.SetClipboard("hi") }, "wl-copy < hi"},
+		{"get clipboard", false, func(l *Linux) error { _, err := l.GetClipboard(); return err }, "xclip -selection clipboard -out"},
+		{"get wayland clipboard", true, func(l *Linux) error { _, err := l.GetClipboard(); return err }, "wl-paste --no-newline"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l, commands := fakeLinux(tt.wayland, "")
+			if err := tt.run(l); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if want := []string{tt.want}; !reflect.DeepEqual(*commands, want) {
+				t.Errorf("Expected %q, got %q", want, *commands)
+			}
+		})
+	}
+}
+
+func TestLinuxListWindows(t *testing.T) {
+	out := "0x03a00003  0 code.Code             host main.go - module - Visual Studio Code\n" +
+		"0x04000006  0 antigravity.Antigravity host Antigravity\n" +
+		"0x01e00001 -1 desktop_window.Nautilus host\n"
+	l, _ := fakeLinux(false, out)
+
+	windows, err := l.ListWindows()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Window{
+		{App: "Code", Title: "main.go - module - Visual Studio Code"},
+		{App: "Antigravity", Title: "Antigravity"},
+		{App: "Nautilus", Title: ""},
+	}
+	if !reflect.DeepEqual(windows, want) {
+		t.Errorf("Expected %+v, got %+v", want, windows)
+	}
+}
+
+func TestParseWindows(t *testing.T) {
+	windows := parseWindows("Finder\tDownloads\nAntigravity\tmodule — main.go\n\n")
+	want := []Window{{App: "Finder", Title: "Downloads"}, {App: "Antigravity", Title: "module — main.go"}}
+	if !reflect.DeepEqual(windows, want) {
+		t.Errorf("Expected %+v, got %+v", want, windows)
+	}
+}
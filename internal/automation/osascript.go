@@ -4,9 +4,73 @@ import (
 	"bytes"
 	"fmt"
 	"os/exec"
+	"strconv"
 	"strings"
+	"unicode/utf8"
 )
 
+// OSAScript is the macOS Automator; it drives apps through System Events
+type OSAScript struct{}
+
+var _ Automator = OSAScript{}
+
+// Activate opens an app and brings it to the front
+func (OSAScript) Activate(app string) error { return OpenApp(app) }
+
+// IsRunning reports whether an app has a process
+func (OSAScript) IsRunning(app string) (bool, error) { return IsAppRunning(app) }
+
+// OpenWorkspace opens a folder in an app with open -a
+func (OSAScript) OpenWorkspace(app, path string) error {
+	if out, err := exec.Command("open", "-a", app, path).CombinedOutput(); err != nil {
+		return fmt.Errorf("open error: %w, output: %s", err, out)
+	}
+	return nil
+}
+
+// Type types text into the frontmost app
+func (OSAScript) Type(text string) error { return TypeText(text) }
+
+// KeyChord presses a key while holding modifiers
+func (OSAScript) KeyChord(key string, modifiers ...Modifier) error {
+	names := make([]string, len(modifiers))
+	for i, m := range modifiers {
+		names[i] = string(m)
+	}
+	return PressKey(key, names...)
+}
+
+// GetClipboard returns the clipboard text
+func (OSAScript) GetClipboard() (string, error) { return GetClipboard() }
+
+// SetClipboard replaces the clipboard text
+func (OSAScript) SetClipboard(text string) error { return SetClipboard(text) }
+
+// Paste presses Cmd+V
+func (OSAScript) Paste() error { return PasteFromClipboard() }
+
+// ListWindows returns the windows of apps with a user interface
+func (OSAScript) ListWindows() ([]Window, error) {
+	result, err := listWindowsScript().Run()
+	if err != nil {
+		return nil, err
+	}
+	return parseWindows(result), nil
+}
+
+// parseWindows reads "app<TAB>title" lines
+func parseWindows(out string) []Window {
+	var windows []Window
+	for _, line := range strings.Split(out, "\n") {
+		app, title, ok := strings.Cut(line, "\t")
+		if !ok || app == "" {
+			continue
+		}
+		windows = append(windows, Window{App: app, Title: title})
+	}
+	return windows
+}
+
 // RunScript executes an AppleScript and returns the output
 func RunScript(script string) (string, error) {
 	cmd := exec.Command("osascript", "-e", script)
@@ -42,147 +106,187 @@ func RunScriptMultiLine(lines []string) (string, error) {
 	return strings.TrimSpace(stdout.String()), nil
 }
 
+// systemEvents drives the keyboard and processes
+var systemEvents = App("System Events")
+
+// modifierKeys are the modifiers a key can be pressed with
+var modifierKeys = map[string]Raw{
+	"command": "command down",
+	"shift":   "shift down",
+	"option":  "option down",
+	"control": "control down",
+}
+
 // OpenApp opens an application by name
 func OpenApp(appName string) error {
-	script := fmt.Sprintf(`tell application "%s" to activate`, appName)
-	_, err := RunScript(script)
+	_, err := openAppScript(appName).Run()
 	return err
 }
 
+func openAppScript(appName string) Script {
+	return Script{Tell(App(appName), Cmd("activate"))}
+}
+
 // IsAppRunning checks if an application is running
 func IsAppRunning(appName string) (bool, error) {
-	script := fmt.Sprintf(`
-		tell application "System Events"
-			set appList to name of every process
-			return appList contains "%s"
-		end tell
-	`, appName)
-	result, err := RunScript(script)
+	result, err := isAppRunningScript(appName).Run()
 	if err != nil {
 		return false, err
 	}
 	return result == "true", nil
 }
 
+func isAppRunningScript(appName string) Script {
+	return Script{Tell(systemEvents,
+		Cmd("set appList to name of every process"),
+		Cmd("return appList contains %s", String(appName)),
+	)}
+}
+
 // TypeText types text using System Events
 func TypeText(text string) error {
-	// Escape special characters for AppleScript
-	escaped := strings.ReplaceAll(text, "\\", "\\\\")
-	escaped = strings.ReplaceAll(escaped, "\"", "\\\"")
-
-	script := fmt.Sprintf(`
-		tell application "System Events"
-			keystroke "%s"
-		end tell
-	`, escaped)
-	_, err := RunScript(script)
+	_, err := typeTextScript(text).Run()
 	return err
 }
 
+func typeTextScript(text string) Script {
+	return Script{Tell(systemEvents, Cmd("keystroke %s", String(text)))}
+}
+
 // TypeTextSlowly types text with a delay between characters (for stability)
 func TypeTextSlowly(text string, delayMs int) error {
 	for _, char := range text {
-		escaped := strings.ReplaceAll(string(char), "\"", "\\\"")
-		script := fmt.Sprintf(`
-			tell application "System Events"
-				keystroke "%s"
-				delay %f
-			end tell
-		`, escaped, float64(delayMs)/1000.0)
-		if _, err := RunScript(script); err != nil {
+		if _, err := typeCharScript(char, delayMs).Run(); err != nil {
 			return err
 		}
 	}
 	return nil
 }
 
+func typeCharScript(char rune, delayMs int) Script {
+	return Script{Tell(systemEvents,
+		Cmd("keystroke %s", String(char)),
+		Cmd("delay %s", Number(float64(delayMs)/1000.0)),
+	)}
+}
+
 // PressKey presses a key with optional modifiers
-// key: the key to press (e.g., "return", "tab", "escape")
+// key: a named key (e.g., "return", "tab", "escape") or a single character
 // modifiers: optional modifiers (e.g., "command", "shift", "option", "control")
 func PressKey(key string, modifiers ...string) error {
-	var script string
-	if len(modifiers) > 0 {
-		modList := strings.Join(modifiers, " down, ") + " down"
-		script = fmt.Sprintf(`
-			tell application "System Events"
-				key code %s using {%s}
-			end tell
-		`, getKeyCode(key), modList)
-	} else {
-		script = fmt.Sprintf(`
-			tell application "System Events"
-				key code %s
-			end tell
-		`, getKeyCode(key))
-	}
-	_, err := RunScript(script)
+	script, err := pressKeyScript(key, modifiers...)
+	if err != nil {
+		return err
+	}
+	_, err = script.Run()
+	return err
+}
+
+// PressKeyCode presses a key by its macOS virtual key code, with optional modifiers
+func PressKeyCode(code int, modifiers ...string) error {
+	script, err := pressKeyCodeScript(code, modifiers...)
+	if err != nil {
+		return err
+	}
+	_, err = script.Run()
 	return err
 }
 
+func pressKeyScript(key string, modifiers ...string) (Script, error) {
+	// Named keys are pressed by code; characters, digits too, as keystrokes
+	if code, ok := keyCodes[strings.ToLower(key)]; ok {
+		return pressKeyCodeScript(code, modifiers...)
+	}
+	if utf8.RuneCountInString(key) != 1 {
+		return nil, fmt.Errorf("unknown key %q", key)
+	}
+	return pressScript("keystroke %s", String(key), modifiers)
+}
+
+func pressKeyCodeScript(code int, modifiers ...string) (Script, error) {
+	return pressScript("key code %s", Number(code), modifiers)
+}
+
+// pressScript presses key with press, holding modifiers
+func pressScript(press string, key Expr, modifiers []string) (Script, error) {
+	if len(modifiers) == 0 {
+		return Script{Tell(systemEvents, Cmd(press, key))}, nil
+	}
+
+	using := make(List, len(modifiers))
+	for i, m := range modifiers {
+		keyword, ok := modifierKeys[strings.ToLower(m)]
+		if !ok {
+			return nil, fmt.Errorf("unknown modifier %q", m)
+		}
+		using[i] = keyword
+	}
+	return Script{Tell(systemEvents, Cmd(press+" using %s", key, using))}, nil
+}
+
 // PressEnter presses the Enter/Return key
 func PressEnter() error {
-	script := `
-		tell application "System Events"
-			key code 36
-		end tell
-	`
-	_, err := RunScript(script)
-	return err
+	return PressKey("return")
 }
 
 // PressCommandEnter presses Command+Enter
 func PressCommandEnter() error {
-	script := `
-		tell application "System Events"
-			key code 36 using command down
-		end tell
-	`
-	_, err := RunScript(script)
-	return err
+	return PressKey("return", "command")
+}
+
+// keyCodes are the key codes of the named keys
+var keyCodes = map[string]int{
+	"return":    36,
+	"enter":     36,
+	"tab":       48,
+	"escape":    53,
+	"space":     49,
+	"delete":    51,
+	"backspace": 51,
+	"up":        126,
+	"down":      125,
+	"left":      123,
+	"right":     124,
 }
 
 // getKeyCode returns the key code for common keys
 func getKeyCode(key string) string {
-	codes := map[string]string{
-		"return":    "36",
-		"enter":     "36",
-		"tab":       "48",
-		"escape":    "53",
-		"space":     "49",
-		"delete":    "51",
-		"backspace": "51",
-		"up":        "126",
-		"down":      "125",
-		"left":      "123",
-		"right":     "124",
-	}
-	if code, ok := codes[strings.ToLower(key)]; ok {
-		return code
+	if code, ok := keyCodes[strings.ToLower(key)]; ok {
+		return strconv.Itoa(code)
 	}
 	return key // Assume it's already a key code
 }
 
 // SetClipboard sets the system clipboard content
 func SetClipboard(text string) error {
-	escaped := strings.ReplaceAll(text, "\"", "\\\"")
-	script := fmt.Sprintf(`set the clipboard to "%s"`, escaped)
-	_, err := RunScript(script)
+	_, err := setClipboardScript(text).Run()
 	return err
 }
 
+func setClipboardScript(text string) Script {
+	return Script{Cmd("set the clipboard to %s", String(text))}
+}
+
 // GetClipboard gets the system clipboard content
 func GetClipboard() (string, error) {
-	script := `the clipboard as text`
-	return RunScript(script)
+	return Script{Cmd("the clipboard as text")}.Run()
 }
 
 // PasteFromClipboard pastes from clipboard
 func PasteFromClipboard() error {
-	script := `
-		tell application "System Events"
-			keystroke "v" using command down
-		end tell
-	`
-	_, err := RunScript(script)
-	return err
+	return PressKey("v", "command")
+}
+
+func listWindowsScript() Script {
+	return Script{
+		Cmd(`set out to ""`),
+		Tell(systemEvents,
+			RepeatWith("p", Raw("every process whose background only is false"),
+				RepeatWith("w", Raw("every window of p"),
+					Cmd("set out to out & (name of p) & tab & (name of w) & linefeed"),
+				),
+			),
+		),
+		Cmd("return out"),
+	}
 }
@@ -0,0 +1,173 @@
+package automation
+
+import (
+	"strings"
+	"sync"
+)
+
+// Recorder is an in-memory Automator for tests. It records each call as an
+// action such as "activate Antigravity", "key command+shift+l" or "paste",
+// and keeps a clipboard and a list of running apps.
+type Recorder struct {
+	mu        sync.Mutex
+	actions   []string
+	clipboard string
+	windows   []Window
+	front     string
+	failures  map[string]error
+}
+
+var _ Automator = (*Recorder)(nil)
+
+// NewRecorder returns a Recorder with a window open for each app
+func NewRecorder(apps ...string) *Recorder {
+	r := &Recorder{failures: make(map[string]error)}
+	for _, app := range apps {
+		r.windows = append(r.windows, Window{App: app, Title: app})
+	}
+	return r
+}
+
+// Fail makes actions that start with prefix return err; they are still
+// recorded
+func (r *Recorder) Fail(prefix string, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.failures[prefix] = err
+}
+
+// Actions returns what the Recorder was asked to do, in order
+func (r *Recorder) Actions() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]string(nil), r.actions...)
+}
+
+// Reset forgets the recorded actions
+func (r *Recorder) Reset() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.actions = nil
+}
+
+// Frontmost returns the app activated last
+func (r *Recorder) Frontmost() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.front
+}
+
+// record adds an action and returns its failure, if any; r.mu must be held
+func (r *Recorder) record(action string) error {
+	r.actions = append(r.actions, action)
+	for prefix, err := range r.failures {
+		if strings.HasPrefix(action, prefix) {
+			return err
+		}
+	}
+	return nil
+}
+
+// Activate brings app to the front, opening a window if it has none
+func (r *Recorder) Activate(app string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.record("activate " + app); err != nil {
+		return err
+	}
+	if !r.running(app) {
+		r.windows = append(r.windows, Window{App: app, Title: app})
+	}
+	r.front = app
+	return nil
+}
+
+// IsRunning reports whether app has a window
+func (r *Recorder) IsRunning(app string) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.record("is running " + app); err != nil {
+		return false, err
+	}
+	return r.running(app), nil
+}
+
+// running reports whether app has a window; r.mu must be held
+func (r *Recorder) running(app string) bool {
+	for _, w := range r.windows {
+		if w.App == app {
+			return true
+		}
+	}
+	return false
+}
+
+// OpenWorkspace records "open <app> <path>" and brings app to the front
+func (r *Recorder) OpenWorkspace(app, path string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.record("open " + app + " " + path); err != nil {
+		return err
+	}
+	if !r.running(app) {
+		r.windows = append(r.windows, Window{App: app, Title: path})
+	}
+	r.front = app
+	return nil
+}
+
+// Type records the text
+func (r *Recorder) Type(text string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.record("type " + text)
+}
+
+// KeyChord records the chord as "key command+shift+l"
+func (r *Recorder) KeyChord(key string, modifiers ...Modifier) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	parts := make([]string, 0, len(modifiers)+1)
+	for _, m := range modifiers {
+		parts = append(parts, string(m))
+	}
+	return r.record("key " + strings.Join(append(parts, key), "+"))
+}
+
+// GetClipboard returns the text last set
+func (r *Recorder) GetClipboard() (string, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.record("get clipboard"); err != nil {
+		return "", err
+	}
+	return r.clipboard, nil
+}
+
+// SetClipboard keeps the text
+func (r *Recorder) SetClipboard(text string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.record("set clipboard " + text); err != nil {
+		return err
+	}
+	r.clipboard = text
+	return nil
+}
+
+// Paste records a paste
+func (r *Recorder) Paste() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.record("paste")
+}
+
+// ListWindows returns a window for each app that was opened or activated
+func (r *Recorder) ListWindows() ([]Window, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := r.record("list windows"); err != nil {
+		return nil, err
+	}
+	return append([]Window(nil), r.windows...), nil
+}
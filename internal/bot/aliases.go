@@ -0,0 +1,70 @@
+package bot
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/applejobs/telegram-remote-controller/internal/catalog"
+	"github.com/applejobs/telegram-remote-controller/internal/command"
+)
+
+// handleListAliases lists the aliases of one kind, one line per name,
+// marking the user's default
+func (h *MainHandler) handleListAliases(chatID, userID int64, kind catalog.Kind) error {
+	p := h.tr(chatID)
+	current := h.Prefs.Get(userID)
+	title, mark := p.T("aliases.apps"), orDefault(current.App, h.profile(current.IDE).App)
+	if kind == catalog.KindModel {
+		title, mark = p.T("aliases.models"), orDefault(current.Model, command.DefaultModel)
+	}
+
+	entries := h.Catalog.List(kind)
+	if len(entries) == 0 {
+		return h.Bot.SendText(chatID, title+"\n\n"+p.T("aliases.none"))
+	}
+
+	var sb strings.Builder
+	sb.WriteString(title + "\n")
+	for i := 0; i < len(entries); {
+		name := entries[i].Name
+		var aliases []string
+		for ; i < len(entries) && entries[i].Name == name; i++ {
+			aliases = append(aliases, entries[i].Alias)
+		}
+		line := fmt.Sprintf("\n• %s → %s", strings.Join(aliases, " / "), name)
+		if name == mark {
+			line += p.T("aliases.default")
+		}
+		sb.WriteString(line)
+	}
+	sb.WriteString("\n\n" + p.T("aliases.add_hint", kind))
+	return h.Bot.SendText(chatID, sb.String())
+}
+
+// handleAlias changes an alias: /alias set <kind> <alias> <name> or /alias rm <kind> <alias>
+func (h *MainHandler) handleAlias(chatID int64, cmd *command.Command) error {
+	p := h.tr(chatID)
+	action, alias := strings.ToLower(cmd.Args[0]), cmd.Args[2]
+	kind, err := catalog.ParseKind(cmd.Args[1])
+	if err != nil {
+		return h.Bot.SendText(chatID, p.T("error", err))
+	}
+
+	switch action {
+	case "set":
+		if cmd.Prompt == "" {
+			return h.Bot.SendText(chatID, p.T("aliases.missing_name"))
+		}
+		if err := h.Catalog.Set(kind, alias, cmd.Prompt); err != nil {
+			return h.Bot.SendText(chatID, p.T("error", err))
+		}
+		return h.Bot.SendText(chatID, p.T("aliases.set", kind, strings.ToLower(alias), cmd.Prompt))
+	case "rm", "remove", "del":
+		if err := h.Catalog.Remove(kind, alias); err != nil {
+			return h.Bot.SendText(chatID, p.T("error", err))
+		}
+		return h.Bot.SendText(chatID, p.T("aliases.removed", kind, strings.ToLower(alias)))
+	default:
+		return h.Bot.SendText(chatID, p.T("aliases.usage"))
+	}
+}
@@ -0,0 +1,171 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"log"
+
+	"github.com/applejobs/telegram-remote-controller/internal/callback"
+	"github.com/applejobs/telegram-remote-controller/internal/i18n"
+	"github.com/applejobs/telegram-remote-controller/internal/notes"
+	"github.com/applejobs/telegram-remote-controller/internal/queue"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Callback actions, kept short to fit Telegram's 64-byte callback data
+const (
+	callbackFullText   = "full"  // Expand a long response; arg is the kept text's key
+	callbackRerun      = "rerun" // Enqueue a job's prompt again; arg is the job ID
+	callbackScreenshot = "shot"  // Screenshot an app; arg is the app name
+	callbackNoteDone   = "done"  // Mark a note DONE; arg is the note ID
+	callbackNoteDelete = "del"   // Delete a note; arg is the note ID
+	callbackSettings   = "cfg"   // Show the settings, or the values of one; arg is empty or the setting
+	callbackSetPref    = "pref"  // Change a setting; arg is "setting=value"
+)
+
+// callbackButton is an inline button before its data is signed
+type callbackButton struct {
+	label  string // Message ID
+	action string
+	arg    string
+}
+
+// keyboard builds an inline keyboard with signed callback data, labelled in
+// p's locale. Buttons whose data cannot be encoded are left out; nil means
+// no buttons.
+func (h *MainHandler) keyboard(p i18n.Printer, rows ...[]callbackButton) *tgbotapi.InlineKeyboardMarkup {
+	var markup [][]tgbotapi.InlineKeyboardButton
+	for _, row := range rows {
+		var buttons []tgbotapi.InlineKeyboardButton
+		for _, b := range row {
+			if button, ok := h.button(p.T(b.label), b.action, b.arg); ok {
+				buttons = append(buttons, button)
+			}
+		}
+		if len(buttons) > 0 {
+			markup = append(markup, buttons)
+		}
+	}
+	return inlineKeyboard(markup)
+}
+
+// button makes an inline button with signed callback data; false means the
+// data cannot be encoded
+func (h *MainHandler) button(text, action, arg string) (tgbotapi.InlineKeyboardButton, bool) {
+	data, err := h.Callbacks.Encode(action, arg)
+	if err != nil {
+		log.Printf("Skipping %s button: %v", action, err)
+		return tgbotapi.InlineKeyboardButton{}, false
+	}
+	return tgbotapi.NewInlineKeyboardButtonData(text, data), true
+}
+
+// inlineKeyboard wraps rows of buttons; nil means no buttons
+func inlineKeyboard(rows [][]tgbotapi.InlineKeyboardButton) *tgbotapi.InlineKeyboardMarkup {
+	if len(rows) == 0 {
+		return nil
+	}
+	keyboard := tgbotapi.NewInlineKeyboardMarkup(rows...)
+	return &keyboard
+}
+
+// responseButtons are offered under a delivered response; app is the one to screenshot
+func responseButtons(jobID, app string) []callbackButton {
+	buttons := []callbackButton{{"button.screenshot", callbackScreenshot, app}}
+	if jobID != "" {
+		buttons = append([]callbackButton{{"button.rerun", callbackRerun, jobID}}, buttons...)
+	}
+	return buttons
+}
+
+// noteKeyboard offers to finish or delete a note
+func (h *MainHandler) noteKeyboard(p i18n.Printer, noteID string, withDone bool) *tgbotapi.InlineKeyboardMarkup {
+	row := []callbackButton{{"button.delete", callbackNoteDelete, noteID}}
+	if withDone {
+		row = append([]callbackButton{{"button.done", callbackNoteDone, noteID}}, row...)
+	}
+	return h.keyboard(p, row)
+}
+
+// HandleCallback processes inline keyboard button presses
+func (h *MainHandler) HandleCallback(ctx context.Context, query *tgbotapi.CallbackQuery) error {
+	p := h.localeOfQuery(query)
+	if !h.Auth.IsAuthorized(query.From.ID) {
+		log.Printf("Unauthorized callback from user %d", query.From.ID)
+		return h.Bot.AnswerCallback(query.ID, p.T("auth.denied"))
+	}
+
+	data, err := h.Callbacks.Decode(query.Data)
+	if errors.Is(err, callback.ErrExpired) {
+		return h.Bot.AnswerCallback(query.ID, p.T("callback.expired"))
+	}
+	if err != nil {
+		log.Printf("Rejected callback data %q: %v", query.Data, err)
+		return h.Bot.AnswerCallback(query.ID, p.T("callback.invalid"))
+	}
+	// Every action needs the chat the button was in, which Telegram
+	// leaves out for inline and very old messages
+	if query.Message == nil || query.Message.Chat == nil {
+		log.Printf("Callback %q from user %d has no message", data.Action, query.From.ID)
+		return h.Bot.AnswerCallback(query.ID, p.T("callback.no_message"))
+	}
+
+	switch data.Action {
+	case callbackFullText:
+		return h.handleShowFullText(query, data.Arg)
+	case callbackRerun:
+		return h.handleRerunCallback(query, data.Arg)
+	case callbackScreenshot:
+		h.Bot.AnswerCallback(query.ID, p.T("callback.screenshot"))
+		return h.handleScreenshot(query.Message.Chat.ID, data.Arg)
+	case callbackNoteDone:
+		return h.handleNoteDoneCallback(query, data.Arg)
+	case callbackNoteDelete:
+		return h.handleNoteDeleteCallback(query, data.Arg)
+	case callbackSettings:
+		return h.handleSettingsCallback(query, data.Arg)
+	case callbackSetPref:
+		return h.handleSetPrefCallback(query, data.Arg)
+	default:
+		return h.Bot.AnswerCallback(query.ID, p.T("callback.unknown"))
+	}
+}
+
+// handleRerunCallback enqueues the prompt of a job again
+func (h *MainHandler) handleRerunCallback(query *tgbotapi.CallbackQuery, jobID string) error {
+	p := h.tr(query.Message.Chat.ID)
+	job, err := h.Queue.Rerun(jobID)
+	if err == queue.ErrJobNotFound {
+		return h.Bot.AnswerCallback(query.ID, p.T("job.not_found", jobID))
+	}
+	if err != nil {
+		return h.Bot.AnswerCallback(query.ID, p.T("error", err))
+	}
+	return h.Bot.AnswerCallback(query.ID, p.T("job.requeued", jobID, job.ID))
+}
+
+// handleNoteDoneCallback marks a note DONE and leaves only the delete button
+func (h *MainHandler) handleNoteDoneCallback(query *tgbotapi.CallbackQuery, noteID string) error {
+	p := h.tr(query.Message.Chat.ID)
+	if !h.NoteStore.UpdateStatus(noteID, notes.StatusDone) {
+		return h.Bot.AnswerCallback(query.ID, p.T("notes.not_found"))
+	}
+	if keyboard := h.noteKeyboard(p, noteID, false); keyboard != nil {
+		if err := h.Bot.SetKeyboard(query.Message.Chat.ID, query.Message.MessageID, *keyboard); err != nil {
+			log.Printf("Failed to update note keyboard: %v", err)
+		}
+	}
+	return h.Bot.AnswerCallback(query.ID, p.T("notes.marked_done"))
+}
+
+// handleNoteDeleteCallback deletes a note and removes its buttons
+func (h *MainHandler) handleNoteDeleteCallback(query *tgbotapi.CallbackQuery, noteID string) error {
+	p := h.tr(query.Message.Chat.ID)
+	if !h.NoteStore.Delete(noteID) {
+		return h.Bot.AnswerCallback(query.ID, p.T("notes.not_found"))
+	}
+	if err := h.Bot.SetKeyboard(query.Message.Chat.ID, query.Message.MessageID, tgbotapi.InlineKeyboardMarkup{}); err != nil {
+		log.Printf("Failed to remove note keyboard: %v", err)
+	}
+	return h.Bot.AnswerCallback(query.ID, p.T("notes.deleted"))
+}
@@ -2,8 +2,17 @@ package bot
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/applejobs/telegram-remote-controller/internal/command"
+	"github.com/applejobs/telegram-remote-controller/internal/outbox"
+	"github.com/applejobs/telegram-remote-controller/internal/render"
 
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 )
@@ -13,15 +22,55 @@ type MessageHandler interface {
 	HandleMessage(ctx context.Context, msg *tgbotapi.Message) error
 }
 
+// CallbackHandler handles inline keyboard button presses.
+// A MessageHandler may implement it to receive callback queries.
+type CallbackHandler interface {
+	HandleCallback(ctx context.Context, query *tgbotapi.CallbackQuery) error
+}
+
 // Bot represents the Telegram bot client
 type Bot struct {
-	api     *tgbotapi.BotAPI
-	handler MessageHandler
+	token    string
+	endpoint string
+	handler  MessageHandler
+
+	// StallTimeout is how long polling may go without a completed getUpdates
+	// round trip before the API client is re-created
+	StallTimeout time.Duration
+
+	// Updates, if set, persists the update offset and skips updates that
+	// were already handled
+	Updates *UpdateLog
+
+	// Workers bounds how many updates are handled at once, and
+	// UpdateTimeout how long each may take. Set them before Start.
+	Workers       int
+	UpdateTimeout time.Duration
+
+	dispatchOnce sync.Once
+	dispatcher   *dispatcher
+
+	minBackoff  time.Duration // First delay after a polling error
+	maxBackoff  time.Duration // Longest delay between polling errors
+	reportAfter time.Duration // Outages at least this long are reported
+
+	mu     sync.RWMutex
+	api    *tgbotapi.BotAPI // Replaced on reconnect; use client()
+	status ConnectionStatus
+	stop   context.CancelFunc
+
+	outbox *outbox.Outbox // Set by EnableOutbox; nil sends right away
 }
 
 // New creates a new Bot instance
 func New(token string, handler MessageHandler) (*Bot, error) {
-	api, err := tgbotapi.NewBotAPI(token)
+	return NewWithEndpoint(token, tgbotapi.APIEndpoint, handler)
+}
+
+// NewWithEndpoint creates a Bot that talks to the Bot API at endpoint,
+// a format string like tgbotapi.APIEndpoint, e.g. a local test server
+func NewWithEndpoint(token, endpoint string, handler MessageHandler) (*Bot, error) {
+	api, err := tgbotapi.NewBotAPIWithClient(token, endpoint, newHTTPClient())
 	if err != nil {
 		return nil, fmt.Errorf("failed to create bot: %w", err)
 	}
@@ -29,58 +78,167 @@ func New(token string, handler MessageHandler) (*Bot, error) {
 	log.Printf("Authorized on account %s", api.Self.UserName)
 
 	return &Bot{
-		api:     api,
-		handler: handler,
+		token:        token,
+		endpoint:     endpoint,
+		handler:      handler,
+		StallTimeout: DefaultStallTimeout,
+		minBackoff:   time.Second,
+		maxBackoff:   time.Minute,
+		reportAfter:  30 * time.Second,
+		api:          api,
 	}, nil
 }
 
-// Start begins polling for updates
-func (b *Bot) Start(ctx context.Context) error {
-	u := tgbotapi.NewUpdate(0)
-	u.Timeout = 60
+// SetHandler sets the handler that receives updates
+func (b *Bot) SetHandler(handler MessageHandler) {
+	b.handler = handler
+}
+
+// client returns the current API client
+func (b *Bot) client() *tgbotapi.BotAPI {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.api
+}
+
+// handleUpdate skips updates that were already handled and dispatches the rest
+func (b *Bot) handleUpdate(ctx context.Context, update tgbotapi.Update) {
+	if b.Updates != nil && !b.Updates.Begin(update.UpdateID) {
+		log.Printf("Skipping update %d: already handled", update.UpdateID)
+		return
+	}
+	b.dispatch().Dispatch(ctx, update)
+}
+
+// dispatch returns the dispatcher, creating it on first use
+func (b *Bot) dispatch() *dispatcher {
+	b.dispatchOnce.Do(func() {
+		b.dispatcher = newDispatcher(b.Workers, b.UpdateTimeout, b.process)
+		b.dispatcher.onPanic = b.reportPanic
+	})
+	return b.dispatcher
+}
 
-	updates := b.api.GetUpdatesChan(u)
+// reportPanic passes a recovered panic to the handler if it wants to know
+func (b *Bot) reportPanic(update tgbotapi.Update, value interface{}, stack []byte) {
+	if reporter, ok := b.handler.(PanicReporter); ok {
+		reporter.OnPanic(update, value, stack)
+	}
+}
 
-	for {
-		select {
-		case <-ctx.Done():
-			log.Println("Bot stopping...")
-			b.api.StopReceivingUpdates()
-			return nil
-		case update := <-updates:
-			if update.Message == nil {
-				continue
-			}
+// process passes one update to the handler
+func (b *Bot) process(ctx context.Context, update tgbotapi.Update) {
+	if update.CallbackQuery != nil {
+		b.handleCallback(ctx, update.CallbackQuery)
+		return
+	}
+	if update.Message == nil {
+		return
+	}
 
-			log.Printf("[%s] %s", update.Message.From.UserName, update.Message.Text)
+	log.Printf("[%s] %s", update.Message.From.UserName, update.Message.Text)
 
-			if b.handler != nil {
-				if err := b.handler.HandleMessage(ctx, update.Message); err != nil {
-					log.Printf("Error handling message: %v", err)
-				}
-			}
+	if b.handler != nil {
+		if err := b.handler.HandleMessage(ctx, update.Message); err != nil {
+			log.Printf("Error handling message: %v", err)
 		}
 	}
 }
 
-// Stop stops the bot
+// handleCallback passes a callback query to the handler if it accepts them
+func (b *Bot) handleCallback(ctx context.Context, query *tgbotapi.CallbackQuery) {
+	handler, ok := b.handler.(CallbackHandler)
+	if !ok {
+		return
+	}
+
+	log.Printf("[%s] callback: %s", query.From.UserName, query.Data)
+	if err := handler.HandleCallback(ctx, query); err != nil {
+		log.Printf("Error handling callback: %v", err)
+	}
+}
+
+// Stop stops a running Start or StartWebhook
 func (b *Bot) Stop() {
-	b.api.StopReceivingUpdates()
+	b.mu.RLock()
+	stop := b.stop
+	b.mu.RUnlock()
+	if stop != nil {
+		stop()
+	}
 }
 
 // SendText sends a text message to a chat
 func (b *Bot) SendText(chatID int64, text string) error {
-	msg := tgbotapi.NewMessage(chatID, text)
-	_, err := b.api.Send(msg)
+	_, err := b.send(message(chatID, 0, text, ""))
+	return err
+}
+
+// SendReply sends a text message as a reply to another message and returns its ID
+func (b *Bot) SendReply(chatID int64, replyTo int, text string) (int, error) {
+	return b.send(message(chatID, replyTo, text, ""))
+}
+
+// EditText replaces the text of a message the bot sent earlier
+func (b *Bot) EditText(chatID int64, messageID int, text string) error {
+	_, err := b.send(editText(chatID, messageID, text, ""))
+	return err
+}
+
+// SendKeyboard sends a reply with an inline keyboard and returns its ID
+func (b *Bot) SendKeyboard(chatID int64, replyTo int, text string, keyboard tgbotapi.InlineKeyboardMarkup) (int, error) {
+	return b.send(withKeyboard(message(chatID, replyTo, text, ""), keyboard))
+}
+
+// EditKeyboard replaces the text and inline keyboard of a message
+func (b *Bot) EditKeyboard(chatID int64, messageID int, text string, keyboard tgbotapi.InlineKeyboardMarkup) error {
+	_, err := b.send(withKeyboard(editText(chatID, messageID, text, ""), keyboard))
+	return err
+}
+
+// SetKeyboard replaces the inline keyboard of a message; an empty keyboard removes it
+func (b *Bot) SetKeyboard(chatID int64, messageID int, keyboard tgbotapi.InlineKeyboardMarkup) error {
+	req := outbox.Request{ChatID: chatID, Method: "editMessageReplyMarkup", Params: map[string]string{
+		"chat_id":    strconv.FormatInt(chatID, 10),
+		"message_id": strconv.Itoa(messageID),
+	}}
+	_, err := b.send(withKeyboard(req, keyboard))
+	return err
+}
+
+// SendDocument uploads data as a file named name, replying to replyTo
+func (b *Bot) SendDocument(chatID int64, replyTo int, name string, data []byte, caption string) (int, error) {
+	log.Printf("Sending document: %s (%d bytes) to chat %d", name, len(data), chatID)
+	req := message(chatID, replyTo, "", "")
+	req.Method = "sendDocument"
+	delete(req.Params, "text")
+	if caption != "" {
+		req.Params["caption"] = caption
+	}
+	req.File = &outbox.File{Field: "document", Name: name, Data: data}
+	id, err := b.send(req)
+	if err != nil {
+		log.Printf("Failed to send document: %v", err)
+		return 0, err
+	}
+	return id, nil
+}
+
+// AnswerCallback acknowledges a callback query, optionally showing text to the user.
+// It bypasses the outbox: an answer is only useful while the user waits for it.
+func (b *Bot) AnswerCallback(queryID string, text string) error {
+	_, err := b.client().Request(tgbotapi.NewCallback(queryID, text))
 	return err
 }
 
 // SendPhoto sends a photo to a chat
 func (b *Bot) SendPhoto(chatID int64, photoPath string) error {
 	log.Printf("Sending photo: %s to chat %d", photoPath, chatID)
-	photo := tgbotapi.NewPhoto(chatID, tgbotapi.FilePath(photoPath))
-	_, err := b.api.Send(photo)
-	if err != nil {
+	req := message(chatID, 0, "", "")
+	req.Method = "sendPhoto"
+	delete(req.Params, "text")
+	req.File = &outbox.File{Field: "photo", Path: photoPath}
+	if _, err := b.send(req); err != nil {
 		log.Printf("Failed to send photo: %v", err)
 		return err
 	}
@@ -88,10 +246,54 @@ func (b *Bot) SendPhoto(chatID int64, photoPath string) error {
 	return nil
 }
 
-// SendMarkdown sends a markdown-formatted message
+// SetCommands sets the command menu for a chat, or for all chats when chatID
+// is 0, shown to users whose app is in languageCode, or to everyone when empty
+func (b *Bot) SetCommands(chatID int64, languageCode string, menu []command.MenuEntry) error {
+	commands := make([]tgbotapi.BotCommand, len(menu))
+	for i, entry := range menu {
+		commands[i] = tgbotapi.BotCommand{Command: entry.Command, Description: entry.Description}
+	}
+
+	config := tgbotapi.NewSetMyCommands(commands...)
+	if chatID != 0 {
+		config = tgbotapi.NewSetMyCommandsWithScope(tgbotapi.NewBotCommandScopeChat(chatID), commands...)
+	}
+	config.LanguageCode = languageCode
+	_, err := b.client().Request(config)
+	return err
+}
+
+// SendMarkdown renders CommonMark and sends it as Telegram HTML,
+// falling back to plain text if Telegram rejects the entities
 func (b *Bot) SendMarkdown(chatID int64, text string) error {
-	msg := tgbotapi.NewMessage(chatID, text)
-	msg.ParseMode = tgbotapi.ModeMarkdown
-	_, err := b.api.Send(msg)
+	_, err := b.SendHTML(chatID, 0, render.HTML(text), render.Plain(text))
+	return err
+}
+
+// SendHTML sends an HTML message as a reply and returns its ID. If Telegram
+// cannot parse the entities, plain is sent instead.
+func (b *Bot) SendHTML(chatID int64, replyTo int, html, plain string) (int, error) {
+	id, err := b.send(message(chatID, replyTo, html, tgbotapi.ModeHTML))
+	if isEntityError(err) {
+		log.Printf("Telegram rejected HTML entities, sending plain text: %v", err)
+		return b.SendReply(chatID, replyTo, plain)
+	}
+	return id, err
+}
+
+// EditHTML replaces the text of a message with HTML, falling back to plain
+func (b *Bot) EditHTML(chatID int64, messageID int, html, plain string) error {
+	_, err := b.send(editText(chatID, messageID, html, tgbotapi.ModeHTML))
+	if isEntityError(err) {
+		log.Printf("Telegram rejected HTML entities, editing as plain text: %v", err)
+		return b.EditText(chatID, messageID, plain)
+	}
 	return err
 }
+
+// isEntityError reports whether Telegram refused a message because its
+// formatting could not be parsed
+func isEntityError(err error) bool {
+	var apiErr *tgbotapi.Error
+	return errors.As(err, &apiErr) && apiErr.Code == 400 && strings.Contains(apiErr.Message, "can't parse entities")
+}
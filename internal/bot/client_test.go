@@ -2,8 +2,12 @@ package bot
 
 import (
 	"context"
+	"path/filepath"
 	"testing"
+	"time"
 
+	"github.com/applejobs/telegram-remote-controller/internal/outbox"
+	"github.com/applejobs/telegram-remote-controller/internal/telegramtest"
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 )
 
@@ -41,8 +45,134 @@ func TestMockHandler(t *testing.T) {
 	}
 }
 
-// Note: Full integration tests require a real bot token
-// Run with: TELEGRAM_BOT_TOKEN=xxx go test -v -run TestIntegration
+// TestIntegration runs the bot against a fake Bot API server
 func TestIntegration(t *testing.T) {
-	t.Skip("Requires real bot token - run manually")
+	srv := telegramtest.NewServer()
+	defer srv.Close()
+
+	received := make(chan *tgbotapi.Message, 1)
+	handler := &chanHandler{messages: received}
+	b, err := NewWithEndpoint(telegramtest.Token, srv.Endpoint(), handler)
+	if err != nil {
+		t.Fatalf("NewWithEndpoint failed: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go b.Start(ctx)
+
+	srv.PushMessage(42, 7, "/status")
+	select {
+	case msg := <-received:
+		if msg.Text != "/status" || msg.Chat.ID != 42 {
+			t.Errorf("Unexpected message: %+v", msg)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Handler did not receive the update")
+	}
+
+	if err := b.SendText(42, "pong"); err != nil {
+		t.Fatalf("SendText failed: %v", err)
+	}
+	if _, ok := srv.WaitForText("pong", time.Second); !ok {
+		t.Error("sendMessage was not recorded")
+	}
+}
+
+func TestSendHTMLFallsBackToPlain(t *testing.T) {
+	srv := telegramtest.NewServer()
+	defer srv.Close()
+
+	b, err := NewWithEndpoint(telegramtest.Token, srv.Endpoint(), nil)
+	if err != nil {
+		t.Fatalf("NewWithEndpoint failed: %v", err)
+	}
+
+	srv.FailNext("sendMessage", 400, "Bad Request: can't parse entities: unclosed tag")
+	if _, err := b.SendHTML(42, 0, "<b>oops", "oops"); err != nil {
+		t.Fatalf("SendHTML should fall back, got %v", err)
+	}
+
+	calls := srv.Calls("sendMessage")
+	if len(calls) != 2 {
+		t.Fatalf("Expected 2 sendMessage calls, got %d", len(calls))
+	}
+	if calls[0].Params["parse_mode"] != "HTML" || calls[1].Params["parse_mode"] != "" || calls[1].Params["text"] != "oops" {
+		t.Errorf("Expected an HTML attempt then plain text, got %+v", calls)
+	}
+}
+
+func TestOutboxRetriesAfterRateLimit(t *testing.T) {
+	srv := telegramtest.NewServer()
+	defer srv.Close()
+
+	b, err := NewWithEndpoint(telegramtest.Token, srv.Endpoint(), nil)
+	if err != nil {
+		t.Fatalf("NewWithEndpoint failed: %v", err)
+	}
+	if err := b.EnableOutbox(filepath.Join(t.TempDir(), "outbox.json"), outbox.Options{MinBackoff: 10 * time.Millisecond}); err != nil {
+		t.Fatalf("EnableOutbox failed: %v", err)
+	}
+	defer b.CloseOutbox()
+
+	srv.FailNextRetryAfter("sendMessage", 429, "Too Many Requests: retry after 1", 1)
+	start := time.Now()
+	if _, err := b.SendReply(42, 0, "hello"); err != nil {
+		t.Fatalf("SendReply should succeed after the retry, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < time.Second {
+		t.Errorf("Retried after %v, before retry_after", elapsed)
+	}
+	if calls := srv.Calls("sendMessage"); len(calls) != 2 {
+		t.Errorf("Expected 2 sendMessage calls, got %d", len(calls))
+	}
+
+	// Bad requests are not retried, so the HTML fallback still works
+	srv.FailNext("sendMessage", 400, "Bad Request: can't parse entities: unclosed tag")
+	if _, err := b.SendHTML(42, 0, "<b>oops", "oops"); err != nil {
+		t.Fatalf("SendHTML should fall back, got %v", err)
+	}
+}
+
+func TestOutboxQueuedMessageCanBeEdited(t *testing.T) {
+	srv := telegramtest.NewServer()
+	defer srv.Close()
+
+	b, err := NewWithEndpoint(telegramtest.Token, srv.Endpoint(), nil)
+	if err != nil {
+		t.Fatalf("NewWithEndpoint failed: %v", err)
+	}
+	opts := outbox.Options{Wait: 50 * time.Millisecond, MinBackoff: 10 * time.Millisecond}
+	if err := b.EnableOutbox(filepath.Join(t.TempDir(), "outbox.json"), opts); err != nil {
+		t.Fatalf("EnableOutbox failed: %v", err)
+	}
+	defer b.CloseOutbox()
+
+	// Rate limited for longer than the outbox waits: the message is queued, not failed
+	srv.FailNextRetryAfter("sendMessage", 429, "Too Many Requests: retry after 1", 1)
+	id, err := b.SendReply(42, 0, "hello")
+	if err != nil {
+		t.Fatalf("A queued message should not fail, got %v", err)
+	}
+	if err := b.EditText(42, id, "hello again"); err != nil {
+		t.Fatalf("Editing a queued message failed: %v", err)
+	}
+
+	edit, ok := srv.WaitFor("editMessageText", 3*time.Second, func(telegramtest.Call) bool { return true })
+	if !ok {
+		t.Fatal("The edit was never delivered")
+	}
+	if got := edit.Int("message_id"); got <= 0 {
+		t.Errorf("The edit should refer to the sent message, got message_id %d", got)
+	}
+}
+
+// chanHandler passes received messages to a channel
+type chanHandler struct {
+	messages chan *tgbotapi.Message
+}
+
+func (c *chanHandler) HandleMessage(ctx context.Context, msg *tgbotapi.Message) error {
+	c.messages <- msg
+	return nil
 }
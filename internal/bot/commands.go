@@ -0,0 +1,146 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/applejobs/telegram-remote-controller/internal/catalog"
+	"github.com/applejobs/telegram-remote-controller/internal/command"
+	"github.com/applejobs/telegram-remote-controller/internal/i18n"
+	"github.com/applejobs/telegram-remote-controller/internal/prefs"
+	"github.com/applejobs/telegram-remote-controller/internal/render"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// commandHandlers binds every built-in command to the method that runs it
+func (h *MainHandler) commandHandlers() map[string]command.Handler {
+	chat := func(run func(chatID, userID int64) error) command.Handler {
+		return func(ctx context.Context, msg *tgbotapi.Message, cmd *command.Command) error {
+			return run(msg.Chat.ID, msg.From.ID)
+		}
+	}
+	return map[string]command.Handler{
+		command.CmdRun: func(ctx context.Context, msg *tgbotapi.Message, cmd *command.Command) error {
+			return h.handleRun(msg, cmd)
+		},
+		command.CmdRoute: func(ctx context.Context, msg *tgbotapi.Message, cmd *command.Command) error {
+			return h.handleRoute(msg.Chat.ID, msg.From.ID, cmd.Prompt)
+		},
+		command.CmdPrompt: h.handlePrompt,
+		command.CmdTemplate: func(ctx context.Context, msg *tgbotapi.Message, cmd *command.Command) error {
+			return h.handleTemplate(msg.Chat.ID, msg.From.ID, cmd)
+		},
+		command.CmdQueue: chat(h.handleQueue),
+		command.CmdCancel: func(ctx context.Context, msg *tgbotapi.Message, cmd *command.Command) error {
+			return h.handleCancel(msg.Chat.ID, cmd.Args[0])
+		},
+		command.CmdRetry: func(ctx context.Context, msg *tgbotapi.Message, cmd *command.Command) error {
+			return h.handleRetry(msg.Chat.ID, cmd.Args[0])
+		},
+		command.CmdNotes: func(ctx context.Context, msg *tgbotapi.Message, cmd *command.Command) error {
+			return h.handleNotes(msg.Chat.ID, cmd)
+		},
+		command.CmdScreenshot: func(ctx context.Context, msg *tgbotapi.Message, cmd *command.Command) error {
+			return h.handleScreenshot(msg.Chat.ID, h.screenshotApp(msg.From.ID, cmd.AppName))
+		},
+		command.CmdModels: func(ctx context.Context, msg *tgbotapi.Message, cmd *command.Command) error {
+			return h.handleListAliases(msg.Chat.ID, msg.From.ID, catalog.KindModel)
+		},
+		command.CmdApps: func(ctx context.Context, msg *tgbotapi.Message, cmd *command.Command) error {
+			return h.handleListAliases(msg.Chat.ID, msg.From.ID, catalog.KindApp)
+		},
+		command.CmdAlias: func(ctx context.Context, msg *tgbotapi.Message, cmd *command.Command) error {
+			return h.handleAlias(msg.Chat.ID, cmd)
+		},
+		command.CmdStatus:   chat(h.handleStatus),
+		command.CmdLang:     h.handleLangCommand,
+		command.CmdSettings: h.handleSettings,
+		command.CmdIDE:      h.handleIDE,
+		command.CmdHelp: func(ctx context.Context, msg *tgbotapi.Message, cmd *command.Command) error {
+			return h.Bot.SendText(msg.Chat.ID, h.Commands.Help(h.roleOf(msg.From.ID), h.tr(msg.Chat.ID)))
+		},
+	}
+}
+
+// newCommandRegistry returns the built-in commands bound to h
+func (h *MainHandler) newCommandRegistry() *command.Registry {
+	builtins, err := command.NewRegistry(command.Builtins(h.Catalog)...)
+	if err == nil {
+		builtins, err = builtins.WithHandlers(h.commandHandlers())
+	}
+	if err != nil {
+		panic(fmt.Sprintf("invalid command registry: %v", err))
+	}
+	return builtins
+}
+
+// dispatchCommand parses a message and runs the command it names; macros
+// run each of their commands through it as well
+func (h *MainHandler) dispatchCommand(ctx context.Context, msg *tgbotapi.Message) error {
+	chatID := msg.Chat.ID
+	p := h.tr(chatID)
+
+	cmd, err := h.Commands.Parse(msg.Text)
+	if errors.Is(err, command.ErrUnknownCommand) {
+		return h.Bot.SendText(chatID, p.T("command.unknown"))
+	}
+	var perr *command.ParseError
+	if errors.As(err, &perr) {
+		// Show where in the message the problem is
+		plain := fmt.Sprintf("❌ %v\n\n%s", err, perr.Pointer())
+		html := fmt.Sprintf("❌ %s\n\n<pre>%s</pre>", render.EscapeHTML(err.Error()), render.EscapeHTML(perr.Pointer()))
+		_, err := h.Bot.SendHTML(chatID, msg.MessageID, html, plain)
+		return err
+	}
+	if err != nil {
+		return h.Bot.SendText(chatID, p.T("error", err))
+	}
+
+	// Plain text saves an idea instead for users who prefer it
+	if cmd.Name == command.CmdRun && !strings.HasPrefix(strings.TrimSpace(msg.Text), "/") &&
+		h.Prefs.Get(msg.From.ID).PlainText == prefs.PlainNotes {
+		cmd = &command.Command{Name: command.CmdNotes, Prompt: cmd.Prompt}
+	}
+
+	spec, _ := h.Commands.Lookup(cmd.Name)
+	if spec.Role > h.roleOf(msg.From.ID) {
+		log.Printf("User %d may not run /%s", msg.From.ID, cmd.Name)
+		return h.Bot.SendText(chatID, p.T("command.admin_only"))
+	}
+	return spec.Handler(ctx, msg, cmd)
+}
+
+// roleOf returns what a user may do
+func (h *MainHandler) roleOf(userID int64) command.Role {
+	if h.Auth.IsAdmin(userID) {
+		return command.RoleAdmin
+	}
+	return command.RoleUser
+}
+
+// PublishCommands sets the command menu Telegram shows: user commands for
+// everyone, in each user's app language, and admin commands as well in the
+// admin chat
+func (h *MainHandler) PublishCommands() error {
+	publisher, ok := h.Bot.(CommandPublisher)
+	if !ok {
+		return nil
+	}
+	for _, locale := range i18n.Locales() {
+		// The default locale's menu is also the fallback for other languages
+		language := string(locale)
+		if locale == i18n.Default {
+			language = ""
+		}
+		if err := publisher.SetCommands(0, language, h.Commands.Menu(command.RoleUser, i18n.For(locale))); err != nil {
+			return err
+		}
+	}
+	if h.AdminChatID != 0 {
+		return publisher.SetCommands(h.AdminChatID, "", h.Commands.Menu(command.RoleAdmin, h.tr(h.AdminChatID)))
+	}
+	return nil
+}
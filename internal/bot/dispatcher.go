@@ -0,0 +1,134 @@
+package bot
+
+import (
+	"context"
+	"log"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	// DefaultWorkers is how many updates are handled at once
+	DefaultWorkers = 4
+
+	// DefaultUpdateTimeout is how long one update may take to handle
+	DefaultUpdateTimeout = 5 * time.Minute
+)
+
+// PanicReporter is told when handling an update panics.
+// A MessageHandler may implement it, e.g. to notify the admin chat.
+type PanicReporter interface {
+	OnPanic(update tgbotapi.Update, value interface{}, stack []byte)
+}
+
+// dispatcher runs updates on a bounded number of workers. Updates from the
+// same chat are handled one at a time in arrival order, while different
+// chats proceed in parallel. A handler that panics does not hold up the
+// updates behind it; one that overruns its deadline has its context
+// cancelled and is waited for.
+type dispatcher struct {
+	timeout time.Duration
+	handle  func(ctx context.Context, update tgbotapi.Update)
+	onPanic func(update tgbotapi.Update, value interface{}, stack []byte)
+
+	slots   chan struct{} // One token per busy worker
+	mu      sync.Mutex
+	pending map[int64][]tgbotapi.Update // Waiting updates per chat
+	wg      sync.WaitGroup              // Chats with a running drain
+}
+
+// newDispatcher creates a dispatcher; workers and timeout default when not positive
+func newDispatcher(workers int, timeout time.Duration, handle func(context.Context, tgbotapi.Update)) *dispatcher {
+	if workers <= 0 {
+		workers = DefaultWorkers
+	}
+	if timeout <= 0 {
+		timeout = DefaultUpdateTimeout
+	}
+	return &dispatcher{
+		timeout: timeout,
+		handle:  handle,
+		slots:   make(chan struct{}, workers),
+		pending: make(map[int64][]tgbotapi.Update),
+	}
+}
+
+// Dispatch queues an update behind earlier ones from the same chat. It never blocks.
+func (d *dispatcher) Dispatch(ctx context.Context, update tgbotapi.Update) {
+	chat := chatOf(update)
+
+	d.mu.Lock()
+	queue, busy := d.pending[chat]
+	d.pending[chat] = append(queue, update)
+	if !busy {
+		d.wg.Add(1)
+		go d.drain(ctx, chat)
+	}
+	d.mu.Unlock()
+}
+
+// Wait blocks until every queued update has been handled
+func (d *dispatcher) Wait() {
+	d.wg.Wait()
+}
+
+// drain handles a chat's updates in order until its queue is empty
+func (d *dispatcher) drain(ctx context.Context, chat int64) {
+	defer d.wg.Done()
+
+	for {
+		d.mu.Lock()
+		queue := d.pending[chat]
+		if len(queue) == 0 {
+			delete(d.pending, chat)
+			d.mu.Unlock()
+			return
+		}
+		update := queue[0]
+		d.pending[chat] = queue[1:]
+		d.mu.Unlock()
+
+		d.slots <- struct{}{}
+		d.run(ctx, update)
+		<-d.slots
+	}
+}
+
+// run handles one update under its deadline. The handler keeps its worker
+// and its chat until it returns, so handlers must give up once ctx is done;
+// one that ignores the deadline holds up its chat and a worker.
+func (d *dispatcher) run(ctx context.Context, update tgbotapi.Update) {
+	ctx, cancel := context.WithTimeout(ctx, d.timeout)
+	defer cancel()
+
+	defer func() {
+		if value := recover(); value != nil {
+			stack := debug.Stack()
+			log.Printf("Panic handling update %d: %v\n%s", update.UpdateID, value, stack)
+			if d.onPanic != nil {
+				d.onPanic(update, value, stack)
+			}
+		}
+	}()
+	d.handle(ctx, update)
+
+	if ctx.Err() == context.DeadlineExceeded {
+		log.Printf("Update %d from chat %d exceeded %v", update.UpdateID, chatOf(update), d.timeout)
+	}
+}
+
+// chatOf returns the chat an update belongs to, for ordering
+func chatOf(update tgbotapi.Update) int64 {
+	switch {
+	case update.Message != nil && update.Message.Chat != nil:
+		return update.Message.Chat.ID
+	case update.CallbackQuery != nil && update.CallbackQuery.Message != nil && update.CallbackQuery.Message.Chat != nil:
+		return update.CallbackQuery.Message.Chat.ID
+	case update.CallbackQuery != nil && update.CallbackQuery.From != nil:
+		return update.CallbackQuery.From.ID
+	}
+	return 0
+}
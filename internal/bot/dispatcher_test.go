@@ -0,0 +1,169 @@
+package bot
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+func chatUpdate(id int, chat int64, text string) tgbotapi.Update {
+	return tgbotapi.Update{UpdateID: id, Message: &tgbotapi.Message{Text: text, Chat: &tgbotapi.Chat{ID: chat}}}
+}
+
+func TestDispatcherKeepsChatOrder(t *testing.T) {
+	var mu sync.Mutex
+	var order []string
+	d := newDispatcher(4, time.Second, func(ctx context.Context, u tgbotapi.Update) {
+		// Earlier updates take longer, so any reordering would show
+		time.Sleep(time.Duration(10-u.UpdateID) * time.Millisecond)
+		mu.Lock()
+		order = append(order, u.Message.Text)
+		mu.Unlock()
+	})
+
+	for i, text := range []string{"a", "b", "c", "d", "e"} {
+		d.Dispatch(context.Background(), chatUpdate(i, 1, text))
+	}
+	d.Wait()
+
+	if got := len(order); got != 5 {
+		t.Fatalf("Expected 5 updates handled, got %d", got)
+	}
+	for i, text := range []string{"a", "b", "c", "d", "e"} {
+		if order[i] != text {
+			t.Fatalf("Updates from one chat ran out of order: %v", order)
+		}
+	}
+}
+
+func TestDispatcherRunsChatsInParallel(t *testing.T) {
+	release := make(chan struct{})
+	d := newDispatcher(4, 2*time.Second, func(ctx context.Context, u tgbotapi.Update) {
+		if u.Message.Chat.ID == 1 {
+			// A slow command, such as a screenshot
+			<-release
+			return
+		}
+		close(release)
+	})
+
+	d.Dispatch(context.Background(), chatUpdate(1, 1, "/screenshot"))
+	d.Dispatch(context.Background(), chatUpdate(2, 2, "/status"))
+
+	done := make(chan struct{})
+	go func() { d.Wait(); close(done) }()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("A slow chat blocked another chat")
+	}
+}
+
+func TestDispatcherBoundsWorkers(t *testing.T) {
+	var running, peak int32
+	d := newDispatcher(2, time.Second, func(ctx context.Context, u tgbotapi.Update) {
+		n := atomic.AddInt32(&running, 1)
+		for {
+			p := atomic.LoadInt32(&peak)
+			if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+		atomic.AddInt32(&running, -1)
+	})
+
+	for chat := int64(1); chat <= 6; chat++ {
+		d.Dispatch(context.Background(), chatUpdate(int(chat), chat, "x"))
+	}
+	d.Wait()
+
+	if peak > 2 {
+		t.Errorf("Expected at most 2 concurrent updates, saw %d", peak)
+	}
+}
+
+func TestDispatcherRecoversPanics(t *testing.T) {
+	var handled []string
+	var reported interface{}
+	d := newDispatcher(1, time.Second, func(ctx context.Context, u tgbotapi.Update) {
+		if u.Message.Text == "boom" {
+			panic("nil map")
+		}
+		handled = append(handled, u.Message.Text)
+	})
+	d.onPanic = func(u tgbotapi.Update, value interface{}, stack []byte) {
+		reported = value
+		if len(stack) == 0 {
+			t.Error("Expected a stack trace")
+		}
+	}
+
+	d.Dispatch(context.Background(), chatUpdate(1, 1, "boom"))
+	d.Dispatch(context.Background(), chatUpdate(2, 1, "after"))
+	d.Wait()
+
+	if reported != "nil map" {
+		t.Errorf("Panic was not reported, got %v", reported)
+	}
+	if len(handled) != 1 || handled[0] != "after" {
+		t.Errorf("Updates after a panic should still run, got %v", handled)
+	}
+}
+
+func TestDispatcherEnforcesDeadline(t *testing.T) {
+	var sawDeadline atomic.Bool
+	var hangReturned atomic.Bool
+	next := make(chan bool, 1)
+	d := newDispatcher(1, 50*time.Millisecond, func(ctx context.Context, u tgbotapi.Update) {
+		if u.Message.Text == "hang" {
+			<-ctx.Done()
+			sawDeadline.Store(ctx.Err() == context.DeadlineExceeded)
+			time.Sleep(20 * time.Millisecond) // Cleans up after the deadline
+			hangReturned.Store(true)
+			return
+		}
+		next <- hangReturned.Load()
+	})
+
+	d.Dispatch(context.Background(), chatUpdate(1, 1, "hang"))
+	d.Dispatch(context.Background(), chatUpdate(2, 1, "next"))
+
+	select {
+	case afterHang := <-next:
+		if !afterHang {
+			t.Error("The next update ran while the overrunning handler was still running")
+		}
+	case <-time.After(500 * time.Millisecond):
+		t.Fatal("An overrunning handler held up its chat")
+	}
+	if !sawDeadline.Load() {
+		t.Error("Handler context should carry the deadline")
+	}
+}
+
+func TestDispatcherHoldsWorkerUntilHandlerReturns(t *testing.T) {
+	var running, peak int32
+	d := newDispatcher(1, 10*time.Millisecond, func(ctx context.Context, u tgbotapi.Update) {
+		n := atomic.AddInt32(&running, 1)
+		if n > atomic.LoadInt32(&peak) {
+			atomic.StoreInt32(&peak, n)
+		}
+		<-ctx.Done()
+		time.Sleep(30 * time.Millisecond) // Overruns the deadline
+		atomic.AddInt32(&running, -1)
+	})
+
+	for chat := int64(1); chat <= 3; chat++ {
+		d.Dispatch(context.Background(), chatUpdate(int(chat), chat, "x"))
+	}
+	d.Wait()
+
+	if peak > 1 {
+		t.Errorf("Overrunning handlers should keep their worker, saw %d at once", peak)
+	}
+}
@@ -2,144 +2,324 @@ package bot
 
 import (
 	"context"
-	"fmt"
 	"log"
 	"os"
 	"path/filepath"
 	"sync"
 	"time"
+	"unicode/utf8"
 
 	"github.com/applejobs/telegram-remote-controller/internal/auth"
+	"github.com/applejobs/telegram-remote-controller/internal/callback"
+	"github.com/applejobs/telegram-remote-controller/internal/catalog"
 	"github.com/applejobs/telegram-remote-controller/internal/command"
 	"github.com/applejobs/telegram-remote-controller/internal/controller"
+	"github.com/applejobs/telegram-remote-controller/internal/gemini"
+	"github.com/applejobs/telegram-remote-controller/internal/i18n"
 	"github.com/applejobs/telegram-remote-controller/internal/notes"
+	"github.com/applejobs/telegram-remote-controller/internal/prefs"
+	"github.com/applejobs/telegram-remote-controller/internal/queue"
+	"github.com/applejobs/telegram-remote-controller/internal/router"
+	"github.com/applejobs/telegram-remote-controller/internal/templates"
 	"github.com/applejobs/telegram-remote-controller/internal/web"
 	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
 )
 
 // MainHandler handles all incoming messages with full functionality
 type MainHandler struct {
-	Bot       *Bot
+	Bot       Messenger
 	Auth      *auth.Whitelist
 	IDE       *controller.IDEController
+	Profiles  *controller.Profiles // How to drive each IDE, chosen with /ide
 	Watcher   *controller.FileWatcher
 	NoteStore *notes.Store
 	WebServer *web.Server
+	Queue     *queue.Queue
+	Gemini    *gemini.Client
+	Callbacks *callback.Signer // Signs inline button data
+	Commands  *command.Registry
+	Catalog   *catalog.Catalog // Model and app aliases
+	Router    *router.Router   // Picks models for prompts without -m
+	Templates *templates.Store // Saved prompts and macros for /p
+	Prefs     *prefs.Store     // Each user's /settings
+
+	// AdminChatID receives responses that match no run
+	AdminChatID int64
+
+	// Responses longer than DocumentThreshold (UTF-16 units) go out as a
+	// document with a preview of PreviewLines lines or a Gemini summary
+	DocumentThreshold int
+	PreviewLines      int
+
+	// Live messages for response files that are still growing, keyed by path.
+	// Only touched by the background watcher goroutine.
+	streams map[string]*responseStream
+
+	// Long responses kept for the "show full text" button
+	fullMutex sync.Mutex
+	fullTexts map[string]fullText
+	fullOrder []string
+
+	// The locale of whoever last wrote in each chat
+	localeMutex sync.Mutex
+	chatLocales map[int64]i18n.Locale
+
+	// The last complete response of each chat, for {{last_response}}
+	lastMutex     sync.Mutex
+	lastResponses map[int64]string
+
+	// Watchers of the response directories profiles set, by directory
+	profileWatchers map[string]*controller.FileWatcher
+}
+
+// Defaults for long response delivery
+const (
+	DefaultDocumentThreshold = 8000 // UTF-16 units
+	DefaultPreviewLines      = 15
+)
 
-	// Response watching state
-	watchingMutex sync.Mutex
-	watchChatID   int64
+// HandlerOptions sets where the handler keeps its state, e.g. in tests
+type HandlerOptions struct {
+	JournalPath   string // Job queue journal
+	NotesDir      string // Notes store
+	WatchDir      string // Response files
+	WebPort       int    // Web UI port; 0 disables the web UI
+	CatalogPath   string // Model and app aliases
+	RoutingPath   string // Model routing rules
+	TemplatesPath string // Saved templates
+	PrefsPath     string // Users' preferences
+	LanguagesPath string // Languages from before preferences, imported into them once
+	ProfilesPath  string // IDE profiles
+
+	AdminChatID       int64         // Gets unmatched responses and panics; 0 uses the first allowed user
+	DocumentThreshold int           // Longer responses are sent as documents
+	PreviewLines      int           // Lines previewed under a document
+	CallbackSecret    []byte        // Signs buttons; empty uses a random secret
+	CallbackTTL       time.Duration // How long buttons keep working
+}
+
+// DefaultHandlerOptions returns the paths and port NewMainHandler uses
+func DefaultHandlerOptions() HandlerOptions {
+	return HandlerOptions{
+		JournalPath:   queue.DefaultJournalPath,
+		NotesDir:      notes.DefaultDir,
+		WatchDir:      controller.DefaultWatchDir,
+		WebPort:       8080,
+		CatalogPath:   catalog.DefaultPath,
+		RoutingPath:   router.DefaultPath,
+		TemplatesPath: templates.DefaultPath,
+		PrefsPath:     prefs.DefaultPath,
+		LanguagesPath: prefs.DefaultLanguagesPath,
+		ProfilesPath:  controller.DefaultProfilesPath,
+
+		DocumentThreshold: DefaultDocumentThreshold,
+		PreviewLines:      DefaultPreviewLines,
+		CallbackTTL:       callback.DefaultTTL,
+	}
 }
 
 // NewMainHandler creates a new main handler
-func NewMainHandler(bot *Bot, allowedUsers []int64) *MainHandler {
+func NewMainHandler(bot Messenger, allowedUsers []int64) *MainHandler {
+	return NewMainHandlerWithOptions(bot, allowedUsers, DefaultHandlerOptions())
+}
+
+// NewMainHandlerWithOptions creates a main handler that keeps its state as
+// opts says. Nothing runs until Start, so the handler and its Bot can still
+// be set up.
+func NewMainHandlerWithOptions(bot Messenger, allowedUsers []int64, opts HandlerOptions) *MainHandler {
 	// Initialize components
-	noteStore := notes.NewStore()
-	webServer := web.NewServer(noteStore, 8080)
+	noteStore := notes.NewStoreAt(opts.NotesDir)
+
+	aliases := catalog.New()
+	if opts.CatalogPath != "" {
+		loaded, err := catalog.Load(opts.CatalogPath)
+		if err != nil {
+			log.Printf("Warning: %v; using built-in aliases", err)
+		} else {
+			aliases = loaded
+		}
+	}
+
+	saved := templates.NewStore()
+	if opts.TemplatesPath != "" {
+		loaded, err := templates.Load(opts.TemplatesPath)
+		if err != nil {
+			log.Printf("Warning: %v; templates will not be saved", err)
+		} else {
+			saved = loaded
+		}
+	}
+
+	preferences := prefs.NewStore()
+	if opts.PrefsPath != "" {
+		loaded, err := prefs.Load(opts.PrefsPath)
+		if err != nil {
+			log.Printf("Warning: %v; settings will not be saved", err)
+		} else {
+			preferences = loaded
+		}
+	}
+	if opts.LanguagesPath != "" {
+		if n, err := preferences.ImportLanguages(opts.LanguagesPath); err != nil {
+			log.Printf("Warning: %v", err)
+		} else if n > 0 {
+			log.Printf("Imported %d language choices from %s", n, opts.LanguagesPath)
+		}
+	}
+
+	profiles := controller.NewProfiles()
+	if opts.ProfilesPath != "" {
+		loaded, err := controller.LoadProfiles(opts.ProfilesPath)
+		if err != nil {
+			log.Printf("Warning: %v; using built-in IDE profiles", err)
+		} else {
+			profiles = loaded
+		}
+	}
 
 	h := &MainHandler{
 		Bot:       bot,
 		Auth:      auth.NewWhitelist(allowedUsers),
 		IDE:       controller.NewIDEController(),
-		Watcher:   controller.NewFileWatcher(),
+		Profiles:  profiles,
+		Watcher:   controller.NewFileWatcherAt(opts.WatchDir),
 		NoteStore: noteStore,
-		WebServer: webServer,
+		Queue:     queue.NewQueue(opts.JournalPath),
+		Gemini:    gemini.NewClient(),
+		Callbacks: callback.NewSigner(opts.CallbackSecret, opts.CallbackTTL),
+		Catalog:   aliases,
+		Router:    newRouter(opts.RoutingPath, aliases),
+		Templates: saved,
+		Prefs:     preferences,
+		streams:   make(map[string]*responseStream),
+		fullTexts: make(map[string]fullText),
+
+		chatLocales:   make(map[int64]i18n.Locale),
+		lastResponses: make(map[int64]string),
+
+		profileWatchers: make(map[string]*controller.FileWatcher),
+
+		DocumentThreshold: opts.DocumentThreshold,
+		PreviewLines:      opts.PreviewLines,
+	}
+	if h.DocumentThreshold <= 0 {
+		h.DocumentThreshold = DefaultDocumentThreshold
+	}
+	if h.PreviewLines <= 0 {
+		h.PreviewLines = DefaultPreviewLines
+	}
+
+	h.Commands = h.newCommandRegistry()
+
+	for _, dir := range profiles.ResponseDirs() {
+		if dir != h.Watcher.GetWatchDir() {
+			h.profileWatchers[dir] = controller.NewFileWatcherAt(dir)
+		}
 	}
 
-	// Set default watch chat ID to first allowed user
+	// Jobs run one at a time through the IDE
+	h.Queue.SetRunner(h.runJob)
+	h.Queue.OnChange(h.onJobChange)
+
+	// Default admin chat and admin to first allowed user
 	if len(allowedUsers) > 0 {
-		h.watchChatID = allowedUsers[0]
-		log.Printf("Default chat ID set to: %d", h.watchChatID)
+		h.AdminChatID = allowedUsers[0]
+		h.Auth.AddAdmin(allowedUsers[0])
+		log.Printf("Default admin chat ID set to: %d", h.AdminChatID)
+	}
+	if opts.AdminChatID != 0 {
+		h.AdminChatID = opts.AdminChatID
 	}
 
-	// Start background file watcher
+	if opts.WebPort != 0 {
+		h.WebServer = web.NewServer(noteStore, opts.WebPort)
+	}
+
+	return h
+}
+
+// Start runs the job queue, which resumes journaled jobs, the response
+// watcher and the web UI. Call it once the handler and its Bot are set up,
+// since all of them may send messages right away.
+func (h *MainHandler) Start() {
+	go h.Queue.Run(context.Background())
 	go h.backgroundWatcher()
 
-	// Start Web UI
-	go func() {
-		if err := h.WebServer.Start(); err != nil {
-			log.Printf("Web server failed: %v", err)
-		}
-	}()
+	if h.WebServer != nil {
+		go func() {
+			if err := h.WebServer.Start(); err != nil {
+				log.Printf("Web server failed: %v", err)
+			}
+		}()
+	}
+}
 
-	return h
+// newRouter loads the routing rules at path, routing everything to the
+// default model if there are none or they are invalid
+func newRouter(path string, aliases *catalog.Catalog) *router.Router {
+	if path != "" {
+		r, err := router.Load(path, command.DefaultModel, aliases.Model)
+		if err == nil {
+			return r
+		}
+		log.Printf("Warning: routing rules unusable, using %s for every prompt: %v", command.DefaultModel, err)
+	}
+	r, _ := router.New(router.Config{}, command.DefaultModel, nil)
+	return r
 }
 
-// backgroundWatcher continuously monitors for new response files
+// backgroundWatcher streams response files while they grow and delivers them
+// once complete. Files from every response directory are handled here, one
+// at a time.
 func (h *MainHandler) backgroundWatcher() {
-	responseDir := h.Watcher.GetWatchDir()
-	log.Printf("Background watcher started, monitoring: %s", responseDir)
-
-	// Get initial file state
-	initialFiles := h.getFileStates(responseDir)
-
-	for {
-		time.Sleep(2 * time.Second)
-
-		// Get current file state
-		currentFiles := h.getFileStates(responseDir)
-
-		// Check for new or modified files
-		for path, modTime := range currentFiles {
-			oldModTime, exists := initialFiles[path]
-
-			// New file or modified file
-			if !exists || modTime.After(oldModTime) {
-				log.Printf("Detected file change: %s", path)
-
-				// Wait for file to be fully written
-				time.Sleep(2 * time.Second)
-
-				// Read content
-				content, err := os.ReadFile(path)
-				if err != nil {
-					log.Printf("Failed to read file: %v", err)
-					continue
-				}
-
-				// Get the watching chat ID
-				h.watchingMutex.Lock()
-				chatID := h.watchChatID
-				h.watchingMutex.Unlock()
-
-				if chatID != 0 {
-					// Format and send
-					formatted := h.Watcher.FormatResponseForTelegram(string(content))
-					h.Bot.SendText(chatID, fmt.Sprintf("📝 回應：\n\n%s", formatted))
-					log.Printf("Sent response to chat %d (%d chars)", chatID, len(formatted))
-				} else {
-					log.Println("No active chat to send response to")
-				}
-
-				// Update file state
-				initialFiles[path] = modTime
+	files := make(chan controller.ResponseFile)
+	var wg sync.WaitGroup
+	watchers := []*controller.FileWatcher{h.Watcher}
+	for _, w := range h.profileWatchers {
+		watchers = append(watchers, w)
+	}
+	for _, w := range watchers {
+		log.Printf("Background watcher started, monitoring: %s", w.GetWatchDir())
+		wg.Add(1)
+		go func(w *controller.FileWatcher) {
+			defer wg.Done()
+			for file := range w.Watch(context.Background()) {
+				files <- file
 			}
-		}
+		}(w)
+	}
+	go func() {
+		wg.Wait()
+		close(files)
+	}()
 
-		// Update initial files with any new files
-		for path, modTime := range currentFiles {
-			initialFiles[path] = modTime
-		}
+	for file := range files {
+		h.handleResponseFile(file)
 	}
 }
 
-// getFileStates returns modification times for all files in a directory
-func (h *MainHandler) getFileStates(dir string) map[string]time.Time {
-	states := make(map[string]time.Time)
+// watcherFor returns the watcher of the directory a profile's responses go to
+func (h *MainHandler) watcherFor(profile controller.Profile) *controller.FileWatcher {
+	if w, ok := h.profileWatchers[profile.ResponseDir]; ok {
+		return w
+	}
+	return h.Watcher
+}
 
-	filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
-		if err != nil || info.IsDir() {
-			return nil
-		}
-		// Only watch text/markdown files
-		ext := filepath.Ext(path)
-		if ext == ".txt" || ext == ".md" {
-			states[path] = info.ModTime()
-		}
-		return nil
-	})
+// profileOf returns the IDE profile a user picked, or the default
+func (h *MainHandler) profileOf(userID int64) controller.Profile {
+	return h.profile(h.Prefs.Get(userID).IDE)
+}
 
-	return states
+// profile finds a profile by name, using the default for unknown names,
+// e.g. one removed from the profiles file since a job was queued
+func (h *MainHandler) profile(name string) controller.Profile {
+	profile, err := h.Profiles.Get(name)
+	if err != nil {
+		log.Printf("Warning: %v; using %s", err, h.Profiles.Default().Name)
+		return h.Profiles.Default()
+	}
+	return profile
 }
 
 // HandleMessage processes incoming messages
@@ -147,81 +327,48 @@ func (h *MainHandler) HandleMessage(ctx context.Context, msg *tgbotapi.Message)
 	userID := msg.From.ID
 	chatID := msg.Chat.ID
 
+	p := h.observeLocale(chatID, msg.From)
+
 	// Check authorization
 	if !h.Auth.IsAuthorized(userID) {
 		log.Printf("Unauthorized access from user %d", userID)
-		return h.Bot.SendText(chatID, "⛔ 你沒有使用權限")
+		return h.Bot.SendText(chatID, p.T("auth.denied"))
 	}
 
-	// Update watching chat ID (so responses go to the right chat)
-	h.watchingMutex.Lock()
-	h.watchChatID = chatID
-	h.watchingMutex.Unlock()
-
-	// Parse command
-	cmd, err := command.Parse(msg.Text)
-	if err != nil {
-		return h.Bot.SendText(chatID, fmt.Sprintf("❌ %v", err))
-	}
-
-	// Execute command
-	switch cmd.Name {
-	case command.CmdRun:
-		return h.handleRun(chatID, cmd)
-	case command.CmdScreenshot:
-		return h.handleScreenshot(chatID, cmd.AppName)
-	case command.CmdNotes:
-		return h.handleNotes(chatID, cmd)
-	case command.CmdStatus:
-		return h.handleStatus(chatID)
-	case command.CmdHelp:
-		return h.Bot.SendText(chatID, command.HelpText())
-	default:
-		return h.Bot.SendText(chatID, "❓ 未知指令，使用 /help 查看說明")
-	}
-}
-
-// handleRun shows the prompt and waits for response file
-func (h *MainHandler) handleRun(chatID int64, cmd *command.Command) error {
-	responseDir := h.Watcher.GetWatchDir()
-
-	// Clean up old files
-	h.Watcher.CleanupOldFiles(1 * time.Hour)
-
-	// Show the prompt to user and explain the process
-	return h.Bot.SendText(chatID, fmt.Sprintf(`🚀 收到 Prompt:
-%s
-
-📋 請在 Antigravity 執行此 Prompt
-
-✅ 回應完成後，將回應保存到:
-%s/response.md
-
-Bot 會自動偵測並發送回應給你。`, cmd.Prompt, responseDir))
+	return h.dispatchCommand(ctx, msg)
 }
 
 // handleNotes adds a note or shows the web UI link
 func (h *MainHandler) handleNotes(chatID int64, cmd *command.Command) error {
+	p := h.tr(chatID)
 	if cmd.Prompt == "" {
 		// No content, show Web UI info
-		count := h.NoteStore.Count()
-		return h.Bot.SendText(chatID, fmt.Sprintf(`💡 Ideas / Notes
-
-📝 目前筆記： %d 則
-🌐 Web UI: http://localhost:8080
-
-使用方式：
-/notes <你的想法> - 新增一則筆記`, count))
+		return h.Bot.SendText(chatID, p.N("notes.info", h.NoteStore.Count()))
 	}
 
 	// Add note
 	note := h.NoteStore.Add(cmd.Prompt)
-	return h.Bot.SendText(chatID, fmt.Sprintf("✅ Idea 已保存！\nID: %s\n\n可在 Web UI 查看。", note.ID))
+	text := p.T("notes.saved", note.ID)
+	if keyboard := h.noteKeyboard(p, note.ID, true); keyboard != nil {
+		_, err := h.Bot.SendKeyboard(chatID, 0, text, *keyboard)
+		return err
+	}
+	return h.Bot.SendText(chatID, text)
+}
+
+// screenshotApp is the app /screenshot focuses: the one named, or the
+// user's default app
+func (h *MainHandler) screenshotApp(userID int64, named string) string {
+	if named != "" {
+		return named
+	}
+	return orDefault(h.Prefs.Get(userID).App, h.profileOf(userID).App)
 }
 
 // handleScreenshot takes and sends a screenshot of the specified app
 func (h *MainHandler) handleScreenshot(chatID int64, appName string) error {
-	h.Bot.SendText(chatID, fmt.Sprintf("📸 截圖 %s 中...", appName))
+	p := h.tr(chatID)
+	h.Bot.SendText(chatID, p.T("screenshot.taking", appName))
 
 	// Focus the specified app first
 	log.Printf("Focusing app: %s", appName)
@@ -232,27 +379,28 @@ func (h *MainHandler) handleScreenshot(chatID int64, appName string) error {
 	path, err := h.IDE.TakeScreenshotRaw()
 	if err != nil {
 		log.Printf("Screenshot failed: %v", err)
-		return h.Bot.SendText(chatID, fmt.Sprintf("❌ 截圖失敗: %v", err))
+		return h.Bot.SendText(chatID, p.T("screenshot.failed", err))
 	}
 
 	log.Printf("Screenshot saved to: %s", path)
 
 	if err := h.Bot.SendPhoto(chatID, path); err != nil {
 		log.Printf("Failed to send photo to Telegram: %v", err)
-		return h.Bot.SendText(chatID, fmt.Sprintf("❌ 發送圖片失敗: %v", err))
+		return h.Bot.SendText(chatID, p.T("screenshot.send_failed", err))
 	}
 
 	return nil
 }
 
 // handleStatus returns system status
-func (h *MainHandler) handleStatus(chatID int64) error {
+func (h *MainHandler) handleStatus(chatID, userID int64) error {
+	p := h.tr(chatID)
 	responseDir := h.Watcher.GetWatchDir()
 
 	// Check if response directory exists
-	dirExists := "✅ 存在"
+	dirExists := p.T("status.dir_exists")
 	if _, err := os.Stat(responseDir); os.IsNotExist(err) {
-		dirExists = "❌ 不存在"
+		dirExists = p.T("status.dir_missing")
 	}
 
 	// Count response files
@@ -262,27 +410,90 @@ func (h *MainHandler) handleStatus(chatID int64) error {
 	// Notes count
 	notesCount := h.NoteStore.Count()
 
-	h.watchingMutex.Lock()
-	watchingChat := h.watchChatID
-	h.watchingMutex.Unlock()
+	// Unfinished jobs
+	pendingJobs := h.Queue.Pending()
 
-	status := fmt.Sprintf(`📊 系統狀態
-
-✅ Bot: 運行中
-✅ 背景監聽: 已啟動
-🌐 Web UI: http://localhost:8080
-📁 回應目錄: %s
-   狀態: %s
-   檔案數: %d
-💡 筆記數: %d
-💬 當前 Chat ID: %d
+	// Connection to Telegram
+	connection := p.T("status.connection_unknown")
+	if reporter, ok := h.Bot.(StatusReporter); ok {
+		connection = formatConnection(p, h.Prefs.Get(userID).Location(), reporter.Status())
+	}
 
-📝 /run <問題> - 執行 prompt
-💡 /notes <想法> - 記錄 idea`, responseDir, dirExists, fileCount, notesCount, watchingChat)
+	status := p.T("status.report", responseDir, dirExists, fileCount, notesCount, pendingJobs, h.AdminChatID, connection)
 
 	return h.Bot.SendText(chatID, status)
 }
 
+// OnReconnect tells the admin chat that the bot recovered from an outage
+func (h *MainHandler) OnReconnect(event ReconnectEvent) {
+	if h.AdminChatID == 0 {
+		return
+	}
+
+	p := h.tr(h.AdminChatID)
+	text := p.T("reconnect.report", event.Downtime.Round(time.Second), truncate(event.Reason, 200))
+	if event.Recreated {
+		text += "\n" + p.T("reconnect.recreated")
+	}
+	if err := h.Bot.SendText(h.AdminChatID, text); err != nil {
+		log.Printf("Failed to report reconnect: %v", err)
+	}
+}
+
+// OnPanic tells the admin chat, and the chat the update came from, that handling it panicked
+func (h *MainHandler) OnPanic(update tgbotapi.Update, value interface{}, stack []byte) {
+	chatID := chatOf(update)
+	if chatID != 0 && chatID != h.AdminChatID {
+		h.Bot.SendText(chatID, h.tr(chatID).T("panic.user"))
+	}
+	if h.AdminChatID == 0 {
+		return
+	}
+
+	p := h.tr(h.AdminChatID)
+	source := ""
+	switch {
+	case update.Message != nil:
+		source = update.Message.Text
+	case update.CallbackQuery != nil:
+		source = p.T("panic.button", update.CallbackQuery.Data)
+	}
+	text := p.T("panic.admin", value, chatID, truncate(source, 100), truncateStack(stack, 1500))
+	if err := h.Bot.SendText(h.AdminChatID, text); err != nil {
+		log.Printf("Failed to report panic: %v", err)
+	}
+}
+
+// truncateStack keeps the first n bytes of a stack trace, which name the
+// failing frame, cutting on a rune boundary so panic values in other
+// scripts stay valid UTF-8
+func truncateStack(stack []byte, n int) string {
+	if len(stack) <= n {
+		return string(stack)
+	}
+	for n > 0 && !utf8.RuneStart(stack[n]) {
+		n--
+	}
+	return string(stack[:n]) + "\n…"
+}
+
+// formatConnection summarizes the connection status for /status, with times in loc
+func formatConnection(p i18n.Printer, loc *time.Location, status ConnectionStatus) string {
+	last := p.T("connection.never")
+	if !status.LastPoll.IsZero() {
+		last = p.T("connection.last_poll", status.LastPoll.In(loc).Format("15:04:05"), time.Since(status.LastPoll).Round(time.Second))
+	}
+
+	text := p.N("connection.summary", status.Reconnects, status.Mode, last, status.Reconnects)
+	if status.LastError != "" {
+		text += "\n   ⚠️ " + truncate(status.LastError, 100)
+	}
+	if status.Unsent > 0 {
+		text += "\n   " + p.N("connection.unsent", status.Unsent)
+	}
+	return text
+}
+
 func orDefault(s, def string) string {
 	if s == "" {
 		return def
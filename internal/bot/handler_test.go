@@ -0,0 +1,685 @@
+package bot
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/applejobs/telegram-remote-controller/internal/automation"
+	"github.com/applejobs/telegram-remote-controller/internal/command"
+	"github.com/applejobs/telegram-remote-controller/internal/controller"
+	"github.com/applejobs/telegram-remote-controller/internal/i18n"
+	"github.com/applejobs/telegram-remote-controller/internal/notes"
+	"github.com/applejobs/telegram-remote-controller/internal/prefs"
+	"github.com/applejobs/telegram-remote-controller/internal/queue"
+	"github.com/applejobs/telegram-remote-controller/internal/router"
+	"github.com/applejobs/telegram-remote-controller/internal/telegramtest"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	testUser = 7
+	testChat = 42
+	waitTime = 5 * time.Second
+)
+
+// newTestHandler runs a handler against a fake Bot API server, with its
+// state in a temp dir and the IDE replaced by a runner that records prompts
+func newTestHandler(t *testing.T) (*telegramtest.Server, *MainHandler, *promptRecorder) {
+	return newTestHandlerWith(t, func(*HandlerOptions) {})
+}
+
+// newTestHandlerWith is newTestHandler with options changed by set
+func newTestHandlerWith(t *testing.T, set func(*HandlerOptions)) (*telegramtest.Server, *MainHandler, *promptRecorder) {
+	srv := telegramtest.NewServer()
+	t.Cleanup(srv.Close)
+
+	b, err := NewWithEndpoint(telegramtest.Token, srv.Endpoint(), nil)
+	if err != nil {
+		t.Fatalf("NewWithEndpoint failed: %v", err)
+	}
+
+	dir := t.TempDir()
+	opts := HandlerOptions{
+		JournalPath: filepath.Join(dir, "queue", "jobs.jsonl"),
+		NotesDir:    filepath.Join(dir, "notes"),
+		WatchDir:    filepath.Join(dir, "responses"),
+
+		PrefsPath: filepath.Join(dir, "preferences.json"),
+	}
+	set(&opts)
+	h := NewMainHandlerWithOptions(b, []int64{testUser}, opts)
+	recorder := &promptRecorder{}
+	h.Queue.SetRunner(recorder.run)
+	b.SetHandler(h)
+	h.Start()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go b.Start(ctx)
+
+	return srv, h, recorder
+}
+
+// promptRecorder stands in for the IDE
+type promptRecorder struct {
+	mu   sync.Mutex
+	jobs []queue.Job
+}
+
+func (r *promptRecorder) run(ctx context.Context, job queue.Job) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.jobs = append(r.jobs, job)
+	return nil
+}
+
+func (r *promptRecorder) count() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.jobs)
+}
+
+// buttons returns the callback data of an inline keyboard sent with a call
+func buttons(t *testing.T, call telegramtest.Call) []string {
+	var markup tgbotapi.InlineKeyboardMarkup
+	if err := json.Unmarshal([]byte(call.Params["reply_markup"]), &markup); err != nil {
+		t.Fatalf("Call has no inline keyboard: %v", err)
+	}
+	var data []string
+	for _, row := range markup.InlineKeyboard {
+		for _, b := range row {
+			data = append(data, *b.CallbackData)
+		}
+	}
+	return data
+}
+
+func TestHandlerRejectsUnauthorizedUser(t *testing.T) {
+	srv, _, _ := newTestHandler(t)
+
+	srv.PushMessage(testChat, 999, "/status")
+	if _, ok := srv.WaitForText("你沒有使用權限", waitTime); !ok {
+		t.Fatal("Unauthorized user should be refused")
+	}
+}
+
+func TestHandlerStatus(t *testing.T) {
+	srv, _, _ := newTestHandler(t)
+
+	srv.PushMessage(testChat, testUser, "/status")
+	if _, ok := srv.WaitForText("系統狀態", waitTime); !ok {
+		t.Fatal("Expected a status reply")
+	}
+}
+
+func TestHandlerAdminCommands(t *testing.T) {
+	srv, h, _ := newTestHandler(t)
+	h.Auth.AddUser(8)
+
+	srv.PushMessage(testChat, 8, "/alias set model fast gemini")
+	if _, ok := srv.WaitForText("僅限管理者", waitTime); !ok {
+		t.Fatal("Non-admin users should not run admin commands")
+	}
+
+	srv.PushMessage(testChat, 8, "/start")
+	help, ok := srv.WaitForText("可用指令", waitTime)
+	if !ok || strings.Contains(help.Params["text"], "/alias") {
+		t.Errorf("Users should get help without admin commands, got %q", help.Params["text"])
+	}
+}
+
+func TestHandlerPublishCommands(t *testing.T) {
+	srv, h, _ := newTestHandler(t)
+
+	if err := h.PublishCommands(); err != nil {
+		t.Fatalf("PublishCommands failed: %v", err)
+	}
+	calls := srv.Calls("setMyCommands")
+	if len(calls) != 3 {
+		t.Fatalf("Expected a default, an English and an admin menu, got %d calls", len(calls))
+	}
+	menus := map[string]string{}
+	for _, call := range calls[:2] {
+		menus[call.Params["language_code"]] = call.Params["commands"]
+	}
+	if !strings.Contains(menus[""], "顯示此說明") || !strings.Contains(menus["en"], "Show this help") {
+		t.Errorf("Expected a zh-TW default menu and an en menu, got %+v", calls)
+	}
+	if strings.Contains(menus[""], `"alias"`) || !strings.Contains(calls[2].Params["commands"], `"alias"`) {
+		t.Errorf("Only the admin chat menu should list /alias, got %+v", calls)
+	}
+}
+
+func TestHandlerLanguage(t *testing.T) {
+	srv, h, _ := newTestHandler(t)
+
+	srv.PushMessage(testChat, testUser, "/lang en")
+	if _, ok := srv.WaitForText("English", waitTime); !ok {
+		t.Fatal("Expected /lang to confirm the switch")
+	}
+	if got := h.Prefs.Get(testUser).Language; got != i18n.En {
+		t.Errorf("Expected the choice to be stored, got %q", got)
+	}
+
+	srv.PushMessage(testChat, testUser, "/help")
+	if _, ok := srv.WaitForText("🤖 Commands:", waitTime); !ok {
+		t.Fatal("Expected help in English")
+	}
+
+	srv.PushMessage(testChat, testUser, "/lang xx")
+	if _, ok := srv.WaitForText("zh-TW", waitTime); !ok {
+		t.Fatal("Expected unknown languages to list the choices")
+	}
+}
+
+func TestHandlerSettings(t *testing.T) {
+	srv, h, recorder := newTestHandler(t)
+
+	// Labels are looked up by key, so the source check cannot see them
+	for _, locale := range i18n.Locales() {
+		p := i18n.For(locale)
+		for _, key := range prefs.Keys {
+			if !p.Has("settings.key." + string(key)) {
+				t.Errorf("%s has no label for %s", locale, key)
+			}
+			for _, value := range prefs.Choices[key] {
+				if id := "settings." + string(key) + "." + value; !p.Has(id) {
+					t.Errorf("%s is missing %q", locale, id)
+				}
+			}
+		}
+	}
+
+	srv.PushMessage(testChat, testUser, "/settings")
+	menu, ok := srv.WaitForText("⚙️ 設定", waitTime)
+	if !ok {
+		t.Fatal("Expected the settings menu")
+	}
+	data := buttons(t, menu)
+	if len(data) != len(prefs.Keys) {
+		t.Fatalf("Expected a button per setting, got %q", data)
+	}
+
+	// Open the long response choices and pick a summary
+	message := &tgbotapi.Message{MessageID: 1000, Chat: &tgbotapi.Chat{ID: testChat}}
+	srv.PushCallback(testUser, message, findButton(t, data, callbackSettings+"|long_response|"))
+	choices, ok := srv.WaitFor("editMessageText", waitTime, nil)
+	if !ok || !strings.Contains(choices.Params["text"], "長回應") {
+		t.Fatalf("Expected the long response choices, got %+v", choices.Params)
+	}
+	queryID := srv.PushCallback(testUser, message, findButton(t, buttons(t, choices), callbackSetPref+"|long_response=summary|"))
+	answer, ok := srv.WaitFor("answerCallbackQuery", waitTime, func(c telegramtest.Call) bool {
+		return c.Params["callback_query_id"] == queryID
+	})
+	if !ok || !strings.Contains(answer.Params["text"], "已保存") {
+		t.Fatalf("Expected the choice to be saved, got %+v", answer.Params)
+	}
+	if got := h.Prefs.Get(testUser).LongResponse; got != prefs.LongSummary {
+		t.Errorf("Expected summary, got %s", got)
+	}
+
+	srv.PushMessage(testChat, testUser, "/settings model nosuch")
+	if _, ok := srv.WaitForText("unknown model", waitTime); !ok {
+		t.Error("Unknown models should be rejected")
+	}
+	srv.PushMessage(testChat, testUser, "/settings model gemini")
+	if _, ok := srv.WaitForText("已更新 🎯 Model：Gemini 3 Pro", waitTime); !ok {
+		t.Error("Expected model aliases to be expanded")
+	}
+
+	// Plain text now saves ideas instead of running
+	srv.PushMessage(testChat, testUser, "/settings plain_text notes")
+	if _, ok := srv.WaitForText("存成 idea", waitTime); !ok {
+		t.Fatal("Expected plain text mode to change")
+	}
+	srv.PushMessage(testChat, testUser, "try the webhook mode")
+	if _, ok := srv.WaitForText("Idea 已保存", waitTime); !ok {
+		t.Fatal("Expected plain text to be saved as an idea")
+	}
+	if recorder.count() != 0 || h.NoteStore.Count() != 1 {
+		t.Errorf("Expected a note and no run, got %d run(s) and %d note(s)", recorder.count(), h.NoteStore.Count())
+	}
+}
+
+// findButton returns the callback data that starts with prefix
+func findButton(t *testing.T, data []string, prefix string) string {
+	t.Helper()
+	for _, d := range data {
+		if strings.HasPrefix(d, prefix) {
+			return d
+		}
+	}
+	t.Fatalf("No button %q in %q", prefix, data)
+	return ""
+}
+
+func TestHandlerSettingsApplyToRuns(t *testing.T) {
+	srv, h, recorder := newTestHandlerWith(t, func(o *HandlerOptions) { o.DocumentThreshold = 20 })
+	h.Prefs.Set(testUser, prefs.KeyModel, "Gemini 3 Pro")
+	h.Prefs.Set(testUser, prefs.KeyApp, "Visual Studio Code")
+	h.Prefs.Set(testUser, prefs.KeyLongResponse, string(prefs.LongSummary))
+
+	srv.PushMessage(testChat, testUser, "/run explain the queue")
+	if _, ok := srv.WaitForText("#1 Prompt 已送出", waitTime); !ok {
+		t.Fatal("Expected the job to be submitted")
+	}
+	recorder.mu.Lock()
+	job := recorder.jobs[0]
+	recorder.mu.Unlock()
+	if job.Model != "Gemini 3 Pro" || job.App != "Visual Studio Code" {
+		t.Errorf("Expected the user's model and app, got %+v", job)
+	}
+
+	path := h.Watcher.ResponsePath("1")
+	if err := os.WriteFile(path, []byte(strings.Repeat("a long answer\n", 10)), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := srv.WaitForText("以下為摘要", waitTime); !ok {
+		t.Fatal("Expected a summary of the long response")
+	}
+	if calls := srv.Calls("sendDocument"); len(calls) != 0 {
+		t.Errorf("Users who prefer summaries should get no attachment, got %d", len(calls))
+	}
+}
+
+func TestHandlerIDE(t *testing.T) {
+	srv, h, recorder := newTestHandler(t)
+
+	srv.PushMessage(testChat, testUser, "/ide")
+	menu, ok := srv.WaitForText("選擇 🧩 IDE", waitTime)
+	if !ok {
+		t.Fatal("Expected the profiles to choose from")
+	}
+	findButton(t, buttons(t, menu), callbackSetPref+"|ide=cursor|")
+
+	srv.PushMessage(testChat, testUser, "/ide nosuch")
+	if _, ok := srv.WaitForText("unknown IDE profile", waitTime); !ok {
+		t.Error("Unknown profiles should be rejected")
+	}
+	srv.PushMessage(testChat, testUser, "/ide Cursor")
+	if _, ok := srv.WaitForText("已切換到 cursor，/run 會操作 Cursor", waitTime); !ok {
+		t.Fatal("Expected the profile to be switched")
+	}
+
+	srv.PushMessage(testChat, testUser, "/run fix the flaky test")
+	if _, ok := srv.WaitForText("#1 Prompt 已送出", waitTime); !ok {
+		t.Fatal("Expected the job to be submitted")
+	}
+	recorder.mu.Lock()
+	job := recorder.jobs[0]
+	recorder.mu.Unlock()
+	if job.IDE != "cursor" {
+		t.Errorf("Expected the job to use the cursor profile, got %q", job.IDE)
+	}
+	if got := h.screenshotApp(testUser, ""); got != "Cursor" {
+		t.Errorf("Screenshots should focus the profile's app, got %q", got)
+	}
+}
+
+func TestHandlerRunDeliversResponse(t *testing.T) {
+	srv, h, recorder := newTestHandler(t)
+
+	run := srv.PushMessage(testChat, testUser, "/run explain the queue")
+	if _, ok := srv.WaitForText("#1 Prompt 已送出", waitTime); !ok {
+		t.Fatal("Expected the job to be submitted")
+	}
+
+	recorder.mu.Lock()
+	if len(recorder.jobs) != 1 || recorder.jobs[0].Prompt != "explain the queue" {
+		t.Errorf("Unexpected jobs run: %+v", recorder.jobs)
+	}
+	recorder.mu.Unlock()
+
+	// The agent writes its answer where the prompt asked it to
+	path := h.Watcher.ResponsePath("1")
+	if err := os.WriteFile(path, []byte("The queue is **persistent**."), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	reply, ok := srv.WaitForText("<b>persistent</b>", waitTime)
+	if !ok {
+		t.Fatal("Expected the response to be delivered as HTML")
+	}
+	if reply.Params["parse_mode"] != "HTML" || reply.Int("reply_to_message_id") != int64(run.MessageID) {
+		t.Errorf("Response should reply to the run in HTML, got %+v", reply.Params)
+	}
+
+	markup, ok := srv.WaitFor("editMessageReplyMarkup", waitTime, nil)
+	if !ok {
+		t.Fatal("Expected follow-up buttons under the response")
+	}
+	if data := buttons(t, markup); len(data) != 2 || !strings.HasPrefix(data[0], callbackRerun+"|1|") {
+		t.Errorf("Expected re-run and screenshot buttons, got %q", data)
+	}
+
+	if job, _ := h.Queue.Get("1"); job.State != queue.StateDone {
+		t.Errorf("Job should be done, got %s", job.State)
+	}
+}
+
+func TestHandlerFinishesStoppedStream(t *testing.T) {
+	srv, h, _ := newTestHandlerWith(t, func(o *HandlerOptions) { o.DocumentThreshold = 60 })
+
+	srv.PushMessage(testChat, testUser, "/run explain the queue")
+	if _, ok := srv.WaitForText("#1 Prompt 已送出", waitTime); !ok {
+		t.Fatal("Expected the job to be submitted")
+	}
+	path := h.Watcher.ResponsePath("1")
+
+	// The partial response outgrows the threshold, then the agent trims it
+	h.handleResponseFile(controller.ResponseFile{Path: path, Content: "Draft answer", Partial: true})
+	h.handleResponseFile(controller.ResponseFile{Path: path, Content: strings.Repeat("long draft ", 10), Partial: true})
+	h.handleResponseFile(controller.ResponseFile{Path: path, Content: "Final answer"})
+
+	if _, ok := srv.WaitFor("editMessageText", waitTime, func(c telegramtest.Call) bool {
+		return strings.Contains(c.Params["text"], "Final answer")
+	}); !ok {
+		t.Fatal("The final response should replace the stopped stream")
+	}
+	if _, ok := srv.WaitFor("editMessageReplyMarkup", waitTime, nil); !ok {
+		t.Error("Expected follow-up buttons under the final response")
+	}
+}
+
+func TestHandlerStopsStreamForLongFinal(t *testing.T) {
+	srv, h, _ := newTestHandlerWith(t, func(o *HandlerOptions) { o.DocumentThreshold = 60 })
+
+	srv.PushMessage(testChat, testUser, "/run explain the queue")
+	if _, ok := srv.WaitForText("#1 Prompt 已送出", waitTime); !ok {
+		t.Fatal("Expected the job to be submitted")
+	}
+	path := h.Watcher.ResponsePath("1")
+
+	h.handleResponseFile(controller.ResponseFile{Path: path, Content: "Draft answer", Partial: true})
+	h.handleResponseFile(controller.ResponseFile{Path: path, Content: strings.Repeat("long answer ", 10)})
+
+	if _, ok := srv.WaitFor("sendDocument", waitTime, nil); !ok {
+		t.Fatal("Expected the long response as a document")
+	}
+	edit, ok := srv.WaitFor("editMessageText", waitTime, nil)
+	if !ok {
+		t.Fatal("Expected the live message to be finished")
+	}
+	if text := edit.Params["text"]; strings.Contains(text, "撰寫中") || !strings.Contains(text, "Draft answer") {
+		t.Errorf("The live message should lose its writing mark, got %q", text)
+	}
+}
+
+func TestHandlerRunFlags(t *testing.T) {
+	srv, _, recorder := newTestHandler(t)
+
+	srv.PushMessage(testChat, testUser, `/run --app code -t 10m --no-submit -- --explain this`)
+	deadline := time.Now().Add(waitTime)
+	for time.Now().Before(deadline) && recorder.count() == 0 {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if recorder.count() == 0 {
+		t.Fatal("Expected the run to reach the runner")
+	}
+	recorder.mu.Lock()
+	job := recorder.jobs[0]
+	recorder.mu.Unlock()
+	if job.App != "Visual Studio Code" || job.Timeout != 10*time.Minute || !job.NoSubmit || job.Prompt != "--explain this" {
+		t.Errorf("Flags did not reach the job: %+v", job)
+	}
+
+	srv.PushMessage(testChat, testUser, "/run --modle x hi")
+	reply, ok := srv.WaitForText("unknown flag", waitTime)
+	if !ok || reply.Params["parse_mode"] != "HTML" || !strings.Contains(reply.Params["text"], "^^^^^^^") {
+		t.Errorf("Expected the error to point at the flag, got %+v", reply.Params)
+	}
+}
+
+func TestHandlerAliases(t *testing.T) {
+	srv, _, recorder := newTestHandler(t)
+
+	srv.PushMessage(testChat, testUser, "/alias set model fast Gemini 3 Flash")
+	if _, ok := srv.WaitForText("fast → Gemini 3 Flash", waitTime); !ok {
+		t.Fatal("Expected the alias to be set")
+	}
+
+	srv.PushMessage(testChat, testUser, "/models")
+	if _, ok := srv.WaitForText("• fast → Gemini 3 Flash", waitTime); !ok {
+		t.Error("/models should list the new alias")
+	}
+
+	srv.PushMessage(testChat, testUser, "/run -m fsat hi")
+	if _, ok := srv.WaitForText("did you mean fast", waitTime); !ok {
+		t.Error("A mistyped model should get a suggestion")
+	}
+
+	srv.PushMessage(testChat, testUser, "/run -m fast hi")
+	deadline := time.Now().Add(waitTime)
+	for time.Now().Before(deadline) && recorder.count() == 0 {
+		time.Sleep(10 * time.Millisecond)
+	}
+	recorder.mu.Lock()
+	defer recorder.mu.Unlock()
+	if len(recorder.jobs) != 1 || recorder.jobs[0].Model != "Gemini 3 Flash" {
+		t.Errorf("Expected the alias to pick the model, got %+v", recorder.jobs)
+	}
+}
+
+func TestHandlerNoteButtons(t *testing.T) {
+	srv, h, _ := newTestHandler(t)
+
+	srv.PushMessage(testChat, testUser, "/notes try webhooks")
+	saved, ok := srv.WaitForText("Idea 已保存", waitTime)
+	if !ok {
+		t.Fatal("Expected the note to be saved")
+	}
+	data := buttons(t, saved)
+	if len(data) != 2 {
+		t.Fatalf("Expected done and delete buttons, got %q", data)
+	}
+
+	message := &tgbotapi.Message{MessageID: 1000, Chat: &tgbotapi.Chat{ID: testChat}}
+	queryID := srv.PushCallback(testUser, message, data[0])
+	answer, ok := srv.WaitFor("answerCallbackQuery", waitTime, func(c telegramtest.Call) bool {
+		return c.Params["callback_query_id"] == queryID
+	})
+	if !ok || !strings.Contains(answer.Params["text"], "已標記完成") {
+		t.Fatalf("Expected the button press to be answered, got %+v", answer.Params)
+	}
+
+	all := h.NoteStore.GetAll()
+	if len(all) != 1 || all[0].Status != notes.StatusDone {
+		t.Errorf("Note should be DONE, got %+v", all)
+	}
+
+	// A button whose message Telegram left out is answered, not handled
+	queryID = srv.PushCallback(testUser, nil, data[1])
+	answer, ok = srv.WaitFor("answerCallbackQuery", waitTime, func(c telegramtest.Call) bool {
+		return c.Params["callback_query_id"] == queryID
+	})
+	if !ok || !strings.Contains(answer.Params["text"], "找不到按鈕所在的訊息") {
+		t.Errorf("Expected a press without a message to be answered, got %+v", answer.Params)
+	}
+	if len(h.NoteStore.GetAll()) != 1 {
+		t.Error("A press without a message should not delete the note")
+	}
+
+	// Forged data is refused
+	forged := strings.Replace(data[1], "del|", "done|", 1)
+	queryID = srv.PushCallback(testUser, message, forged)
+	answer, ok = srv.WaitFor("answerCallbackQuery", waitTime, func(c telegramtest.Call) bool {
+		return c.Params["callback_query_id"] == queryID
+	})
+	if !ok || !strings.Contains(answer.Params["text"], "無效") {
+		t.Errorf("Forged callback data should be rejected, got %+v", answer.Params)
+	}
+}
+
+func TestHandlerReportsPanics(t *testing.T) {
+	srv, h, _ := newTestHandlerWith(t, func(o *HandlerOptions) { o.AdminChatID = 99 })
+
+	update := tgbotapi.Update{Message: &tgbotapi.Message{Text: "/status", Chat: &tgbotapi.Chat{ID: testChat}}}
+	h.OnPanic(update, "index out of range", []byte("goroutine 1 [running]:\nmain.handleStatus()"))
+
+	admin, ok := srv.WaitFor("sendMessage", waitTime, func(c telegramtest.Call) bool { return c.Int("chat_id") == 99 })
+	if !ok || !strings.Contains(admin.Params["text"], "index out of range") || !strings.Contains(admin.Params["text"], "handleStatus") {
+		t.Errorf("Admin should get the panic and stack, got %+v", admin.Params)
+	}
+	if _, ok := srv.WaitForText("內部錯誤", waitTime); !ok {
+		t.Error("The user's chat should be told something went wrong")
+	}
+}
+
+func TestHandlerRoutesPromptsWithoutModel(t *testing.T) {
+	srv, h, recorder := newTestHandler(t)
+	r, err := router.New(router.Config{Rules: []router.Rule{
+		{Name: "coding", Keywords: []string{"bug"}, Model: "gemini"},
+	}}, command.DefaultModel, h.Catalog.Model)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h.Router = r
+
+	srv.PushMessage(testChat, testUser, "/route fix this bug")
+	if _, ok := srv.WaitForText("🧭 路由試算：Gemini 3 Pro", waitTime); !ok {
+		t.Fatal("/route should show the chosen model")
+	}
+	if recorder.count() != 0 {
+		t.Error("/route should not run the prompt")
+	}
+
+	srv.PushMessage(testChat, testUser, "/run fix this bug")
+	deadline := time.Now().Add(waitTime)
+	for time.Now().Before(deadline) && recorder.count() == 0 {
+		time.Sleep(10 * time.Millisecond)
+	}
+	recorder.mu.Lock()
+	defer recorder.mu.Unlock()
+	if len(recorder.jobs) != 1 || recorder.jobs[0].Model != "Gemini 3 Pro" {
+		t.Fatalf("Expected the prompt to be routed, got %+v", recorder.jobs)
+	}
+	if route := recorder.jobs[0].Route; route != "選用 Gemini 3 Pro，因為：coding (關鍵字：bug)" {
+		t.Errorf("The job should explain the route in the chat's language, got %q", route)
+	}
+}
+
+func TestExplainRouteIsTranslated(t *testing.T) {
+	d := router.Decision{Model: "Gemini 3 Flash", Rule: "short", Reasons: []router.Reason{
+		{Kind: router.ReasonMaxLength, Args: []any{16, 80}},
+		{Kind: router.ReasonCheapest, Args: []any{"Claude Opus 4.5 (Thinking), Gemini 3 Flash"}},
+	}}
+	want := "routed to Gemini 3 Flash because: short (length 16 ≤ 80; cheapest of Claude Opus 4.5 (Thinking), Gemini 3 Flash)"
+	if got := explainRoute(i18n.For(i18n.En), d); got != want {
+		t.Errorf("explainRoute = %q, want %q", got, want)
+	}
+	if got := explainRoute(i18n.For(i18n.ZhTW), router.Decision{Model: "Gemini 3 Pro"}); got != "選用 Gemini 3 Pro，因為：沒有符合的規則，使用預設 model" {
+		t.Errorf("explainRoute without a rule = %q", got)
+	}
+
+	for kind, id := range reasonMessages {
+		for _, locale := range i18n.Locales() {
+			if !i18n.For(locale).Has(id) {
+				t.Errorf("%s has no %s message for %s reasons", locale, id, kind)
+			}
+		}
+	}
+
+	job := queue.Job{App: "Cursor", Workspace: "~/app", Timeout: 10 * time.Minute}
+	if got := jobOptions(i18n.For(i18n.ZhTW), job); got != ", app：Cursor, 工作區：~/app, 逾時：10m0s" {
+		t.Errorf("jobOptions = %q", got)
+	}
+}
+
+func TestHandlerTemplates(t *testing.T) {
+	srv, h, _ := newTestHandler(t)
+
+	srv.PushMessage(testChat, testUser, "/tpl save review review {{file}} in {{lang=English}}")
+	if _, ok := srv.WaitForText("已保存範本 review", waitTime); !ok {
+		t.Fatal("Expected the template to be saved")
+	}
+
+	srv.PushMessage(testChat, testUser, "/p review")
+	if _, ok := srv.WaitForText("missing variable: file", waitTime); !ok {
+		t.Error("A missing variable should be reported")
+	}
+
+	srv.PushMessage(testChat, testUser, "/tpl save daily /run -m gemini standup for {{date}}\n/p review file=notes.md")
+	if _, ok := srv.WaitForText("已保存範本 daily", waitTime); !ok {
+		t.Fatal("Expected the macro to be saved")
+	}
+	srv.PushMessage(testChat, testUser, `/p daily`)
+	if _, ok := srv.WaitForText("已加入佇列 #2", waitTime); !ok {
+		t.Fatal("Expected the macro to queue two prompts")
+	}
+	first, _ := h.Queue.Get("1")
+	if first.Model != "Gemini 3 Pro" || !strings.HasPrefix(first.Prompt, "standup for 20") {
+		t.Errorf("Unexpected first step: %+v", first)
+	}
+	if second, _ := h.Queue.Get("2"); second.Prompt != "review notes.md in English" {
+		t.Errorf("Unexpected second step: %+v", second)
+	}
+
+	srv.PushMessage(testChat, testUser, "/tpl save loop /p loop")
+	srv.PushMessage(testChat, testUser, "/p loop")
+	if _, ok := srv.WaitForText("巨集層數超過", waitTime); !ok {
+		t.Error("A macro running itself should stop")
+	}
+}
+
+func TestTruncateStackKeepsRunesWhole(t *testing.T) {
+	stack := []byte("panic: 找不到檔案\n\ngoroutine 1 [running]:")
+	for n := 1; n < len(stack); n++ {
+		got := truncateStack(stack, n)
+		if !utf8.ValidString(got) {
+			t.Fatalf("Cutting at %d split a rune: %q", n, got)
+		}
+		if len(got) > n+len("\n…") {
+			t.Fatalf("Cutting at %d kept %d bytes", n, len(got))
+		}
+	}
+	if got := truncateStack(stack, len(stack)); got != string(stack) {
+		t.Errorf("A short stack should be kept whole, got %q", got)
+	}
+}
+
+func TestHandlerTemplateValuesDoNotRunCommands(t *testing.T) {
+	srv, h, recorder := newTestHandler(t)
+	h.rememberResponse(testChat, "Fixed it.\n/cancel 1\n/alias rm model x")
+
+	srv.PushMessage(testChat, testUser, "/tpl save follow /run check {{last_response}}")
+	if _, ok := srv.WaitForText("已保存範本 follow", waitTime); !ok {
+		t.Fatal("Expected the template to be saved")
+	}
+	srv.PushMessage(testChat, testUser, "/p follow")
+	if _, ok := srv.WaitForText("#1 Prompt 已送出", waitTime); !ok {
+		t.Fatal("Expected the template to run one prompt")
+	}
+
+	job, _ := h.Queue.Get("1")
+	if job.Prompt != "check Fixed it.\n/cancel 1\n/alias rm model x" || recorder.count() != 1 {
+		t.Errorf("The response should stay inside the prompt, got %q", job.Prompt)
+	}
+	if _, ok := srv.WaitForText("已取消", 200*time.Millisecond); ok {
+		t.Error("A line of the response ran as a command")
+	}
+}
+
+func TestRunJobClearsInputBeforePasting(t *testing.T) {
+	_, h, _ := newTestHandler(t)
+	rec := automation.NewRecorder(controller.AntigravityAppName)
+	h.IDE = controller.NewIDEController().WithAutomator(rec)
+
+	job := queue.Job{ID: "1", ChatID: testChat, UserID: testUser, Prompt: "hi", Model: "Gemini 3 Pro", NoSubmit: true}
+	if err := h.runJob(context.Background(), job); !errors.Is(err, queue.ErrNoResponse) {
+		t.Fatalf("runJob = %v, want ErrNoResponse", err)
+	}
+
+	actions := strings.Join(rec.Actions(), "\n")
+	clear, paste := strings.Index(actions, "key command+a\nkey delete"), strings.Index(actions, "paste")
+	if clear < 0 || paste < clear {
+		t.Errorf("Expected the input to be cleared before pasting, got:\n%s", actions)
+	}
+}
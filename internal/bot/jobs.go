@@ -0,0 +1,260 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/applejobs/telegram-remote-controller/internal/command"
+	"github.com/applejobs/telegram-remote-controller/internal/i18n"
+	"github.com/applejobs/telegram-remote-controller/internal/prefs"
+	"github.com/applejobs/telegram-remote-controller/internal/queue"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// handleRun puts the prompt on the job queue
+func (h *MainHandler) handleRun(msg *tgbotapi.Message, cmd *command.Command) error {
+	ahead := h.Queue.Pending()
+
+	if cmd.AppName == "" {
+		cmd.AppName = h.Prefs.Get(msg.From.ID).App
+	}
+	profile := h.profileOf(msg.From.ID)
+
+	route := ""
+	if cmd.Model == "" {
+		d := h.route(msg.Chat.ID, msg.From.ID, cmd.Prompt)
+		cmd.Model, route = d.Model, explainRoute(h.tr(msg.Chat.ID), d)
+		log.Printf("Prompt from chat %d %s", msg.Chat.ID, route)
+	}
+
+	job := h.Queue.Enqueue(queue.Job{
+		ChatID:    msg.Chat.ID,
+		UserID:    msg.From.ID,
+		MessageID: msg.MessageID,
+		Prompt:    cmd.Prompt,
+		Model:     cmd.Model,
+		Route:     route,
+
+		IDE:             profile.Name,
+		App:             cmd.AppName,
+		Workspace:       cmd.Workspace,
+		Timeout:         cmd.Timeout,
+		NewChat:         cmd.NewChat,
+		NoSubmit:        cmd.NoSubmit,
+		ScreenshotAfter: cmd.ScreenshotAfter,
+	})
+
+	if ahead == 0 {
+		return nil
+	}
+	return h.Bot.SendText(job.ChatID, h.tr(job.ChatID).N("job.queued", ahead, job.ID, ahead))
+}
+
+// runJob drives the IDE as the job's profile describes: focus, paste the
+// prompt, select the model and submit
+func (h *MainHandler) runJob(ctx context.Context, job queue.Job) error {
+	profile := h.profile(job.IDE)
+	watcher := h.watcherFor(profile)
+
+	// Clean up old files
+	watcher.CleanupOldFiles(1 * time.Hour)
+
+	ide := h.IDE.ForProfile(profile)
+	if job.App != "" {
+		ide = ide.ForApp(job.App)
+	}
+
+	p := h.tr(job.ChatID)
+	verbosity := h.Prefs.Get(job.UserID).Verbosity
+	start := p.T("job.started", job.ID, job.Model, jobOptions(p, job), job.Prompt)
+	if job.Route != "" && verbosity != prefs.VerbosityQuiet {
+		start += "\n\n🧭 " + job.Route
+	}
+	h.Bot.SendText(job.ChatID, start)
+
+	// Ask the agent to write its answer where the watcher can match it to this job
+	prompt := job.Prompt + "\n\n" + p.T("job.save_instruction", watcher.ResponsePath(job.ID))
+
+	type step struct {
+		label string
+		run   func() error
+	}
+	steps := []step{{p.T("step.focus", ide.AppName()), ide.EnsureReady}}
+	if job.Workspace != "" {
+		steps = append(steps, step{p.T("step.workspace", job.Workspace), func() error { return ide.OpenWorkspace(job.Workspace) }})
+	}
+	if job.NewChat {
+		steps = append(steps, step{p.T("step.new_chat"), ide.NewChat})
+	}
+	steps = append(steps,
+		step{p.T("step.clear"), ide.ClearInput},
+		step{p.T("step.paste"), func() error { return ide.InputPrompt(prompt) }},
+		step{p.T("step.model", job.Model), func() error { return ide.SelectModel(job.Model) }},
+	)
+	if !job.NoSubmit {
+		steps = append(steps, step{p.T("step.submit"), ide.Submit})
+	}
+
+	for i, step := range steps {
+		// Stop between steps if the job was cancelled
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		log.Printf("Job %s step %d/%d: %s", job.ID, i+1, len(steps), step.label)
+		started := time.Now()
+		if err := step.run(); err != nil {
+			return fmt.Errorf("[%d/%d] %s: %w", i+1, len(steps), step.label, err)
+		}
+		switch verbosity {
+		case prefs.VerbosityNormal:
+			h.Bot.SendText(job.ChatID, fmt.Sprintf("✅ #%s [%d/%d] %s", job.ID, i+1, len(steps), step.label))
+		case prefs.VerbosityVerbose:
+			took := time.Since(started).Round(10 * time.Millisecond)
+			h.Bot.SendText(job.ChatID, fmt.Sprintf("✅ #%s [%d/%d] %s (%v)", job.ID, i+1, len(steps), step.label, took))
+		}
+	}
+
+	if job.NoSubmit {
+		h.Bot.SendText(job.ChatID, p.T("job.not_submitted", job.ID, ide.AppName()))
+	}
+	if job.ScreenshotAfter {
+		if err := h.handleScreenshot(job.ChatID, ide.AppName()); err != nil {
+			log.Printf("Job %s screenshot failed: %v", job.ID, err)
+		}
+	}
+
+	if job.NoSubmit {
+		// Nothing will answer a prompt that was not sent, so free the queue
+		return queue.ErrNoResponse
+	}
+	return nil
+}
+
+// jobOptions describes the /run flags a job was started with, e.g. ", app: Cursor"
+func jobOptions(p i18n.Printer, job queue.Job) string {
+	var opts []string
+	if job.App != "" {
+		opts = append(opts, p.T("option.app", job.App))
+	}
+	if job.Workspace != "" {
+		opts = append(opts, p.T("option.workspace", job.Workspace))
+	}
+	if job.Timeout > 0 {
+		opts = append(opts, p.T("option.timeout", job.Timeout))
+	}
+	if job.NewChat {
+		opts = append(opts, p.T("option.new_chat"))
+	}
+	if job.NoSubmit {
+		opts = append(opts, p.T("option.no_submit"))
+	}
+	if job.ScreenshotAfter {
+		opts = append(opts, p.T("option.screenshot_after"))
+	}
+	if len(opts) == 0 {
+		return ""
+	}
+	return ", " + strings.Join(opts, ", ")
+}
+
+// onJobChange reports job state changes that the runner does not report itself
+func (h *MainHandler) onJobChange(job queue.Job) {
+	p := h.tr(job.ChatID)
+	switch job.State {
+	case queue.StateWaiting:
+		h.Bot.SendText(job.ChatID, p.T("job.submitted", job.ID, h.watcherFor(h.profile(job.IDE)).ResponsePath(job.ID)))
+	case queue.StateFailed:
+		text := p.T("job.failed", job.ID, job.Error, job.ID)
+		if keyboard := h.keyboard(p, []callbackButton{{"button.rerun", callbackRerun, job.ID}}); keyboard != nil {
+			h.Bot.SendKeyboard(job.ChatID, job.MessageID, text, *keyboard)
+			return
+		}
+		h.Bot.SendText(job.ChatID, text)
+	}
+}
+
+// handleQueue lists active and recent jobs, with times in the user's time zone
+func (h *MainHandler) handleQueue(chatID, userID int64) error {
+	p := h.tr(chatID)
+	loc := h.Prefs.Get(userID).Location()
+	jobs := h.Queue.List(5)
+	if len(jobs) == 0 {
+		return h.Bot.SendText(chatID, p.T("queue.empty"))
+	}
+
+	var sb strings.Builder
+	sb.WriteString(p.T("queue.title") + "\n")
+	for _, job := range jobs {
+		sb.WriteString(fmt.Sprintf("\n%s #%s [%s] %s\n   %s", jobStateIcon(job.State), job.ID, job.State,
+			job.CreatedAt.In(loc).Format("01/02 15:04"), truncate(job.Prompt, 60)))
+		if job.Error != "" {
+			sb.WriteString(fmt.Sprintf("\n   ⚠️ %s", job.Error))
+		}
+	}
+	return h.Bot.SendText(chatID, sb.String())
+}
+
+// handleCancel cancels a job
+func (h *MainHandler) handleCancel(chatID int64, id string) error {
+	p := h.tr(chatID)
+	job, err := h.Queue.Cancel(id)
+	switch err {
+	case nil:
+		return h.Bot.SendText(chatID, p.T("job.cancelled", job.ID))
+	case queue.ErrJobNotFound:
+		return h.Bot.SendText(chatID, p.T("job.not_found", id))
+	case queue.ErrJobFinished:
+		return h.Bot.SendText(chatID, p.T("job.already_finished", job.ID, job.State))
+	default:
+		return h.Bot.SendText(chatID, p.T("error", err))
+	}
+}
+
+// handleRetry re-enqueues a failed or cancelled job
+func (h *MainHandler) handleRetry(chatID int64, id string) error {
+	p := h.tr(chatID)
+	job, err := h.Queue.Retry(id)
+	switch err {
+	case nil:
+		return h.Bot.SendText(chatID, p.T("job.requeued", id, job.ID))
+	case queue.ErrJobNotFound:
+		return h.Bot.SendText(chatID, p.T("job.not_found", id))
+	case queue.ErrJobNotRetried:
+		return h.Bot.SendText(chatID, p.T("job.not_retried", job.ID, job.State))
+	default:
+		return h.Bot.SendText(chatID, p.T("error", err))
+	}
+}
+
+func jobStateIcon(state queue.State) string {
+	switch state {
+	case queue.StateQueued:
+		return "⏳"
+	case queue.StateRunning:
+		return "⚙️"
+	case queue.StateWaiting:
+		return "⌛"
+	case queue.StateDone:
+		return "✅"
+	case queue.StateFailed:
+		return "❌"
+	case queue.StateCancelled:
+		return "🛑"
+	default:
+		return "•"
+	}
+}
+
+// truncate shortens s to at most n runes
+func truncate(s string, n int) string {
+	s = strings.ReplaceAll(s, "\n", " ")
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	return string(runes[:n]) + "…"
+}
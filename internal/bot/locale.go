@@ -0,0 +1,90 @@
+package bot
+
+import (
+	"context"
+	"log"
+	"strings"
+
+	"github.com/applejobs/telegram-remote-controller/internal/command"
+	"github.com/applejobs/telegram-remote-controller/internal/i18n"
+	"github.com/applejobs/telegram-remote-controller/internal/prefs"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// localeOf returns the language a user picked in /settings, or the one
+// their Telegram app is set to
+func (h *MainHandler) localeOf(user *tgbotapi.User) i18n.Locale {
+	if user == nil {
+		return i18n.Default
+	}
+	if locale := h.Prefs.Get(user.ID).Language; locale != "" {
+		return locale
+	}
+	return i18n.Match(user.LanguageCode)
+}
+
+// observeLocale remembers the locale of whoever last wrote in a chat, so
+// later messages there, such as job updates, use it too
+func (h *MainHandler) observeLocale(chatID int64, user *tgbotapi.User) i18n.Printer {
+	locale := h.localeOf(user)
+	h.localeMutex.Lock()
+	h.chatLocales[chatID] = locale
+	h.localeMutex.Unlock()
+	return i18n.For(locale)
+}
+
+// localeOfQuery is observeLocale for a button press
+func (h *MainHandler) localeOfQuery(query *tgbotapi.CallbackQuery) i18n.Printer {
+	if query.Message == nil || query.Message.Chat == nil {
+		return i18n.For(h.localeOf(query.From))
+	}
+	return h.observeLocale(query.Message.Chat.ID, query.From)
+}
+
+// tr returns the printer for messages to a chat
+func (h *MainHandler) tr(chatID int64) i18n.Printer {
+	h.localeMutex.Lock()
+	locale, ok := h.chatLocales[chatID]
+	h.localeMutex.Unlock()
+	if !ok {
+		// In private chats the chat ID is the user ID
+		locale = i18n.Default
+		if picked := h.Prefs.Get(chatID).Language; picked != "" {
+			locale = picked
+		}
+	}
+	return i18n.For(locale)
+}
+
+// handleLangCommand shows or sets the user's language: /lang [zh-TW|en].
+// It is a shortcut for /settings language.
+func (h *MainHandler) handleLangCommand(ctx context.Context, msg *tgbotapi.Message, cmd *command.Command) error {
+	chatID := msg.Chat.ID
+	names := make([]string, 0, len(i18n.Locales()))
+	for _, locale := range i18n.Locales() {
+		names = append(names, string(locale))
+	}
+	if len(cmd.Args) == 0 {
+		p := h.tr(chatID)
+		return h.Bot.SendText(chatID, p.T("lang.current", p.T("lang.name"), strings.Join(names, ", ")))
+	}
+
+	if _, ok := i18n.Parse(cmd.Args[0]); !ok {
+		return h.Bot.SendText(chatID, h.tr(chatID).T("lang.unknown", cmd.Args[0], strings.Join(names, ", ")))
+	}
+	if _, err := h.setPreference(chatID, msg.From, prefs.KeyLanguage, cmd.Args[0]); err != nil {
+		log.Printf("Failed to save language for user %d: %v", msg.From.ID, err)
+	}
+	p := h.tr(chatID)
+	return h.Bot.SendText(chatID, p.T("lang.set", p.T("lang.name")))
+}
+
+// languageChanged shows the command menu of a chat in the user's new language
+func (h *MainHandler) languageChanged(chatID int64, user *tgbotapi.User) {
+	p := h.observeLocale(chatID, user)
+	if publisher, ok := h.Bot.(CommandPublisher); ok {
+		if err := publisher.SetCommands(chatID, "", h.Commands.Menu(h.roleOf(user.ID), p)); err != nil {
+			log.Printf("Failed to set the command menu for chat %d: %v", chatID, err)
+		}
+	}
+}
@@ -0,0 +1,34 @@
+package bot
+
+import (
+	"github.com/applejobs/telegram-remote-controller/internal/command"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Messenger sends and edits chat messages. MainHandler talks to the chat
+// only through it; *Bot implements it on top of the Telegram Bot API.
+type Messenger interface {
+	SendText(chatID int64, text string) error
+	SendReply(chatID int64, replyTo int, text string) (int, error)
+	SendHTML(chatID int64, replyTo int, html, plain string) (int, error)
+	SendKeyboard(chatID int64, replyTo int, text string, keyboard tgbotapi.InlineKeyboardMarkup) (int, error)
+	SendPhoto(chatID int64, photoPath string) error
+	SendDocument(chatID int64, replyTo int, name string, data []byte, caption string) (int, error)
+	EditText(chatID int64, messageID int, text string) error
+	EditHTML(chatID int64, messageID int, html, plain string) error
+	EditKeyboard(chatID int64, messageID int, text string, keyboard tgbotapi.InlineKeyboardMarkup) error
+	SetKeyboard(chatID int64, messageID int, keyboard tgbotapi.InlineKeyboardMarkup) error
+	AnswerCallback(queryID string, text string) error
+}
+
+var _ Messenger = (*Bot)(nil)
+
+// CommandPublisher sets the command menu Telegram shows; a Messenger may
+// implement it
+type CommandPublisher interface {
+	// SetCommands sets the menu of a chat, or of all chats when chatID is
+	// 0, for users of a language, or for every language when it is empty
+	SetCommands(chatID int64, languageCode string, menu []command.MenuEntry) error
+}
+
+var _ CommandPublisher = (*Bot)(nil)
@@ -0,0 +1,147 @@
+package bot
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/applejobs/telegram-remote-controller/internal/outbox"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// DefaultOutboxPath is where undelivered messages are kept across restarts
+const DefaultOutboxPath = "/Users/applejobs/.gemini/antigravity/scratch/telegram-agent-controller/state/outbox.json"
+
+// EnableOutbox routes outgoing messages through an outbox kept at path,
+// which rate limits them, retries temporary failures and delivers what is
+// left over after a restart. Call it before Start.
+func (b *Bot) EnableOutbox(path string, opts outbox.Options) error {
+	ob, err := outbox.Open(path, b.execute, opts)
+	if err != nil {
+		return err
+	}
+	b.outbox = ob
+	return nil
+}
+
+// CloseOutbox stops delivery; undelivered messages stay on disk for the next start
+func (b *Bot) CloseOutbox() {
+	if b.outbox != nil {
+		b.outbox.Close()
+	}
+}
+
+// send performs a request through the outbox if there is one, or right away.
+// A request the outbox keeps queued is not a failure: it is delivered later,
+// and the placeholder ID returned for it can be edited or replied to.
+func (b *Bot) send(req outbox.Request) (int, error) {
+	if b.outbox != nil {
+		id, err := b.outbox.Do(req)
+		if errors.Is(err, outbox.ErrQueued) {
+			return id, nil
+		}
+		return id, err
+	}
+	id, err := b.execute(req)
+	var temp *outbox.TemporaryError
+	if errors.As(err, &temp) {
+		return id, temp.Err
+	}
+	return id, err
+}
+
+// execute performs one request against the Bot API and returns the ID of
+// the message it sent or edited. Failures worth retrying are returned as
+// *outbox.TemporaryError.
+func (b *Bot) execute(req outbox.Request) (int, error) {
+	api := b.client()
+	params := tgbotapi.Params(req.Params)
+
+	var resp *tgbotapi.APIResponse
+	var err error
+	if f := req.File; f != nil {
+		var data tgbotapi.RequestFileData = tgbotapi.FileBytes{Name: f.Name, Bytes: f.Data}
+		if f.Path != "" {
+			if _, err := os.Stat(f.Path); err != nil {
+				return 0, fmt.Errorf("cannot upload %s: %w", f.Path, err)
+			}
+			data = tgbotapi.FilePath(f.Path)
+		}
+		resp, err = api.UploadFiles(req.Method, params, []tgbotapi.RequestFile{{Name: f.Field, Data: data}})
+	} else {
+		resp, err = api.MakeRequest(req.Method, params)
+	}
+	if err != nil {
+		return 0, classify(err)
+	}
+
+	// Most methods return the message; some only return true
+	var sent tgbotapi.Message
+	if json.Unmarshal(resp.Result, &sent) == nil {
+		return sent.MessageID, nil
+	}
+	return 0, nil
+}
+
+// classify marks rate limiting, server errors and network failures as
+// temporary; other API errors, such as a bad request, are final
+func classify(err error) error {
+	var apiErr *tgbotapi.Error
+	if !errors.As(err, &apiErr) {
+		return &outbox.TemporaryError{Err: err}
+	}
+	if apiErr.RetryAfter > 0 || apiErr.Code == 429 {
+		return &outbox.TemporaryError{Err: err, RetryAfter: time.Duration(apiErr.RetryAfter) * time.Second}
+	}
+	if apiErr.Code >= 500 {
+		return &outbox.TemporaryError{Err: err}
+	}
+	return err
+}
+
+// message builds a sendMessage request
+func message(chatID int64, replyTo int, text, parseMode string) outbox.Request {
+	params := map[string]string{
+		"chat_id": strconv.FormatInt(chatID, 10),
+		"text":    text,
+	}
+	if parseMode != "" {
+		params["parse_mode"] = parseMode
+	}
+	if replyTo != 0 {
+		params["reply_to_message_id"] = strconv.Itoa(replyTo)
+		params["allow_sending_without_reply"] = "true"
+	}
+	return outbox.Request{ChatID: chatID, Method: "sendMessage", Params: params}
+}
+
+// editText builds an editMessageText request
+func editText(chatID int64, messageID int, text, parseMode string) outbox.Request {
+	params := map[string]string{
+		"chat_id":    strconv.FormatInt(chatID, 10),
+		"message_id": strconv.Itoa(messageID),
+		"text":       text,
+	}
+	if parseMode != "" {
+		params["parse_mode"] = parseMode
+	}
+	return outbox.Request{ChatID: chatID, Method: "editMessageText", Params: params}
+}
+
+// withKeyboard attaches an inline keyboard to a request
+func withKeyboard(req outbox.Request, keyboard tgbotapi.InlineKeyboardMarkup) outbox.Request {
+	if keyboard.InlineKeyboard == nil {
+		keyboard.InlineKeyboard = [][]tgbotapi.InlineKeyboardButton{}
+	}
+	data, err := json.Marshal(keyboard)
+	if err != nil {
+		log.Printf("Failed to encode keyboard: %v", err)
+		return req
+	}
+	req.Params["reply_markup"] = string(data)
+	return req
+}
@@ -0,0 +1,239 @@
+package bot
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+const (
+	// pollTimeout is the long-poll timeout passed to getUpdates, in seconds
+	pollTimeout = 60
+
+	// DefaultStallTimeout is how long polling may hang before reconnecting
+	DefaultStallTimeout = 3 * time.Minute
+)
+
+// ConnectionStatus describes the bot's link to Telegram
+type ConnectionStatus struct {
+	Mode       string    // "polling" or "webhook"
+	LastPoll   time.Time // Last completed getUpdates, or last webhook update
+	Reconnects int       // Times the API client was re-created
+	LastError  string    // Latest polling error, cleared once polling works again
+	Unsent     int       // Outgoing messages waiting in the outbox
+}
+
+// StatusReporter exposes the connection status, e.g. for /status
+type StatusReporter interface {
+	Status() ConnectionStatus
+}
+
+// ReconnectEvent describes how the bot recovered from an outage
+type ReconnectEvent struct {
+	Reason    string        // The first error or stall of the outage
+	Downtime  time.Duration // How long updates could not be received
+	Recreated bool          // The API client was re-created
+}
+
+// ConnectionObserver is told when the bot recovers from an outage.
+// A MessageHandler may implement it, e.g. to notify the admin chat.
+type ConnectionObserver interface {
+	OnReconnect(event ReconnectEvent)
+}
+
+// Status returns the current connection status
+func (b *Bot) Status() ConnectionStatus {
+	b.mu.RLock()
+	status := b.status
+	b.mu.RUnlock()
+	if b.outbox != nil {
+		status.Unsent = b.outbox.Pending()
+	}
+	return status
+}
+
+// outage tracks a period in which polling failed
+type outage struct {
+	start     time.Time
+	reason    string
+	recreated bool
+}
+
+// pollResult is the outcome of one getUpdates round trip
+type pollResult struct {
+	updates []tgbotapi.Update
+	err     error
+}
+
+// Start polls for updates until ctx is done. Errors back off exponentially.
+// If no getUpdates round trip completes within StallTimeout, e.g. after the
+// machine slept and its connections went dead, the API client is re-created.
+func (b *Bot) Start(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	b.mu.Lock()
+	b.stop = cancel
+	b.status.Mode = "polling"
+	b.mu.Unlock()
+
+	// Polling does not work while a webhook is registered
+	if _, err := b.client().Request(tgbotapi.DeleteWebhookConfig{}); err != nil {
+		log.Printf("Failed to delete webhook: %v", err)
+	}
+
+	offset := 0
+	if b.Updates != nil {
+		offset = b.Updates.Offset()
+		log.Printf("Resuming updates from offset %d", offset)
+	}
+	backoff := b.minBackoff
+	healthy := time.Now() // Last successful poll or reconnect
+	var down *outage
+
+	for {
+		// While recovering, poll without waiting so recovery shows at once
+		timeout := b.longPollTimeout()
+		if down != nil {
+			timeout = 0
+		}
+
+		started := time.Now()
+		results := make(chan pollResult, 1)
+		go func(api *tgbotapi.BotAPI, offset int) {
+			config := tgbotapi.NewUpdate(offset)
+			config.Timeout = timeout
+			updates, err := api.GetUpdates(config)
+			results <- pollResult{updates, err}
+		}(b.client(), offset)
+
+		stall := time.NewTimer(b.StallTimeout)
+		select {
+		case <-ctx.Done():
+			stall.Stop()
+			log.Println("Bot stopping...")
+			b.dispatch().Wait()
+			return nil
+
+		case <-stall.C:
+			// The request hangs; its result is dropped if it ever arrives
+			down = b.failed(down, started, fmt.Sprintf("getUpdates stalled for %v", b.StallTimeout))
+			b.reconnect(down)
+			healthy = time.Now()
+
+		case result := <-results:
+			stall.Stop()
+			if result.err != nil {
+				down = b.failed(down, started, result.err.Error())
+				if time.Since(healthy) >= b.StallTimeout {
+					b.reconnect(down)
+					healthy = time.Now()
+				}
+				if !sleepContext(ctx, backoff) {
+					b.dispatch().Wait()
+					return nil
+				}
+				backoff = min(backoff*2, b.maxBackoff)
+				continue
+			}
+
+			healthy = time.Now()
+			backoff = b.minBackoff
+			b.markReceived()
+			if down != nil {
+				b.recovered(down)
+				down = nil
+			}
+
+			for _, update := range result.updates {
+				if update.UpdateID < offset {
+					continue
+				}
+				offset = update.UpdateID + 1
+				b.handleUpdate(ctx, update)
+			}
+		}
+	}
+}
+
+// longPollTimeout is the getUpdates timeout in seconds, kept well within
+// StallTimeout so that an idle long poll does not look like a stall
+func (b *Bot) longPollTimeout() int {
+	return min(pollTimeout, int(b.StallTimeout/2/time.Second))
+}
+
+// failed records a polling failure, starting an outage if there is none
+func (b *Bot) failed(down *outage, started time.Time, reason string) *outage {
+	log.Printf("Polling failed: %s", reason)
+	b.mu.Lock()
+	b.status.LastError = reason
+	b.mu.Unlock()
+
+	if down == nil {
+		down = &outage{start: started, reason: reason}
+	}
+	return down
+}
+
+// reconnect replaces the API client, dropping its dead connections
+func (b *Bot) reconnect(down *outage) {
+	api, err := tgbotapi.NewBotAPIWithClient(b.token, b.endpoint, newHTTPClient())
+	if err != nil {
+		log.Printf("Failed to re-create API client: %v", err)
+		return
+	}
+
+	b.mu.Lock()
+	old := b.api
+	b.api = api
+	b.status.Reconnects++
+	b.mu.Unlock()
+
+	if client, ok := old.Client.(*http.Client); ok {
+		client.CloseIdleConnections()
+	}
+	down.recreated = true
+	log.Println("Re-created Telegram API client")
+}
+
+// recovered reports the end of an outage if it was long or needed a reconnect
+func (b *Bot) recovered(down *outage) {
+	event := ReconnectEvent{Reason: down.reason, Downtime: time.Since(down.start), Recreated: down.recreated}
+	log.Printf("Polling recovered after %v", event.Downtime.Round(time.Second))
+
+	if !event.Recreated && event.Downtime < b.reportAfter {
+		return
+	}
+	if observer, ok := b.handler.(ConnectionObserver); ok {
+		observer.OnReconnect(event)
+	}
+}
+
+// markReceived records that updates are flowing
+func (b *Bot) markReceived() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.status.LastPoll = time.Now()
+	b.status.LastError = ""
+}
+
+// newHTTPClient creates the HTTP client for the Bot API. Its timeout
+// outlasts a long poll, so a dead connection fails instead of hanging.
+func newHTTPClient() *http.Client {
+	return &http.Client{Timeout: pollTimeout*time.Second + 30*time.Second}
+}
+
+// sleepContext waits for d, returning false if ctx ends first
+func sleepContext(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
@@ -0,0 +1,202 @@
+package bot
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/applejobs/telegram-remote-controller/internal/telegramtest"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// observingHandler records messages and reconnect reports
+type observingHandler struct {
+	messages   chan *tgbotapi.Message
+	reconnects chan ReconnectEvent
+}
+
+func newObservingHandler() *observingHandler {
+	return &observingHandler{
+		messages:   make(chan *tgbotapi.Message, 10),
+		reconnects: make(chan ReconnectEvent, 10),
+	}
+}
+
+func (o *observingHandler) HandleMessage(ctx context.Context, msg *tgbotapi.Message) error {
+	o.messages <- msg
+	return nil
+}
+
+func (o *observingHandler) OnReconnect(event ReconnectEvent) {
+	o.reconnects <- event
+}
+
+// startTestPoller runs a polling bot with short timings against srv
+func startTestPoller(t *testing.T, srv *telegramtest.Server, handler MessageHandler) *Bot {
+	b, err := NewWithEndpoint(telegramtest.Token, srv.Endpoint(), handler)
+	if err != nil {
+		t.Fatalf("NewWithEndpoint failed: %v", err)
+	}
+	b.minBackoff = 10 * time.Millisecond
+	b.maxBackoff = 50 * time.Millisecond
+	b.reportAfter = 0
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go b.Start(ctx)
+	return b
+}
+
+func TestPollingBacksOffAndRecovers(t *testing.T) {
+	srv := telegramtest.NewServer()
+	defer srv.Close()
+	handler := newObservingHandler()
+
+	srv.FailNext("getUpdates", 502, "Bad Gateway")
+	srv.FailNext("getUpdates", 502, "Bad Gateway")
+	b := startTestPoller(t, srv, handler)
+
+	select {
+	case event := <-handler.reconnects:
+		if !strings.Contains(event.Reason, "Bad Gateway") || event.Recreated {
+			t.Errorf("Unexpected reconnect event: %+v", event)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Recovery was not reported")
+	}
+
+	srv.PushMessage(1, 1, "hello")
+	select {
+	case <-handler.messages:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Updates should flow after recovery")
+	}
+
+	status := b.Status()
+	if status.Mode != "polling" || status.LastPoll.IsZero() || status.LastError != "" {
+		t.Errorf("Unexpected status: %+v", status)
+	}
+}
+
+func TestPollingRecreatesClientOnStall(t *testing.T) {
+	srv := telegramtest.NewServer()
+	defer srv.Close()
+	handler := newObservingHandler()
+
+	srv.DelayNext("getUpdates", 10*time.Second)
+	b, err := NewWithEndpoint(telegramtest.Token, srv.Endpoint(), handler)
+	if err != nil {
+		t.Fatalf("NewWithEndpoint failed: %v", err)
+	}
+	b.StallTimeout = 2500 * time.Millisecond
+	b.reportAfter = 0
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go b.Start(ctx)
+
+	select {
+	case event := <-handler.reconnects:
+		if !event.Recreated {
+			t.Errorf("Expected the client to be re-created, got %+v", event)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Stall was not detected")
+	}
+
+	srv.PushMessage(1, 1, "after stall")
+	select {
+	case msg := <-handler.messages:
+		if msg.Text != "after stall" {
+			t.Errorf("Unexpected message: %q", msg.Text)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Updates should flow after reconnecting")
+	}
+	if b.Status().Reconnects < 1 {
+		t.Errorf("Expected a reconnect to be counted, got %+v", b.Status())
+	}
+}
+
+func TestPollingDeliversUpdatesOnce(t *testing.T) {
+	srv := telegramtest.NewServer()
+	defer srv.Close()
+	handler := newObservingHandler()
+	startTestPoller(t, srv, handler)
+
+	srv.PushMessage(1, 1, "one")
+	srv.PushMessage(1, 1, "two")
+	for _, want := range []string{"one", "two"} {
+		select {
+		case msg := <-handler.messages:
+			if msg.Text != want {
+				t.Errorf("Expected %q, got %q", want, msg.Text)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("Did not receive %q", want)
+		}
+	}
+
+	select {
+	case msg := <-handler.messages:
+		t.Errorf("Update delivered twice: %q", msg.Text)
+	case <-time.After(200 * time.Millisecond):
+	}
+}
+
+func TestPollingResumesFromPersistedOffset(t *testing.T) {
+	srv := telegramtest.NewServer()
+	defer srv.Close()
+	path := filepath.Join(t.TempDir(), "updates.json")
+
+	// run polls with a fresh bot on the log at path until one message arrives or timeout
+	run := func(timeout time.Duration) *tgbotapi.Message {
+		updates, err := OpenUpdateLog(path, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		handler := newObservingHandler()
+		b, err := NewWithEndpoint(telegramtest.Token, srv.Endpoint(), handler)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b.Updates = updates
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go b.Start(ctx)
+		select {
+		case msg := <-handler.messages:
+			return msg
+		case <-time.After(timeout):
+			return nil
+		}
+	}
+
+	srv.PushMessage(1, 1, "/run once")
+	if msg := run(2 * time.Second); msg == nil {
+		t.Fatal("First run should handle the update")
+	}
+
+	// The fake server still holds the update; a restarted bot must not replay it
+	if msg := run(300 * time.Millisecond); msg != nil {
+		t.Errorf("Handled update replayed after restart: %q", msg.Text)
+	}
+}
+
+func TestHandleUpdateSkipsDuplicates(t *testing.T) {
+	updates, _ := OpenUpdateLog(filepath.Join(t.TempDir(), "updates.json"), 10)
+	handler := newObservingHandler()
+	b := &Bot{handler: handler, Updates: updates}
+
+	update := tgbotapi.Update{UpdateID: 9, Message: &tgbotapi.Message{Text: "/run x", From: &tgbotapi.User{}}}
+	b.handleUpdate(context.Background(), update)
+	b.handleUpdate(context.Background(), update)
+	b.dispatch().Wait()
+
+	if len(handler.messages) != 1 {
+		t.Errorf("Expected the update to be handled once, got %d", len(handler.messages))
+	}
+}
@@ -0,0 +1,230 @@
+package bot
+
+import (
+	"log"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/applejobs/telegram-remote-controller/internal/chunk"
+	"github.com/applejobs/telegram-remote-controller/internal/controller"
+	"github.com/applejobs/telegram-remote-controller/internal/i18n"
+	"github.com/applejobs/telegram-remote-controller/internal/prefs"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// responseTarget is where a response file is delivered
+type responseTarget struct {
+	chatID  int64
+	replyTo int
+	header  string
+	jobID   string      // Empty when the file matches no run
+	app     string      // Offered for a screenshot
+	prefs   prefs.Prefs // Of the user who started the run
+}
+
+// resolveResponse finds the chat that started the run a response belongs to,
+// falling back to the admin chat. Returns the body without front matter.
+func (h *MainHandler) resolveResponse(path, content string) (responseTarget, string, bool) {
+	runID, body := controller.MatchRun(path, content)
+
+	if job, ok := h.Queue.Get(runID); ok {
+		return responseTarget{
+			chatID:  job.ChatID,
+			replyTo: job.MessageID,
+			header:  h.tr(job.ChatID).T("response.header", job.ID) + "\n\n",
+			jobID:   job.ID,
+			app:     h.screenshotApp(job.UserID, job.App),
+			prefs:   h.Prefs.Get(job.UserID),
+		}, body, true
+	}
+
+	if h.AdminChatID == 0 {
+		log.Printf("No run matches %s and no admin chat is configured", path)
+		return responseTarget{}, "", false
+	}
+	// The admin chat is the admin's private chat, so its ID is theirs
+	return responseTarget{
+		chatID: h.AdminChatID,
+		header: h.tr(h.AdminChatID).T("response.unmatched", filepath.Base(path)) + "\n\n",
+		app:    h.screenshotApp(h.AdminChatID, ""),
+		prefs:  h.Prefs.Get(h.AdminChatID),
+	}, body, true
+}
+
+// handleResponseFile streams a growing response file and delivers it once complete
+func (h *MainHandler) handleResponseFile(file controller.ResponseFile) {
+	// Front matter may still be incomplete, so the run is not known yet
+	if file.Partial && strings.HasPrefix(file.Content, "---") {
+		if _, _, closed := strings.Cut(strings.TrimPrefix(file.Content, "---"), "\n---"); !closed {
+			return
+		}
+	}
+
+	target, body, ok := h.resolveResponse(file.Path, file.Content)
+	if !ok {
+		return
+	}
+	body = h.Watcher.FormatResponseForTelegram(body)
+	p := h.tr(target.chatID)
+
+	// Users who prefer chunks get every response as messages
+	long := chunk.UTF16Len(body) > h.DocumentThreshold && target.prefs.LongResponse != prefs.LongChunk
+	stream := h.streams[file.Path]
+	if file.Partial {
+		if long {
+			// Too long to follow live; it will arrive as a document
+			if stream != nil && !stream.stopped {
+				stream.Stop("\n\n" + p.T("response.too_long_to_stream"))
+			}
+			return
+		}
+		if stream == nil {
+			log.Printf("Streaming growing response %s to chat %d", file.Path, target.chatID)
+			stream = newResponseStream(h.Bot, target.chatID, target.replyTo, target.header, p.T("response.writing"))
+			h.streams[file.Path] = stream
+		}
+		if err := stream.Update(body, false); err != nil {
+			log.Printf("Failed to stream response %s: %v", file.Path, err)
+		}
+		return
+	}
+	delete(h.streams, file.Path)
+	h.rememberResponse(target.chatID, body)
+
+	if target.jobID != "" {
+		if _, completed := h.Queue.Complete(target.jobID); completed {
+			log.Printf("Response %s completes job %s", file.Path, target.jobID)
+		}
+	}
+
+	if long {
+		// A live stream of the shorter partial response gives way to the document
+		if stream != nil && !stream.stopped {
+			if err := stream.Stop("\n\n" + p.T("response.too_long_to_stream")); err != nil {
+				log.Printf("Failed to stop streaming %s: %v", file.Path, err)
+			}
+		}
+		if err := h.sendLong(target, documentName(file.Path, target.jobID), body); err != nil {
+			log.Printf("Failed to send long response %s: %v", file.Path, err)
+		}
+		return
+	}
+
+	// Finalize the streamed messages, or send the whole response in chunks
+	if stream == nil {
+		stream = newResponseStream(h.Bot, target.chatID, target.replyTo, target.header, p.T("response.writing"))
+	}
+	if err := stream.Update(body, true); err != nil {
+		log.Printf("Failed to send response %s: %v", file.Path, err)
+		return
+	}
+	log.Printf("Sent response %s to chat %d in %d message(s)", file.Path, target.chatID, len(stream.messages))
+
+	// Offer follow-up actions under the last part
+	if keyboard := h.keyboard(p, responseButtons(target.jobID, target.app)); keyboard != nil && len(stream.messages) > 0 {
+		if err := h.Bot.SetKeyboard(target.chatID, stream.messages[len(stream.messages)-1], *keyboard); err != nil {
+			log.Printf("Failed to add response buttons: %v", err)
+		}
+	}
+}
+
+// maxFullTexts bounds how many long responses are kept for expansion
+const maxFullTexts = 50
+
+// fullText is a long response kept for the "show full text" button
+type fullText struct {
+	chatID  int64
+	replyTo int
+	header  string
+	body    string
+}
+
+// sendLong sends a long response as a .md attachment, unless the user
+// prefers a summary, followed by a short preview with a button that expands
+// it into chunked messages
+func (h *MainHandler) sendLong(target responseTarget, name, body string) error {
+	p := h.tr(target.chatID)
+	note := p.N("response.summarized", len([]rune(body)))
+	if target.prefs.LongResponse != prefs.LongSummary {
+		caption := strings.TrimSpace(target.header)
+		if _, err := h.Bot.SendDocument(target.chatID, target.replyTo, name, []byte(body), caption); err != nil {
+			return err
+		}
+		note = p.N("response.attached", len([]rune(body)))
+	}
+
+	key := h.keepFullText(fullText{chatID: target.chatID, replyTo: target.replyTo, header: target.header, body: body})
+	keyboard := h.keyboard(p,
+		[]callbackButton{{"button.full_text", callbackFullText, key}},
+		responseButtons(target.jobID, target.app),
+	)
+
+	preview := target.header + note + "\n\n" + h.previewText(p, body)
+	if keyboard == nil {
+		_, err := h.Bot.SendReply(target.chatID, target.replyTo, preview)
+		return err
+	}
+	_, err := h.Bot.SendKeyboard(target.chatID, target.replyTo, preview, *keyboard)
+	return err
+}
+
+// previewText summarizes a long response with Gemini when available,
+// otherwise returns its first lines
+func (h *MainHandler) previewText(p i18n.Printer, body string) string {
+	if h.Gemini != nil && h.Gemini.IsAvailable() {
+		summary, err := h.Gemini.Summarize(body, 500)
+		if err == nil && strings.TrimSpace(summary) != "" {
+			return p.T("response.summary") + "\n" + strings.TrimSpace(summary)
+		}
+		log.Printf("Summarize failed, falling back to first lines: %v", err)
+	}
+
+	lines := strings.Split(body, "\n")
+	if len(lines) <= h.PreviewLines {
+		return body
+	}
+	return strings.Join(lines[:h.PreviewLines], "\n") + "\n…"
+}
+
+// keepFullText stores a long response and returns its key, evicting the oldest
+func (h *MainHandler) keepFullText(text fullText) string {
+	h.fullMutex.Lock()
+	defer h.fullMutex.Unlock()
+
+	key := strconv.FormatInt(time.Now().UnixNano(), 36)
+	h.fullTexts[key] = text
+	h.fullOrder = append(h.fullOrder, key)
+	if len(h.fullOrder) > maxFullTexts {
+		delete(h.fullTexts, h.fullOrder[0])
+		h.fullOrder = h.fullOrder[1:]
+	}
+	return key
+}
+
+// handleShowFullText expands a long response into chunked messages
+func (h *MainHandler) handleShowFullText(query *tgbotapi.CallbackQuery, key string) error {
+	h.fullMutex.Lock()
+	text, ok := h.fullTexts[key]
+	h.fullMutex.Unlock()
+
+	if !ok {
+		return h.Bot.AnswerCallback(query.ID, h.tr(query.Message.Chat.ID).T("response.full_text_expired"))
+	}
+	if err := h.Bot.AnswerCallback(query.ID, ""); err != nil {
+		log.Printf("Failed to answer callback: %v", err)
+	}
+
+	stream := newResponseStream(h.Bot, text.chatID, text.replyTo, text.header, h.tr(text.chatID).T("response.writing"))
+	return stream.Update(text.body, true)
+}
+
+// documentName names the attachment after the run, or after the response file
+func documentName(path, jobID string) string {
+	if jobID != "" {
+		return jobID + ".md"
+	}
+	base := filepath.Base(path)
+	return strings.TrimSuffix(base, filepath.Ext(base)) + ".md"
+}
@@ -0,0 +1,58 @@
+package bot
+
+import (
+	"strings"
+
+	"github.com/applejobs/telegram-remote-controller/internal/i18n"
+	"github.com/applejobs/telegram-remote-controller/internal/router"
+)
+
+// reasonMessages holds the message describing each kind of routing reason
+var reasonMessages = map[router.ReasonKind]string{
+	router.ReasonKeywords:  "route.reason.keywords",
+	router.ReasonPattern:   "route.reason.pattern",
+	router.ReasonMinLength: "route.reason.min_length",
+	router.ReasonMaxLength: "route.reason.max_length",
+	router.ReasonChat:      "route.reason.chat",
+	router.ReasonHours:     "route.reason.hours",
+	router.ReasonCheapest:  "route.reason.cheapest",
+}
+
+// route picks the model for a prompt sent without -m, falling back to the
+// user's default model when no rule matches
+func (h *MainHandler) route(chatID, userID int64, prompt string) router.Decision {
+	current := h.Prefs.Get(userID)
+	return h.Router.Route(router.Input{Prompt: prompt, ChatID: chatID, Time: current.Now(), Default: current.Model})
+}
+
+// explainRoute describes a routing decision, e.g.
+// "routed to Gemini 3 Pro because: coding (keywords: bug, test)"
+func explainRoute(p i18n.Printer, d router.Decision) string {
+	if d.Rule == "" {
+		return p.T("route.because", d.Model, p.T("route.no_rule"))
+	}
+	why := d.Rule
+	if len(d.Reasons) > 0 {
+		reasons := make([]string, len(d.Reasons))
+		for i, reason := range d.Reasons {
+			reasons[i] = p.T(reasonMessages[reason.Kind], reason.Args...)
+		}
+		why += " (" + strings.Join(reasons, "; ") + ")"
+	}
+	return p.T("route.because", d.Model, why)
+}
+
+// handleRoute shows which model a prompt would go to, without running it
+func (h *MainHandler) handleRoute(chatID, userID int64, prompt string) error {
+	p := h.tr(chatID)
+	d := h.route(chatID, userID, prompt)
+
+	text := p.T("route.result", d.Model, explainRoute(p, d))
+	if d.Cost > 0 {
+		text += "\n" + p.N("route.cost", d.Tokens, d.Cost, d.Tokens)
+	} else {
+		text += "\n" + p.N("route.tokens", d.Tokens)
+	}
+	text += "\n\n" + p.T("route.dry_run")
+	return h.Bot.SendText(chatID, text)
+}
@@ -0,0 +1,295 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/applejobs/telegram-remote-controller/internal/catalog"
+	"github.com/applejobs/telegram-remote-controller/internal/command"
+	"github.com/applejobs/telegram-remote-controller/internal/i18n"
+	"github.com/applejobs/telegram-remote-controller/internal/prefs"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// commonTimezones are offered as buttons; others can be typed with
+// /settings timezone <zone>
+var commonTimezones = []string{
+	"UTC",
+	"Asia/Taipei",
+	"Asia/Tokyo",
+	"Europe/London",
+	"Europe/Berlin",
+	"America/New_York",
+	"America/Los_Angeles",
+}
+
+// settingChoice is one button in the list of values for a setting
+type settingChoice struct {
+	label string
+	value string // Sent back in the callback; model and app choices use an alias to fit
+}
+
+// handleSettings shows the settings with buttons to change them, or sets
+// one: /settings <key> [value]
+func (h *MainHandler) handleSettings(ctx context.Context, msg *tgbotapi.Message, cmd *command.Command) error {
+	chatID := msg.Chat.ID
+	p := h.tr(chatID)
+	if len(cmd.Args) == 0 {
+		text, keyboard := h.settingsMenu(p, h.Prefs.Get(msg.From.ID))
+		if keyboard == nil {
+			return h.Bot.SendText(chatID, text)
+		}
+		_, err := h.Bot.SendKeyboard(chatID, msg.MessageID, text, *keyboard)
+		return err
+	}
+
+	key := prefs.Key(strings.ToLower(cmd.Args[0]))
+	updated, err := h.setPreference(chatID, msg.From, key, cmd.Prompt)
+	if err != nil {
+		return h.Bot.SendText(chatID, p.T("error", err))
+	}
+	p = h.tr(chatID)
+	return h.Bot.SendText(chatID, p.T("settings.updated", p.T("settings.line", settingLabel(p, key), h.settingValue(p, key, updated))))
+}
+
+// setPreference changes a user's setting, expanding model and app aliases.
+// The chat switches language at once when that is what changed.
+func (h *MainHandler) setPreference(chatID int64, user *tgbotapi.User, key prefs.Key, value string) (prefs.Prefs, error) {
+	value = strings.TrimSpace(value)
+	if value != "" {
+		switch key {
+		case prefs.KeyModel:
+			name, err := h.Catalog.Model(value)
+			if err != nil {
+				return prefs.Prefs{}, err
+			}
+			value = name
+		case prefs.KeyIDE:
+			profile, err := h.Profiles.Get(value)
+			if err != nil {
+				return prefs.Prefs{}, err
+			}
+			value = profile.Name
+		case prefs.KeyApp:
+			value = h.Catalog.App(value)
+		}
+	}
+
+	updated, err := h.Prefs.Set(user.ID, key, value)
+	if errors.Is(err, prefs.ErrUnknownKey) || errors.Is(err, prefs.ErrInvalidValue) {
+		return updated, err
+	}
+	if err != nil {
+		// Changed, but only until the bot restarts
+		log.Printf("Failed to save settings of user %d: %v", user.ID, err)
+	}
+	log.Printf("User %d set %s to %q", user.ID, key, value)
+
+	if key == prefs.KeyLanguage {
+		h.languageChanged(chatID, user)
+	}
+	return updated, nil
+}
+
+// settingsMenu describes a user's settings, with a button for each
+func (h *MainHandler) settingsMenu(p i18n.Printer, current prefs.Prefs) (string, *tgbotapi.InlineKeyboardMarkup) {
+	var sb strings.Builder
+	sb.WriteString(p.T("settings.title") + "\n")
+	for _, key := range prefs.Keys {
+		sb.WriteString("\n" + p.T("settings.line", settingLabel(p, key), h.settingValue(p, key, current)))
+	}
+	sb.WriteString("\n\n" + p.T("settings.hint"))
+
+	var rows [][]tgbotapi.InlineKeyboardButton
+	var row []tgbotapi.InlineKeyboardButton
+	for _, key := range prefs.Keys {
+		button, ok := h.button(settingLabel(p, key), callbackSettings, string(key))
+		if !ok {
+			continue
+		}
+		if row = append(row, button); len(row) == 2 {
+			rows = append(rows, row)
+			row = nil
+		}
+	}
+	if len(row) > 0 {
+		rows = append(rows, row)
+	}
+	return sb.String(), inlineKeyboard(rows)
+}
+
+// choiceMenu lists the values of one setting, marking the current one
+func (h *MainHandler) choiceMenu(p i18n.Printer, key prefs.Key, current prefs.Prefs) (string, *tgbotapi.InlineKeyboardMarkup) {
+	text := p.T("settings.choose", settingLabel(p, key))
+	if key == prefs.KeyTimezone {
+		text += "\n" + p.T("settings.timezone_hint")
+	}
+
+	var rows [][]tgbotapi.InlineKeyboardButton
+	for _, choice := range h.settingChoices(p, key) {
+		label := choice.label
+		if choice.value == current.Value(key) || choice.label == current.Value(key) {
+			label = "✓ " + label
+		}
+		if button, ok := h.button(label, callbackSetPref, string(key)+"="+choice.value); ok {
+			rows = append(rows, []tgbotapi.InlineKeyboardButton{button})
+		}
+	}
+	if button, ok := h.button(p.T("button.back"), callbackSettings, ""); ok {
+		rows = append(rows, []tgbotapi.InlineKeyboardButton{button})
+	}
+	return text, inlineKeyboard(rows)
+}
+
+// settingChoices are the values offered as buttons for a setting; the first
+// restores the default
+func (h *MainHandler) settingChoices(p i18n.Printer, key prefs.Key) []settingChoice {
+	if values, ok := prefs.Choices[key]; ok {
+		// These always have a value, so the default is one of the choices
+		choices := make([]settingChoice, len(values))
+		for i, value := range values {
+			choices[i] = settingChoice{label: p.T("settings." + string(key) + "." + value), value: value}
+		}
+		return choices
+	}
+
+	choices := []settingChoice{{label: h.settingValue(p, key, prefs.Prefs{}), value: ""}}
+	switch key {
+	case prefs.KeyModel:
+		choices = append(choices, h.aliasChoices(catalog.KindModel)...)
+	case prefs.KeyIDE:
+		for _, profile := range h.Profiles.List() {
+			choices = append(choices, settingChoice{label: p.T("ide.entry", profile.Name, profile.App), value: profile.Name})
+		}
+	case prefs.KeyApp:
+		choices = append(choices, h.aliasChoices(catalog.KindApp)...)
+	case prefs.KeyLanguage:
+		for _, locale := range i18n.Locales() {
+			choices = append(choices, settingChoice{label: i18n.For(locale).T("lang.name"), value: string(locale)})
+		}
+	case prefs.KeyTimezone:
+		for _, zone := range commonTimezones {
+			choices = append(choices, settingChoice{label: zone, value: zone})
+		}
+	}
+	return choices
+}
+
+// aliasChoices offers each model or app once, by its first alias
+func (h *MainHandler) aliasChoices(kind catalog.Kind) []settingChoice {
+	var choices []settingChoice
+	entries := h.Catalog.List(kind)
+	for i, entry := range entries {
+		if i > 0 && entries[i-1].Name == entry.Name {
+			continue
+		}
+		choices = append(choices, settingChoice{label: entry.Name, value: entry.Alias})
+	}
+	return choices
+}
+
+// settingLabel names a setting, e.g. "🎯 Model"
+func settingLabel(p i18n.Printer, key prefs.Key) string {
+	return p.T("settings.key." + string(key))
+}
+
+// settingValue describes the value of a setting
+func (h *MainHandler) settingValue(p i18n.Printer, key prefs.Key, current prefs.Prefs) string {
+	value := current.Value(key)
+	switch key {
+	case prefs.KeyModel:
+		if value == "" {
+			return p.T("settings.model.auto")
+		}
+	case prefs.KeyIDE:
+		if value == "" {
+			return p.T("settings.ide.default", h.Profiles.Default().Name)
+		}
+	case prefs.KeyApp:
+		if value == "" {
+			return p.T("settings.app.default", h.profile(current.IDE).App)
+		}
+	case prefs.KeyLanguage:
+		if value == "" {
+			return p.T("settings.language.auto")
+		}
+		return i18n.For(current.Language).T("lang.name")
+	case prefs.KeyTimezone:
+		if value == "" {
+			return p.T("settings.timezone.server", time.Local.String())
+		}
+	default:
+		if _, ok := prefs.Choices[key]; ok {
+			return p.T("settings." + string(key) + "." + value)
+		}
+	}
+	return value
+}
+
+// handleIDE switches the user's IDE profile, or offers the profiles as
+// buttons: /ide [profile]
+func (h *MainHandler) handleIDE(ctx context.Context, msg *tgbotapi.Message, cmd *command.Command) error {
+	chatID := msg.Chat.ID
+	p := h.tr(chatID)
+	if len(cmd.Args) == 0 {
+		text, keyboard := h.choiceMenu(p, prefs.KeyIDE, h.Prefs.Get(msg.From.ID))
+		if keyboard == nil {
+			return h.Bot.SendText(chatID, text)
+		}
+		_, err := h.Bot.SendKeyboard(chatID, msg.MessageID, text, *keyboard)
+		return err
+	}
+
+	updated, err := h.setPreference(chatID, msg.From, prefs.KeyIDE, cmd.Args[0])
+	if err != nil {
+		return h.Bot.SendText(chatID, p.T("error", err))
+	}
+	profile := h.profile(updated.IDE)
+	return h.Bot.SendText(chatID, p.T("ide.switched", profile.Name, orDefault(updated.App, profile.App)))
+}
+
+// handleSettingsCallback shows the settings, or the values of one of them
+func (h *MainHandler) handleSettingsCallback(query *tgbotapi.CallbackQuery, key string) error {
+	chatID := query.Message.Chat.ID
+	p := h.tr(chatID)
+	current := h.Prefs.Get(query.From.ID)
+
+	text, keyboard := h.settingsMenu(p, current)
+	if key != "" {
+		text, keyboard = h.choiceMenu(p, prefs.Key(key), current)
+	}
+	if err := h.showMenu(query, text, keyboard); err != nil {
+		return err
+	}
+	return h.Bot.AnswerCallback(query.ID, "")
+}
+
+// handleSetPrefCallback changes a setting and returns to the settings
+func (h *MainHandler) handleSetPrefCallback(query *tgbotapi.CallbackQuery, arg string) error {
+	chatID := query.Message.Chat.ID
+	key, value, _ := strings.Cut(arg, "=")
+
+	updated, err := h.setPreference(chatID, query.From, prefs.Key(key), value)
+	if err != nil {
+		return h.Bot.AnswerCallback(query.ID, h.tr(chatID).T("error", err))
+	}
+
+	p := h.tr(chatID)
+	text, keyboard := h.settingsMenu(p, updated)
+	if err := h.showMenu(query, text, keyboard); err != nil {
+		return err
+	}
+	return h.Bot.AnswerCallback(query.ID, p.T("settings.saved"))
+}
+
+// showMenu replaces the message a button was pressed on, which HandleCallback
+// has checked is present
+func (h *MainHandler) showMenu(query *tgbotapi.CallbackQuery, text string, keyboard *tgbotapi.InlineKeyboardMarkup) error {
+	if keyboard == nil {
+		keyboard = &tgbotapi.InlineKeyboardMarkup{}
+	}
+	return h.Bot.EditKeyboard(query.Message.Chat.ID, query.Message.MessageID, text, *keyboard)
+}
@@ -0,0 +1,137 @@
+package bot
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/applejobs/telegram-remote-controller/internal/chunk"
+	"github.com/applejobs/telegram-remote-controller/internal/render"
+)
+
+// streamEditInterval throttles edits of a live message to stay within Telegram's limits
+const streamEditInterval = 2 * time.Second
+
+// streamMessage is one message of a stream, as HTML and as its plain fallback
+type streamMessage struct {
+	html  string
+	plain string
+}
+
+// responseStream mirrors a response into a series of messages, editing them
+// as the response grows. Content that overflows one message continues in
+// the next; once final, the messages are numbered (1/3, 2/3…). The response
+// is rendered from Markdown to Telegram HTML one message at a time.
+type responseStream struct {
+	bot      Messenger
+	chatID   int64
+	replyTo  int
+	header   string
+	writing  string          // Appended to the last message while the file is still growing
+	messages []int           // Sent message IDs, in order
+	shown    []streamMessage // Text currently shown in each message
+	lastEdit time.Time       // When messages were last sent or edited
+	stopped  bool            // Stop was called; only the final update is shown
+}
+
+// newResponseStream creates a stream that replies to replyTo in chatID,
+// marking unfinished responses with writing
+func newResponseStream(bot Messenger, chatID int64, replyTo int, header, writing string) *responseStream {
+	return &responseStream{
+		bot:     bot,
+		chatID:  chatID,
+		replyTo: replyTo,
+		header:  header,
+		writing: "\n\n" + writing,
+	}
+}
+
+// Update shows the content written so far. Edits are throttled unless
+// final, and after Stop only the final content is shown.
+func (s *responseStream) Update(content string, final bool) error {
+	if !final && (s.stopped || time.Since(s.lastEdit) < streamEditInterval) {
+		return nil
+	}
+
+	// Always leave room for the header and writing mark so chunk boundaries stay put
+	limit := chunk.Limit - chunk.UTF16Len(s.header) - chunk.UTF16Len(s.writing)
+	parts := s.render(chunk.Split(content, limit))
+	if final {
+		parts = numberMessages(parts)
+	} else {
+		parts[len(parts)-1] = parts[len(parts)-1].append(s.writing)
+	}
+
+	for i, text := range parts {
+		if i < len(s.messages) {
+			if s.shown[i] == text {
+				continue
+			}
+			if err := s.bot.EditHTML(s.chatID, s.messages[i], text.html, text.plain); err != nil {
+				log.Printf("Failed to edit streamed message: %v", err)
+				return err
+			}
+			s.shown[i] = text
+			continue
+		}
+
+		// Every part replies to the run so the parts stay linked to it
+		id, err := s.bot.SendHTML(s.chatID, s.replyTo, text.html, text.plain)
+		if err != nil {
+			return err
+		}
+		s.messages = append(s.messages, id)
+		s.shown = append(s.shown, text)
+	}
+
+	s.lastEdit = time.Now()
+	return nil
+}
+
+// Stop ends live updates, replacing the writing mark on the last message with note
+func (s *responseStream) Stop(note string) error {
+	s.stopped = true
+	if len(s.messages) == 0 {
+		return nil
+	}
+
+	last := len(s.messages) - 1
+	text := streamMessage{
+		html:  strings.TrimSuffix(s.shown[last].html, render.EscapeHTML(s.writing)),
+		plain: strings.TrimSuffix(s.shown[last].plain, s.writing),
+	}.append(note)
+	if err := s.bot.EditHTML(s.chatID, s.messages[last], text.html, text.plain); err != nil {
+		return err
+	}
+	s.shown[last] = text
+	return nil
+}
+
+// render converts Markdown chunks to messages, the first one under the header
+func (s *responseStream) render(parts []string) []streamMessage {
+	messages := make([]streamMessage, len(parts))
+	for i, part := range parts {
+		messages[i] = streamMessage{html: render.HTML(part), plain: render.Plain(part)}
+	}
+	messages[0].html = render.EscapeHTML(s.header) + messages[0].html
+	messages[0].plain = s.header + messages[0].plain
+	return messages
+}
+
+// append adds plain text to the end of a message
+func (m streamMessage) append(text string) streamMessage {
+	return streamMessage{html: m.html + render.EscapeHTML(text), plain: m.plain + text}
+}
+
+// numberMessages tags each message with its position, like chunk.Number
+func numberMessages(messages []streamMessage) []streamMessage {
+	if len(messages) < 2 {
+		return messages
+	}
+	for i := range messages {
+		tag := fmt.Sprintf("(%d/%d)\n", i+1, len(messages))
+		messages[i] = streamMessage{html: tag + messages[i].html, plain: tag + messages[i].plain}
+	}
+	return messages
+}
@@ -0,0 +1,182 @@
+package bot
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/applejobs/telegram-remote-controller/internal/command"
+	"github.com/applejobs/telegram-remote-controller/internal/i18n"
+	"github.com/applejobs/telegram-remote-controller/internal/templates"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// maxMacroDepth bounds macros that run other macros, so a macro that
+// runs itself stops
+const maxMacroDepth = 3
+
+type macroDepthKey struct{}
+
+// templateBuiltins are the variables the bot fills in for a user in chatID
+func (h *MainHandler) templateBuiltins(chatID, userID int64) templates.Builtins {
+	return templates.Builtins{
+		"date": func() (string, error) {
+			return h.Prefs.Get(userID).Now().Format("2006-01-02"), nil
+		},
+		"clipboard": h.IDE.Automator().GetClipboard,
+		"last_response": func() (string, error) {
+			if text, ok := h.lastResponse(chatID); ok {
+				return text, nil
+			}
+			return "", errors.New("no response in this chat yet")
+		},
+	}
+}
+
+// rememberResponse keeps the last complete response of a chat for {{last_response}}
+func (h *MainHandler) rememberResponse(chatID int64, body string) {
+	h.lastMutex.Lock()
+	defer h.lastMutex.Unlock()
+	h.lastResponses[chatID] = body
+}
+
+func (h *MainHandler) lastResponse(chatID int64) (string, bool) {
+	h.lastMutex.Lock()
+	defer h.lastMutex.Unlock()
+	text, ok := h.lastResponses[chatID]
+	return text, ok
+}
+
+// handleTemplate runs /tpl save|list|show|rm
+func (h *MainHandler) handleTemplate(chatID, userID int64, cmd *command.Command) error {
+	p := h.tr(chatID)
+	action, name := "list", ""
+	if len(cmd.Args) > 0 {
+		action = strings.ToLower(cmd.Args[0])
+	}
+	if len(cmd.Args) > 1 {
+		name = cmd.Args[1]
+	}
+	if action != "list" && name == "" {
+		return h.Bot.SendText(chatID, p.T("tpl.missing_name", action))
+	}
+
+	switch action {
+	case "list", "ls":
+		return h.Bot.SendText(chatID, h.formatTemplates(p, chatID, userID))
+	case "save", "set":
+		if cmd.Prompt == "" {
+			return h.Bot.SendText(chatID, p.T("tpl.missing_text"))
+		}
+		t, err := h.Templates.Save(name, cmd.Prompt)
+		if err != nil {
+			return h.Bot.SendText(chatID, p.T("error", err))
+		}
+		return h.Bot.SendText(chatID, p.T("tpl.saved", t.Name)+"\n"+h.formatVariables(p, chatID, userID, t.Text))
+	case "show":
+		t, err := h.Templates.Get(name)
+		if err != nil {
+			return h.Bot.SendText(chatID, p.T("error", err))
+		}
+		return h.Bot.SendText(chatID, fmt.Sprintf("📑 %s\n\n%s\n\n%s", t.Name, t.Text, h.formatVariables(p, chatID, userID, t.Text)))
+	case "rm", "remove", "del":
+		if err := h.Templates.Remove(name); err != nil {
+			return h.Bot.SendText(chatID, p.T("error", err))
+		}
+		return h.Bot.SendText(chatID, p.T("tpl.removed", name))
+	default:
+		return h.Bot.SendText(chatID, p.T("tpl.usage"))
+	}
+}
+
+// formatTemplates lists the templates with their variables
+func (h *MainHandler) formatTemplates(p i18n.Printer, chatID, userID int64) string {
+	list := h.Templates.List()
+	if len(list) == 0 {
+		return p.T("tpl.title") + "\n\n" + p.T("tpl.none")
+	}
+
+	builtins := h.templateBuiltins(chatID, userID)
+	var sb strings.Builder
+	sb.WriteString(p.T("tpl.title") + "\n")
+	for _, t := range list {
+		kind := p.T("tpl.kind_prompt")
+		if strings.HasPrefix(t.Text, "/") {
+			kind = p.N("tpl.kind_macro", len(templates.Steps(t.Text)))
+		}
+		sb.WriteString("\n" + p.T("tpl.entry", t.Name, kind, usage(t, builtins)))
+	}
+	sb.WriteString("\n\n" + p.T("tpl.list_hint"))
+	return sb.String()
+}
+
+// usage lists the variables /p needs for a template, e.g. " file= [lang=]"
+func usage(t templates.Template, builtins templates.Builtins) string {
+	vars, _ := templates.Variables(t.Text, builtins)
+	var sb strings.Builder
+	for _, v := range vars {
+		switch {
+		case v.Builtin:
+		case v.Required:
+			sb.WriteString(" " + v.Name + "=")
+		default:
+			sb.WriteString(" [" + v.Name + "=]")
+		}
+	}
+	return sb.String()
+}
+
+// formatVariables describes the variables a template uses
+func (h *MainHandler) formatVariables(p i18n.Printer, chatID, userID int64, text string) string {
+	vars, _ := templates.Variables(text, h.templateBuiltins(chatID, userID))
+	if len(vars) == 0 {
+		return p.T("tpl.no_variables")
+	}
+	lines := make([]string, len(vars))
+	for i, v := range vars {
+		switch {
+		case v.Builtin:
+			lines[i] = p.T("tpl.variable_builtin", v.Name)
+		case v.Required:
+			lines[i] = p.T("tpl.variable_required", v.Name)
+		default:
+			lines[i] = fmt.Sprintf("• %s = %q", v.Name, v.Default)
+		}
+	}
+	return p.T("tpl.variables") + "\n" + strings.Join(lines, "\n")
+}
+
+// handlePrompt expands a template and runs the commands it stands for: a
+// prompt becomes a /run, and a macro runs each of its commands in order
+func (h *MainHandler) handlePrompt(ctx context.Context, msg *tgbotapi.Message, cmd *command.Command) error {
+	chatID := msg.Chat.ID
+	p := h.tr(chatID)
+
+	depth, _ := ctx.Value(macroDepthKey{}).(int)
+	if depth >= maxMacroDepth {
+		return h.Bot.SendText(chatID, p.T("tpl.too_deep", maxMacroDepth))
+	}
+
+	t, err := h.Templates.Get(cmd.Args[0])
+	if err != nil {
+		return h.Bot.SendText(chatID, p.T("tpl.unknown", err))
+	}
+	builtins := h.templateBuiltins(chatID, msg.From.ID)
+	steps, err := templates.ExpandSteps(t.Text, cmd.Vars, builtins)
+	if err != nil {
+		return h.Bot.SendText(chatID, p.T("tpl.expand_failed", t.Name, err, t.Name+usage(t, builtins)))
+	}
+	log.Printf("Template %s expands to %d command(s) in chat %d", t.Name, len(steps), chatID)
+
+	ctx = context.WithValue(ctx, macroDepthKey{}, depth+1)
+	for _, step := range steps {
+		stepMsg := *msg
+		stepMsg.Text = step
+		if err := h.dispatchCommand(ctx, &stepMsg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+package bot
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+const (
+	// DefaultUpdateLogPath is where the update offset and recent IDs are kept
+	DefaultUpdateLogPath = "/Users/applejobs/.gemini/antigravity/scratch/telegram-agent-controller/state/updates.json"
+
+	// DefaultUpdateLogSize is how many handled update IDs are remembered
+	DefaultUpdateLogSize = 1000
+)
+
+// UpdateLog persists the last acknowledged update ID and remembers recently
+// handled IDs, so that no update is handled twice across crashes, restarts
+// or webhook redeliveries. An update is recorded before it is handled:
+// one interrupted mid-way is dropped rather than replayed.
+type UpdateLog struct {
+	path  string
+	size  int
+	mu    sync.Mutex
+	state updateLogState
+	seen  map[int]bool
+}
+
+// updateLogState is the on-disk form of the log
+type updateLogState struct {
+	Offset int   `json:"offset"` // Next update ID to request
+	Recent []int `json:"recent"` // Handled IDs, oldest first
+}
+
+// OpenUpdateLog loads the log at path, starting empty if it does not exist.
+// A corrupt file is set aside and an empty log is used.
+func OpenUpdateLog(path string, size int) (*UpdateLog, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create update log directory: %w", err)
+	}
+	if size <= 0 {
+		size = DefaultUpdateLogSize
+	}
+
+	l := &UpdateLog{path: path, size: size, seen: make(map[int]bool)}
+	data, err := os.ReadFile(path)
+	switch {
+	case os.IsNotExist(err):
+	case err != nil:
+		return nil, fmt.Errorf("failed to read update log: %w", err)
+	default:
+		if err := json.Unmarshal(data, &l.state); err != nil {
+			log.Printf("Update log %s is corrupt (%v), starting fresh", path, err)
+			os.Rename(path, path+".corrupt")
+			l.state = updateLogState{}
+		}
+	}
+
+	if len(l.state.Recent) > size {
+		l.state.Recent = l.state.Recent[len(l.state.Recent)-size:]
+	}
+	for _, id := range l.state.Recent {
+		l.seen[id] = true
+	}
+	return l, nil
+}
+
+// Offset returns the next update ID to request from getUpdates
+func (l *UpdateLog) Offset() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.state.Offset
+}
+
+// Begin records that update id is about to be handled. It returns false if
+// the update was handled before and must be skipped.
+func (l *UpdateLog) Begin(id int) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.seen[id] {
+		return false
+	}
+
+	l.seen[id] = true
+	l.state.Recent = append(l.state.Recent, id)
+	if len(l.state.Recent) > l.size {
+		delete(l.seen, l.state.Recent[0])
+		l.state.Recent = l.state.Recent[1:]
+	}
+	if id >= l.state.Offset {
+		l.state.Offset = id + 1
+	}
+
+	if err := l.save(); err != nil {
+		log.Printf("Failed to save update log: %v", err)
+	}
+	return true
+}
+
+// save writes the log atomically through a synced temp file and a rename
+func (l *UpdateLog) save() error {
+	data, err := json.Marshal(l.state)
+	if err != nil {
+		return err
+	}
+
+	tmp := l.path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, l.path)
+}
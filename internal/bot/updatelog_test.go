@@ -0,0 +1,86 @@
+package bot
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestUpdateLogSkipsHandledUpdates(t *testing.T) {
+	l, err := OpenUpdateLog(filepath.Join(t.TempDir(), "updates.json"), 10)
+	if err != nil {
+		t.Fatalf("OpenUpdateLog failed: %v", err)
+	}
+
+	if !l.Begin(5) {
+		t.Fatal("First delivery should be handled")
+	}
+	if l.Begin(5) {
+		t.Error("Second delivery should be skipped")
+	}
+	if l.Offset() != 6 {
+		t.Errorf("Expected offset 6, got %d", l.Offset())
+	}
+
+	// An older update arriving late is still handled once
+	if !l.Begin(3) || l.Offset() != 6 {
+		t.Errorf("Late update should be handled without moving the offset back, offset %d", l.Offset())
+	}
+}
+
+func TestUpdateLogSurvivesRestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state", "updates.json")
+	l, err := OpenUpdateLog(path, 10)
+	if err != nil {
+		t.Fatalf("OpenUpdateLog failed: %v", err)
+	}
+	l.Begin(41)
+	l.Begin(42)
+
+	reopened, err := OpenUpdateLog(path, 10)
+	if err != nil {
+		t.Fatalf("Reopen failed: %v", err)
+	}
+	if reopened.Offset() != 43 {
+		t.Errorf("Expected offset 43 after restart, got %d", reopened.Offset())
+	}
+	if reopened.Begin(42) {
+		t.Error("Update handled before the restart should be skipped")
+	}
+	if _, err := os.Stat(path + ".tmp"); !os.IsNotExist(err) {
+		t.Error("Temp file should be renamed into place")
+	}
+}
+
+func TestUpdateLogIsBounded(t *testing.T) {
+	l, err := OpenUpdateLog(filepath.Join(t.TempDir(), "updates.json"), 3)
+	if err != nil {
+		t.Fatalf("OpenUpdateLog failed: %v", err)
+	}
+	for id := 1; id <= 5; id++ {
+		l.Begin(id)
+	}
+
+	if len(l.state.Recent) != 3 || len(l.seen) != 3 {
+		t.Errorf("Expected 3 remembered IDs, got %v", l.state.Recent)
+	}
+	if l.Begin(5) {
+		t.Error("Recent update should still be skipped")
+	}
+}
+
+func TestUpdateLogCorruptFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "updates.json")
+	os.WriteFile(path, []byte("{not json"), 0644)
+
+	l, err := OpenUpdateLog(path, 10)
+	if err != nil {
+		t.Fatalf("Corrupt log should not fail to open: %v", err)
+	}
+	if l.Offset() != 0 {
+		t.Errorf("Expected a fresh log, got offset %d", l.Offset())
+	}
+	if _, err := os.Stat(path + ".corrupt"); err != nil {
+		t.Error("Corrupt file should be kept aside")
+	}
+}
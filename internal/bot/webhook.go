@@ -0,0 +1,129 @@
+package bot
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// secretTokenHeader carries the webhook secret on every request from Telegram
+const secretTokenHeader = "X-Telegram-Bot-Api-Secret-Token"
+
+// webhookBacklog is how many received updates may wait for the handler
+const webhookBacklog = 100
+
+// WebhookOptions configures webhook mode
+type WebhookOptions struct {
+	URL    string // Public URL Telegram posts updates to
+	Listen string // Local listen address, e.g. ":8443"
+	Path   string // Path the receiver is mounted on
+	Secret string // Expected X-Telegram-Bot-Api-Secret-Token value
+}
+
+// StartWebhook registers a webhook with Telegram and serves updates until
+// ctx is done, then deletes the webhook again
+func (b *Bot) StartWebhook(ctx context.Context, opts WebhookOptions) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	b.mu.Lock()
+	b.stop = cancel
+	b.status.Mode = "webhook"
+	b.mu.Unlock()
+
+	updates := make(chan tgbotapi.Update, webhookBacklog)
+	mux := http.NewServeMux()
+	mux.Handle(opts.Path, WebhookHandler(opts.Secret, updates))
+	server := &http.Server{Addr: opts.Listen, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+
+	serveErr := make(chan error, 1)
+	go func() {
+		log.Printf("Webhook receiver listening on %s%s", opts.Listen, opts.Path)
+		serveErr <- server.ListenAndServe()
+	}()
+
+	if err := b.setWebhook(opts.URL, opts.Secret); err != nil {
+		server.Close()
+		return fmt.Errorf("failed to set webhook: %w", err)
+	}
+	log.Printf("Webhook registered: %s", opts.URL)
+
+	defer func() {
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+
+		if _, err := b.client().Request(tgbotapi.DeleteWebhookConfig{}); err != nil {
+			log.Printf("Failed to delete webhook: %v", err)
+		} else {
+			log.Println("Webhook deleted")
+		}
+	}()
+
+	// Updates run on the dispatcher; each chat's in the order they arrived
+	for {
+		select {
+		case <-ctx.Done():
+			log.Println("Bot stopping...")
+			b.dispatch().Wait()
+			return nil
+		case err := <-serveErr:
+			if errors.Is(err, http.ErrServerClosed) {
+				return nil
+			}
+			return fmt.Errorf("webhook server failed: %w", err)
+		case update := <-updates:
+			b.markReceived()
+			b.handleUpdate(ctx, update)
+		}
+	}
+}
+
+// setWebhook registers url with Telegram. The library's WebhookConfig has
+// no secret token field, so the request is made directly.
+func (b *Bot) setWebhook(url, secret string) error {
+	params := tgbotapi.Params{}
+	params.AddNonEmpty("url", url)
+	params.AddNonEmpty("secret_token", secret)
+	params.AddNonEmpty("allowed_updates", `["message","callback_query"]`)
+	_, err := b.client().MakeRequest("setWebhook", params)
+	return err
+}
+
+// WebhookHandler receives updates posted by Telegram and queues them on
+// updates. Requests without the expected secret token are rejected.
+func WebhookHandler(secret string, updates chan<- tgbotapi.Update) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		token := r.Header.Get(secretTokenHeader)
+		if subtle.ConstantTimeCompare([]byte(token), []byte(secret)) != 1 {
+			log.Printf("Rejected webhook request from %s: bad secret token", r.RemoteAddr)
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+
+		var update tgbotapi.Update
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20)).Decode(&update); err != nil {
+			http.Error(w, "invalid update", http.StatusBadRequest)
+			return
+		}
+
+		select {
+		case updates <- update:
+			w.WriteHeader(http.StatusOK)
+		case <-r.Context().Done():
+			// Telegram redelivers updates that were not acknowledged
+			http.Error(w, "busy", http.StatusServiceUnavailable)
+		}
+	})
+}
@@ -0,0 +1,64 @@
+package bot
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+func TestWebhookHandlerVerifiesSecret(t *testing.T) {
+	updates := make(chan tgbotapi.Update, 1)
+	handler := WebhookHandler("s3cret", updates)
+	body := `{"update_id": 10, "message": {"message_id": 1, "text": "/status", "chat": {"id": 5}}}`
+
+	tests := []struct {
+		name     string
+		method   string
+		secret   string
+		body     string
+		expected int
+	}{
+		{"missing secret", http.MethodPost, "", body, http.StatusForbidden},
+		{"wrong secret", http.MethodPost, "nope", body, http.StatusForbidden},
+		{"wrong method", http.MethodGet, "s3cret", "", http.StatusMethodNotAllowed},
+		{"bad body", http.MethodPost, "s3cret", "{", http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, "/telegram/webhook", strings.NewReader(tt.body))
+		if tt.secret != "" {
+			req.Header.Set(secretTokenHeader, tt.secret)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		if rec.Code != tt.expected {
+			t.Errorf("%s: expected status %d, got %d", tt.name, tt.expected, rec.Code)
+		}
+	}
+	if len(updates) != 0 {
+		t.Fatal("Rejected requests should not queue updates")
+	}
+}
+
+func TestWebhookHandlerQueuesUpdate(t *testing.T) {
+	updates := make(chan tgbotapi.Update, 1)
+	handler := WebhookHandler("s3cret", updates)
+
+	req := httptest.NewRequest(http.MethodPost, "/telegram/webhook",
+		strings.NewReader(`{"update_id": 10, "message": {"message_id": 1, "text": "/status", "chat": {"id": 5}}}`))
+	req.Header.Set(secretTokenHeader, "s3cret")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d", rec.Code)
+	}
+	update := <-updates
+	if update.UpdateID != 10 || update.Message.Text != "/status" {
+		t.Errorf("Unexpected update: %+v", update)
+	}
+}
@@ -0,0 +1,108 @@
+package callback
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// MaxDataLen is Telegram's limit on callback data, in bytes
+	MaxDataLen = 64
+
+	// DefaultTTL is how long a button keeps working after it was sent
+	DefaultTTL = 7 * 24 * time.Hour
+
+	// separator joins the fields of encoded data
+	separator = "|"
+
+	// signatureLen is how many HMAC bytes are kept; 9 bytes encode to 12 characters
+	signatureLen = 9
+)
+
+// Errors
+var (
+	ErrMalformed    = errors.New("malformed callback data")
+	ErrBadSignature = errors.New("callback data signature mismatch")
+	ErrExpired      = errors.New("callback data expired")
+	ErrTooLong      = errors.New("callback data exceeds 64 bytes")
+)
+
+// Data is the decoded content of a button's callback data
+type Data struct {
+	Action  string
+	Arg     string
+	Expires time.Time
+}
+
+// Signer encodes button actions as "action|arg|expiry|signature" so that
+// callback data cannot be forged or replayed after it expires
+type Signer struct {
+	key []byte
+	ttl time.Duration
+	now func() time.Time
+}
+
+// NewSigner creates a signer. With an empty secret a random key is used,
+// so buttons stop working when the process restarts.
+func NewSigner(secret []byte, ttl time.Duration) *Signer {
+	key := secret
+	if len(key) == 0 {
+		key = make([]byte, 32)
+		rand.Read(key)
+	}
+	if ttl <= 0 {
+		ttl = DefaultTTL
+	}
+	return &Signer{key: key, ttl: ttl, now: time.Now}
+}
+
+// Encode signs an action and its argument for use as callback data
+func (s *Signer) Encode(action, arg string) (string, error) {
+	if action == "" || strings.Contains(action, separator) || strings.Contains(arg, separator) {
+		return "", ErrMalformed
+	}
+
+	expires := strconv.FormatInt(s.now().Add(s.ttl).Unix(), 36)
+	payload := action + separator + arg + separator + expires
+	data := payload + separator + s.sign(payload)
+	if len(data) > MaxDataLen {
+		return "", ErrTooLong
+	}
+	return data, nil
+}
+
+// Decode verifies callback data and returns its action and argument
+func (s *Signer) Decode(data string) (Data, error) {
+	fields := strings.Split(data, separator)
+	if len(fields) != 4 || fields[0] == "" {
+		return Data{}, ErrMalformed
+	}
+
+	payload := data[:strings.LastIndex(data, separator)]
+	if !hmac.Equal([]byte(fields[3]), []byte(s.sign(payload))) {
+		return Data{}, ErrBadSignature
+	}
+
+	unix, err := strconv.ParseInt(fields[2], 36, 64)
+	if err != nil {
+		return Data{}, ErrMalformed
+	}
+	decoded := Data{Action: fields[0], Arg: fields[1], Expires: time.Unix(unix, 0)}
+	if s.now().After(decoded.Expires) {
+		return decoded, ErrExpired
+	}
+	return decoded, nil
+}
+
+// sign returns a truncated HMAC-SHA256 of payload
+func (s *Signer) sign(payload string) string {
+	mac := hmac.New(sha256.New, s.key)
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil)[:signatureLen])
+}
@@ -0,0 +1,76 @@
+package callback
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEncodeDecode(t *testing.T) {
+	s := NewSigner([]byte("secret"), time.Hour)
+
+	data, err := s.Encode("done", "20260101-120000")
+	if err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+	if len(data) > MaxDataLen {
+		t.Errorf("Encoded data is %d bytes, limit %d", len(data), MaxDataLen)
+	}
+
+	decoded, err := s.Decode(data)
+	if err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+	if decoded.Action != "done" || decoded.Arg != "20260101-120000" {
+		t.Errorf("Unexpected data: %+v", decoded)
+	}
+}
+
+func TestDecodeRejectsTampering(t *testing.T) {
+	s := NewSigner([]byte("secret"), time.Hour)
+	data, _ := s.Encode("del", "1")
+
+	tampered := strings.Replace(data, "del|1|", "del|2|", 1)
+	if _, err := s.Decode(tampered); err != ErrBadSignature {
+		t.Errorf("Expected ErrBadSignature for tampered arg, got %v", err)
+	}
+
+	other := NewSigner([]byte("other"), time.Hour)
+	if _, err := other.Decode(data); err != ErrBadSignature {
+		t.Errorf("Expected ErrBadSignature for another key, got %v", err)
+	}
+
+	for _, bad := range []string{"", "full:3", "a|b|c", "|x|y|z"} {
+		if _, err := s.Decode(bad); err != ErrMalformed {
+			t.Errorf("Decode(%q): expected ErrMalformed, got %v", bad, err)
+		}
+	}
+}
+
+func TestDecodeExpired(t *testing.T) {
+	s := NewSigner([]byte("secret"), time.Minute)
+	now := time.Now()
+	s.now = func() time.Time { return now }
+
+	data, _ := s.Encode("rerun", "12")
+	s.now = func() time.Time { return now.Add(2 * time.Minute) }
+
+	decoded, err := s.Decode(data)
+	if err != ErrExpired {
+		t.Fatalf("Expected ErrExpired, got %v", err)
+	}
+	if decoded.Action != "rerun" {
+		t.Errorf("Expired data should still be decoded, got %+v", decoded)
+	}
+}
+
+func TestEncodeLimits(t *testing.T) {
+	s := NewSigner(nil, 0)
+
+	if _, err := s.Encode("shot", strings.Repeat("x", 60)); err != ErrTooLong {
+		t.Errorf("Expected ErrTooLong, got %v", err)
+	}
+	if _, err := s.Encode("shot", "a|b"); err != ErrMalformed {
+		t.Errorf("Expected ErrMalformed for separator in arg, got %v", err)
+	}
+}
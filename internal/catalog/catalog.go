@@ -0,0 +1,260 @@
+// Package catalog keeps the model and app aliases users type in commands,
+// loaded from a JSON file and editable at runtime.
+package catalog
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// DefaultPath is where the alias catalog is kept
+const DefaultPath = "/Users/applejobs/.gemini/antigravity/scratch/telegram-agent-controller/config/aliases.json"
+
+// Kind is a type of alias
+type Kind string
+
+const (
+	KindModel Kind = "model"
+	KindApp   Kind = "app"
+)
+
+// ParseKind accepts "model", "app" and their plurals
+func ParseKind(s string) (Kind, error) {
+	switch strings.TrimSuffix(strings.ToLower(s), "s") {
+	case "model":
+		return KindModel, nil
+	case "app":
+		return KindApp, nil
+	default:
+		return "", fmt.Errorf("%w: %q", ErrUnknownKind, s)
+	}
+}
+
+// Entry is one alias and the name it stands for
+type Entry struct {
+	Alias string
+	Name  string
+}
+
+// Errors
+var (
+	ErrUnknownKind  = errors.New("kind must be model or app")
+	ErrInvalidAlias = errors.New("alias must be one word")
+	ErrEmptyName    = errors.New("name is empty")
+	ErrUnknownAlias = errors.New("unknown alias")
+)
+
+// UnknownError is returned for a name that is neither an alias nor a known name
+type UnknownError struct {
+	Kind        Kind
+	Name        string
+	Suggestions []string
+}
+
+func (e *UnknownError) Error() string {
+	msg := fmt.Sprintf("unknown %s %q", e.Kind, e.Name)
+	if len(e.Suggestions) > 0 {
+		msg += fmt.Sprintf(" (did you mean %s?)", strings.Join(e.Suggestions, ", "))
+	}
+	return msg
+}
+
+// Catalog maps aliases to model and app names
+type Catalog struct {
+	path string
+
+	mu      sync.RWMutex
+	aliases map[Kind]map[string]string // Lowercase alias to name
+}
+
+// file is the catalog's JSON layout
+type file struct {
+	Models map[string]string `json:"models"`
+	Apps   map[string]string `json:"apps"`
+}
+
+// New returns a catalog of the built-in aliases that is not saved anywhere
+func New() *Catalog {
+	return fromFile("", defaults())
+}
+
+// Load reads the catalog at path. A missing file yields the built-in
+// aliases, which are written there on the first change.
+func Load(path string) (*Catalog, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		log.Printf("No alias catalog at %s, using built-in aliases", path)
+		return fromFile(path, defaults()), nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read alias catalog: %w", err)
+	}
+
+	var f file
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("failed to parse alias catalog %s: %w", path, err)
+	}
+	return fromFile(path, f), nil
+}
+
+func fromFile(path string, f file) *Catalog {
+	c := &Catalog{path: path, aliases: map[Kind]map[string]string{KindModel: {}, KindApp: {}}}
+	for alias, name := range f.Models {
+		c.aliases[KindModel][strings.ToLower(alias)] = name
+	}
+	for alias, name := range f.Apps {
+		c.aliases[KindApp][strings.ToLower(alias)] = name
+	}
+	return c
+}
+
+// Model resolves a model alias or name. Unknown models are an *UnknownError
+// with the closest matches as suggestions.
+func (c *Catalog) Model(name string) (string, error) {
+	if full, ok := c.lookup(KindModel, name); ok {
+		return full, nil
+	}
+	return "", &UnknownError{Kind: KindModel, Name: name, Suggestions: c.Suggest(KindModel, name)}
+}
+
+// App resolves an app alias. Other names pass through, since any installed
+// app may be named.
+func (c *Catalog) App(name string) string {
+	if full, ok := c.lookup(KindApp, name); ok {
+		return full
+	}
+	return name
+}
+
+// lookup finds name as an alias or, ignoring case, as a name
+func (c *Catalog) lookup(kind Kind, name string) (string, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	lower := strings.ToLower(strings.TrimSpace(name))
+	if full, ok := c.aliases[kind][lower]; ok {
+		return full, true
+	}
+	for _, full := range c.aliases[kind] {
+		if strings.ToLower(full) == lower {
+			return full, true
+		}
+	}
+	return "", false
+}
+
+// List returns the aliases of a kind, sorted by name and then alias
+func (c *Catalog) List(kind Kind) []Entry {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	entries := make([]Entry, 0, len(c.aliases[kind]))
+	for alias, name := range c.aliases[kind] {
+		entries = append(entries, Entry{Alias: alias, Name: name})
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Name != entries[j].Name {
+			return entries[i].Name < entries[j].Name
+		}
+		return entries[i].Alias < entries[j].Alias
+	})
+	return entries
+}
+
+// Set points alias at name and saves the catalog
+func (c *Catalog) Set(kind Kind, alias, name string) error {
+	alias = strings.ToLower(strings.TrimSpace(alias))
+	name = strings.TrimSpace(name)
+	if alias == "" || strings.ContainsAny(alias, " \t\n") {
+		return ErrInvalidAlias
+	}
+	if name == "" {
+		return ErrEmptyName
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.aliases[kind][alias] = name
+	return c.save()
+}
+
+// Remove deletes an alias and saves the catalog
+func (c *Catalog) Remove(kind Kind, alias string) error {
+	alias = strings.ToLower(strings.TrimSpace(alias))
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.aliases[kind][alias]; !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownAlias, alias)
+	}
+	delete(c.aliases[kind], alias)
+	return c.save()
+}
+
+// save writes the catalog atomically; c.mu must be held
+func (c *Catalog) save() error {
+	if c.path == "" {
+		return nil
+	}
+
+	data, err := json.MarshalIndent(file{Models: c.aliases[KindModel], Apps: c.aliases[KindApp]}, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(c.path), 0755); err != nil {
+		return fmt.Errorf("failed to create catalog directory: %w", err)
+	}
+
+	tmp := c.path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return fmt.Errorf("failed to save alias catalog: %w", err)
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to save alias catalog: %w", err)
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to save alias catalog: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed to save alias catalog: %w", err)
+	}
+	return os.Rename(tmp, c.path)
+}
+
+// defaults are the aliases used when there is no catalog file
+func defaults() file {
+	return file{
+		Models: map[string]string{
+			"thinking": "Claude Opus 4.5 (Thinking)",
+			"opus":     "Claude Opus 4.5 (Thinking)",
+			"coding":   "Gemini 3 Pro",
+			"gemini":   "Gemini 3 Pro",
+			"claude":   "Claude Opus 4.5",
+			"sonnet":   "Claude Sonnet 4",
+		},
+		Apps: map[string]string{
+			"chrome":      "Google Chrome",
+			"safari":      "Safari",
+			"firefox":     "Firefox",
+			"code":        "Visual Studio Code",
+			"vscode":      "Visual Studio Code",
+			"terminal":    "Terminal",
+			"finder":      "Finder",
+			"antigravity": "Antigravity",
+			"ag":          "Antigravity",
+			"slack":       "Slack",
+			"discord":     "Discord",
+			"notion":      "Notion",
+		},
+	}
+}
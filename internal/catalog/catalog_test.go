@@ -0,0 +1,114 @@
+package catalog
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadMissingFileUsesDefaults(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "aliases.json")
+	c, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if got, err := c.Model("opus"); err != nil || got != "Claude Opus 4.5 (Thinking)" {
+		t.Errorf("Model(opus) = %q, %v", got, err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Error("The file should not be written until something changes")
+	}
+}
+
+func TestResolve(t *testing.T) {
+	c := New()
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"OPUS", "Claude Opus 4.5 (Thinking)"},
+		{"claude sonnet 4", "Claude Sonnet 4"},
+		{" gemini ", "Gemini 3 Pro"},
+	}
+	for _, tt := range tests {
+		if got, err := c.Model(tt.input); err != nil || got != tt.want {
+			t.Errorf("Model(%q) = %q, %v; want %q", tt.input, got, err, tt.want)
+		}
+	}
+
+	if got := c.App("ag"); got != "Antigravity" {
+		t.Errorf("App(ag) = %q", got)
+	}
+	if got := c.App("Xcode"); got != "Xcode" {
+		t.Errorf("Unknown apps should pass through, got %q", got)
+	}
+}
+
+func TestSetAndRemovePersist(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config", "aliases.json")
+	c, _ := Load(path)
+
+	if err := c.Set(KindModel, "Flash", "Gemini 3 Flash"); err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if err := c.Remove(KindApp, "ag"); err != nil {
+		t.Fatalf("Remove failed: %v", err)
+	}
+	if err := c.Remove(KindApp, "ag"); !errors.Is(err, ErrUnknownAlias) {
+		t.Errorf("Expected ErrUnknownAlias, got %v", err)
+	}
+	if err := c.Set(KindModel, "two words", "x"); err != ErrInvalidAlias {
+		t.Errorf("Expected ErrInvalidAlias, got %v", err)
+	}
+
+	reloaded, err := Load(path)
+	if err != nil {
+		t.Fatalf("Reload failed: %v", err)
+	}
+	if got, err := reloaded.Model("flash"); err != nil || got != "Gemini 3 Flash" {
+		t.Errorf("Model(flash) after reload = %q, %v", got, err)
+	}
+	if got := reloaded.App("ag"); got != "ag" {
+		t.Errorf("Removed alias should stay removed, got %q", got)
+	}
+}
+
+func TestUnknownModelSuggestions(t *testing.T) {
+	c := New()
+	tests := []struct {
+		input string
+		want  string // Expected first suggestion
+	}{
+		{"opsu", "opus"},        // Swapped letters
+		{"sonet", "sonnet"},     // Missing letter
+		{"gemni", "gemini"},     // Missing letter
+		{"pro", "Gemini 3 Pro"}, // Part of a name
+	}
+	for _, tt := range tests {
+		_, err := c.Model(tt.input)
+		var unknown *UnknownError
+		if !errors.As(err, &unknown) {
+			t.Errorf("Model(%q): expected *UnknownError, got %v", tt.input, err)
+			continue
+		}
+		if len(unknown.Suggestions) == 0 || unknown.Suggestions[0] != tt.want {
+			t.Errorf("Model(%q) suggestions = %v, want %q first", tt.input, unknown.Suggestions, tt.want)
+		}
+	}
+
+	if got := c.Suggest(KindModel, "zzzzzz"); len(got) != 0 {
+		t.Errorf("Expected no suggestions for nonsense, got %v", got)
+	}
+}
+
+func TestParseKind(t *testing.T) {
+	for input, want := range map[string]Kind{"model": KindModel, "Models": KindModel, "apps": KindApp} {
+		if got, err := ParseKind(input); err != nil || got != want {
+			t.Errorf("ParseKind(%q) = %q, %v", input, got, err)
+		}
+	}
+	if _, err := ParseKind("user"); !errors.Is(err, ErrUnknownKind) {
+		t.Errorf("Expected ErrUnknownKind, got %v", err)
+	}
+}
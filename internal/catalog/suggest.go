@@ -0,0 +1,84 @@
+package catalog
+
+import (
+	"sort"
+	"strings"
+)
+
+// maxSuggestions is how many "did you mean" candidates are offered
+const maxSuggestions = 3
+
+// Suggest returns the aliases and names closest to name, best first
+func (c *Catalog) Suggest(kind Kind, name string) []string {
+	c.mu.RLock()
+	candidates := make(map[string]bool)
+	for alias, full := range c.aliases[kind] {
+		candidates[alias] = true
+		candidates[full] = true
+	}
+	c.mu.RUnlock()
+
+	target := strings.ToLower(strings.TrimSpace(name))
+	if target == "" {
+		return nil
+	}
+
+	type match struct {
+		text     string
+		distance int
+	}
+	var matches []match
+	for text := range candidates {
+		lower := strings.ToLower(text)
+		d := distance(target, lower)
+		// Accept a few typos, or a word of a longer name such as "opus" in "Claude Opus 4.5"
+		limit := max(1, len([]rune(target))/3)
+		if d <= limit || (len(target) >= 3 && strings.Contains(lower, target)) {
+			matches = append(matches, match{text, d})
+		}
+	}
+
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].distance != matches[j].distance {
+			return matches[i].distance < matches[j].distance
+		}
+		return matches[i].text < matches[j].text
+	})
+
+	var suggestions []string
+	for _, m := range matches {
+		if len(suggestions) == maxSuggestions {
+			break
+		}
+		suggestions = append(suggestions, m.text)
+	}
+	return suggestions
+}
+
+// distance is the Damerau-Levenshtein (optimal string alignment) distance
+// between a and b, counting a swap of two neighbours as one edit
+func distance(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev2 := make([]int, len(rb)+1)
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+			if i > 1 && j > 1 && ra[i-1] == rb[j-2] && ra[i-2] == rb[j-1] {
+				cur[j] = min(cur[j], prev2[j-2]+1)
+			}
+		}
+		prev2, prev, cur = prev, cur, prev2
+	}
+	return prev[len(rb)]
+}
@@ -0,0 +1,245 @@
+package chunk
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf16"
+)
+
+const (
+	// Limit is Telegram's maximum message length in UTF-16 code units
+	Limit = 4096
+
+	// numberReserve is room kept free in every chunk for a "(12/34)\n" tag
+	numberReserve = 12
+
+	// fenceReserve is room kept for closing a code block cut at the end of a chunk
+	fenceReserve = 8
+)
+
+// UTF16Len returns the length of s in UTF-16 code units, the way Telegram counts it
+func UTF16Len(s string) int {
+	n := 0
+	for _, r := range s {
+		n += utf16.RuneLen(r)
+	}
+	return n
+}
+
+// line is one input line and the code fence open after it
+type line struct {
+	text  string // Including its trailing newline, if any
+	fence string // Opening fence line still open after this line, or ""
+}
+
+// Split breaks text into chunks of at most limit UTF-16 units, leaving room
+// for Number to tag them. It cuts on paragraph breaks where it can, then on
+// line breaks, and only splits inside a line when the line alone is too long.
+// A code block cut in two is closed at the end of one chunk and reopened,
+// with its language hint, at the start of the next. Text that already fits
+// is returned unchanged as a single chunk.
+func Split(text string, limit int) []string {
+	if limit <= 0 {
+		limit = Limit
+	}
+	if UTF16Len(text) <= limit {
+		return []string{text}
+	}
+
+	budget := limit - numberReserve
+	s := &splitter{budget: budget}
+
+	fence := ""
+	for _, raw := range splitLines(text) {
+		for _, piece := range s.fit(raw, fence) {
+			fence = nextFence(fence, piece)
+			s.add(line{text: piece, fence: fence})
+		}
+	}
+	s.flush(len(s.cur))
+
+	return s.chunks
+}
+
+// Number tags each chunk with its position, e.g. "(1/3)", when there is more than one
+func Number(chunks []string) []string {
+	if len(chunks) < 2 {
+		return chunks
+	}
+	numbered := make([]string, len(chunks))
+	for i, c := range chunks {
+		numbered[i] = fmt.Sprintf("(%d/%d)\n%s", i+1, len(chunks), c)
+	}
+	return numbered
+}
+
+// splitter accumulates lines into chunks
+type splitter struct {
+	budget int
+	chunks []string
+	reopen string // Fence line the current chunk starts inside of
+	cur    []line
+	curLen int
+}
+
+// add appends a line, first emitting the current chunk if the line does not fit
+func (s *splitter) add(l line) {
+	if len(s.cur) > 0 && s.size(l) > s.budget {
+		s.flush(s.breakPoint())
+		// Lines carried over from a paragraph break may still leave too little room
+		if len(s.cur) > 0 && s.size(l) > s.budget {
+			s.flush(len(s.cur))
+		}
+	}
+	s.cur = append(s.cur, l)
+	s.curLen += UTF16Len(l.text)
+}
+
+// size is the current chunk's length if l were added, including fence repairs
+func (s *splitter) size(l line) int {
+	n := s.curLen + UTF16Len(l.text)
+	if s.reopen != "" {
+		n += UTF16Len(s.reopen) + 1
+	}
+	if l.fence != "" {
+		n += len(closing(l.fence))
+	}
+	return n
+}
+
+// breakPoint prefers to cut after the last blank line outside a code block in
+// the second half of the chunk; otherwise the whole chunk is emitted
+func (s *splitter) breakPoint() int {
+	for i := len(s.cur) - 1; i >= len(s.cur)/2 && i > 0; i-- {
+		if strings.TrimSpace(s.cur[i].text) == "" && s.cur[i].fence == "" {
+			return i + 1
+		}
+	}
+	return len(s.cur)
+}
+
+// flush emits the first n lines as a chunk and keeps the rest for the next one
+func (s *splitter) flush(n int) {
+	if n == 0 {
+		return
+	}
+
+	var sb strings.Builder
+	if s.reopen != "" {
+		sb.WriteString(s.reopen)
+		sb.WriteString("\n")
+	}
+	for _, l := range s.cur[:n] {
+		sb.WriteString(l.text)
+	}
+
+	open := s.cur[n-1].fence
+	chunk := sb.String()
+	if open != "" {
+		chunk = strings.TrimRight(chunk, "\n") + closing(open)
+	} else {
+		chunk = strings.TrimRight(chunk, "\n")
+	}
+	if strings.TrimSpace(chunk) != "" {
+		s.chunks = append(s.chunks, chunk)
+	}
+
+	rest := append([]line(nil), s.cur[n:]...)
+	s.reopen = open
+	s.cur = nil
+	s.curLen = 0
+	for _, l := range rest {
+		s.add(l)
+	}
+}
+
+// fit splits a line that cannot fit in an empty chunk
+func (s *splitter) fit(raw, fence string) []string {
+	room := s.budget - fenceReserve
+	if fence != "" {
+		room -= UTF16Len(fence) + 1
+	}
+	if UTF16Len(raw) <= room {
+		return []string{raw}
+	}
+
+	var pieces []string
+	runes := []rune(raw)
+	for len(runes) > 0 {
+		cut, units := 0, 0
+		for cut < len(runes) && units+utf16.RuneLen(runes[cut]) <= room {
+			units += utf16.RuneLen(runes[cut])
+			cut++
+		}
+		if cut == 0 {
+			// A long fence line or a tiny limit can leave no room; always
+			// take a rune so splitting ends, even if the chunk runs over
+			cut = 1
+		}
+		if cut < len(runes) {
+			// Prefer to break after whitespace in the last quarter
+			for i := cut; i > cut*3/4; i-- {
+				if unicode.IsSpace(runes[i-1]) {
+					cut = i
+					break
+				}
+			}
+		}
+		pieces = append(pieces, string(runes[:cut]))
+		runes = runes[cut:]
+	}
+	return pieces
+}
+
+// splitLines splits text into lines that keep their trailing newline
+func splitLines(text string) []string {
+	var lines []string
+	for len(text) > 0 {
+		i := strings.IndexByte(text, '\n')
+		if i == -1 {
+			lines = append(lines, text)
+			break
+		}
+		lines = append(lines, text[:i+1])
+		text = text[i+1:]
+	}
+	return lines
+}
+
+// nextFence returns the fence open after text, given the fence open before it
+func nextFence(open, text string) string {
+	trimmed := strings.TrimSpace(text)
+	marker := fenceMarker(trimmed)
+	if marker == "" {
+		return open
+	}
+	if open == "" {
+		return strings.TrimRight(text, "\r\n")
+	}
+	// A closing fence uses the same character, at least as many times, and nothing else
+	if marker[0] == fenceMarker(strings.TrimSpace(open))[0] && strings.Trim(trimmed, marker[:1]) == "" &&
+		len(trimmed) >= len(fenceMarker(strings.TrimSpace(open))) {
+		return ""
+	}
+	return open
+}
+
+// closing returns the text that closes the code block opened by fence
+func closing(fence string) string {
+	return "\n" + fenceMarker(strings.TrimSpace(fence))
+}
+
+// fenceMarker returns the leading run of ``` or ~~~ in a trimmed line
+func fenceMarker(trimmed string) string {
+	for _, ch := range []byte{'`', '~'} {
+		n := 0
+		for n < len(trimmed) && trimmed[n] == ch {
+			n++
+		}
+		if n >= 3 {
+			return trimmed[:n]
+		}
+	}
+	return ""
+}
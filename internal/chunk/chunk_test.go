@@ -0,0 +1,146 @@
+package chunk
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+func TestUTF16Len(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected int
+	}{
+		{"hello", 5},
+		{"回應", 2},
+		{"😀", 2}, // Outside the BMP: a surrogate pair
+		{"a😀b", 4},
+	}
+
+	for _, tt := range tests {
+		if got := UTF16Len(tt.input); got != tt.expected {
+			t.Errorf("UTF16Len(%q) = %d, want %d", tt.input, got, tt.expected)
+		}
+	}
+}
+
+func TestSplitShortTextUnchanged(t *testing.T) {
+	text := "短訊息\n\n```go\nfmt.Println()\n```"
+	chunks := Split(text, Limit)
+	if len(chunks) != 1 || chunks[0] != text {
+		t.Errorf("Expected text unchanged, got %q", chunks)
+	}
+}
+
+func TestSplitRespectsLimitInUTF16(t *testing.T) {
+	// Each line is 50 CJK characters plus an emoji
+	line := strings.Repeat("測", 50) + "😀\n"
+	text := strings.Repeat(line, 200)
+
+	limit := 1000
+	chunks := Split(text, limit)
+	if len(chunks) < 2 {
+		t.Fatalf("Expected multiple chunks, got %d", len(chunks))
+	}
+
+	for i, c := range Number(chunks) {
+		if UTF16Len(c) > limit {
+			t.Errorf("Chunk %d is %d UTF-16 units, limit %d", i, UTF16Len(c), limit)
+		}
+		if !utf8.ValidString(c) {
+			t.Errorf("Chunk %d is not valid UTF-8", i)
+		}
+	}
+
+	// Lossless apart from the newlines at the cuts
+	joined := strings.Join(chunks, "\n")
+	if strings.TrimSpace(joined) != strings.TrimSpace(text) {
+		t.Error("Chunks do not add up to the original text")
+	}
+}
+
+func TestSplitPrefersParagraphs(t *testing.T) {
+	para := strings.Repeat("word ", 30) + "\n"
+	text := para + para + "\n" + para + para + "\n" + para
+
+	chunks := Split(text, 400)
+	for i, c := range chunks[:len(chunks)-1] {
+		if !strings.HasSuffix(c, strings.TrimRight(para, "\n")) {
+			t.Errorf("Chunk %d should end at a paragraph boundary, got %q", i, c[len(c)-20:])
+		}
+	}
+}
+
+func TestSplitReopensCodeFences(t *testing.T) {
+	var sb strings.Builder
+	sb.WriteString("說明\n\n```python\n")
+	for i := 0; i < 100; i++ {
+		fmt.Fprintf(&sb, "print('第 %d 行')\n", i)
+	}
+	sb.WriteString("```\n\n結束")
+
+	chunks := Split(sb.String(), 500)
+	if len(chunks) < 3 {
+		t.Fatalf("Expected the code block to span several chunks, got %d", len(chunks))
+	}
+
+	for i, c := range chunks {
+		if strings.Count(c, "```")%2 != 0 {
+			t.Errorf("Chunk %d has unbalanced fences:\n%s", i, c)
+		}
+		if i > 0 && i < len(chunks)-1 && !strings.HasPrefix(c, "```python\n") {
+			t.Errorf("Chunk %d should reopen the fence with its language, got %q", i, c[:20])
+		}
+	}
+	if !strings.HasSuffix(chunks[len(chunks)-1], "結束") {
+		t.Error("Last chunk should hold the trailing text")
+	}
+}
+
+func TestSplitTildeFence(t *testing.T) {
+	text := "~~~\n" + strings.Repeat("x\n", 300) + "~~~"
+	for i, c := range Split(text, 200) {
+		if !strings.HasPrefix(c, "~~~") || !strings.HasSuffix(c, "~~~") {
+			t.Errorf("Chunk %d should be wrapped in ~~~ fences: %q", i, c)
+		}
+	}
+}
+
+func TestSplitLongLine(t *testing.T) {
+	text := strings.Repeat("長", 3000)
+	chunks := Split(text, 1000)
+	if len(chunks) < 3 {
+		t.Fatalf("Expected long line to be split, got %d chunks", len(chunks))
+	}
+	if strings.Join(chunks, "") != text {
+		t.Error("Splitting a long line should be lossless")
+	}
+}
+
+func TestSplitTinyLimitWithLongFence(t *testing.T) {
+	text := "```" + strings.Repeat("a", 40) + "\n" + strings.Repeat("程式", 30) + "\n```"
+
+	done := make(chan []string)
+	go func() { done <- Split(text, 30) }()
+	select {
+	case chunks := <-done:
+		if got := strings.Count(strings.Join(chunks, ""), "程"); got != 30 {
+			t.Errorf("Expected all 30 code runes across chunks, got %d", got)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Split did not finish when the fence left no room")
+	}
+}
+
+func TestNumber(t *testing.T) {
+	if got := Number([]string{"only"}); got[0] != "only" {
+		t.Errorf("Single chunk should not be numbered, got %q", got[0])
+	}
+
+	got := Number([]string{"a", "b", "c"})
+	if got[0] != "(1/3)\na" || got[2] != "(3/3)\nc" {
+		t.Errorf("Unexpected numbering: %q", got)
+	}
+}
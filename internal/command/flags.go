@@ -0,0 +1,262 @@
+package command
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/applejobs/telegram-remote-controller/internal/catalog"
+	"github.com/applejobs/telegram-remote-controller/internal/i18n"
+)
+
+// Flag errors, wrapped in a *ParseError
+var (
+	ErrUnknownFlag       = errors.New("unknown flag")
+	ErrMissingFlagValue  = errors.New("flag needs a value")
+	ErrInvalidFlagValue  = errors.New("invalid flag value")
+	ErrUnterminatedQuote = errors.New("unterminated quote")
+)
+
+// ParseError is a problem with one token of a command
+type ParseError struct {
+	Input  string // The whole message
+	Offset int    // Byte offset of Token in Input
+	Token  string // As typed
+	Err    error
+}
+
+func (e *ParseError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Token, e.Err)
+}
+
+func (e *ParseError) Unwrap() error { return e.Err }
+
+// Pointer returns the line of input holding the token, with carets under it
+func (e *ParseError) Pointer() string {
+	start := strings.LastIndexByte(e.Input[:e.Offset], '\n') + 1
+	end := len(e.Input)
+	if i := strings.IndexByte(e.Input[e.Offset:], '\n'); i >= 0 {
+		end = e.Offset + i
+	}
+	width := max(displayWidth(e.Token), 1)
+	return e.Input[start:end] + "\n" + strings.Repeat(" ", displayWidth(e.Input[start:e.Offset])) + strings.Repeat("^", width)
+}
+
+// displayWidth approximates how many columns s takes in a monospace font
+func displayWidth(s string) int {
+	n := 0
+	for _, r := range s {
+		if unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul) || (r >= 0xFF00 && r <= 0xFFEF) {
+			n += 2
+		} else {
+			n++
+		}
+	}
+	return n
+}
+
+// runFlag is one option /run accepts before the prompt
+type runFlag struct {
+	long        string
+	short       string
+	value       string // Name of the value; empty for a switch
+	description string // Message ID
+	apply       func(cmd *Command, value string, aliases *catalog.Catalog) error
+}
+
+var runFlags = []runFlag{
+	{"model", "m", "model", "flag.model", func(cmd *Command, v string, aliases *catalog.Catalog) error {
+		model, err := aliases.Model(v)
+		cmd.Model = model
+		return err
+	}},
+	{"app", "a", "app", "flag.app", func(cmd *Command, v string, aliases *catalog.Catalog) error {
+		cmd.AppName = aliases.App(v)
+		return nil
+	}},
+	{"timeout", "t", "duration", "flag.timeout", func(cmd *Command, v string, aliases *catalog.Catalog) error {
+		d, err := parseTimeout(v)
+		cmd.Timeout = d
+		return err
+	}},
+	{"workspace", "w", "path", "flag.workspace", func(cmd *Command, v string, aliases *catalog.Catalog) error {
+		cmd.Workspace = v
+		return nil
+	}},
+	{"new-chat", "n", "", "flag.new-chat", func(cmd *Command, _ string, _ *catalog.Catalog) error {
+		cmd.NewChat = true
+		return nil
+	}},
+	{"no-submit", "", "", "flag.no-submit", func(cmd *Command, _ string, _ *catalog.Catalog) error {
+		cmd.NoSubmit = true
+		return nil
+	}},
+	{"screenshot-after", "s", "", "flag.screenshot-after", func(cmd *Command, _ string, _ *catalog.Catalog) error {
+		cmd.ScreenshotAfter = true
+		return nil
+	}},
+}
+
+// parseTimeout accepts a Go duration or a number of seconds
+func parseTimeout(v string) (time.Duration, error) {
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		secs, convErr := strconv.Atoi(v)
+		if convErr != nil {
+			return 0, err
+		}
+		d = time.Duration(secs) * time.Second
+	}
+	if d <= 0 {
+		return 0, errors.New("must be positive")
+	}
+	return d, nil
+}
+
+// lookupRunFlag finds a flag by its long or short name
+func lookupRunFlag(name string, long bool) (runFlag, bool) {
+	for _, f := range runFlags {
+		if (long && f.long == name) || (!long && f.short != "" && f.short == name) {
+			return f, true
+		}
+	}
+	return runFlag{}, false
+}
+
+// runFlagHelp returns a /help line per /run flag
+func runFlagHelp(p i18n.Printer) []string {
+	var lines []string
+	for _, f := range runFlags {
+		line := "  --" + f.long
+		if f.short != "" {
+			line += ", -" + f.short
+		}
+		if f.value != "" {
+			line += " <" + f.value + ">"
+		}
+		lines = append(lines, line+" - "+p.T(f.description))
+	}
+	return lines
+}
+
+// token is one word of a command, unquoted
+type token struct {
+	text  string // Value with quotes removed
+	raw   string // As typed
+	start int    // Byte offset of raw
+}
+
+// scanToken reads the token starting at s[i], which is not whitespace.
+// Double quotes allow \" and \\ escapes; single quotes are literal.
+func scanToken(s string, i int) (token, error) {
+	var sb strings.Builder
+	start := i
+	for i < len(s) {
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if unicode.IsSpace(r) {
+			break
+		}
+		if r != '"' && r != '\'' {
+			sb.WriteRune(r)
+			i += size
+			continue
+		}
+
+		quote := s[i]
+		open := i
+		i++
+		for {
+			if i >= len(s) {
+				return token{}, &ParseError{Offset: open, Token: s[open:], Err: ErrUnterminatedQuote}
+			}
+			if s[i] == quote {
+				i++
+				break
+			}
+			if quote == '"' && s[i] == '\\' && i+1 < len(s) && (s[i+1] == '"' || s[i+1] == '\\') {
+				i++
+			}
+			sb.WriteByte(s[i])
+			i++
+		}
+	}
+	return token{text: sb.String(), raw: s[start:i], start: start}, nil
+}
+
+// skipSpace returns the offset of the first non-whitespace character at or after i
+func skipSpace(s string, i int) int {
+	for i < len(s) {
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if !unicode.IsSpace(r) {
+			break
+		}
+		i += size
+	}
+	return i
+}
+
+// parseRunFlags applies the flags at the start of rest to cmd and returns
+// the prompt: everything after "--" or from the first token that is not a
+// flag, exactly as typed
+func parseRunFlags(cmd *Command, rest string, aliases *catalog.Catalog) (string, error) {
+	i := skipSpace(rest, 0)
+	for i < len(rest) {
+		if rest[i] != '-' {
+			return rest[i:], nil
+		}
+
+		tok, err := scanToken(rest, i)
+		if err != nil {
+			return "", err
+		}
+		i = skipSpace(rest, tok.start+len(tok.raw))
+
+		if tok.raw == "--" {
+			return rest[i:], nil
+		}
+
+		name, value, hasValue := tok.text, "", false
+		long := strings.HasPrefix(name, "--")
+		if long {
+			name, value, hasValue = strings.Cut(name[2:], "=")
+		} else {
+			name = name[1:]
+		}
+
+		flag, ok := lookupRunFlag(name, long)
+		if !ok {
+			return "", &ParseError{Offset: tok.start, Token: tok.raw, Err: ErrUnknownFlag}
+		}
+
+		if flag.value == "" {
+			if hasValue {
+				return "", &ParseError{Offset: tok.start, Token: tok.raw, Err: fmt.Errorf("%w: --%s takes no value", ErrInvalidFlagValue, flag.long)}
+			}
+			flag.apply(cmd, "", aliases)
+			continue
+		}
+
+		at := tok
+		if !hasValue {
+			if i >= len(rest) {
+				return "", &ParseError{Offset: tok.start, Token: tok.raw, Err: ErrMissingFlagValue}
+			}
+			if at, err = scanToken(rest, i); err != nil {
+				return "", err
+			}
+			value = at.text
+			i = skipSpace(rest, at.start+len(at.raw))
+		}
+		if value == "" {
+			return "", &ParseError{Offset: at.start, Token: at.raw, Err: ErrMissingFlagValue}
+		}
+		if err := flag.apply(cmd, value, aliases); err != nil {
+			return "", &ParseError{Offset: at.start, Token: at.raw, Err: fmt.Errorf("%w: %w", ErrInvalidFlagValue, err)}
+		}
+	}
+	return "", nil
+}
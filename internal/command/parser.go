@@ -2,7 +2,12 @@ package command
 
 import (
 	"errors"
+	"fmt"
 	"strings"
+	"time"
+
+	"github.com/applejobs/telegram-remote-controller/internal/catalog"
+	"github.com/applejobs/telegram-remote-controller/internal/i18n"
 )
 
 // Command types
@@ -12,44 +17,39 @@ const (
 	CmdScreenshot = "screenshot"
 	CmdHelp       = "help"
 	CmdNotes      = "notes"
+	CmdQueue      = "queue"
+	CmdCancel     = "cancel"
+	CmdRetry      = "retry"
+	CmdModels     = "models"
+	CmdApps       = "apps"
+	CmdAlias      = "alias"
+	CmdRoute      = "route"
+	CmdTemplate   = "tpl"
+	CmdPrompt     = "p"
+	CmdLang       = "lang"
+	CmdSettings   = "settings"
+	CmdIDE        = "ide"
 )
 
-// Model aliases
-var modelAliases = map[string]string{
-	"thinking": "Claude Opus 4.5 (Thinking)",
-	"opus":     "Claude Opus 4.5 (Thinking)",
-	"coding":   "Gemini 3 Pro",
-	"gemini":   "Gemini 3 Pro",
-	"claude":   "Claude Opus 4.5",
-	"sonnet":   "Claude Sonnet 4",
-}
-
-// App aliases for common applications
-var appAliases = map[string]string{
-	"chrome":      "Google Chrome",
-	"safari":      "Safari",
-	"firefox":     "Firefox",
-	"code":        "Visual Studio Code",
-	"vscode":      "Visual Studio Code",
-	"terminal":    "Terminal",
-	"finder":      "Finder",
-	"antigravity": "Antigravity",
-	"ag":          "Antigravity",
-	"slack":       "Slack",
-	"discord":     "Discord",
-	"notion":      "Notion",
-}
-
-// DefaultModel is used when no model is specified
+// DefaultModel is used when no model is specified and no routing rule matches
 const DefaultModel = "Claude Opus 4.5 (Thinking)"
 
 // Command represents a parsed user command
 type Command struct {
 	Name    string   // Command name (run, status, screenshot, help)
-	Model   string   // Model selection (expanded from alias)
+	Model   string   // Model selection (expanded from alias); empty lets the router pick
 	Args    []string // Additional arguments
 	Prompt  string   // The main prompt content (raw, preserved)
-	AppName string   // For screenshot: which app to focus first
+	AppName string   // For screenshot: which app to focus first; for run: which app to drive. Empty uses the user's default
+
+	// Options set by /run flags
+	Timeout         time.Duration // How long to wait for the response; 0 uses the default
+	Workspace       string        // Folder to open in the app first
+	NewChat         bool          // Start a new chat before pasting
+	NoSubmit        bool          // Paste the prompt but leave submitting to the user
+	ScreenshotAfter bool          // Send a screenshot once the prompt is submitted
+
+	Vars map[string]string // For /p: template variables given as key=value
 }
 
 // Errors
@@ -57,90 +57,198 @@ var (
 	ErrEmptyInput     = errors.New("empty input")
 	ErrUnknownCommand = errors.New("unknown command")
 	ErrMissingPrompt  = errors.New("missing prompt")
+	ErrMissingJobID   = errors.New("missing job id")
+	ErrInvalidVar     = errors.New("expected key=value")
 )
 
-// Parse parses a user message into a Command
-func Parse(input string) (*Command, error) {
-	input = strings.TrimSpace(input)
-	if input == "" {
-		return nil, ErrEmptyInput
-	}
-
-	// Check if it's a command (starts with /)
-	if !strings.HasPrefix(input, "/") {
-		// Treat non-command messages as run commands with default model
-		return &Command{
-			Name:   CmdRun,
-			Model:  DefaultModel,
-			Prompt: input,
-		}, nil
-	}
+// Help sections, in the order /help shows them
+const (
+	GroupRun        = "run"
+	GroupTemplates  = "templates"
+	GroupQueue      = "queue"
+	GroupNotes      = "notes"
+	GroupScreenshot = "screenshot"
+	GroupAliases    = "aliases"
+	GroupOther      = "other"
+)
 
-	// Find command name (first word)
-	spaceIdx := strings.Index(input, " ")
-	var cmdPart, rest string
-	if spaceIdx == -1 {
-		cmdPart = input
-		rest = ""
-	} else {
-		cmdPart = input[:spaceIdx]
-		rest = strings.TrimSpace(input[spaceIdx+1:])
-	}
+// helpGroups orders the /help sections; titles are message IDs
+var helpGroups = []struct{ name, title string }{
+	{GroupRun, "help.group.run"},
+	{GroupTemplates, "help.group.templates"},
+	{GroupQueue, "help.group.queue"},
+	{GroupNotes, "help.group.notes"},
+	{GroupScreenshot, "help.group.screenshot"},
+	{GroupAliases, "help.group.aliases"},
+	{GroupOther, "help.group.other"},
+}
 
-	// Extract command name (remove leading /)
-	cmdName := strings.ToLower(strings.TrimPrefix(cmdPart, "/"))
-
-	switch cmdName {
-	case CmdRun:
-		return parseRunCommand(rest)
-	case CmdStatus:
-		return &Command{Name: CmdStatus}, nil
-	case CmdScreenshot:
-		return parseScreenshotCommand(rest)
-	case CmdNotes:
-		return parseNotesCommand(rest)
-	case CmdHelp:
-		return &Command{Name: CmdHelp}, nil
-	default:
-		return nil, ErrUnknownCommand
+// Builtins returns the built-in commands, without handlers, expanding
+// model and app names with aliases
+func Builtins(aliases *catalog.Catalog) []Spec {
+	return []Spec{
+		{
+			Name:        CmdRun,
+			Args:        []Arg{{Name: "prompt", Required: true, Rest: true}},
+			Description: "cmd.run",
+			Notes:       []string{"cmd.run.flags"},
+			Extra:       runFlagHelp,
+			Group:       GroupRun,
+			Parse:       func(rest string) (*Command, error) { return parseRunCommand(rest, aliases) },
+		},
+		{
+			Name:        CmdRoute,
+			Args:        []Arg{{Name: "prompt", Required: true, Rest: true}},
+			Description: "cmd.route",
+			Group:       GroupRun,
+		},
+		{
+			Name: CmdPrompt,
+			Args: []Arg{
+				{Name: "template", Required: true},
+				{Name: "key=value ...", Rest: true},
+			},
+			Description: "cmd.p",
+			Notes:       []string{"cmd.p.example"},
+			Group:       GroupTemplates,
+			Parse:       parsePromptCommand,
+		},
+		{
+			Name: CmdTemplate,
+			Args: []Arg{
+				{Name: "save|list|show|rm"},
+				{Name: "name"},
+				{Name: "text", Rest: true},
+			},
+			Description: "cmd.tpl",
+			Notes: []string{
+				"cmd.tpl.variables",
+				"cmd.tpl.macros",
+			},
+			Group: GroupTemplates,
+		},
+		{
+			Name:        CmdQueue,
+			Aliases:     []string{"jobs"},
+			Description: "cmd.queue",
+			Group:       GroupQueue,
+		},
+		{
+			Name:        CmdCancel,
+			Args:        []Arg{{Name: "id", Required: true}},
+			Description: "cmd.cancel",
+			Group:       GroupQueue,
+			Parse:       func(rest string) (*Command, error) { return parseJobCommand(CmdCancel, rest) },
+		},
+		{
+			Name:        CmdRetry,
+			Args:        []Arg{{Name: "id", Required: true}},
+			Description: "cmd.retry",
+			Group:       GroupQueue,
+			Parse:       func(rest string) (*Command, error) { return parseJobCommand(CmdRetry, rest) },
+		},
+		{
+			Name:        CmdNotes,
+			Aliases:     []string{"note", "idea"},
+			Args:        []Arg{{Name: "idea", Rest: true}},
+			Description: "cmd.notes",
+			Group:       GroupNotes,
+			Parse:       parseNotesCommand,
+		},
+		{
+			Name:        CmdScreenshot,
+			Aliases:     []string{"ss", "shot"},
+			Args:        []Arg{{Name: "app"}},
+			Description: "cmd.screenshot",
+			Group:       GroupScreenshot,
+			Parse:       func(rest string) (*Command, error) { return parseScreenshotCommand(rest, aliases) },
+		},
+		{
+			Name:        CmdModels,
+			Description: "cmd.models",
+			Group:       GroupAliases,
+		},
+		{
+			Name:        CmdApps,
+			Description: "cmd.apps",
+			Group:       GroupAliases,
+		},
+		{
+			Name: CmdAlias,
+			Args: []Arg{
+				{Name: "set|rm", Required: true},
+				{Name: "model|app", Required: true},
+				{Name: "alias", Required: true},
+				{Name: "name", Rest: true},
+			},
+			Description: "cmd.alias",
+			Notes:       []string{"cmd.alias.example"},
+			Group:       GroupAliases,
+			Role:        RoleAdmin,
+		},
+		{
+			Name:        CmdStatus,
+			Description: "cmd.status",
+			Group:       GroupOther,
+		},
+		{
+			Name: CmdSettings,
+			Args: []Arg{
+				{Name: "key"},
+				{Name: "value", Rest: true},
+			},
+			Description: "cmd.settings",
+			Notes:       []string{"cmd.settings.example"},
+			Group:       GroupOther,
+		},
+		{
+			Name:        CmdIDE,
+			Args:        []Arg{{Name: "profile"}},
+			Description: "cmd.ide",
+			Group:       GroupOther,
+		},
+		{
+			Name:        CmdLang,
+			Args:        []Arg{{Name: "zh-TW|en"}},
+			Description: "cmd.lang",
+			Group:       GroupOther,
+		},
+		{
+			Name:        CmdHelp,
+			Aliases:     []string{"start"},
+			Description: "cmd.help",
+			Group:       GroupOther,
+		},
 	}
 }
 
-// parseRunCommand parses a /run command with optional -m flag
-// Preserves the entire prompt with spaces
-func parseRunCommand(rest string) (*Command, error) {
-	cmd := &Command{
-		Name:  CmdRun,
-		Model: DefaultModel,
-	}
+// defaultRegistry parses with the built-in commands and aliases
+var defaultRegistry = mustRegistry(Builtins(catalog.New())...)
 
-	rest = strings.TrimSpace(rest)
-	if rest == "" {
-		return nil, ErrMissingPrompt
+func mustRegistry(specs ...Spec) *Registry {
+	r, err := NewRegistry(specs...)
+	if err != nil {
+		panic(err)
 	}
+	return r
+}
 
-	// Check for model flag at the beginning
-	if strings.HasPrefix(rest, "-m ") || strings.HasPrefix(rest, "-m\t") {
-		// Remove "-m "
-		rest = strings.TrimSpace(rest[3:])
-
-		// Find the model name (first word/token)
-		spaceIdx := strings.Index(rest, " ")
-		if spaceIdx == -1 {
-			// Only model name, no prompt
-			return nil, ErrMissingPrompt
-		}
+// Parse parses a user message into a Command using the built-in commands
+func Parse(input string) (*Command, error) {
+	return defaultRegistry.Parse(input)
+}
 
-		modelName := rest[:spaceIdx]
-		rest = strings.TrimSpace(rest[spaceIdx+1:])
+// parseRunCommand parses a /run command: flags, then the prompt, which is
+// kept exactly as typed
+func parseRunCommand(rest string, aliases *catalog.Catalog) (*Command, error) {
+	cmd := &Command{Name: CmdRun}
 
-		// Expand model alias
-		cmd.Model = expandModelAlias(modelName)
+	prompt, err := parseRunFlags(cmd, rest, aliases)
+	if err != nil {
+		return nil, err
 	}
 
-	// Rest is the entire prompt (preserved with spaces)
-	cmd.Prompt = rest
-
+	cmd.Prompt = strings.TrimSpace(prompt)
 	if cmd.Prompt == "" {
 		return nil, ErrMissingPrompt
 	}
@@ -149,41 +257,18 @@ func parseRunCommand(rest string) (*Command, error) {
 }
 
 // parseScreenshotCommand parses a /screenshot command with optional app name
-func parseScreenshotCommand(rest string) (*Command, error) {
-	cmd := &Command{
-		Name:    CmdScreenshot,
-		AppName: "Antigravity", // Default to Antigravity
-	}
+func parseScreenshotCommand(rest string, aliases *catalog.Catalog) (*Command, error) {
+	cmd := &Command{Name: CmdScreenshot}
 
 	rest = strings.TrimSpace(rest)
 	if rest != "" {
 		// User specified an app name
-		cmd.AppName = expandAppAlias(rest)
+		cmd.AppName = aliases.App(rest)
 	}
 
 	return cmd, nil
 }
 
-// expandModelAlias expands a model alias to full name
-func expandModelAlias(alias string) string {
-	lower := strings.ToLower(alias)
-	if full, ok := modelAliases[lower]; ok {
-		return full
-	}
-	// Return as-is if not an alias
-	return alias
-}
-
-// expandAppAlias expands an app alias to full name
-func expandAppAlias(alias string) string {
-	lower := strings.ToLower(alias)
-	if full, ok := appAliases[lower]; ok {
-		return full
-	}
-	// Return as-is if not an alias (user might have typed the full app name)
-	return alias
-}
-
 // parseNotesCommand parses a /notes command
 func parseNotesCommand(rest string) (*Command, error) {
 	return &Command{
@@ -192,36 +277,50 @@ func parseNotesCommand(rest string) (*Command, error) {
 	}, nil
 }
 
-// HelpText returns the help message
-func HelpText() string {
-	return `🤖 可用指令：
-
-📝 執行 Prompt：
-/run <prompt> - 使用預設 model
-/run -m <model> <prompt> - 指定 model
-
-💡 Ideas/Notes：
-/notes <idea> - 新增 idea
-/notes - 查看 Web UI 連結
+// parseJobCommand parses /cancel <id> and /retry <id>
+func parseJobCommand(name, rest string) (*Command, error) {
+	id := strings.TrimPrefix(strings.TrimSpace(rest), "#")
+	if id == "" {
+		return nil, ErrMissingJobID
+	}
+	return &Command{
+		Name: name,
+		Args: []string{id},
+	}, nil
+}
 
-🎯 Model 別名：
-• thinking / opus → Claude Opus 4.5 (Thinking)
-• coding / gemini → Gemini 3 Pro  
-• claude → Claude Opus 4.5
-• sonnet → Claude Sonnet 4
+// parsePromptCommand parses /p <template> key=value ..., where values may
+// be quoted
+func parsePromptCommand(rest string) (*Command, error) {
+	cmd := &Command{Name: CmdPrompt, Vars: make(map[string]string)}
 
-📸 截圖：
-/screenshot - 截取 Antigravity
-/screenshot <app> - 截取指定應用程式
+	i := skipSpace(rest, 0)
+	for i < len(rest) {
+		tok, err := scanToken(rest, i)
+		if err != nil {
+			return nil, err
+		}
+		i = skipSpace(rest, tok.start+len(tok.raw))
 
-📱 App 別名：
-• chrome, safari, firefox
-• code/vscode, terminal, finder
-• ag → Antigravity
+		if len(cmd.Args) == 0 {
+			cmd.Args = append(cmd.Args, tok.text)
+			continue
+		}
+		key, value, ok := strings.Cut(tok.text, "=")
+		if !ok || key == "" {
+			return nil, &ParseError{Offset: tok.start, Token: tok.raw, Err: ErrInvalidVar}
+		}
+		cmd.Vars[key] = value
+	}
 
-🔧 其他：
-/status - 檢查系統狀態
-/help - 顯示此說明
+	if len(cmd.Args) == 0 {
+		return nil, fmt.Errorf("%w: template", ErrMissingArgument)
+	}
+	return cmd, nil
+}
 
-💡 直接發送文字也會用預設 model 執行！`
+// HelpText returns the help message listing every built-in command in the
+// default locale
+func HelpText() string {
+	return defaultRegistry.Help(RoleAdmin, i18n.For(i18n.Default))
 }
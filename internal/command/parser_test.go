@@ -1,7 +1,13 @@
 package command
 
 import (
+	"errors"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/applejobs/telegram-remote-controller/internal/catalog"
 )
 
 func TestParseRunCommand(t *testing.T) {
@@ -102,6 +108,46 @@ func TestParseRunWithModelMissingPrompt(t *testing.T) {
 	}
 }
 
+func TestParseQueue(t *testing.T) {
+	cmd, err := Parse("/queue")
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if cmd.Name != CmdQueue {
+		t.Errorf("Expected name 'queue', got '%s'", cmd.Name)
+	}
+}
+
+func TestParseJobCommands(t *testing.T) {
+	tests := []struct {
+		input string
+		name  string
+		id    string
+	}{
+		{"/cancel 3", CmdCancel, "3"},
+		{"/retry #12", CmdRetry, "12"},
+	}
+
+	for _, tt := range tests {
+		cmd, err := Parse(tt.input)
+		if err != nil {
+			t.Errorf("Parse(%s) failed: %v", tt.input, err)
+			continue
+		}
+		if cmd.Name != tt.name || len(cmd.Args) != 1 || cmd.Args[0] != tt.id {
+			t.Errorf("Parse(%s) = %+v, want %s %s", tt.input, cmd, tt.name, tt.id)
+		}
+	}
+}
+
+func TestParseJobCommandMissingID(t *testing.T) {
+	for _, input := range []string{"/cancel", "/retry  "} {
+		if _, err := Parse(input); err != ErrMissingJobID {
+			t.Errorf("Parse(%q): expected ErrMissingJobID, got %v", input, err)
+		}
+	}
+}
+
 func TestCaseInsensitive(t *testing.T) {
 	commands := []string{"/RUN test", "/Run test", "/run test"}
 	for _, input := range commands {
@@ -122,3 +168,134 @@ func TestHelpText(t *testing.T) {
 		t.Error("HelpText() returned empty string")
 	}
 }
+
+func TestParseRunFlags(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  Command
+	}{
+		{"tab after model", "/run -m\tsonnet\tfix it", Command{Model: "Claude Sonnet 4", Prompt: "fix it"}},
+		{"long flag", "/run --model gemini hi", Command{Model: "Gemini 3 Pro", Prompt: "hi"}},
+		{"equals value", "/run --model=sonnet hi", Command{Model: "Claude Sonnet 4", Prompt: "hi"}},
+		{"quoted value", `/run --model "claude sonnet 4" hi`, Command{Model: "Claude Sonnet 4", Prompt: "hi"}},
+		{"quoted equals value", `/run --workspace="~/code/my app" hi`, Command{Workspace: "~/code/my app", Prompt: "hi"}},
+		{"single quotes are literal", `/run -w '/tmp/a\b' hi`, Command{Workspace: `/tmp/a\b`, Prompt: "hi"}},
+		{"escaped quote", `/run -w "say \"hi\"" go`, Command{Workspace: `say "hi"`, Prompt: "go"}},
+		{"app alias", "/run --app code hi", Command{AppName: "Visual Studio Code", Prompt: "hi"}},
+		{"timeout duration", "/run -t 10m hi", Command{Timeout: 10 * time.Minute, Prompt: "hi"}},
+		{"timeout seconds", "/run --timeout 90 hi", Command{Timeout: 90 * time.Second, Prompt: "hi"}},
+		{"switches", "/run --new-chat --no-submit -s hi", Command{NewChat: true, NoSubmit: true, ScreenshotAfter: true, Prompt: "hi"}},
+		{"prompt after double dash", "/run -n -- --model is a flag", Command{NewChat: true, Prompt: "--model is a flag"}},
+		{"prompt untouched", "/run -n  say \"hi\"  -m x\n\tnext line", Command{NewChat: true, Prompt: "say \"hi\"  -m x\n\tnext line"}},
+		{"quoted prompt kept as typed", `/run "quoted" rest`, Command{Prompt: `"quoted" rest`}},
+		{"unterminated quote in prompt", `/run it's fine`, Command{Prompt: `it's fine`}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd, err := Parse(tt.input)
+			if err != nil {
+				t.Fatalf("Parse(%q) failed: %v", tt.input, err)
+			}
+			tt.want.Name = CmdRun
+			if !reflect.DeepEqual(*cmd, tt.want) {
+				t.Errorf("Parse(%q) =\n%+v\nwant\n%+v", tt.input, *cmd, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseRunWithoutModelIsRouted(t *testing.T) {
+	for _, input := range []string{"/run hello", "hello"} {
+		cmd, err := Parse(input)
+		if err != nil || cmd.Model != "" {
+			t.Errorf("Parse(%q): model should be left to the router, got %q, %v", input, cmd.Model, err)
+		}
+	}
+}
+
+func TestParseRunFlagErrors(t *testing.T) {
+	tests := []struct {
+		input string
+		err   error
+		token string
+	}{
+		{"/run --modle x hi", ErrUnknownFlag, "--modle"},
+		{"/run -x hi", ErrUnknownFlag, "-x"},
+		{"/run -m", ErrMissingFlagValue, "-m"},
+		{"/run --timeout soon hi", ErrInvalidFlagValue, "soon"},
+		{"/run --timeout=-5s hi", ErrInvalidFlagValue, "--timeout=-5s"},
+		{"/run --no-submit=yes hi", ErrInvalidFlagValue, "--no-submit=yes"},
+		{`/run -w "unfinished hi`, ErrUnterminatedQuote, `"unfinished hi`},
+		{"/run --model= hi", ErrMissingFlagValue, "--model="},
+		{"/run -m opsu hi", ErrInvalidFlagValue, "opsu"},
+	}
+
+	for _, tt := range tests {
+		_, err := Parse(tt.input)
+		if !errors.Is(err, tt.err) {
+			t.Errorf("Parse(%q): expected %v, got %v", tt.input, tt.err, err)
+			continue
+		}
+		var perr *ParseError
+		if !errors.As(err, &perr) {
+			t.Errorf("Parse(%q): expected a *ParseError, got %T", tt.input, err)
+			continue
+		}
+		if perr.Token != tt.token || perr.Input[perr.Offset:perr.Offset+len(perr.Token)] != tt.token {
+			t.Errorf("Parse(%q): error points at %q (offset %d), want %q", tt.input, perr.Token, perr.Offset, tt.token)
+		}
+	}
+}
+
+func TestParseRunSuggestsModels(t *testing.T) {
+	_, err := Parse("/run -m sonet hi")
+	var unknown *catalog.UnknownError
+	if !errors.As(err, &unknown) {
+		t.Fatalf("Expected an unknown model error, got %v", err)
+	}
+	if len(unknown.Suggestions) == 0 || unknown.Suggestions[0] != "sonnet" {
+		t.Errorf("Expected sonnet to be suggested first, got %v", unknown.Suggestions)
+	}
+	if !strings.Contains(err.Error(), "did you mean sonnet") {
+		t.Errorf("Error should carry the suggestion, got %q", err.Error())
+	}
+}
+
+func TestParseErrorPointer(t *testing.T) {
+	_, err := Parse("/run -n --modle x\nsecond line")
+	var perr *ParseError
+	if !errors.As(err, &perr) {
+		t.Fatalf("Expected a *ParseError, got %v", err)
+	}
+	want := "/run -n --modle x\n        ^^^^^^^"
+	if got := perr.Pointer(); got != want {
+		t.Errorf("Pointer() =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestParsePromptCommand(t *testing.T) {
+	cmd, err := Parse(`/p review file=main.go lang="繁體 中文" empty=`)
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	want := map[string]string{"file": "main.go", "lang": "繁體 中文", "empty": ""}
+	if cmd.Name != CmdPrompt || len(cmd.Args) != 1 || cmd.Args[0] != "review" || !reflect.DeepEqual(cmd.Vars, want) {
+		t.Errorf("Unexpected command: %+v", cmd)
+	}
+
+	_, err = Parse("/p review main.go")
+	var perr *ParseError
+	if !errors.As(err, &perr) || !errors.Is(err, ErrInvalidVar) || perr.Token != "main.go" {
+		t.Errorf("Expected a ParseError on main.go, got %v", err)
+	}
+	if _, err := Parse("/p"); !errors.Is(err, ErrMissingArgument) {
+		t.Errorf("Expected ErrMissingArgument, got %v", err)
+	}
+
+	cmd, err = Parse("/tpl save daily\n/run standup")
+	if err != nil || len(cmd.Args) != 2 || cmd.Args[1] != "daily" || cmd.Prompt != "/run standup" {
+		t.Errorf("Template text should start after the name, got %+v, %v", cmd, err)
+	}
+}
@@ -0,0 +1,255 @@
+package command
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/applejobs/telegram-remote-controller/internal/i18n"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Role is what a user may do; a command needs at least its Spec.Role
+type Role int
+
+const (
+	RoleUser  Role = iota // Any allowed user
+	RoleAdmin             // Users named as admins
+)
+
+// Arg describes one argument of a command
+type Arg struct {
+	Name     string // Shown in usage, e.g. "id"
+	Required bool
+	Rest     bool // Takes the rest of the message, spaces and all, as the prompt
+}
+
+// Handler runs a parsed command sent in msg
+type Handler func(ctx context.Context, msg *tgbotapi.Message, cmd *Command) error
+
+// Spec declares a command: how it is parsed, documented and handled
+type Spec struct {
+	Name        string
+	Aliases     []string
+	Args        []Arg
+	Description string   // Message ID of one line for /help and the Telegram menu
+	Notes       []string // Message IDs of extra /help lines, e.g. other forms of the command
+	Group       string   // /help section
+	Role        Role
+	Handler     Handler
+
+	// Extra generates /help lines after Notes, e.g. from a flag table
+	Extra func(p i18n.Printer) []string
+
+	// Parse parses the text after the command name; by default Args are
+	// filled in from whitespace-separated words
+	Parse func(rest string) (*Command, error)
+}
+
+// Usage returns the command line shown in /help, e.g. "/cancel <id>"
+func (s Spec) Usage() string {
+	usage := "/" + s.Name
+	for _, arg := range s.Args {
+		if arg.Required {
+			usage += " <" + arg.Name + ">"
+		} else {
+			usage += " [" + arg.Name + "]"
+		}
+	}
+	return usage
+}
+
+// MenuEntry is one command in Telegram's command menu
+type MenuEntry struct {
+	Command     string
+	Description string
+}
+
+// Registry holds the known commands
+type Registry struct {
+	specs []Spec
+	index map[string]int // Names and aliases to positions in specs
+}
+
+// Errors
+var (
+	ErrMissingArgument = errors.New("missing argument")
+	ErrDuplicateName   = errors.New("duplicate command name")
+	ErrInvalidName     = errors.New("invalid command name")
+	ErrMissingHandler  = errors.New("command has no handler")
+)
+
+// namePattern is what Telegram accepts as a command name
+var namePattern = regexp.MustCompile(`^[a-z0-9_]{1,32}$`)
+
+// NewRegistry creates a registry of specs, checking names are valid and unique
+func NewRegistry(specs ...Spec) (*Registry, error) {
+	r := &Registry{index: make(map[string]int)}
+	for _, spec := range specs {
+		for _, name := range append([]string{spec.Name}, spec.Aliases...) {
+			if !namePattern.MatchString(name) {
+				return nil, fmt.Errorf("%w: %q", ErrInvalidName, name)
+			}
+			if _, ok := r.index[name]; ok {
+				return nil, fmt.Errorf("%w: %q", ErrDuplicateName, name)
+			}
+			r.index[name] = len(r.specs)
+		}
+		r.specs = append(r.specs, spec)
+	}
+	return r, nil
+}
+
+// WithHandlers returns a copy of the registry with handlers bound by
+// command name. Every command must get one.
+func (r *Registry) WithHandlers(handlers map[string]Handler) (*Registry, error) {
+	bound := &Registry{specs: make([]Spec, len(r.specs)), index: r.index}
+	for i, spec := range r.specs {
+		handler, ok := handlers[spec.Name]
+		if !ok || handler == nil {
+			return nil, fmt.Errorf("%w: /%s", ErrMissingHandler, spec.Name)
+		}
+		spec.Handler = handler
+		bound.specs[i] = spec
+	}
+	for name := range handlers {
+		if _, ok := r.index[name]; !ok {
+			return nil, fmt.Errorf("%w: /%s", ErrUnknownCommand, name)
+		}
+	}
+	return bound, nil
+}
+
+// Specs returns the registered commands in registration order
+func (r *Registry) Specs() []Spec {
+	return append([]Spec(nil), r.specs...)
+}
+
+// Lookup finds a command by name or alias
+func (r *Registry) Lookup(name string) (Spec, bool) {
+	i, ok := r.index[strings.ToLower(name)]
+	if !ok {
+		return Spec{}, false
+	}
+	return r.specs[i], true
+}
+
+// Parse parses a user message into a Command. Text that is not a command
+// runs as a prompt, with the model left for the router.
+func (r *Registry) Parse(input string) (*Command, error) {
+	input = strings.TrimSpace(input)
+	if input == "" {
+		return nil, ErrEmptyInput
+	}
+
+	if !strings.HasPrefix(input, "/") {
+		return &Command{
+			Name:   CmdRun,
+			Prompt: input,
+		}, nil
+	}
+
+	name, rest := input[1:], ""
+	if i := strings.IndexFunc(name, unicode.IsSpace); i >= 0 {
+		name, rest = name[:i], name[i:]
+	}
+	// In groups Telegram appends the bot's name, e.g. /status@my_bot
+	name, _, _ = strings.Cut(name, "@")
+
+	spec, ok := r.Lookup(name)
+	if !ok {
+		return nil, ErrUnknownCommand
+	}
+	rest = strings.TrimSpace(rest)
+	parse := spec.parseArgs
+	if spec.Parse != nil {
+		parse = spec.Parse
+	}
+	cmd, err := parse(rest)
+
+	// Point token errors at the whole message
+	var perr *ParseError
+	if errors.As(err, &perr) {
+		perr.Input = input
+		perr.Offset += len(input) - len(rest)
+	}
+	return cmd, err
+}
+
+// parseArgs fills a Command from whitespace-separated words according to Args
+func (s Spec) parseArgs(rest string) (*Command, error) {
+	cmd := &Command{Name: s.Name}
+	for _, arg := range s.Args {
+		if arg.Rest {
+			cmd.Prompt = rest
+			rest = ""
+			if cmd.Prompt == "" && arg.Required {
+				return nil, fmt.Errorf("%w: %s", ErrMissingArgument, arg.Name)
+			}
+			continue
+		}
+
+		word, remaining := rest, ""
+		if i := strings.IndexFunc(rest, unicode.IsSpace); i >= 0 {
+			word, remaining = rest[:i], rest[i:]
+		}
+		rest = strings.TrimSpace(remaining)
+		if word == "" {
+			if arg.Required {
+				return nil, fmt.Errorf("%w: %s", ErrMissingArgument, arg.Name)
+			}
+			continue
+		}
+		cmd.Args = append(cmd.Args, word)
+	}
+	return cmd, nil
+}
+
+// Help returns the /help text listing the commands role may use, in p's locale
+func (r *Registry) Help(role Role, p i18n.Printer) string {
+	var sb strings.Builder
+	sb.WriteString(p.T("help.title") + "\n")
+
+	for _, group := range helpGroups {
+		var lines []string
+		for _, spec := range r.specs {
+			if spec.Group != group.name || spec.Role > role {
+				continue
+			}
+			line := spec.Usage() + " - " + p.T(spec.Description)
+			if len(spec.Aliases) > 0 {
+				line += p.T("help.aliases", "/"+strings.Join(spec.Aliases, ", /"))
+			}
+			lines = append(lines, line)
+			for _, note := range spec.Notes {
+				lines = append(lines, p.T(note))
+			}
+			if spec.Extra != nil {
+				lines = append(lines, spec.Extra(p)...)
+			}
+		}
+		if len(lines) == 0 {
+			continue
+		}
+		sb.WriteString("\n" + p.T(group.title) + "\n")
+		sb.WriteString(strings.Join(lines, "\n"))
+		sb.WriteString("\n")
+	}
+
+	sb.WriteString("\n" + p.T("help.footer"))
+	return sb.String()
+}
+
+// Menu returns the commands role may use, for Telegram's setMyCommands
+func (r *Registry) Menu(role Role, p i18n.Printer) []MenuEntry {
+	var menu []MenuEntry
+	for _, spec := range r.specs {
+		if spec.Role <= role {
+			menu = append(menu, MenuEntry{Command: spec.Name, Description: p.T(spec.Description)})
+		}
+	}
+	return menu
+}
@@ -0,0 +1,156 @@
+package command
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/applejobs/telegram-remote-controller/internal/catalog"
+	"github.com/applejobs/telegram-remote-controller/internal/i18n"
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+func TestEveryCommandIsDocumented(t *testing.T) {
+	for _, locale := range i18n.Locales() {
+		p := i18n.For(locale)
+		help := defaultRegistry.Help(RoleAdmin, p)
+		menu := map[string]string{}
+		for _, entry := range defaultRegistry.Menu(RoleAdmin, p) {
+			menu[entry.Command] = entry.Description
+		}
+
+		for _, spec := range Builtins(catalog.New()) {
+			description := p.T(spec.Description)
+			if !p.Has(spec.Description) {
+				t.Errorf("%s: /%s description %q is not in the catalog", locale, spec.Name, spec.Description)
+			}
+			for _, note := range spec.Notes {
+				if !p.Has(note) {
+					t.Errorf("%s: /%s note %q is not in the catalog", locale, spec.Name, note)
+				}
+			}
+			// Telegram wants menu descriptions of 3-256 characters
+			if n := len([]rune(description)); n < 3 || n > 256 {
+				t.Errorf("%s: /%s description must be 3-256 characters, got %q", locale, spec.Name, description)
+			}
+			if !strings.Contains(help, spec.Usage()+" - "+description) {
+				t.Errorf("%s: /%s is missing from /help", locale, spec.Name)
+			}
+			if menu[spec.Name] != description {
+				t.Errorf("%s: /%s is missing from the command menu", locale, spec.Name)
+			}
+			if !knownGroup(spec.Group) {
+				t.Errorf("/%s has unknown help group %q", spec.Name, spec.Group)
+			}
+		}
+		for _, group := range helpGroups {
+			if !p.Has(group.title) {
+				t.Errorf("%s: help group title %q is not in the catalog", locale, group.title)
+			}
+		}
+	}
+}
+
+func knownGroup(name string) bool {
+	for _, group := range helpGroups {
+		if group.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+func TestHelpAndMenuRespectRoles(t *testing.T) {
+	if strings.Contains(defaultRegistry.Help(RoleUser, i18n.For(i18n.Default)), "/alias") {
+		t.Error("Admin commands should not be listed for users")
+	}
+	for _, entry := range defaultRegistry.Menu(RoleUser, i18n.For(i18n.Default)) {
+		if entry.Command == CmdAlias {
+			t.Error("Admin commands should not be in the user menu")
+		}
+	}
+}
+
+func TestParseAliasesAndBotName(t *testing.T) {
+	tests := []struct {
+		input string
+		name  string
+	}{
+		{"/ss", CmdScreenshot},
+		{"/start", CmdHelp},
+		{"/jobs", CmdQueue},
+		{"/status@test_bot", CmdStatus},
+		{"/Idea 新想法", CmdNotes},
+	}
+
+	for _, tt := range tests {
+		cmd, err := Parse(tt.input)
+		if err != nil {
+			t.Errorf("Parse(%q) failed: %v", tt.input, err)
+			continue
+		}
+		if cmd.Name != tt.name {
+			t.Errorf("Parse(%q) = %s, want %s", tt.input, cmd.Name, tt.name)
+		}
+	}
+}
+
+func TestParseArgsFromSchema(t *testing.T) {
+	r, err := NewRegistry(Spec{
+		Name:        "tag",
+		Args:        []Arg{{Name: "id", Required: true}, {Name: "label"}, {Name: "note", Rest: true}},
+		Description: "Tag a job",
+	})
+	if err != nil {
+		t.Fatalf("NewRegistry failed: %v", err)
+	}
+
+	cmd, err := r.Parse("/tag 3 urgent  needs a second look")
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if len(cmd.Args) != 2 || cmd.Args[0] != "3" || cmd.Args[1] != "urgent" || cmd.Prompt != "needs a second look" {
+		t.Errorf("Unexpected command: %+v", cmd)
+	}
+
+	if _, err := r.Parse("/tag"); !errors.Is(err, ErrMissingArgument) {
+		t.Errorf("Expected ErrMissingArgument, got %v", err)
+	}
+	if got := (Spec{Name: "tag", Args: []Arg{{Name: "id", Required: true}, {Name: "label"}}}).Usage(); got != "/tag <id> [label]" {
+		t.Errorf("Unexpected usage %q", got)
+	}
+}
+
+func TestNewRegistryRejectsBadNames(t *testing.T) {
+	if _, err := NewRegistry(Spec{Name: "a"}, Spec{Name: "b", Aliases: []string{"a"}}); !errors.Is(err, ErrDuplicateName) {
+		t.Errorf("Expected ErrDuplicateName, got %v", err)
+	}
+	if _, err := NewRegistry(Spec{Name: "Bad-Name"}); !errors.Is(err, ErrInvalidName) {
+		t.Errorf("Expected ErrInvalidName, got %v", err)
+	}
+}
+
+func TestWithHandlers(t *testing.T) {
+	noop := func(ctx context.Context, msg *tgbotapi.Message, cmd *Command) error { return nil }
+
+	handlers := map[string]Handler{}
+	for _, spec := range Builtins(catalog.New()) {
+		handlers[spec.Name] = noop
+	}
+	bound, err := defaultRegistry.WithHandlers(handlers)
+	if err != nil {
+		t.Fatalf("WithHandlers failed: %v", err)
+	}
+	if spec, _ := bound.Lookup(CmdRun); spec.Handler == nil {
+		t.Error("Expected /run to have a handler")
+	}
+	if spec, _ := defaultRegistry.Lookup(CmdRun); spec.Handler != nil {
+		t.Error("WithHandlers should not change the original registry")
+	}
+
+	delete(handlers, CmdHelp)
+	if _, err := defaultRegistry.WithHandlers(handlers); !errors.Is(err, ErrMissingHandler) {
+		t.Errorf("Expected ErrMissingHandler, got %v", err)
+	}
+}
@@ -3,40 +3,44 @@ package controller
 import (
 	"fmt"
 	"log"
-	"os/exec"
-	"strings"
 	"time"
+
+	"github.com/applejobs/telegram-remote-controller/internal/automation"
 )
 
 // ClipboardMonitor monitors clipboard for changes
 type ClipboardMonitor struct {
 	pollInterval time.Duration
 	timeout      time.Duration
+	auto         automation.Automator
 }
 
-// NewClipboardMonitor creates a new clipboard monitor
+// NewClipboardMonitor creates a new clipboard monitor for this platform
 func NewClipboardMonitor() *ClipboardMonitor {
+	return NewClipboardMonitorWith(automation.New())
+}
+
+// NewClipboardMonitorWith creates a clipboard monitor that reads the clipboard through auto
+func NewClipboardMonitorWith(auto automation.Automator) *ClipboardMonitor {
 	return &ClipboardMonitor{
 		pollInterval: 500 * time.Millisecond,
 		timeout:      60 * time.Second, // Wait up to 60 seconds for response
+		auto:         auto,
 	}
 }
 
 // GetClipboard reads the current clipboard content
 func (m *ClipboardMonitor) GetClipboard() (string, error) {
-	cmd := exec.Command("pbpaste")
-	output, err := cmd.Output()
+	text, err := m.auto.GetClipboard()
 	if err != nil {
 		return "", fmt.Errorf("failed to read clipboard: %w", err)
 	}
-	return string(output), nil
+	return text, nil
 }
 
 // SetClipboard sets the clipboard content
 func (m *ClipboardMonitor) SetClipboard(text string) error {
-	cmd := exec.Command("pbcopy")
-	cmd.Stdin = strings.NewReader(text)
-	return cmd.Run()
+	return m.auto.SetClipboard(text)
 }
 
 // WaitForChange waits for clipboard content to change from the initial value
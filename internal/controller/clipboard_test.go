@@ -0,0 +1,32 @@
+package controller
+
+import (
+	"testing"
+	"time"
+
+	"github.com/applejobs/telegram-remote-controller/internal/automation"
+)
+
+func TestClipboardMonitorWaitsForNewContent(t *testing.T) {
+	rec := automation.NewRecorder()
+	rec.SetClipboard("old")
+	m := NewClipboardMonitorWith(rec)
+	m.pollInterval = time.Millisecond
+	m.timeout = time.Second
+
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		rec.SetClipboard("answer")
+	}()
+
+	got, err := m.WaitForNewContent()
+	if err != nil {
+		t.Fatalf("WaitForNewContent failed: %v", err)
+	}
+	if got != "answer" {
+		t.Errorf("Expected %q, got %q", "answer", got)
+	}
+	if actions := rec.Actions(); actions[1] != "set clipboard " {
+		t.Errorf("Expected the clipboard to be cleared first, got %q", actions)
+	}
+}
@@ -0,0 +1,35 @@
+package controller
+
+import "errors"
+
+// fsOp describes what happened to a watched path
+type fsOp int
+
+const (
+	// opChanged means the path was created or written to
+	opChanged fsOp = iota
+	// opClosed means a writer closed the file; more writes may follow
+	opClosed
+	// opMovedIn means the file was renamed into place, so it is complete
+	opMovedIn
+	// opRemoved means the path was deleted or renamed away
+	opRemoved
+	// opOverflow means events were dropped and the directory must be rescanned
+	opOverflow
+)
+
+// fsEvent is a single change notification from the OS
+type fsEvent struct {
+	Path string
+	Op   fsOp
+}
+
+// eventSource delivers change notifications for one directory
+type eventSource interface {
+	Events() <-chan fsEvent
+	Close() error
+}
+
+// errEventsUnsupported is returned on platforms without a native watcher;
+// the FileWatcher falls back to polling
+var errEventsUnsupported = errors.New("file events not supported on this platform")
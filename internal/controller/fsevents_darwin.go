@@ -0,0 +1,173 @@
+//go:build darwin
+
+package controller
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// kqueueSource watches a directory and its files with kqueue
+type kqueueSource struct {
+	dir    string
+	kq     int
+	events chan fsEvent
+
+	mu     sync.Mutex
+	fds    map[int]string // watched fd -> path
+	paths  map[string]int // path -> watched fd
+	closed bool
+}
+
+// newEventSource starts a kqueue watch on dir
+func newEventSource(dir string) (eventSource, error) {
+	kq, err := syscall.Kqueue()
+	if err != nil {
+		return nil, fmt.Errorf("kqueue: %w", err)
+	}
+
+	s := &kqueueSource{
+		dir:    dir,
+		kq:     kq,
+		events: make(chan fsEvent, 64),
+		fds:    make(map[int]string),
+		paths:  make(map[string]int),
+	}
+
+	if err := s.watch(dir); err != nil {
+		syscall.Close(kq)
+		return nil, err
+	}
+	s.syncEntries(false)
+
+	go s.read()
+	return s, nil
+}
+
+// Events returns the notification channel
+func (s *kqueueSource) Events() <-chan fsEvent {
+	return s.events
+}
+
+// Close stops watching
+func (s *kqueueSource) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	return nil
+}
+
+// watch registers a vnode filter for path
+func (s *kqueueSource) watch(path string) error {
+	fd, err := syscall.Open(path, syscall.O_EVTONLY|syscall.O_CLOEXEC, 0)
+	if err != nil {
+		return fmt.Errorf("open %s: %w", path, err)
+	}
+
+	var change syscall.Kevent_t
+	syscall.SetKevent(&change, fd, syscall.EVFILT_VNODE, syscall.EV_ADD|syscall.EV_ENABLE|syscall.EV_CLEAR)
+	change.Fflags = syscall.NOTE_WRITE | syscall.NOTE_EXTEND | syscall.NOTE_DELETE | syscall.NOTE_RENAME
+	if _, err := syscall.Kevent(s.kq, []syscall.Kevent_t{change}, nil, nil); err != nil {
+		syscall.Close(fd)
+		return fmt.Errorf("kevent %s: %w", path, err)
+	}
+
+	s.mu.Lock()
+	s.fds[fd] = path
+	s.paths[path] = fd
+	s.mu.Unlock()
+	return nil
+}
+
+// unwatch drops the filter for path
+func (s *kqueueSource) unwatch(path string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if fd, ok := s.paths[path]; ok {
+		syscall.Close(fd)
+		delete(s.fds, fd)
+		delete(s.paths, path)
+	}
+}
+
+// syncEntries watches files that appeared in the directory since the last
+// call. kqueue does not tell a rename from a create, so a file that already
+// has content when it appears is reported as renamed into place.
+func (s *kqueueSource) syncEntries(emit bool) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return
+	}
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		path := filepath.Join(s.dir, entry.Name())
+		s.mu.Lock()
+		_, known := s.paths[path]
+		s.mu.Unlock()
+		if known {
+			continue
+		}
+		if err := s.watch(path); err == nil && emit {
+			op := opChanged
+			if info, err := entry.Info(); err == nil && info.Size() > 0 {
+				op = opMovedIn
+			}
+			s.events <- fsEvent{Path: path, Op: op}
+		}
+	}
+}
+
+func (s *kqueueSource) read() {
+	defer func() {
+		s.mu.Lock()
+		for fd := range s.fds {
+			syscall.Close(fd)
+		}
+		s.mu.Unlock()
+		syscall.Close(s.kq)
+		close(s.events)
+	}()
+
+	received := make([]syscall.Kevent_t, 32)
+	timeout := syscall.NsecToTimespec(int64(500 * time.Millisecond))
+
+	for {
+		s.mu.Lock()
+		closed := s.closed
+		s.mu.Unlock()
+		if closed {
+			return
+		}
+
+		n, err := syscall.Kevent(s.kq, nil, received, &timeout)
+		if err != nil {
+			if err == syscall.EINTR {
+				continue
+			}
+			return
+		}
+
+		for _, ev := range received[:n] {
+			s.mu.Lock()
+			path := s.fds[int(ev.Ident)]
+			s.mu.Unlock()
+
+			switch {
+			case path == s.dir:
+				// Entries were added, removed or renamed into the directory
+				s.syncEntries(true)
+			case ev.Fflags&(syscall.NOTE_DELETE|syscall.NOTE_RENAME) != 0:
+				s.unwatch(path)
+				s.events <- fsEvent{Path: path, Op: opRemoved}
+			default:
+				s.events <- fsEvent{Path: path, Op: opChanged}
+			}
+		}
+	}
+}
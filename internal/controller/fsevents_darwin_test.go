@@ -0,0 +1,57 @@
+//go:build darwin
+
+package controller
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// nextEvent waits for an event about path
+func nextEvent(t *testing.T, source eventSource, path string) fsEvent {
+	t.Helper()
+	timeout := time.After(2 * time.Second)
+	for {
+		select {
+		case ev := <-source.Events():
+			if ev.Path == path {
+				return ev
+			}
+		case <-timeout:
+			t.Fatalf("No event for %s", path)
+		}
+	}
+}
+
+func TestKqueueReportsRenameIn(t *testing.T) {
+	dir := t.TempDir()
+	source, err := newEventSource(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer source.Close()
+
+	// Written elsewhere, then renamed into the directory
+	tmp := filepath.Join(t.TempDir(), "1.md")
+	if err := os.WriteFile(tmp, []byte("done"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	moved := filepath.Join(dir, "1.md")
+	if err := os.Rename(tmp, moved); err != nil {
+		t.Fatal(err)
+	}
+	if ev := nextEvent(t, source, moved); ev.Op != opMovedIn {
+		t.Errorf("Expected a file renamed in to be opMovedIn, got %v", ev.Op)
+	}
+
+	// Created empty, to be written later
+	created := filepath.Join(dir, "2.md")
+	if err := os.WriteFile(created, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if ev := nextEvent(t, source, created); ev.Op != opChanged {
+		t.Errorf("Expected a new empty file to be opChanged, got %v", ev.Op)
+	}
+}
@@ -0,0 +1,103 @@
+//go:build linux
+
+package controller
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+	"unsafe"
+)
+
+// inotifySource watches a directory with inotify
+type inotifySource struct {
+	dir    string
+	file   *os.File
+	events chan fsEvent
+}
+
+// newEventSource starts an inotify watch on dir
+func newEventSource(dir string) (eventSource, error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return nil, fmt.Errorf("inotify init: %w", err)
+	}
+
+	mask := uint32(syscall.IN_CREATE | syscall.IN_MODIFY | syscall.IN_CLOSE_WRITE |
+		syscall.IN_MOVED_TO | syscall.IN_MOVED_FROM | syscall.IN_DELETE)
+	if _, err := syscall.InotifyAddWatch(fd, dir, mask); err != nil {
+		syscall.Close(fd)
+		return nil, fmt.Errorf("inotify watch %s: %w", dir, err)
+	}
+
+	// A non-blocking fd lets the runtime poller wake Read when the file is closed
+	s := &inotifySource{
+		dir:    dir,
+		file:   os.NewFile(uintptr(fd), "inotify"),
+		events: make(chan fsEvent, 64),
+	}
+	go s.read()
+	return s, nil
+}
+
+// Events returns the notification channel
+func (s *inotifySource) Events() <-chan fsEvent {
+	return s.events
+}
+
+// Close stops watching
+func (s *inotifySource) Close() error {
+	return s.file.Close()
+}
+
+func (s *inotifySource) read() {
+	defer close(s.events)
+
+	buf := make([]byte, 64*(syscall.SizeofInotifyEvent+syscall.NAME_MAX+1))
+	for {
+		n, err := s.file.Read(buf)
+		if err != nil {
+			return
+		}
+
+		for offset := 0; offset+syscall.SizeofInotifyEvent <= n; {
+			raw := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+			nameStart := offset + syscall.SizeofInotifyEvent
+			nameEnd := nameStart + int(raw.Len)
+			offset = nameEnd
+
+			if raw.Mask&syscall.IN_Q_OVERFLOW != 0 {
+				s.events <- fsEvent{Op: opOverflow}
+				continue
+			}
+			if raw.Len == 0 || nameEnd > n {
+				continue
+			}
+
+			name := string(buf[nameStart:nameEnd])
+			for i := 0; i < len(name); i++ {
+				if name[i] == 0 {
+					name = name[:i]
+					break
+				}
+			}
+
+			s.events <- fsEvent{Path: filepath.Join(s.dir, name), Op: inotifyOp(raw.Mask)}
+		}
+	}
+}
+
+// inotifyOp maps an inotify mask to an fsOp
+func inotifyOp(mask uint32) fsOp {
+	switch {
+	case mask&(syscall.IN_DELETE|syscall.IN_MOVED_FROM) != 0:
+		return opRemoved
+	case mask&syscall.IN_MOVED_TO != 0:
+		return opMovedIn
+	case mask&syscall.IN_CLOSE_WRITE != 0:
+		return opClosed
+	default:
+		return opChanged
+	}
+}
@@ -0,0 +1,8 @@
+//go:build !linux && !darwin
+
+package controller
+
+// newEventSource is not available on this platform
+func newEventSource(dir string) (eventSource, error) {
+	return nil, errEventsUnsupported
+}
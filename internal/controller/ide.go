@@ -3,6 +3,9 @@ package controller
 import (
 	"fmt"
 	"log"
+	"os"
+	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/applejobs/telegram-remote-controller/internal/automation"
@@ -16,34 +19,147 @@ const (
 	DefaultInputDelay = 100 * time.Millisecond
 )
 
-// IDEController controls the Antigravity IDE
+// IDEController controls an IDE's agent chat as its profile describes
 type IDEController struct {
 	appName    string
+	profile    Profile
 	inputDelay time.Duration
 	screenshot *Screenshot
+	auto       automation.Automator
+	sleep      func(time.Duration) // Waits for the UI to catch up; tests skip it
 }
 
-// NewIDEController creates a new IDE controller
+// NewIDEController creates a new IDE controller for this platform
 func NewIDEController() *IDEController {
+	profile := NewProfiles().Default()
 	return &IDEController{
-		appName:    AntigravityAppName,
+		appName:    profile.App,
+		profile:    profile,
 		inputDelay: DefaultInputDelay,
 		screenshot: NewScreenshot(),
+		auto:       automation.New(),
+		sleep:      time.Sleep,
 	}
 }
 
+// WithAutomator returns a controller that drives the desktop through auto
+func (c *IDEController) WithAutomator(auto automation.Automator) *IDEController {
+	ctrl := *c
+	ctrl.auto = auto
+	return &ctrl
+}
+
+// Automator returns what the controller drives the desktop with
+func (c *IDEController) Automator() automation.Automator {
+	return c.auto
+}
+
+// ForApp returns a controller that drives appName instead
+func (c *IDEController) ForApp(appName string) *IDEController {
+	app := *c
+	app.appName = appName
+	return &app
+}
+
+// ForProfile returns a controller that drives the IDE profile describes
+func (c *IDEController) ForProfile(profile Profile) *IDEController {
+	ctrl := *c
+	ctrl.profile = profile
+	ctrl.appName = profile.App
+	return &ctrl
+}
+
+// Profile returns the profile the controller follows
+func (c *IDEController) Profile() Profile {
+	return c.profile
+}
+
+// AppName returns the application the controller drives
+func (c *IDEController) AppName() string {
+	return c.appName
+}
+
+// OpenWorkspace opens a folder in the app
+func (c *IDEController) OpenWorkspace(path string) error {
+	log.Printf("Opening workspace %s in %s", path, c.appName)
+
+	path = expandHome(path)
+	if _, err := os.Stat(path); err != nil {
+		return fmt.Errorf("workspace not found: %w", err)
+	}
+
+	if err := c.auto.OpenWorkspace(c.appName, path); err != nil {
+		return fmt.Errorf("failed to open %s in %s: %w", path, c.appName, err)
+	}
+
+	// Wait for the window to load
+	c.sleep(2 * time.Second)
+	return nil
+}
+
+// expandHome replaces a leading "~/" with the home directory
+func expandHome(path string) string {
+	if strings.HasPrefix(path, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			path = filepath.Join(home, path[2:])
+		}
+	}
+	return path
+}
+
+// runSteps performs profile steps, putting model into typed text
+func (c *IDEController) runSteps(steps []Step, model string) error {
+	for _, step := range steps {
+		var err error
+		switch {
+		case step.Wait > 0:
+			c.sleep(step.Wait)
+		case step.Text != "":
+			err = c.auto.Type(strings.ReplaceAll(step.Text, ModelPlaceholder, model))
+		default:
+			err = c.auto.KeyChord(step.Key, step.Modifiers...)
+		}
+		if err != nil {
+			return fmt.Errorf("step %q: %w", step, err)
+		}
+	}
+	return nil
+}
+
+// NewChat starts a new conversation in the agent panel
+func (c *IDEController) NewChat() error {
+	log.Println("Starting a new chat...")
+
+	if len(c.profile.NewChat) == 0 {
+		return fmt.Errorf("IDE profile %s has no new chat shortcut", c.profile.Name)
+	}
+	if err := c.EnsureReady(); err != nil {
+		return err
+	}
+
+	if err := c.runSteps(c.profile.NewChat, ""); err != nil {
+		return fmt.Errorf("failed to start a new chat: %w", err)
+	}
+
+	c.sleep(500 * time.Millisecond)
+	return nil
+}
+
 // EnsureReady ensures the IDE is open and focused
 func (c *IDEController) EnsureReady() error {
 	log.Printf("Ensuring %s is ready...", c.appName)
 
 	// Open and focus the app
-	if err := automation.OpenApp(c.appName); err != nil {
+	if err := c.auto.Activate(c.appName); err != nil {
 		return fmt.Errorf("failed to open %s: %w", c.appName, err)
 	}
 
 	// Wait for app to be ready
-	time.Sleep(500 * time.Millisecond)
+	c.sleep(500 * time.Millisecond)
 
+	if err := c.runSteps(c.profile.Focus, ""); err != nil {
+		return fmt.Errorf("failed to focus the agent panel: %w", err)
+	}
 	return nil
 }
 
@@ -52,8 +168,7 @@ func (c *IDEController) EnsureReady() error {
 func (c *IDEController) InputPrompt(prompt string) error {
 	log.Printf("Inputting prompt (%d chars)", len(prompt))
 
-	// Ensure IDE is focused
-	if err := c.EnsureReady(); err != nil {
+	if err := c.focusInput(); err != nil {
 		return err
 	}
 
@@ -61,61 +176,84 @@ func (c *IDEController) InputPrompt(prompt string) error {
 	return c.inputViaClipboard(prompt)
 }
 
+// focusInput brings the IDE forward and moves focus to the chat input
+func (c *IDEController) focusInput() error {
+	if err := c.EnsureReady(); err != nil {
+		return err
+	}
+	if err := c.runSteps(c.profile.FocusInput, ""); err != nil {
+		return fmt.Errorf("failed to focus the input: %w", err)
+	}
+	return nil
+}
+
 // inputViaClipboard inputs text by copying to clipboard and pasting
 func (c *IDEController) inputViaClipboard(text string) error {
 	// Set clipboard content (handles all characters correctly)
-	if err := automation.SetClipboard(text); err != nil {
+	if err := c.auto.SetClipboard(text); err != nil {
 		return fmt.Errorf("failed to set clipboard: %w", err)
 	}
 
-	time.Sleep(c.inputDelay)
+	c.sleep(c.inputDelay)
 
 	// Paste
-	if err := automation.PasteFromClipboard(); err != nil {
+	if err := c.auto.Paste(); err != nil {
 		return fmt.Errorf("failed to paste: %w", err)
 	}
 
 	return nil
 }
 
-// Submit sends the current input (press Enter or Cmd+Enter)
+// Submit sends the current input with the profile's submit key, or with
+// Cmd+Enter falling back to Enter
 func (c *IDEController) Submit() error {
 	log.Println("Submitting prompt...")
 
-	time.Sleep(c.inputDelay)
+	c.sleep(c.inputDelay)
+
+	if len(c.profile.Submit) > 0 {
+		return c.runSteps(c.profile.Submit, "")
+	}
 
 	// Try Cmd+Enter first (common for chat-style interfaces)
-	if err := automation.PressCommandEnter(); err != nil {
+	if err := c.auto.KeyChord("return", automation.Command); err != nil {
 		// Fallback to Enter
-		return automation.PressEnter()
+		return c.auto.KeyChord("return")
 	}
 
 	return nil
 }
 
-// SelectModel attempts to select a specific model in the IDE
-// Note: Implementation depends on IDE's UI
+// SelectModel picks a model with the profile's model picker steps. Without
+// them the IDE keeps its current model.
 func (c *IDEController) SelectModel(model string) error {
-	log.Printf("Selecting model: %s", model)
-
-	// This is IDE-specific and may need adjustment
-	// For now, we'll log and return nil
-	// TODO: Implement model selection based on Antigravity's UI
+	if len(c.profile.ModelPicker) == 0 {
+		log.Printf("IDE profile %s has no model picker, keeping the current model", c.profile.Name)
+		return nil
+	}
 
+	log.Printf("Selecting model: %s", model)
+	if err := c.runSteps(c.profile.ModelPicker, model); err != nil {
+		return fmt.Errorf("failed to select %s: %w", model, err)
+	}
 	return nil
 }
 
-// ClearInput clears the current input field
+// ClearInput focuses the chat input and clears it, e.g. of a draft left
+// from an earlier prompt
 func (c *IDEController) ClearInput() error {
+	if err := c.focusInput(); err != nil {
+		return err
+	}
+	if len(c.profile.ClearInput) > 0 {
+		return c.runSteps(c.profile.ClearInput, "")
+	}
+
 	// Select all and delete
-	script := `
-		tell application "System Events"
-			keystroke "a" using command down
-			key code 51
-		end tell
-	`
-	_, err := automation.RunScript(script)
-	return err
+	if err := c.auto.KeyChord("a", automation.Command); err != nil {
+		return err
+	}
+	return c.auto.KeyChord("delete")
 }
 
 // TakeScreenshot takes a screenshot of the current state
@@ -126,28 +264,16 @@ func (c *IDEController) TakeScreenshot() (string, error) {
 	log.Printf("Focusing %s...", c.appName)
 
 	// First activation
-	if err := automation.OpenApp(c.appName); err != nil {
+	if err := c.auto.Activate(c.appName); err != nil {
 		log.Printf("Warning: first focus attempt failed: %v", err)
 	}
-	time.Sleep(500 * time.Millisecond)
+	c.sleep(500 * time.Millisecond)
 
 	// Second activation to be sure
-	if err := automation.OpenApp(c.appName); err != nil {
+	if err := c.auto.Activate(c.appName); err != nil {
 		log.Printf("Warning: second focus attempt failed: %v", err)
 	}
-	time.Sleep(500 * time.Millisecond)
-
-	// Use AppleScript to ensure window is frontmost
-	script := fmt.Sprintf(`
-		tell application "%s"
-			activate
-			set frontmost to true
-		end tell
-		delay 0.3
-	`, c.appName)
-	_, _ = automation.RunScript(script)
-
-	time.Sleep(300 * time.Millisecond)
+	c.sleep(600 * time.Millisecond)
 
 	log.Println("Focus complete, taking screenshot...")
 
@@ -158,10 +284,10 @@ func (c *IDEController) TakeScreenshot() (string, error) {
 // TakeAntigravityScreenshot specifically captures the Antigravity window
 func (c *IDEController) TakeAntigravityScreenshot() (string, error) {
 	// Focus Antigravity first
-	if err := automation.OpenApp(c.appName); err != nil {
+	if err := c.auto.Activate(c.appName); err != nil {
 		log.Printf("Warning: could not focus Antigravity: %v", err)
 	}
-	time.Sleep(300 * time.Millisecond)
+	c.sleep(300 * time.Millisecond)
 
 	// Use system screenshot (Shift+Cmd+3)
 	return c.screenshot.CaptureScreen()
@@ -171,17 +297,16 @@ func (c *IDEController) TakeAntigravityScreenshot() (string, error) {
 func (c *IDEController) FocusApp(appName string) error {
 	log.Printf("Focusing app: %s", appName)
 
-	// Use AppleScript to activate the app
-	if err := automation.OpenApp(appName); err != nil {
+	if err := c.auto.Activate(appName); err != nil {
 		return fmt.Errorf("failed to focus %s: %w", appName, err)
 	}
 
 	// Wait for app to come to front
-	time.Sleep(500 * time.Millisecond)
+	c.sleep(500 * time.Millisecond)
 
 	// Double activate to ensure it's really in front
-	automation.OpenApp(appName)
-	time.Sleep(300 * time.Millisecond)
+	c.auto.Activate(appName)
+	c.sleep(300 * time.Millisecond)
 
 	return nil
 }
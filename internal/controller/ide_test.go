@@ -1,8 +1,15 @@
 package controller
 
 import (
+	"errors"
 	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/applejobs/telegram-remote-controller/internal/automation"
 )
 
 func TestNewIDEController(t *testing.T) {
@@ -13,6 +20,9 @@ func TestNewIDEController(t *testing.T) {
 	if ctrl.appName != AntigravityAppName {
 		t.Errorf("Expected app name %s, got %s", AntigravityAppName, ctrl.appName)
 	}
+	if ctrl.Profile().Name != DefaultProfile {
+		t.Errorf("Expected the %s profile, got %s", DefaultProfile, ctrl.Profile().Name)
+	}
 }
 
 func TestInputPromptShort(t *testing.T) {
@@ -53,3 +63,143 @@ func TestNewScreenshot(t *testing.T) {
 		t.Errorf("Expected output dir /tmp, got %s", s.outputDir)
 	}
 }
+
+// newTestController drives a Recorder instead of the desktop, without waiting
+func newTestController(apps ...string) (*IDEController, *automation.Recorder) {
+	rec := automation.NewRecorder(apps...)
+	ctrl := NewIDEController().WithAutomator(rec)
+	ctrl.sleep = func(time.Duration) {}
+	return ctrl, rec
+}
+
+func TestIDEControllerFlows(t *testing.T) {
+	tests := []struct {
+		name string
+		run  func(c *IDEController) error
+		want []string
+	}{
+		{
+			name: "input prompt",
+			run:  func(c *IDEController) error { return c.InputPrompt("explain \"this\"\nplease") },
+			want: []string{"activate Antigravity", "set clipboard explain \"this\"\nplease", "paste"},
+		},
+		{
+			name: "new chat",
+			run:  (*IDEController).NewChat,
+			want: []string{"activate Antigravity", "key command+shift+l"},
+		},
+		{
+			name: "submit",
+			run:  (*IDEController).Submit,
+			want: []string{"key command+return"},
+		},
+		{
+			name: "clear input",
+			run:  (*IDEController).ClearInput,
+			want: []string{"activate Antigravity", "key command+a", "key delete"},
+		},
+		{
+			name: "other app",
+			run:  func(c *IDEController) error { return c.ForApp("Cursor").EnsureReady() },
+			want: []string{"activate Cursor"},
+		},
+		{
+			name: "focus app",
+			run:  func(c *IDEController) error { return c.FocusApp("Finder") },
+			want: []string{"activate Finder", "activate Finder"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl, rec := newTestController(AntigravityAppName)
+			if err := tt.run(ctrl); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if got := rec.Actions(); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Expected %q, got %q", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestIDEControllerOpenWorkspace(t *testing.T) {
+	ctrl, rec := newTestController()
+	dir := t.TempDir()
+
+	if err := ctrl.ForApp("Cursor").OpenWorkspace(dir); err != nil {
+		t.Fatalf("OpenWorkspace failed: %v", err)
+	}
+	if err := ctrl.OpenWorkspace(filepath.Join(dir, "missing")); err == nil {
+		t.Error("Expected an error for a missing workspace")
+	}
+	if want, got := []string{"open Cursor " + dir}, rec.Actions(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+}
+
+func TestIDEControllerSubmitFallsBackToEnter(t *testing.T) {
+	ctrl, rec := newTestController()
+	ctrl = ctrl.ForProfile(Profile{Name: "bare", App: "Editor"})
+	rec.Fail("key command+return", errors.New("no shortcut"))
+
+	if err := ctrl.Submit(); err != nil {
+		t.Fatalf("Submit failed: %v", err)
+	}
+	want := []string{"key command+return", "key return"}
+	if got := rec.Actions(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+}
+
+func TestIDEControllerStopsWhenFocusFails(t *testing.T) {
+	ctrl, rec := newTestController()
+	rec.Fail("activate", errors.New("not installed"))
+
+	err := ctrl.InputPrompt("hello")
+	if err == nil || !strings.Contains(err.Error(), "failed to open Antigravity") {
+		t.Fatalf("Expected a focus error, got %v", err)
+	}
+	if got := rec.Actions(); len(got) != 1 {
+		t.Errorf("Nothing should be pasted into an unfocused app, got %q", got)
+	}
+}
+
+func TestIDEControllerFollowsProfile(t *testing.T) {
+	profiles := NewProfiles()
+	cursor, err := profiles.Get("Cursor")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctrl, rec := newTestController()
+	ctrl = ctrl.ForProfile(cursor)
+
+	steps := []func() error{
+		ctrl.NewChat,
+		func() error { return ctrl.InputPrompt("hi") },
+		func() error { return ctrl.SelectModel("GPT-5") },
+		ctrl.Submit,
+	}
+	for _, step := range steps {
+		if err := step(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want := []string{
+		"activate Cursor", "key command+n",
+		"activate Cursor", "key command+i", "set clipboard hi", "paste",
+		"key option+command+/", "type GPT-5", "key return",
+		"key return",
+	}
+	if got := rec.Actions(); !reflect.DeepEqual(got, want) {
+		t.Errorf("Expected %q, got %q", want, got)
+	}
+
+	// A profile without a new chat shortcut cannot start one
+	ctrl = ctrl.ForProfile(Profile{Name: "bare", App: "Editor"})
+	if err := ctrl.NewChat(); err == nil {
+		t.Error("Expected an error without a new chat shortcut")
+	}
+	if err := ctrl.SelectModel("GPT-5"); err != nil {
+		t.Errorf("Profiles without a model picker should keep the model, got %v", err)
+	}
+}
@@ -0,0 +1,294 @@
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/applejobs/telegram-remote-controller/internal/automation"
+)
+
+// DefaultProfilesPath is where IDE profiles are kept
+const DefaultProfilesPath = "/Users/applejobs/.gemini/antigravity/scratch/telegram-agent-controller/config/ide.json"
+
+// DefaultProfile is used when neither the user nor the profiles file picks one
+const DefaultProfile = "antigravity"
+
+// ModelPlaceholder in a step is replaced with the model being selected
+const ModelPlaceholder = "{model}"
+
+// ErrUnknownProfile is returned for a profile name that is not configured
+var ErrUnknownProfile = errors.New("unknown IDE profile")
+
+// Step is one action of a profile, written as a string:
+//
+//	"cmd+shift+l"   a key chord; modifiers are cmd, shift, alt and ctrl
+//	"return"        a key on its own
+//	"type {model}"  types text
+//	"wait 300ms"    waits for the UI
+type Step struct {
+	Key       string
+	Modifiers []automation.Modifier
+	Text      string        // Typed when set
+	Wait      time.Duration // Waited when set
+	source    string
+}
+
+// stepModifiers are the modifier names a chord may use
+var stepModifiers = map[string]automation.Modifier{
+	"cmd":     automation.Command,
+	"command": automation.Command,
+	"shift":   automation.Shift,
+	"alt":     automation.Option,
+	"opt":     automation.Option,
+	"option":  automation.Option,
+	"ctrl":    automation.Control,
+	"control": automation.Control,
+}
+
+// ParseStep reads a step in the form Step describes
+func ParseStep(s string) (Step, error) {
+	s = strings.TrimSpace(s)
+	step := Step{source: s}
+	verb, arg, _ := strings.Cut(s, " ")
+	switch {
+	case s == "":
+		return step, errors.New("empty step")
+	case verb == "type":
+		if arg == "" {
+			return step, fmt.Errorf("nothing to type in %q", s)
+		}
+		step.Text = arg
+	case verb == "wait":
+		d, err := time.ParseDuration(strings.TrimSpace(arg))
+		if err != nil || d <= 0 {
+			return step, fmt.Errorf("bad wait %q", arg)
+		}
+		step.Wait = d
+	default:
+		parts := strings.Split(s, "+")
+		step.Key = parts[len(parts)-1]
+		if step.Key == "" || strings.Contains(step.Key, " ") {
+			return step, fmt.Errorf("bad key in %q", s)
+		}
+		for _, name := range parts[:len(parts)-1] {
+			m, ok := stepModifiers[strings.ToLower(name)]
+			if !ok {
+				return step, fmt.Errorf("unknown modifier %q in %q", name, s)
+			}
+			step.Modifiers = append(step.Modifiers, m)
+		}
+	}
+	return step, nil
+}
+
+// String returns the step as written
+func (s Step) String() string {
+	return s.source
+}
+
+// UnmarshalJSON reads a step from a string
+func (s *Step) UnmarshalJSON(data []byte) error {
+	var text string
+	if err := json.Unmarshal(data, &text); err != nil {
+		return err
+	}
+	step, err := ParseStep(text)
+	if err != nil {
+		return err
+	}
+	*s = step
+	return nil
+}
+
+// MarshalJSON writes the step as a string
+func (s Step) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.source)
+}
+
+// mustSteps parses built-in steps
+func mustSteps(steps ...string) []Step {
+	parsed := make([]Step, len(steps))
+	for i, s := range steps {
+		step, err := ParseStep(s)
+		if err != nil {
+			panic(err)
+		}
+		parsed[i] = step
+	}
+	return parsed
+}
+
+// Profile describes how to drive one IDE's agent chat. Steps that are not
+// set are skipped, except Submit and ClearInput, which fall back to
+// Cmd+Enter and select-all-and-delete.
+type Profile struct {
+	Name        string `json:"name"` // Chosen with /ide, e.g. "cursor"
+	App         string `json:"app"`  // Application to activate
+	Focus       []Step `json:"focus,omitempty"`
+	NewChat     []Step `json:"new_chat,omitempty"`
+	FocusInput  []Step `json:"focus_input,omitempty"`
+	Submit      []Step `json:"submit,omitempty"`
+	ClearInput  []Step `json:"clear_input,omitempty"`
+	ModelPicker []Step `json:"model_picker,omitempty"` // {model} is replaced with the model
+	ResponseDir string `json:"response_dir,omitempty"` // Where agents write responses; empty uses the watch dir
+}
+
+// defaultProfiles are used when no profiles file exists. The shortcuts are
+// each IDE's defaults on macOS; Cmd is Ctrl on Linux.
+func defaultProfiles() []Profile {
+	return []Profile{
+		{
+			Name:       "antigravity",
+			App:        AntigravityAppName,
+			NewChat:    mustSteps("cmd+shift+l"),
+			Submit:     mustSteps("cmd+return"),
+			ClearInput: mustSteps("cmd+a", "delete"),
+		},
+		{
+			Name:        "vscode",
+			App:         "Visual Studio Code",
+			NewChat:     mustSteps("ctrl+cmd+i", "wait 300ms", "cmd+n"),
+			FocusInput:  mustSteps("ctrl+cmd+i"),
+			Submit:      mustSteps("return"),
+			ClearInput:  mustSteps("cmd+a", "delete"),
+			ModelPicker: mustSteps("ctrl+cmd+i", "alt+cmd+.", "wait 300ms", "type {model}", "wait 200ms", "return"),
+		},
+		{
+			Name:        "cursor",
+			App:         "Cursor",
+			NewChat:     mustSteps("cmd+n"),
+			FocusInput:  mustSteps("cmd+i"),
+			Submit:      mustSteps("return"),
+			ClearInput:  mustSteps("cmd+a", "delete"),
+			ModelPicker: mustSteps("alt+cmd+/", "wait 300ms", "type {model}", "wait 200ms", "return"),
+		},
+		{
+			Name:       "windsurf",
+			App:        "Windsurf",
+			NewChat:    mustSteps("cmd+shift+l"),
+			FocusInput: mustSteps("cmd+l"),
+			Submit:     mustSteps("return"),
+			ClearInput: mustSteps("cmd+a", "delete"),
+		},
+	}
+}
+
+// profilesFile is the layout of the profiles file
+type profilesFile struct {
+	Default  string    `json:"default,omitempty"`
+	Profiles []Profile `json:"profiles"`
+}
+
+// Profiles are the configured IDE profiles
+type Profiles struct {
+	defaultName string
+	byName      map[string]Profile // By lowercase name
+}
+
+// NewProfiles returns the built-in profiles
+func NewProfiles() *Profiles {
+	p, _ := newProfiles(profilesFile{Profiles: defaultProfiles()})
+	return p
+}
+
+// LoadProfiles reads the profiles at path on top of the built-in ones; a
+// profile with a built-in name replaces it. A missing file yields the
+// built-in profiles.
+func LoadProfiles(path string) (*Profiles, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		log.Printf("No IDE profiles at %s, using built-in profiles", path)
+		return NewProfiles(), nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read IDE profiles: %w", err)
+	}
+
+	var f profilesFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("failed to parse IDE profiles %s: %w", path, err)
+	}
+	f.Profiles = append(defaultProfiles(), f.Profiles...)
+	p, err := newProfiles(f)
+	if err != nil {
+		return nil, fmt.Errorf("IDE profiles %s: %w", path, err)
+	}
+	return p, nil
+}
+
+func newProfiles(f profilesFile) (*Profiles, error) {
+	p := &Profiles{defaultName: DefaultProfile, byName: make(map[string]Profile)}
+	for _, profile := range f.Profiles {
+		profile.Name = strings.TrimSpace(profile.Name)
+		if profile.Name == "" || strings.ContainsAny(profile.Name, " \t\n") {
+			return nil, fmt.Errorf("profile %q: name must be one word", profile.Name)
+		}
+		if profile.App == "" {
+			return nil, fmt.Errorf("profile %s: app is empty", profile.Name)
+		}
+		if profile.ResponseDir != "" {
+			profile.ResponseDir = expandHome(profile.ResponseDir)
+		}
+		p.byName[strings.ToLower(profile.Name)] = profile
+	}
+	if f.Default != "" {
+		if _, ok := p.byName[strings.ToLower(f.Default)]; !ok {
+			return nil, fmt.Errorf("default: %w %q", ErrUnknownProfile, f.Default)
+		}
+		p.defaultName = strings.ToLower(f.Default)
+	}
+	return p, nil
+}
+
+// Default returns the profile of users who have not picked one
+func (p *Profiles) Default() Profile {
+	return p.byName[p.defaultName]
+}
+
+// Get finds a profile by name, ignoring case; an empty name is the default
+func (p *Profiles) Get(name string) (Profile, error) {
+	if strings.TrimSpace(name) == "" {
+		return p.Default(), nil
+	}
+	if profile, ok := p.byName[strings.ToLower(strings.TrimSpace(name))]; ok {
+		return profile, nil
+	}
+	return Profile{}, fmt.Errorf("%w %q (profiles: %s)", ErrUnknownProfile, name, strings.Join(p.names(), ", "))
+}
+
+// List returns the profiles sorted by name
+func (p *Profiles) List() []Profile {
+	list := make([]Profile, 0, len(p.byName))
+	for _, profile := range p.byName {
+		list = append(list, profile)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+// ResponseDirs returns the distinct response directories profiles set
+func (p *Profiles) ResponseDirs() []string {
+	seen := make(map[string]bool)
+	var dirs []string
+	for _, profile := range p.List() {
+		if profile.ResponseDir != "" && !seen[profile.ResponseDir] {
+			seen[profile.ResponseDir] = true
+			dirs = append(dirs, profile.ResponseDir)
+		}
+	}
+	return dirs
+}
+
+func (p *Profiles) names() []string {
+	var names []string
+	for _, profile := range p.List() {
+		names = append(names, profile.Name)
+	}
+	return names
+}
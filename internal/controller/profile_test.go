@@ -0,0 +1,101 @@
+package controller
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/applejobs/telegram-remote-controller/internal/automation"
+)
+
+func TestParseStep(t *testing.T) {
+	tests := []struct {
+		step string
+		want Step
+		ok   bool
+	}{
+		{"cmd+shift+l", Step{Key: "l", Modifiers: []automation.Modifier{automation.Command, automation.Shift}}, true},
+		{"Ctrl+Alt+.", Step{Key: ".", Modifiers: []automation.Modifier{automation.Control, automation.Option}}, true},
+		{"return", Step{Key: "return"}, true},
+		{"type {model}", Step{Text: "{model}"}, true},
+		{"wait 300ms", Step{Wait: 300 * time.Millisecond}, true},
+		{"hyper+l", Step{}, false},
+		{"cmd+", Step{}, false},
+		{"wait soon", Step{}, false},
+		{"type", Step{}, false},
+		{"", Step{}, false},
+	}
+	for _, tt := range tests {
+		got, err := ParseStep(tt.step)
+		if (err == nil) != tt.ok {
+			t.Errorf("ParseStep(%q) error = %v, want ok %v", tt.step, err, tt.ok)
+			continue
+		}
+		if !tt.ok {
+			continue
+		}
+		tt.want.source = tt.step
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ParseStep(%q) = %+v, want %+v", tt.step, got, tt.want)
+		}
+	}
+}
+
+func TestLoadProfiles(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ide.json")
+	data := `{
+		"default": "zed",
+		"profiles": [
+			{"name": "zed", "app": "Zed", "new_chat": ["cmd+n"], "submit": ["cmd+return"], "response_dir": "/tmp/zed"},
+			{"name": "cursor", "app": "Cursor Nightly"}
+		]
+	}`
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	profiles, err := LoadProfiles(path)
+	if err != nil {
+		t.Fatalf("LoadProfiles failed: %v", err)
+	}
+	if got := profiles.Default(); got.Name != "zed" || got.App != "Zed" || got.NewChat[0].String() != "cmd+n" {
+		t.Errorf("Expected zed to be the default, got %+v", got)
+	}
+	if cursor, _ := profiles.Get("cursor"); cursor.App != "Cursor Nightly" {
+		t.Errorf("Profiles in the file should replace built-ins, got %+v", cursor)
+	}
+	if _, err := profiles.Get("vscode"); err != nil {
+		t.Errorf("Built-in profiles should remain: %v", err)
+	}
+	if _, err := profiles.Get("nosuch"); !errors.Is(err, ErrUnknownProfile) {
+		t.Errorf("Expected ErrUnknownProfile, got %v", err)
+	}
+	if dirs := profiles.ResponseDirs(); !reflect.DeepEqual(dirs, []string{"/tmp/zed"}) {
+		t.Errorf("Expected the zed response dir, got %v", dirs)
+	}
+}
+
+func TestLoadProfilesRejectsInvalid(t *testing.T) {
+	tests := map[string]string{
+		"bad step":        `{"profiles": [{"name": "x", "app": "X", "submit": ["super+return"]}]}`,
+		"no app":          `{"profiles": [{"name": "x"}]}`,
+		"unknown default": `{"default": "nosuch", "profiles": []}`,
+	}
+	for name, data := range tests {
+		path := filepath.Join(t.TempDir(), "ide.json")
+		if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := LoadProfiles(path); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+
+	profiles, err := LoadProfiles(filepath.Join(t.TempDir(), "missing.json"))
+	if err != nil || profiles.Default().Name != DefaultProfile {
+		t.Errorf("A missing file should give the built-in profiles, got %v", err)
+	}
+}
@@ -0,0 +1,57 @@
+package controller
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// ResponsePath returns the file a run is expected to write its response to
+func (w *FileWatcher) ResponsePath(runID string) string {
+	return filepath.Join(w.watchDir, runID+".md")
+}
+
+// MatchRun works out which run a response file belongs to.
+// A front-matter header such as
+//
+//	---
+//	run: 12
+//	---
+//
+// takes precedence over the file name (responses/12.md). The header is
+// stripped from the returned body.
+func MatchRun(path, content string) (runID string, body string) {
+	if id, rest, ok := parseFrontMatter(content); ok && id != "" {
+		return id, rest
+	}
+
+	base := filepath.Base(path)
+	return strings.TrimSuffix(base, filepath.Ext(base)), content
+}
+
+// parseFrontMatter reads the run ID from a leading "---" block
+func parseFrontMatter(content string) (runID string, rest string, ok bool) {
+	normalized := strings.ReplaceAll(content, "\r\n", "\n")
+	if !strings.HasPrefix(normalized, "---\n") {
+		return "", content, false
+	}
+
+	end := strings.Index(normalized[4:], "\n---")
+	if end == -1 {
+		return "", content, false
+	}
+	header := normalized[4 : 4+end]
+	rest = strings.TrimPrefix(normalized[4+end+4:], "\n")
+
+	for _, line := range strings.Split(header, "\n") {
+		key, value, found := strings.Cut(line, ":")
+		if !found {
+			continue
+		}
+		switch strings.ToLower(strings.TrimSpace(key)) {
+		case "run", "run_id", "run-id":
+			runID = strings.TrimPrefix(strings.Trim(strings.TrimSpace(value), `"'`), "#")
+		}
+	}
+
+	return runID, rest, true
+}
@@ -0,0 +1,42 @@
+package controller
+
+import "testing"
+
+func TestMatchRunByFileName(t *testing.T) {
+	id, body := MatchRun("/tmp/responses/12.md", "hello")
+	if id != "12" {
+		t.Errorf("Expected run ID 12, got %q", id)
+	}
+	if body != "hello" {
+		t.Errorf("Body should be unchanged, got %q", body)
+	}
+}
+
+func TestMatchRunByFrontMatter(t *testing.T) {
+	content := "---\nrun: \"#7\"\ntitle: fix\n---\n# Result\n\nDone."
+	id, body := MatchRun("/tmp/responses/response.md", content)
+	if id != "7" {
+		t.Errorf("Expected run ID 7, got %q", id)
+	}
+	if body != "# Result\n\nDone." {
+		t.Errorf("Front matter should be stripped, got %q", body)
+	}
+}
+
+func TestMatchRunFrontMatterWithoutRun(t *testing.T) {
+	content := "---\ntitle: notes\n---\nbody"
+	id, body := MatchRun("/tmp/responses/response.md", content)
+	if id != "response" {
+		t.Errorf("Expected file name fallback, got %q", id)
+	}
+	if body != content {
+		t.Errorf("Body should be unchanged when no run header, got %q", body)
+	}
+}
+
+func TestResponsePath(t *testing.T) {
+	w := &FileWatcher{watchDir: "/tmp/responses"}
+	if got := w.ResponsePath("3"); got != "/tmp/responses/3.md" {
+		t.Errorf("Unexpected response path: %s", got)
+	}
+}
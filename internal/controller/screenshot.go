@@ -9,6 +9,8 @@ import (
 	"sort"
 	"strings"
 	"time"
+
+	"github.com/applejobs/telegram-remote-controller/internal/automation"
 )
 
 // Screenshot handles screen capture functionality
@@ -41,17 +43,10 @@ func (s *Screenshot) CaptureScreen() (string, error) {
 	existingFiles := s.getDesktopScreenshots(desktopPath)
 	log.Printf("Found %d existing screenshots on Desktop", len(existingFiles))
 
-	// Use AppleScript to press Cmd+Shift+3
+	// Use AppleScript to press Cmd+Shift+3 (key code 20)
 	log.Println("Pressing Cmd+Shift+3...")
-	script := `
-		tell application "System Events"
-			key code 20 using {command down, shift down}
-		end tell
-	`
-	cmd := exec.Command("osascript", "-e", script)
-	output, err := cmd.CombinedOutput()
-	if err != nil {
-		log.Printf("Cmd+Shift+3 failed: %v, output: %s", err, string(output))
+	if err := automation.PressKeyCode(20, "command", "shift"); err != nil {
+		log.Printf("Cmd+Shift+3 failed: %v", err)
 		// Fall back to screencapture
 		return s.fallbackCapture()
 	}
@@ -1,6 +1,7 @@
 package controller
 
 import (
+	"context"
 	"fmt"
 	"io/fs"
 	"log"
@@ -11,25 +12,47 @@ import (
 	"time"
 )
 
+// DoneSuffix marks a sentinel file (e.g. "12.md.done") that signals its
+// response file is completely written
+const DoneSuffix = ".done"
+
 // FileWatcher monitors a directory for new files
 type FileWatcher struct {
 	watchDir     string
-	pollInterval time.Duration
+	pollInterval time.Duration // Rescan interval when OS events are unavailable
+	rescanEvery  time.Duration // Safety rescan interval when OS events are available
+	settleTick   time.Duration // How often pending files are re-checked
+	settleWindow time.Duration // Size and mtime must stay unchanged this long
 	timeout      time.Duration
-	stableDelay  time.Duration // Wait after file appears to ensure it's fully written
 }
 
+// ResponseFile is a response file's content as seen by the watcher
+type ResponseFile struct {
+	Path    string
+	Content string
+	ModTime time.Time
+	Partial bool // The file is still being written; a final event follows
+}
+
+// DefaultWatchDir is the dedicated response output directory
+const DefaultWatchDir = "/Users/applejobs/.gemini/antigravity/scratch/telegram-agent-controller/responses"
+
 // NewFileWatcher creates a new file watcher
 func NewFileWatcher() *FileWatcher {
-	// Create a dedicated response output directory
-	watchDir := "/Users/applejobs/.gemini/antigravity/scratch/telegram-agent-controller/responses"
+	return NewFileWatcherAt(DefaultWatchDir)
+}
+
+// NewFileWatcherAt creates a file watcher for watchDir, creating it if needed
+func NewFileWatcherAt(watchDir string) *FileWatcher {
 	os.MkdirAll(watchDir, 0755)
-	
+
 	return &FileWatcher{
 		watchDir:     watchDir,
 		pollInterval: 2 * time.Second,
+		rescanEvery:  15 * time.Second,
+		settleTick:   250 * time.Millisecond,
+		settleWindow: 1500 * time.Millisecond,
 		timeout:      180 * time.Second, // 3 minutes timeout
-		stableDelay:  3 * time.Second,   // Wait 3 seconds after file appears
 	}
 }
 
@@ -38,112 +61,255 @@ func (w *FileWatcher) GetWatchDir() string {
 	return w.watchDir
 }
 
-// WaitForNewFile waits for a new file to appear in the watch directory
-// Returns the path to the new file and its contents
-func (w *FileWatcher) WaitForNewFile() (string, string, error) {
-	log.Printf("Watching for new files in: %s (timeout: %v)", w.watchDir, w.timeout)
-	
-	// Get initial file list
-	initialFiles := w.getFiles()
-	log.Printf("Initial files: %d", len(initialFiles))
-	
-	startTime := time.Now()
-	
+// trackedFile is the watcher's view of one response file
+type trackedFile struct {
+	size      int64
+	modTime   time.Time
+	changedAt time.Time // Last time size or mtime changed
+	complete  bool      // The writer signalled completion (close, rename or sentinel)
+	delivered bool      // This version was already emitted
+	partial   int64     // Size last emitted as a partial event
+}
+
+// Watch emits response files once they are completely written, until ctx is done.
+// Files present when Watch starts are not emitted unless they change.
+// While a file is still growing, Partial events carry the content so far.
+//
+// A file counts as complete when its writer renamed it into place, when a
+// "<name>.done" sentinel appears, or when its size and mtime stay unchanged
+// for the settle window. OS change events are used where
+// available, with periodic rescans as a fallback.
+//
+// On macOS, kqueue cannot tell a rename from a create, so a file that
+// already has content when it first appears counts as renamed into place.
+// A writer that creates a file and writes to it before the watcher looks
+// may then be delivered early; such writers should use a sentinel.
+func (w *FileWatcher) Watch(ctx context.Context) <-chan ResponseFile {
+	out := make(chan ResponseFile)
+	go w.watch(ctx, out)
+	return out
+}
+
+func (w *FileWatcher) watch(ctx context.Context, out chan<- ResponseFile) {
+	defer close(out)
+
+	var events <-chan fsEvent
+	rescanEvery := w.pollInterval
+	source, err := newEventSource(w.watchDir)
+	if err != nil {
+		log.Printf("File events unavailable (%v), polling %s every %v", err, w.watchDir, w.pollInterval)
+	} else {
+		defer source.Close()
+		events = source.Events()
+		rescanEvery = w.rescanEvery
+		log.Printf("Watching %s with file events", w.watchDir)
+	}
+
+	// Existing files count as already delivered
+	files := make(map[string]*trackedFile)
+	for path, info := range w.scan() {
+		files[path] = &trackedFile{size: info.Size(), modTime: info.ModTime(), delivered: true}
+	}
+
+	rescan := time.NewTicker(rescanEvery)
+	defer rescan.Stop()
+	settle := time.NewTicker(w.settleTick)
+	defer settle.Stop()
+
 	for {
-		// Check timeout
-		if time.Since(startTime) > w.timeout {
-			return "", "", fmt.Errorf("file watcher timed out after %v", w.timeout)
-		}
-		
-		// Get current files
-		currentFiles := w.getFiles()
-		
-		// Find new files
-		for path, modTime := range currentFiles {
-			if _, exists := initialFiles[path]; !exists {
-				// New file found!
-				log.Printf("New file detected: %s", path)
-				
-				// Wait for file to be fully written
-				log.Printf("Waiting %v for file to stabilize...", w.stableDelay)
-				time.Sleep(w.stableDelay)
-				
-				// Read file content
-				content, err := os.ReadFile(path)
-				if err != nil {
-					log.Printf("Error reading file: %v", err)
-					continue
-				}
-				
-				return path, string(content), nil
+		select {
+		case <-ctx.Done():
+			return
+
+		case ev, ok := <-events:
+			if !ok {
+				// Event source died; keep going on polling alone
+				log.Println("File event source closed, falling back to polling")
+				events = nil
+				rescan.Reset(w.pollInterval)
+				continue
+			}
+			w.handleEvent(files, ev)
+
+		case <-rescan.C:
+			for path, info := range w.scan() {
+				w.observe(files, path, info)
 			}
-			
-			// Check if existing file was modified
-			if oldModTime, exists := initialFiles[path]; exists {
-				if modTime.After(oldModTime) {
-					log.Printf("File modified: %s", path)
-					time.Sleep(w.stableDelay)
-					
-					content, err := os.ReadFile(path)
-					if err != nil {
-						log.Printf("Error reading file: %v", err)
-						continue
-					}
-					
-					return path, string(content), nil
-				}
+
+		case <-settle.C:
+			if !w.emitPending(ctx, files, out) {
+				return
 			}
 		}
-		
-		time.Sleep(w.pollInterval)
 	}
 }
 
+// handleEvent applies one OS notification to the tracked files
+func (w *FileWatcher) handleEvent(files map[string]*trackedFile, ev fsEvent) {
+	if ev.Op == opOverflow {
+		for path, info := range w.scan() {
+			w.observe(files, path, info)
+		}
+		return
+	}
+
+	// A sentinel marks its response file complete
+	if strings.HasSuffix(ev.Path, DoneSuffix) {
+		if ev.Op == opRemoved {
+			return
+		}
+		target := strings.TrimSuffix(ev.Path, DoneSuffix)
+		if info, err := os.Stat(target); err == nil && isResponseFile(target) {
+			w.observe(files, target, info)
+			files[target].complete = true
+		}
+		return
+	}
+
+	if !isResponseFile(ev.Path) {
+		return
+	}
+	if ev.Op == opRemoved {
+		delete(files, ev.Path)
+		return
+	}
+
+	info, err := os.Stat(ev.Path)
+	if err != nil || info.IsDir() {
+		return
+	}
+	// A close only means one write finished; writers that append with
+	// open/write/close close many times, so it just restarts the settle window
+	w.observe(files, ev.Path, info)
+	if ev.Op == opMovedIn {
+		files[ev.Path].complete = true
+	}
+}
+
+// observe records the current size and mtime of a file
+func (w *FileWatcher) observe(files map[string]*trackedFile, path string, info os.FileInfo) {
+	f, ok := files[path]
+	if !ok {
+		files[path] = &trackedFile{size: info.Size(), modTime: info.ModTime(), changedAt: time.Now()}
+		return
+	}
+	if info.Size() != f.size || !info.ModTime().Equal(f.modTime) {
+		f.size = info.Size()
+		f.modTime = info.ModTime()
+		f.changedAt = time.Now()
+		f.complete = false
+		f.delivered = false
+	}
+}
+
+// emitPending sends every pending file that is complete, and the content so
+// far of files that grew since the last check. Returns false if ctx ended.
+func (w *FileWatcher) emitPending(ctx context.Context, files map[string]*trackedFile, out chan<- ResponseFile) bool {
+	now := time.Now()
+	for path, f := range files {
+		if f.delivered {
+			continue
+		}
+
+		info, err := os.Stat(path)
+		if err != nil {
+			delete(files, path)
+			continue
+		}
+		w.observe(files, path, info)
+
+		sentinel := path + DoneSuffix
+		if _, err := os.Stat(sentinel); err == nil {
+			f.complete = true
+		}
+
+		if f.size == 0 {
+			// Nothing written yet; wait for content
+			continue
+		}
+		settled := f.complete || now.Sub(f.changedAt) >= w.settleWindow
+		if !settled && f.size == f.partial {
+			continue
+		}
+
+		content, err := os.ReadFile(path)
+		if err != nil {
+			log.Printf("Failed to read %s: %v", path, err)
+			continue
+		}
+
+		event := ResponseFile{Path: path, Content: string(content), ModTime: f.modTime, Partial: !settled}
+		if settled {
+			f.delivered = true
+			f.partial = 0
+			os.Remove(sentinel)
+			log.Printf("Response file settled: %s (%d bytes)", path, len(content))
+		} else {
+			f.partial = f.size
+		}
+
+		select {
+		case out <- event:
+		case <-ctx.Done():
+			return false
+		}
+	}
+	return true
+}
+
+// WaitForNewFile waits for a new or modified file to be completely written
+// Returns the path to the file and its contents
+func (w *FileWatcher) WaitForNewFile() (string, string, error) {
+	log.Printf("Watching for new files in: %s (timeout: %v)", w.watchDir, w.timeout)
+
+	ctx, cancel := context.WithTimeout(context.Background(), w.timeout)
+	defer cancel()
+
+	for file := range w.Watch(ctx) {
+		if !file.Partial {
+			return file.Path, file.Content, nil
+		}
+	}
+	return "", "", fmt.Errorf("file watcher timed out after %v", w.timeout)
+}
+
 // WaitForLatestResponse waits for and returns the most recent response file
+// modified after afterTime
 func (w *FileWatcher) WaitForLatestResponse(afterTime time.Time) (string, error) {
 	log.Printf("Waiting for response file after: %v", afterTime)
-	
-	startTime := time.Now()
-	
-	for {
-		if time.Since(startTime) > w.timeout {
-			return "", fmt.Errorf("timeout waiting for response file")
-		}
-		
-		// Get all response files
-		files := w.getFilesWithInfo()
-		
-		// Find files modified after the start time
-		var recentFiles []fileInfo
-		for _, f := range files {
-			if f.modTime.After(afterTime) {
-				recentFiles = append(recentFiles, f)
-			}
+
+	ctx, cancel := context.WithTimeout(context.Background(), w.timeout)
+	defer cancel()
+
+	// Start watching before looking at existing files so nothing slips between
+	updates := w.Watch(ctx)
+
+	// A file may already have been written and settled
+	var recent []fileInfo
+	for path, info := range w.scan() {
+		if info.ModTime().After(afterTime) && time.Since(info.ModTime()) >= w.settleWindow {
+			recent = append(recent, fileInfo{path: path, modTime: info.ModTime()})
 		}
-		
-		if len(recentFiles) > 0 {
-			// Sort by modification time (newest first)
-			sort.Slice(recentFiles, func(i, j int) bool {
-				return recentFiles[i].modTime.After(recentFiles[j].modTime)
-			})
-			
-			newest := recentFiles[0]
-			log.Printf("Found recent response: %s (modified: %v)", newest.path, newest.modTime)
-			
-			// Wait for file to be fully written
-			time.Sleep(w.stableDelay)
-			
-			// Read content
-			content, err := os.ReadFile(newest.path)
-			if err != nil {
-				return "", fmt.Errorf("failed to read response file: %w", err)
-			}
-			
-			return string(content), nil
+	}
+	if len(recent) > 0 {
+		// Sort by modification time (newest first)
+		sort.Slice(recent, func(i, j int) bool {
+			return recent[i].modTime.After(recent[j].modTime)
+		})
+		content, err := os.ReadFile(recent[0].path)
+		if err != nil {
+			return "", fmt.Errorf("failed to read response file: %w", err)
+		}
+		return string(content), nil
+	}
+
+	for file := range updates {
+		if !file.Partial && file.ModTime.After(afterTime) {
+			log.Printf("Found recent response: %s (modified: %v)", file.Path, file.ModTime)
+			return file.Content, nil
 		}
-		
-		time.Sleep(w.pollInterval)
 	}
+	return "", fmt.Errorf("timeout waiting for response file")
 }
 
 type fileInfo struct {
@@ -151,80 +317,51 @@ type fileInfo struct {
 	modTime time.Time
 }
 
-// getFiles returns a map of file paths to modification times
-func (w *FileWatcher) getFiles() map[string]time.Time {
-	files := make(map[string]time.Time)
-	
+// scan returns info for all response files under the watch directory
+func (w *FileWatcher) scan() map[string]os.FileInfo {
+	files := make(map[string]os.FileInfo)
+
 	filepath.WalkDir(w.watchDir, func(path string, d fs.DirEntry, err error) error {
-		if err != nil {
+		if err != nil || d.IsDir() || !isResponseFile(path) {
 			return nil
 		}
-		if d.IsDir() {
-			return nil
-		}
-		// Only watch text/markdown files
-		ext := strings.ToLower(filepath.Ext(path))
-		if ext == ".txt" || ext == ".md" || ext == ".json" {
-			info, err := d.Info()
-			if err == nil {
-				files[path] = info.ModTime()
-			}
+		if info, err := d.Info(); err == nil {
+			files[path] = info
 		}
 		return nil
 	})
-	
+
 	return files
 }
 
-// getFilesWithInfo returns file info for all watched files
-func (w *FileWatcher) getFilesWithInfo() []fileInfo {
-	var files []fileInfo
-	
-	filepath.WalkDir(w.watchDir, func(path string, d fs.DirEntry, err error) error {
-		if err != nil {
-			return nil
-		}
-		if d.IsDir() {
-			return nil
-		}
-		info, err := d.Info()
-		if err == nil {
-			files = append(files, fileInfo{path: path, modTime: info.ModTime()})
-		}
-		return nil
-	})
-	
-	return files
+// isResponseFile reports whether path is a text/markdown response
+func isResponseFile(path string) bool {
+	ext := strings.ToLower(filepath.Ext(path))
+	return ext == ".txt" || ext == ".md"
 }
 
-// FormatResponseForTelegram formats the response content for Telegram
+// FormatResponseForTelegram cleans up response content for Telegram.
+// Long content is kept whole; split it with chunk.Split before sending.
 func (w *FileWatcher) FormatResponseForTelegram(content string) string {
 	// Clean up the content
 	lines := strings.Split(content, "\n")
 	var cleaned []string
-	
+
 	for _, line := range lines {
 		// Remove excessive whitespace
 		line = strings.TrimRight(line, " \t")
 		cleaned = append(cleaned, line)
 	}
-	
+
 	// Join and trim
 	result := strings.Join(cleaned, "\n")
-	result = strings.TrimSpace(result)
-	
-	// Truncate if too long for Telegram
-	if len(result) > 4000 {
-		result = result[:4000] + "\n\n...(已截斷)"
-	}
-	
-	return result
+	return strings.TrimSpace(result)
 }
 
 // CleanupOldFiles removes files older than a certain age
 func (w *FileWatcher) CleanupOldFiles(maxAge time.Duration) {
 	cutoff := time.Now().Add(-maxAge)
-	
+
 	filepath.WalkDir(w.watchDir, func(path string, d fs.DirEntry, err error) error {
 		if err != nil || d.IsDir() {
 			return nil
@@ -0,0 +1,194 @@
+package controller
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newTestWatcher(t *testing.T) *FileWatcher {
+	return &FileWatcher{
+		watchDir:     t.TempDir(),
+		pollInterval: 50 * time.Millisecond,
+		rescanEvery:  50 * time.Millisecond,
+		settleTick:   10 * time.Millisecond,
+		settleWindow: 200 * time.Millisecond,
+		timeout:      2 * time.Second,
+	}
+}
+
+// receive returns the next final (non-partial) event
+func receive(t *testing.T, ch <-chan ResponseFile, within time.Duration) (ResponseFile, bool) {
+	deadline := time.After(within)
+	for {
+		select {
+		case f, ok := <-ch:
+			if ok && f.Partial {
+				continue
+			}
+			return f, ok
+		case <-deadline:
+			return ResponseFile{}, false
+		}
+	}
+}
+
+func TestWatchIgnoresExistingFiles(t *testing.T) {
+	w := newTestWatcher(t)
+	os.WriteFile(filepath.Join(w.watchDir, "old.md"), []byte("old"), 0644)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	files := w.Watch(ctx)
+
+	if f, ok := receive(t, files, 400*time.Millisecond); ok {
+		t.Errorf("Existing file should not be emitted, got %s", f.Path)
+	}
+}
+
+func TestWatchWaitsForQuiescence(t *testing.T) {
+	w := newTestWatcher(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	files := w.Watch(ctx)
+	time.Sleep(50 * time.Millisecond)
+
+	// Keep appending without closing the writer, like a streaming agent
+	path := filepath.Join(w.watchDir, "1.md")
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	for i := 0; i < 5; i++ {
+		f.WriteString("part ")
+		time.Sleep(60 * time.Millisecond)
+	}
+
+	got, ok := receive(t, files, 2*time.Second)
+	if !ok {
+		t.Fatal("Expected settled file")
+	}
+	if got.Content != "part part part part part " {
+		t.Errorf("Expected full content, got %q", got.Content)
+	}
+}
+
+func TestWatchEmitsPartialContent(t *testing.T) {
+	w := newTestWatcher(t)
+	w.settleWindow = time.Hour
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	files := w.Watch(ctx)
+	time.Sleep(50 * time.Millisecond)
+
+	path := filepath.Join(w.watchDir, "5.md")
+	f, _ := os.OpenFile(path, os.O_CREATE|os.O_WRONLY, 0644)
+	defer f.Close()
+	f.WriteString("first line\n")
+
+	select {
+	case got := <-files:
+		if !got.Partial || got.Content != "first line\n" {
+			t.Errorf("Expected partial event with content so far, got %+v", got)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected partial event for growing file")
+	}
+}
+
+func TestWatchSentinelCompletesImmediately(t *testing.T) {
+	w := newTestWatcher(t)
+	w.settleWindow = time.Hour
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	files := w.Watch(ctx)
+	time.Sleep(50 * time.Millisecond)
+
+	path := filepath.Join(w.watchDir, "2.md")
+	f, _ := os.OpenFile(path, os.O_CREATE|os.O_WRONLY, 0644)
+	defer f.Close()
+	f.WriteString("answer")
+	os.WriteFile(path+DoneSuffix, nil, 0644)
+
+	got, ok := receive(t, files, time.Second)
+	if !ok || got.Content != "answer" {
+		t.Fatalf("Expected sentinel to complete file, got %+v %v", got, ok)
+	}
+	if _, err := os.Stat(path + DoneSuffix); !os.IsNotExist(err) {
+		t.Error("Sentinel should be removed after delivery")
+	}
+}
+
+func TestWatchAtomicRename(t *testing.T) {
+	w := newTestWatcher(t)
+	w.settleWindow = time.Hour
+	source, err := newEventSource(w.watchDir)
+	if err != nil {
+		t.Skipf("No file events: %v", err)
+	}
+	source.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	files := w.Watch(ctx)
+	time.Sleep(50 * time.Millisecond)
+
+	tmp := filepath.Join(w.watchDir, "3.tmp")
+	os.WriteFile(tmp, []byte("renamed"), 0644)
+	os.Rename(tmp, filepath.Join(w.watchDir, "3.md"))
+
+	got, ok := receive(t, files, time.Second)
+	if !ok || got.Content != "renamed" {
+		t.Fatalf("Expected renamed file, got %+v %v", got, ok)
+	}
+}
+
+func TestWaitForNewFile(t *testing.T) {
+	w := newTestWatcher(t)
+	go func() {
+		time.Sleep(100 * time.Millisecond)
+		os.WriteFile(filepath.Join(w.watchDir, "4.txt"), []byte("hi"), 0644)
+	}()
+
+	path, content, err := w.WaitForNewFile()
+	if err != nil {
+		t.Fatalf("WaitForNewFile failed: %v", err)
+	}
+	if filepath.Base(path) != "4.txt" || content != "hi" {
+		t.Errorf("Unexpected file %s: %q", path, content)
+	}
+}
+
+func TestWatchAppendsWithCloseAreOneResponse(t *testing.T) {
+	w := newTestWatcher(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	files := w.Watch(ctx)
+	time.Sleep(50 * time.Millisecond)
+
+	// Each append opens and closes the file, which must not end the response
+	path := filepath.Join(w.watchDir, "7.md")
+	for i := 0; i < 4; i++ {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.WriteString("chunk ")
+		f.Close()
+		time.Sleep(60 * time.Millisecond)
+	}
+
+	got, ok := receive(t, files, 2*time.Second)
+	if !ok {
+		t.Fatal("Expected a final event")
+	}
+	if got.Content != "chunk chunk chunk chunk " {
+		t.Errorf("Expected the full content, got %q", got.Content)
+	}
+	if extra, ok := receive(t, files, 400*time.Millisecond); ok {
+		t.Errorf("Expected exactly one final event, got another: %q", extra.Content)
+	}
+}
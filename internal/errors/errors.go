@@ -3,6 +3,8 @@ package errors
 import (
 	"fmt"
 	"time"
+
+	"github.com/applejobs/telegram-remote-controller/internal/i18n"
 )
 
 // ErrorCode represents different types of errors
@@ -62,22 +64,28 @@ func Is(err error, code ErrorCode) bool {
 	return false
 }
 
-// ErrorName returns the human-readable name for an error code
+// ErrorName returns the human-readable name for an error code in the
+// default locale
 func ErrorName(code ErrorCode) string {
-	names := map[ErrorCode]string{
-		ErrUnknown:       "未知錯誤",
-		ErrBotConnection: "Bot 連接失敗",
-		ErrAuthFailed:    "驗證失敗",
-		ErrCommandParse:  "指令解析錯誤",
-		ErrAutomation:    "自動化操作失敗",
-		ErrIDENotReady:   "IDE 未就緒",
-		ErrTimeout:       "操作超時",
-		ErrScreenshot:    "截圖失敗",
+	return LocalizedName(code, i18n.For(i18n.Default))
+}
+
+// LocalizedName returns the human-readable name for an error code in p's locale
+func LocalizedName(code ErrorCode, p i18n.Printer) string {
+	ids := map[ErrorCode]string{
+		ErrUnknown:       "error.unknown",
+		ErrBotConnection: "error.bot_connection",
+		ErrAuthFailed:    "error.auth_failed",
+		ErrCommandParse:  "error.command_parse",
+		ErrAutomation:    "error.automation",
+		ErrIDENotReady:   "error.ide_not_ready",
+		ErrTimeout:       "error.timeout",
+		ErrScreenshot:    "error.screenshot",
 	}
-	if name, ok := names[code]; ok {
-		return name
+	if id, ok := ids[code]; ok {
+		return p.T(id)
 	}
-	return "未知錯誤"
+	return p.T("error.unknown")
 }
 
 // Retry retries a function up to maxAttempts times with delay between attempts
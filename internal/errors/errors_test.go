@@ -4,6 +4,8 @@ import (
 	"errors"
 	"testing"
 	"time"
+
+	"github.com/applejobs/telegram-remote-controller/internal/i18n"
 )
 
 func TestNewAppError(t *testing.T) {
@@ -43,6 +45,9 @@ func TestErrorName(t *testing.T) {
 	if name != "驗證失敗" {
 		t.Errorf("Expected '驗證失敗', got '%s'", name)
 	}
+	if name := LocalizedName(ErrTimeout, i18n.For(i18n.En)); name != "Timed out" {
+		t.Errorf("Expected 'Timed out', got '%s'", name)
+	}
 }
 
 func TestRetrySuccess(t *testing.T) {
@@ -0,0 +1,179 @@
+// Package i18n looks up user-facing text by message ID in per-locale
+// bundles, with fmt-style arguments and plural forms.
+package i18n
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+)
+
+// Locale names a bundle, e.g. "zh-TW"
+type Locale string
+
+const (
+	ZhTW Locale = "zh-TW"
+	En   Locale = "en"
+
+	// Default is used for users whose language has no bundle
+	Default = ZhTW
+)
+
+//go:embed locales/*.json
+var files embed.FS
+
+// message is one bundle entry. Most have only Other; messages that vary
+// with a count set One as well, for languages that distinguish it.
+type message struct {
+	One   string
+	Other string
+}
+
+// UnmarshalJSON accepts "text" or {"one": "...", "other": "..."}
+func (m *message) UnmarshalJSON(data []byte) error {
+	var text string
+	if err := json.Unmarshal(data, &text); err == nil {
+		m.Other = text
+		return nil
+	}
+	var forms struct {
+		One   string `json:"one"`
+		Other string `json:"other"`
+	}
+	if err := json.Unmarshal(data, &forms); err != nil {
+		return err
+	}
+	if forms.Other == "" {
+		return fmt.Errorf("plural message needs an \"other\" form")
+	}
+	m.One, m.Other = forms.One, forms.Other
+	return nil
+}
+
+// bundles holds every locale's messages, loaded from locales/<locale>.json
+var bundles = mustLoad()
+
+func mustLoad() map[Locale]map[string]message {
+	entries, err := files.ReadDir("locales")
+	if err != nil {
+		panic(err)
+	}
+	loaded := make(map[Locale]map[string]message)
+	for _, entry := range entries {
+		data, err := files.ReadFile(path.Join("locales", entry.Name()))
+		if err != nil {
+			panic(err)
+		}
+		var bundle map[string]message
+		if err := json.Unmarshal(data, &bundle); err != nil {
+			panic(fmt.Sprintf("i18n: %s: %v", entry.Name(), err))
+		}
+		loaded[Locale(strings.TrimSuffix(entry.Name(), ".json"))] = bundle
+	}
+	return loaded
+}
+
+// Locales returns the locales that have a bundle, sorted
+func Locales() []Locale {
+	locales := make([]Locale, 0, len(bundles))
+	for locale := range bundles {
+		locales = append(locales, locale)
+	}
+	sort.Slice(locales, func(i, j int) bool { return locales[i] < locales[j] })
+	return locales
+}
+
+// Parse finds the bundle for a language tag such as Telegram's
+// language_code: "en-US" is English, and "zh", "zh-hant" and "zh-TW" are
+// Traditional Chinese
+func Parse(tag string) (Locale, bool) {
+	tag = strings.ToLower(strings.ReplaceAll(strings.TrimSpace(tag), "_", "-"))
+	lang, _, _ := strings.Cut(tag, "-")
+	switch lang {
+	case "en":
+		return En, true
+	case "zh":
+		return ZhTW, true
+	}
+	return "", false
+}
+
+// Match is Parse, using Default for languages without a bundle
+func Match(tag string) Locale {
+	if locale, ok := Parse(tag); ok {
+		return locale
+	}
+	return Default
+}
+
+// Printer formats messages in one locale
+type Printer struct {
+	Locale Locale
+}
+
+// For returns a printer for locale
+func For(locale Locale) Printer {
+	if _, ok := bundles[locale]; !ok {
+		locale = Default
+	}
+	return Printer{Locale: locale}
+}
+
+// Has reports whether the locale's bundle has a message
+func (p Printer) Has(id string) bool {
+	_, ok := bundles[p.Locale][id]
+	return ok
+}
+
+// T formats message id with args. Messages missing from the locale come
+// from Default; unknown IDs are returned as they are.
+func (p Printer) T(id string, args ...interface{}) string {
+	m, ok := p.lookup(id)
+	if !ok {
+		return id
+	}
+	return format(m.Other, args)
+}
+
+// N formats message id in the plural form for n. Without args, n is the
+// only argument.
+func (p Printer) N(id string, n int, args ...interface{}) string {
+	m, ok := p.lookup(id)
+	if !ok {
+		return id
+	}
+	if len(args) == 0 {
+		args = []interface{}{n}
+	}
+	text := m.Other
+	if m.One != "" && p.plural(n) == "one" {
+		text = m.One
+	}
+	return format(text, args)
+}
+
+// plural returns the CLDR plural category of n. Chinese has only "other".
+func (p Printer) plural(n int) string {
+	if p.Locale == En && n == 1 {
+		return "one"
+	}
+	return "other"
+}
+
+func (p Printer) lookup(id string) (message, bool) {
+	if m, ok := bundles[p.Locale][id]; ok {
+		return m, true
+	}
+	m, ok := bundles[Default][id]
+	return m, ok
+}
+
+func format(text string, args []interface{}) string {
+	if len(args) == 0 {
+		return text
+	}
+	return fmt.Sprintf(text, args...)
+}
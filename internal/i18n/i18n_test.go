@@ -0,0 +1,133 @@
+package i18n
+
+import (
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+var verbPattern = regexp.MustCompile(`%[-+# 0]*[0-9]*(?:\.[0-9]+)?[a-zA-Z%]`)
+
+func TestBundlesHaveTheSameMessages(t *testing.T) {
+	if len(Locales()) < 2 {
+		t.Fatalf("Expected at least two bundles, got %v", Locales())
+	}
+	reference := bundles[Default]
+	for _, locale := range Locales() {
+		bundle := bundles[locale]
+		for id := range reference {
+			if _, ok := bundle[id]; !ok {
+				t.Errorf("%s is missing %q", locale, id)
+			}
+		}
+		for id, m := range bundle {
+			ref, ok := reference[id]
+			if !ok {
+				t.Errorf("%s has %q, which %s is missing", locale, id, Default)
+				continue
+			}
+			// Every form must take the same arguments, so callers work in any locale
+			want := verbPattern.FindAllString(ref.Other, -1)
+			for _, text := range []string{m.One, m.Other} {
+				if text == "" {
+					continue
+				}
+				if got := verbPattern.FindAllString(text, -1); !reflect.DeepEqual(got, want) {
+					t.Errorf("%s %q has verbs %v, %s has %v", locale, id, got, Default, want)
+				}
+			}
+		}
+	}
+}
+
+// idPattern matches string literals that look like message IDs
+var idPattern = regexp.MustCompile(`"([a-z]+(?:\.[a-z0-9_]+)+)"`)
+
+func TestSourceUsesKnownMessages(t *testing.T) {
+	prefixes := map[string]bool{}
+	for id := range bundles[Default] {
+		prefix, _, _ := strings.Cut(id, ".")
+		prefixes[prefix] = true
+	}
+
+	root, checked := filepath.Join("..", ".."), 0
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || !strings.HasSuffix(path, ".go") || strings.HasSuffix(path, "_test.go") {
+			return err
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		for _, match := range idPattern.FindAllStringSubmatch(string(data), -1) {
+			id := match[1]
+			prefix, _, _ := strings.Cut(id, ".")
+			if !prefixes[prefix] {
+				continue
+			}
+			checked++
+			if !For(Default).Has(id) {
+				t.Errorf("%s uses %q, which is not in the bundles", path, id)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if checked == 0 {
+		t.Error("Found no message IDs in the source")
+	}
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		tag    string
+		locale Locale
+		ok     bool
+	}{
+		{"en", En, true},
+		{"en-US", En, true},
+		{"EN_gb", En, true},
+		{"zh-TW", ZhTW, true},
+		{"zh-hant", ZhTW, true},
+		{"zh", ZhTW, true},
+		{"ja", "", false},
+		{"", "", false},
+	}
+	for _, tt := range tests {
+		locale, ok := Parse(tt.tag)
+		if locale != tt.locale || ok != tt.ok {
+			t.Errorf("Parse(%q) = %q, %v; want %q, %v", tt.tag, locale, ok, tt.locale, tt.ok)
+		}
+	}
+	if got := Match("ja"); got != Default {
+		t.Errorf("Match(ja) = %q, want the default", got)
+	}
+}
+
+func TestPrinter(t *testing.T) {
+	en := For(En)
+	if got := en.T("lang.set", "English"); got != "✅ Switched to English" {
+		t.Errorf("Unexpected T: %q", got)
+	}
+	if got := en.N("tpl.kind_macro", 1); got != "macro, 1 step" {
+		t.Errorf("Expected the singular form, got %q", got)
+	}
+	if got := en.N("tpl.kind_macro", 3); got != "macro, 3 steps" {
+		t.Errorf("Expected the plural form, got %q", got)
+	}
+	if got := For(ZhTW).N("tpl.kind_macro", 1); got != "巨集 1 步" {
+		t.Errorf("Unexpected zh-TW plural: %q", got)
+	}
+	if got := en.T("no.such.message"); got != "no.such.message" {
+		t.Errorf("Unknown IDs should be returned as is, got %q", got)
+	}
+	if got := For("fr").Locale; got != Default {
+		t.Errorf("Locales without a bundle should use the default, got %q", got)
+	}
+}
@@ -43,9 +43,16 @@ type Store struct {
 	mutex    sync.RWMutex
 }
 
+// DefaultDir is where notes are kept
+const DefaultDir = "/Users/applejobs/.gemini/antigravity/scratch/telegram-agent-controller/notes"
+
 // NewStore creates a new notes store
 func NewStore() *Store {
-	notesDir := "/Users/applejobs/.gemini/antigravity/scratch/telegram-agent-controller/notes"
+	return NewStoreAt(DefaultDir)
+}
+
+// NewStoreAt creates a notes store kept in notesDir
+func NewStoreAt(notesDir string) *Store {
 	os.MkdirAll(notesDir, 0755)
 
 	store := &Store{
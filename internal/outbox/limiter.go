@@ -0,0 +1,77 @@
+package outbox
+
+import (
+	"sync"
+	"time"
+)
+
+// Limits are the minimum intervals between requests. Telegram allows about
+// 30 messages a second overall, one a second per chat and 20 a minute per group.
+type Limits struct {
+	Global   time.Duration // Between any two requests (default 35ms)
+	PerChat  time.Duration // Between requests to one private chat (default 1s)
+	PerGroup time.Duration // Between requests to one group, i.e. a negative chat ID (default 3s)
+}
+
+// limiter hands out send slots that respect Limits
+type limiter struct {
+	limits Limits
+
+	mu         sync.Mutex
+	nextGlobal time.Time
+	nextChat   map[int64]time.Time
+}
+
+func newLimiter(limits Limits) *limiter {
+	if limits.Global <= 0 {
+		limits.Global = 35 * time.Millisecond
+	}
+	if limits.PerChat <= 0 {
+		limits.PerChat = time.Second
+	}
+	if limits.PerGroup <= 0 {
+		limits.PerGroup = 3 * time.Second
+	}
+	return &limiter{limits: limits, nextChat: make(map[int64]time.Time)}
+}
+
+// reserve claims the next send slot for chat and returns how long to wait for it
+func (l *limiter) reserve(chat int64) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	at := now
+	if l.nextGlobal.After(at) {
+		at = l.nextGlobal
+	}
+	if next := l.nextChat[chat]; next.After(at) {
+		at = next
+	}
+
+	interval := l.limits.PerChat
+	if chat < 0 {
+		interval = l.limits.PerGroup
+	}
+	l.nextGlobal = at.Add(l.limits.Global)
+	l.nextChat[chat] = at.Add(interval)
+
+	// Forget chats that have been quiet for a while
+	if len(l.nextChat) > 1000 {
+		for id, next := range l.nextChat {
+			if next.Before(now) {
+				delete(l.nextChat, id)
+			}
+		}
+	}
+	return at.Sub(now)
+}
+
+// pause holds back a chat for d, e.g. after Telegram asked to retry later
+func (l *limiter) pause(chat int64, d time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if until := time.Now().Add(d); until.After(l.nextChat[chat]) {
+		l.nextChat[chat] = until
+	}
+}
@@ -0,0 +1,457 @@
+// Package outbox delivers outgoing Bot API requests in order per chat,
+// within Telegram's rate limits, retrying temporary failures and keeping
+// undelivered requests on disk until they go through.
+package outbox
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Request is one Bot API call
+type Request struct {
+	ID       string            `json:"id"`
+	ChatID   int64             `json:"chat_id"`
+	Method   string            `json:"method"`
+	Params   map[string]string `json:"params"`
+	File     *File             `json:"file,omitempty"`
+	Queued   time.Time         `json:"queued"`
+	Attempts int               `json:"attempts"`
+}
+
+// File is a file uploaded with a request, either read from Path or given as Data
+type File struct {
+	Field string `json:"field"`
+	Name  string `json:"name"`
+	Path  string `json:"path,omitempty"`
+	Data  []byte `json:"data,omitempty"`
+}
+
+// Sender performs a request and returns the ID of the message it sent or
+// edited, if any. It returns a *TemporaryError for failures worth retrying.
+type Sender func(req Request) (int, error)
+
+// TemporaryError marks a failure that may succeed later, such as a network
+// error or 429 Too Many Requests
+type TemporaryError struct {
+	Err        error
+	RetryAfter time.Duration // Wait at least this long, if set
+}
+
+func (e *TemporaryError) Error() string { return e.Err.Error() }
+func (e *TemporaryError) Unwrap() error { return e.Err }
+
+// ErrQueued is returned when a request could not be delivered in time.
+// It stays queued and is delivered later.
+var ErrQueued = errors.New("request queued for later delivery")
+
+// ErrUnresolved is returned for a request whose message_id is the
+// placeholder of a message that was never sent, because its request was
+// dropped or its placeholder was lost in a restart
+var ErrUnresolved = errors.New("refers to a message that was never sent")
+
+// DefaultMaxAge is how long undelivered requests keep being retried
+const DefaultMaxAge = 24 * time.Hour
+
+// messageRefs are the params that refer to another message, and may hold
+// a placeholder ID
+var messageRefs = []string{"message_id", "reply_to_message_id"}
+
+// Options tunes an Outbox; zero values use the defaults
+type Options struct {
+	Wait       time.Duration // How long Do waits for delivery (default 30s)
+	MinBackoff time.Duration // First retry delay (default 1s)
+	MaxBackoff time.Duration // Longest retry delay (default 5m)
+	MaxAge     time.Duration // Undelivered requests older than this are dropped (default DefaultMaxAge)
+	Limits     Limits
+}
+
+// Outbox queues requests per chat and delivers them in order
+type Outbox struct {
+	path    string
+	send    Sender
+	opts    Options
+	limiter *limiter
+
+	mu           sync.Mutex
+	nextID       int
+	queues       map[int64][]*entry // Undelivered requests per chat, oldest first
+	placeholders map[int]int        // Message IDs of queued requests, by placeholder
+	stored       bool               // The file at path holds requests
+	closing      chan struct{}
+	wg           sync.WaitGroup
+}
+
+// entry is a queued request and whoever waits for its result
+type entry struct {
+	req    Request
+	done   chan result
+	queued bool // Do gave up waiting and returned a placeholder
+}
+
+type result struct {
+	messageID int
+	err       error
+}
+
+// Open creates an outbox that keeps undelivered requests in the file at
+// path, and resumes delivering any left there. An empty path keeps them
+// in memory only.
+func Open(path string, send Sender, opts Options) (*Outbox, error) {
+	if opts.Wait <= 0 {
+		opts.Wait = 30 * time.Second
+	}
+	if opts.MinBackoff <= 0 {
+		opts.MinBackoff = time.Second
+	}
+	if opts.MaxBackoff <= 0 {
+		opts.MaxBackoff = 5 * time.Minute
+	}
+	if opts.MaxAge <= 0 {
+		opts.MaxAge = DefaultMaxAge
+	}
+
+	o := &Outbox{
+		path:         path,
+		send:         send,
+		opts:         opts,
+		limiter:      newLimiter(opts.Limits),
+		nextID:       1,
+		queues:       make(map[int64][]*entry),
+		placeholders: make(map[int]int),
+		closing:      make(chan struct{}),
+	}
+
+	saved, err := o.load()
+	if err != nil {
+		return nil, err
+	}
+	if len(saved) > 0 {
+		log.Printf("Resuming delivery of %d queued message(s)", len(saved))
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.stored = len(saved) > 0
+	for _, req := range saved {
+		if id, err := strconv.Atoi(req.ID); err == nil && id >= o.nextID {
+			o.nextID = id + 1
+		}
+		// Later saved requests may refer to these by placeholder
+		o.push(&entry{req: req, done: make(chan result, 1), queued: true})
+	}
+	return o, nil
+}
+
+// Do queues a request and waits for it to be delivered. A permanent
+// failure is returned as is; if delivery takes longer than Options.Wait,
+// Do returns ErrQueued and the request is delivered later.
+//
+// Along with ErrQueued, Do returns a negative placeholder for the message
+// ID. Later requests to the same chat may use it as message_id or
+// reply_to_message_id; it is replaced with the real ID once the message
+// is sent, which happens first since each chat is delivered in order. If
+// the message is never sent, edits that refer to it are dropped with
+// ErrUnresolved and replies to it are sent as plain messages.
+func (o *Outbox) Do(req Request) (int, error) {
+	o.mu.Lock()
+	req.ID = strconv.Itoa(o.nextID)
+	o.nextID++
+	req.Queued = time.Now()
+	req.Attempts = 0
+	e := &entry{req: req, done: make(chan result, 1)}
+	o.resolve(&e.req)
+	o.push(e)
+	o.save()
+	o.mu.Unlock()
+
+	timer := time.NewTimer(o.opts.Wait)
+	defer timer.Stop()
+	select {
+	case r := <-e.done:
+		return r.messageID, r.err
+	case <-timer.C:
+	case <-o.closing:
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	// Delivery may have finished while the lock was free
+	select {
+	case r := <-e.done:
+		return r.messageID, r.err
+	default:
+	}
+	log.Printf("%s to chat %d not delivered yet, keeping it queued", req.Method, req.ChatID)
+	e.queued = true
+	return placeholder(e.req.ID), ErrQueued
+}
+
+// Pending returns how many requests are waiting for delivery
+func (o *Outbox) Pending() int {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	n := 0
+	for _, queue := range o.queues {
+		n += len(queue)
+	}
+	return n
+}
+
+// Close stops delivery; undelivered requests stay on disk
+func (o *Outbox) Close() {
+	o.mu.Lock()
+	select {
+	case <-o.closing:
+	default:
+		close(o.closing)
+	}
+	o.mu.Unlock()
+	o.wg.Wait()
+
+	o.mu.Lock()
+	o.write(true)
+	o.mu.Unlock()
+}
+
+// push adds an entry to its chat's queue, starting delivery for the chat
+// if it is idle; o.mu must be held
+func (o *Outbox) push(e *entry) {
+	queue, busy := o.queues[e.req.ChatID]
+	o.queues[e.req.ChatID] = append(queue, e)
+	if !busy {
+		o.wg.Add(1)
+		go o.deliver(e.req.ChatID)
+	}
+}
+
+// deliver sends a chat's requests in order until its queue is empty
+func (o *Outbox) deliver(chat int64) {
+	defer o.wg.Done()
+
+	backoff := o.opts.MinBackoff
+	for {
+		o.mu.Lock()
+		queue := o.queues[chat]
+		if len(queue) == 0 {
+			delete(o.queues, chat)
+			o.mu.Unlock()
+			return
+		}
+		e := queue[0]
+		if err := o.settle(&e.req); err != nil {
+			log.Printf("Dropping %s to chat %d: %v", e.req.Method, chat, err)
+			o.queues[chat] = queue[1:]
+			o.save()
+			e.done <- result{err: err}
+			o.mu.Unlock()
+			continue
+		}
+		o.mu.Unlock()
+
+		if !o.sleep(o.limiter.reserve(chat)) {
+			return
+		}
+
+		id, err := o.send(e.req)
+		var temp *TemporaryError
+		if errors.As(err, &temp) && time.Since(e.req.Queued) < o.opts.MaxAge {
+			delay := max(backoff, temp.RetryAfter)
+			if temp.RetryAfter > 0 {
+				o.limiter.pause(chat, temp.RetryAfter)
+			}
+			log.Printf("%s to chat %d failed (%v), retrying in %v", e.req.Method, chat, err, delay)
+
+			o.mu.Lock()
+			e.req.Attempts++
+			o.save()
+			o.mu.Unlock()
+
+			if !o.sleep(delay) {
+				return
+			}
+			backoff = min(backoff*2, o.opts.MaxBackoff)
+			continue
+		}
+		backoff = o.opts.MinBackoff
+
+		if err != nil {
+			log.Printf("Dropping %s to chat %d after %d attempt(s): %v", e.req.Method, chat, e.req.Attempts+1, err)
+		}
+
+		o.mu.Lock()
+		o.queues[chat] = o.queues[chat][1:]
+		if e.queued && err == nil {
+			o.placeholders[placeholder(e.req.ID)] = id
+			for _, later := range o.queues[chat] {
+				o.resolve(&later.req)
+			}
+		}
+		o.save()
+		e.done <- result{messageID: id, err: err}
+		o.mu.Unlock()
+	}
+}
+
+// placeholder returns the message ID that stands in for a queued request's message
+func placeholder(requestID string) int {
+	n, _ := strconv.Atoi(requestID)
+	return -n
+}
+
+// resolve replaces placeholders in req with the IDs of messages since
+// sent; o.mu must be held
+func (o *Outbox) resolve(req *Request) {
+	for _, key := range messageRefs {
+		n, err := strconv.Atoi(req.Params[key])
+		if err != nil || n >= 0 {
+			continue
+		}
+		if id, ok := o.placeholders[n]; ok {
+			req.Params[key] = strconv.Itoa(id)
+		}
+	}
+}
+
+// settle resolves the placeholders of a request about to be sent. Their
+// messages were queued ahead of it, so any left unresolved will never be
+// sent: a reply goes out without the reference, and an edit fails with
+// ErrUnresolved. o.mu must be held.
+func (o *Outbox) settle(req *Request) error {
+	o.resolve(req)
+	if n, err := strconv.Atoi(req.Params["message_id"]); err == nil && n < 0 {
+		return fmt.Errorf("message_id %d %w", n, ErrUnresolved)
+	}
+	if n, err := strconv.Atoi(req.Params["reply_to_message_id"]); err == nil && n < 0 {
+		log.Printf("%s to chat %d replies to a message that was never sent (%d), sending it without the reply", req.Method, req.ChatID, n)
+		delete(req.Params, "reply_to_message_id")
+	}
+	return nil
+}
+
+// sleep waits for d, returning false if the outbox is closing
+func (o *Outbox) sleep(d time.Duration) bool {
+	if d <= 0 {
+		select {
+		case <-o.closing:
+			return false
+		default:
+			return true
+		}
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-o.closing:
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+// load reads the undelivered requests saved at o.path, oldest first
+func (o *Outbox) load() ([]Request, error) {
+	if o.path == "" {
+		return nil, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(o.path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create outbox directory: %w", err)
+	}
+
+	data, err := os.ReadFile(o.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read outbox: %w", err)
+	}
+
+	var saved []Request
+	if err := json.Unmarshal(data, &saved); err != nil {
+		log.Printf("Outbox %s is corrupt (%v), starting empty", o.path, err)
+		os.Rename(o.path, o.path+".corrupt")
+		return nil, nil
+	}
+	return saved, nil
+}
+
+// save writes the requests that wait for a retry to o.path atomically:
+// those of chats whose next request failed, and those Do stopped waiting
+// for. Requests that go through on the first try are never written, and
+// the file is only rewritten while it holds or needs requests. o.mu must
+// be held.
+func (o *Outbox) save() {
+	o.write(false)
+}
+
+// write saves the undelivered requests, or only those waiting for a retry;
+// o.mu must be held
+func (o *Outbox) write(all bool) {
+	if o.path == "" {
+		return
+	}
+
+	var pending []Request
+	for _, queue := range o.queues {
+		retrying := len(queue) > 0 && queue[0].req.Attempts > 0
+		for _, e := range queue {
+			if all || retrying || e.queued {
+				pending = append(pending, e.req)
+			}
+		}
+	}
+	if len(pending) == 0 && !o.stored {
+		return
+	}
+	// Keep the file in queue order so replay preserves per-chat order
+	sortRequests(pending)
+
+	data, err := json.Marshal(pending)
+	if err != nil {
+		log.Printf("Failed to encode outbox: %v", err)
+		return
+	}
+	if err := writeFileAtomic(o.path, data); err != nil {
+		log.Printf("Failed to save outbox: %v", err)
+		return
+	}
+	o.stored = len(pending) > 0
+}
+
+// sortRequests orders requests by ID, which follows queue order
+func sortRequests(reqs []Request) {
+	id := func(r Request) int {
+		n, _ := strconv.Atoi(r.ID)
+		return n
+	}
+	sort.Slice(reqs, func(i, j int) bool { return id(reqs[i]) < id(reqs[j]) })
+}
+
+// writeFileAtomic replaces path with data through a synced temp file
+func writeFileAtomic(path string, data []byte) error {
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,331 @@
+package outbox
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fastOptions keeps retries and rate limits short for tests
+var fastOptions = Options{
+	Wait:       2 * time.Second,
+	MinBackoff: 10 * time.Millisecond,
+	MaxBackoff: 50 * time.Millisecond,
+	Limits:     Limits{Global: time.Millisecond, PerChat: time.Millisecond, PerGroup: time.Millisecond},
+}
+
+// recorder is a Sender that records requests and fails as told
+type recorder struct {
+	mu    sync.Mutex
+	sent  []Request
+	times []time.Time
+	fail  []error // Returned by the next calls, in order
+}
+
+func (r *recorder) send(req Request) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.times = append(r.times, time.Now())
+	if len(r.fail) > 0 {
+		err := r.fail[0]
+		r.fail = r.fail[1:]
+		if err != nil {
+			return 0, err
+		}
+	}
+	r.sent = append(r.sent, req)
+	return len(r.sent), nil
+}
+
+func (r *recorder) texts() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var texts []string
+	for _, req := range r.sent {
+		texts = append(texts, req.Params["text"])
+	}
+	return texts
+}
+
+func text(chat int64, s string) Request {
+	return Request{ChatID: chat, Method: "sendMessage", Params: map[string]string{"text": s}}
+}
+
+func TestDoReturnsMessageID(t *testing.T) {
+	rec := &recorder{}
+	o, err := Open("", rec.send, fastOptions)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer o.Close()
+
+	for i, s := range []string{"a", "b"} {
+		id, err := o.Do(text(1, s))
+		if err != nil || id != i+1 {
+			t.Errorf("Do(%q) = %d, %v; want %d", s, id, err, i+1)
+		}
+	}
+	if o.Pending() != 0 {
+		t.Errorf("Expected nothing pending, got %d", o.Pending())
+	}
+}
+
+func TestPermanentErrorIsReturned(t *testing.T) {
+	bad := errors.New("Bad Request: can't parse entities")
+	rec := &recorder{fail: []error{bad}}
+	o, _ := Open("", rec.send, fastOptions)
+	defer o.Close()
+
+	if _, err := o.Do(text(1, "x")); !errors.Is(err, bad) {
+		t.Errorf("Expected the permanent error, got %v", err)
+	}
+	if len(rec.times) != 1 {
+		t.Errorf("Permanent errors should not be retried, got %d attempts", len(rec.times))
+	}
+}
+
+func TestTemporaryErrorIsRetried(t *testing.T) {
+	rec := &recorder{fail: []error{
+		&TemporaryError{Err: errors.New("connection reset")},
+		&TemporaryError{Err: errors.New("502 Bad Gateway")},
+	}}
+	o, _ := Open("", rec.send, fastOptions)
+	defer o.Close()
+
+	if _, err := o.Do(text(1, "x")); err != nil {
+		t.Fatalf("Expected delivery after retries, got %v", err)
+	}
+	if len(rec.times) != 3 {
+		t.Errorf("Expected 3 attempts, got %d", len(rec.times))
+	}
+}
+
+func TestRetryAfterIsHonored(t *testing.T) {
+	rec := &recorder{fail: []error{&TemporaryError{Err: errors.New("Too Many Requests"), RetryAfter: 300 * time.Millisecond}}}
+	o, _ := Open("", rec.send, fastOptions)
+	defer o.Close()
+
+	if _, err := o.Do(text(1, "x")); err != nil {
+		t.Fatalf("Do failed: %v", err)
+	}
+	if gap := rec.times[1].Sub(rec.times[0]); gap < 300*time.Millisecond {
+		t.Errorf("Retried after %v, before retry_after", gap)
+	}
+}
+
+func TestPerChatRateLimit(t *testing.T) {
+	opts := fastOptions
+	opts.Limits = Limits{Global: time.Millisecond, PerChat: 100 * time.Millisecond, PerGroup: 200 * time.Millisecond}
+	rec := &recorder{}
+	o, _ := Open("", rec.send, opts)
+	defer o.Close()
+
+	var wg sync.WaitGroup
+	for _, chat := range []int64{1, 1, 1, -5, -5} {
+		wg.Add(1)
+		go func(chat int64) {
+			defer wg.Done()
+			o.Do(text(chat, "x"))
+		}(chat)
+	}
+	wg.Wait()
+
+	last := map[int64]time.Time{}
+	for i, req := range rec.sent {
+		at := rec.times[i]
+		want := 100 * time.Millisecond
+		if req.ChatID < 0 {
+			want = 200 * time.Millisecond
+		}
+		if prev, ok := last[req.ChatID]; ok && at.Sub(prev) < want-5*time.Millisecond {
+			t.Errorf("Chat %d: sends %v apart, want at least %v", req.ChatID, at.Sub(prev), want)
+		}
+		last[req.ChatID] = at
+	}
+}
+
+func TestOrderKeptPerChat(t *testing.T) {
+	rec := &recorder{fail: []error{&TemporaryError{Err: errors.New("timeout")}}}
+	o, _ := Open("", rec.send, fastOptions)
+	defer o.Close()
+
+	for _, s := range []string{"1", "2", "3"} {
+		o.Do(text(1, s))
+	}
+	if got := rec.texts(); len(got) != 3 || got[0] != "1" || got[1] != "2" || got[2] != "3" {
+		t.Errorf("Expected 1, 2, 3 in order, got %v", got)
+	}
+}
+
+func TestUndeliveredSurviveRestart(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "outbox.json")
+
+	// Telegram is unreachable: requests stay queued
+	down := func(Request) (int, error) { return 0, &TemporaryError{Err: errors.New("network is unreachable")} }
+	opts := fastOptions
+	opts.Wait = 20 * time.Millisecond
+	o, err := Open(path, down, opts)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	for _, s := range []string{"first", "second"} {
+		if _, err := o.Do(text(7, s)); err != ErrQueued {
+			t.Fatalf("Expected ErrQueued, got %v", err)
+		}
+	}
+	o.Close()
+
+	// After a restart they are delivered in order
+	rec := &recorder{}
+	o, err = Open(path, rec.send, fastOptions)
+	if err != nil {
+		t.Fatalf("Reopen failed: %v", err)
+	}
+	defer o.Close()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for o.Pending() > 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if got := rec.texts(); len(got) != 2 || got[0] != "first" || got[1] != "second" {
+		t.Fatalf("Expected queued messages to be delivered in order, got %v", got)
+	}
+
+	// New requests continue the ID sequence
+	o.Do(text(7, "third"))
+	if id := rec.sent[2].ID; id != "3" {
+		t.Errorf("Expected ID 3 after restart, got %s", id)
+	}
+}
+
+func TestExpiredRequestsAreDropped(t *testing.T) {
+	down := func(Request) (int, error) { return 0, &TemporaryError{Err: errors.New("network is unreachable")} }
+	opts := fastOptions
+	opts.MaxAge = 50 * time.Millisecond
+	o, _ := Open("", down, opts)
+	defer o.Close()
+
+	if _, err := o.Do(text(1, "x")); err == nil || err == ErrQueued {
+		t.Errorf("Expected the last error once the request expired, got %v", err)
+	}
+	if o.Pending() != 0 {
+		t.Errorf("Expired request should be dropped, %d pending", o.Pending())
+	}
+}
+
+func TestDeliveredRequestsAreNotSaved(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "outbox.json")
+	rec := &recorder{}
+	o, err := Open(path, rec.send, fastOptions)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+
+	doc := text(1, "report")
+	doc.File = &File{Field: "document", Name: "report.md", Data: []byte("# report")}
+	for _, req := range []Request{text(1, "a"), doc, text(2, "b")} {
+		if _, err := o.Do(req); err != nil {
+			t.Fatalf("Do failed: %v", err)
+		}
+	}
+	o.Close()
+
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("Requests delivered on the first try should not be written, got %v", err)
+	}
+}
+
+func TestPlaceholderIsReplaced(t *testing.T) {
+	release := make(chan struct{})
+	rec := &recorder{}
+	send := func(req Request) (int, error) {
+		if req.Params["text"] == "slow" {
+			<-release
+		}
+		return rec.send(req)
+	}
+	opts := fastOptions
+	opts.Wait = 20 * time.Millisecond
+	o, _ := Open("", send, opts)
+	defer o.Close()
+
+	id, err := o.Do(text(1, "slow"))
+	if err != ErrQueued || id >= 0 {
+		t.Fatalf("Expected a placeholder with ErrQueued, got %d, %v", id, err)
+	}
+	ref := strconv.Itoa(id)
+
+	// An edit queued behind the message, and a reply sent after it
+	edit := Request{ChatID: 1, Method: "editMessageText", Params: map[string]string{"message_id": ref, "text": "edited"}}
+	go o.Do(edit)
+	for o.Pending() < 2 {
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+
+	reply := text(1, "reply")
+	reply.Params["reply_to_message_id"] = ref
+	if _, err := o.Do(reply); err != nil {
+		t.Fatalf("Do failed: %v", err)
+	}
+
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	if len(rec.sent) != 3 {
+		t.Fatalf("Expected 3 requests sent, got %d", len(rec.sent))
+	}
+	if got := rec.sent[1].Params["message_id"]; got != "1" {
+		t.Errorf("Queued edit should refer to message 1, got %s", got)
+	}
+	if got := rec.sent[2].Params["reply_to_message_id"]; got != "1" {
+		t.Errorf("Later reply should refer to message 1, got %s", got)
+	}
+}
+
+func TestUnresolvedPlaceholderIsDropped(t *testing.T) {
+	release := make(chan struct{})
+	bad := errors.New("Bad Request: chat not found")
+	rec := &recorder{fail: []error{bad}}
+	send := func(req Request) (int, error) {
+		if req.Params["text"] == "slow" {
+			<-release
+		}
+		return rec.send(req)
+	}
+	opts := fastOptions
+	opts.Wait = 20 * time.Millisecond
+	o, _ := Open("", send, opts)
+	defer o.Close()
+
+	// The message fails for good after Do returned its placeholder
+	id, err := o.Do(text(1, "slow"))
+	if err != ErrQueued {
+		t.Fatalf("Expected ErrQueued, got %v", err)
+	}
+	ref := strconv.Itoa(id)
+	close(release)
+
+	edit := Request{ChatID: 1, Method: "editMessageText", Params: map[string]string{"message_id": ref, "text": "edited"}}
+	if _, err := o.Do(edit); !errors.Is(err, ErrUnresolved) {
+		t.Errorf("Expected an edit of the lost message to fail with ErrUnresolved, got %v", err)
+	}
+
+	reply := text(1, "reply")
+	reply.Params["reply_to_message_id"] = ref
+	if _, err := o.Do(reply); err != nil {
+		t.Fatalf("Expected the reply to be sent, got %v", err)
+	}
+
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	if len(rec.sent) != 1 || rec.sent[0].Params["text"] != "reply" {
+		t.Fatalf("Expected only the reply to be sent, got %+v", rec.sent)
+	}
+	if got, ok := rec.sent[0].Params["reply_to_message_id"]; ok {
+		t.Errorf("The reply should not refer to the lost message, got %s", got)
+	}
+}
@@ -0,0 +1,344 @@
+// Package prefs keeps each user's preferences, such as their default model
+// and how long responses are delivered, in a JSON file.
+package prefs
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/applejobs/telegram-remote-controller/internal/i18n"
+)
+
+// DefaultPath is where preferences are kept
+const DefaultPath = "/Users/applejobs/.gemini/antigravity/scratch/telegram-agent-controller/state/preferences.json"
+
+// DefaultLanguagesPath is where /lang kept languages before preferences did
+const DefaultLanguagesPath = "/Users/applejobs/.gemini/antigravity/scratch/telegram-agent-controller/state/languages.json"
+
+// Verbosity is how much the bot reports while a job runs
+type Verbosity string
+
+const (
+	VerbosityQuiet   Verbosity = "quiet"   // Only the start, failures and the response
+	VerbosityNormal  Verbosity = "normal"  // Each step as it completes
+	VerbosityVerbose Verbosity = "verbose" // Steps with their timings
+)
+
+// LongMode is how responses over the document threshold are delivered
+type LongMode string
+
+const (
+	LongChunk    LongMode = "chunk"    // Split into several messages
+	LongDocument LongMode = "document" // Attached as a .md file with a preview
+	LongSummary  LongMode = "summary"  // Summarized, with a button for the full text
+)
+
+// PlainMode is what a message that is not a command does
+type PlainMode string
+
+const (
+	PlainRun   PlainMode = "run"   // Runs as a prompt
+	PlainNotes PlainMode = "notes" // Saves an idea
+)
+
+// Key names a preference in /settings
+type Key string
+
+const (
+	KeyModel        Key = "model"
+	KeyApp          Key = "app"
+	KeyIDE          Key = "ide"
+	KeyLanguage     Key = "language"
+	KeyVerbosity    Key = "verbosity"
+	KeyTimezone     Key = "timezone"
+	KeyLongResponse Key = "long_response"
+	KeyPlainText    Key = "plain_text"
+)
+
+// Keys lists the preferences in the order /settings shows them
+var Keys = []Key{KeyModel, KeyIDE, KeyApp, KeyLanguage, KeyVerbosity, KeyTimezone, KeyLongResponse, KeyPlainText}
+
+// Choices are the values of preferences that take one of a fixed set
+var Choices = map[Key][]string{
+	KeyVerbosity:    {string(VerbosityQuiet), string(VerbosityNormal), string(VerbosityVerbose)},
+	KeyLongResponse: {string(LongChunk), string(LongDocument), string(LongSummary)},
+	KeyPlainText:    {string(PlainRun), string(PlainNotes)},
+}
+
+// Errors
+var (
+	ErrUnknownKey   = errors.New("unknown setting")
+	ErrInvalidValue = errors.New("invalid value")
+)
+
+// Prefs are one user's preferences. An empty Model lets the router pick,
+// an empty IDE uses the default profile, an empty App uses the profile's
+// app, an empty Language follows the Telegram app and
+// an empty Timezone is the server's.
+type Prefs struct {
+	Model        string      `json:"model,omitempty"`
+	IDE          string      `json:"ide,omitempty"` // IDE profile name
+	App          string      `json:"app,omitempty"`
+	Language     i18n.Locale `json:"language,omitempty"`
+	Verbosity    Verbosity   `json:"verbosity,omitempty"`
+	Timezone     string      `json:"timezone,omitempty"`
+	LongResponse LongMode    `json:"long_response,omitempty"`
+	PlainText    PlainMode   `json:"plain_text,omitempty"`
+}
+
+// withDefaults fills in the preferences that always have a value
+func (p Prefs) withDefaults() Prefs {
+	if p.Verbosity == "" {
+		p.Verbosity = VerbosityNormal
+	}
+	if p.LongResponse == "" {
+		p.LongResponse = LongDocument
+	}
+	if p.PlainText == "" {
+		p.PlainText = PlainRun
+	}
+	return p
+}
+
+// Location returns the user's time zone
+func (p Prefs) Location() *time.Location {
+	if p.Timezone == "" {
+		return time.Local
+	}
+	loc, err := time.LoadLocation(p.Timezone)
+	if err != nil {
+		return time.Local
+	}
+	return loc
+}
+
+// Now returns the time in the user's time zone
+func (p Prefs) Now() time.Time {
+	return time.Now().In(p.Location())
+}
+
+// Value returns a preference as /settings shows it; empty means unset
+func (p Prefs) Value(key Key) string {
+	switch key {
+	case KeyModel:
+		return p.Model
+	case KeyIDE:
+		return p.IDE
+	case KeyApp:
+		return p.App
+	case KeyLanguage:
+		return string(p.Language)
+	case KeyVerbosity:
+		return string(p.Verbosity)
+	case KeyTimezone:
+		return p.Timezone
+	case KeyLongResponse:
+		return string(p.LongResponse)
+	case KeyPlainText:
+		return string(p.PlainText)
+	}
+	return ""
+}
+
+// set changes one preference; an empty value restores the default
+func (p *Prefs) set(key Key, value string) error {
+	if choices, ok := Choices[key]; ok && value != "" && !contains(choices, value) {
+		return fmt.Errorf("%w for %s: %q", ErrInvalidValue, key, value)
+	}
+
+	switch key {
+	case KeyModel:
+		p.Model = value
+	case KeyIDE:
+		p.IDE = value
+	case KeyApp:
+		p.App = value
+	case KeyLanguage:
+		locale, ok := i18n.Parse(value)
+		if value != "" && !ok {
+			return fmt.Errorf("%w for %s: %q", ErrInvalidValue, key, value)
+		}
+		p.Language = locale
+	case KeyVerbosity:
+		p.Verbosity = Verbosity(value)
+	case KeyTimezone:
+		if value != "" {
+			if _, err := time.LoadLocation(value); err != nil {
+				return fmt.Errorf("%w for %s: %q", ErrInvalidValue, key, value)
+			}
+		}
+		p.Timezone = value
+	case KeyLongResponse:
+		p.LongResponse = LongMode(value)
+	case KeyPlainText:
+		p.PlainText = PlainMode(value)
+	default:
+		return fmt.Errorf("%w: %q", ErrUnknownKey, key)
+	}
+	return nil
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// Store keeps the preferences of every user
+type Store struct {
+	path string
+
+	mu    sync.RWMutex
+	users map[int64]Prefs
+}
+
+// NewStore returns an empty store that is not saved anywhere
+func NewStore() *Store {
+	return &Store{users: make(map[int64]Prefs)}
+}
+
+// Load reads the preferences at path; a missing file is an empty store
+func Load(path string) (*Store, error) {
+	s := NewStore()
+	s.path = path
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read preferences: %w", err)
+	}
+
+	var saved map[string]Prefs
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return nil, fmt.Errorf("failed to parse preferences %s: %w", path, err)
+	}
+	for key, p := range saved {
+		userID, err := strconv.ParseInt(key, 10, 64)
+		if err != nil {
+			log.Printf("Skipping preferences for bad user ID %q", key)
+			continue
+		}
+		s.users[userID] = p
+	}
+	return s, nil
+}
+
+// ImportLanguages copies the languages users picked with /lang from the
+// file at path, which maps user IDs to locales, into the store. Users who
+// already have a language keep it. Once saved, the file is renamed with an
+// .imported suffix so it is read only once; a missing file is not an error.
+func (s *Store) ImportLanguages(path string) (int, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to read language choices: %w", err)
+	}
+
+	var saved map[string]string
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return 0, fmt.Errorf("failed to parse language choices %s: %w", path, err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	imported := 0
+	for key, value := range saved {
+		userID, err := strconv.ParseInt(key, 10, 64)
+		locale, ok := i18n.Parse(value)
+		if err != nil || !ok {
+			log.Printf("Skipping language choice %q for user %q", value, key)
+			continue
+		}
+		p := s.users[userID]
+		if p.Language != "" {
+			continue
+		}
+		p.Language = locale
+		s.users[userID] = p
+		imported++
+	}
+
+	if s.path == "" {
+		return imported, nil
+	}
+	if err := s.save(); err != nil {
+		return 0, err
+	}
+	return imported, os.Rename(path, path+".imported")
+}
+
+// Get returns a user's preferences, with defaults for what they have not set
+func (s *Store) Get(userID int64) Prefs {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.users[userID].withDefaults()
+}
+
+// Set changes one of a user's preferences and saves the store. An empty
+// value restores the default.
+func (s *Store) Set(userID int64, key Key, value string) (Prefs, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p := s.users[userID]
+	if err := p.set(key, value); err != nil {
+		return s.users[userID].withDefaults(), err
+	}
+	if p == (Prefs{}) {
+		delete(s.users, userID)
+	} else {
+		s.users[userID] = p
+	}
+	return p.withDefaults(), s.save()
+}
+
+// save writes the store atomically; s.mu must be held
+func (s *Store) save() error {
+	if s.path == "" {
+		return nil
+	}
+
+	saved := make(map[string]Prefs, len(s.users))
+	for userID, p := range s.users {
+		saved[strconv.FormatInt(userID, 10)] = p
+	}
+	data, err := json.MarshalIndent(saved, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return fmt.Errorf("failed to create preferences directory: %w", err)
+	}
+
+	tmp := s.path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return fmt.Errorf("failed to save preferences: %w", err)
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to save preferences: %w", err)
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to save preferences: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed to save preferences: %w", err)
+	}
+	return os.Rename(tmp, s.path)
+}
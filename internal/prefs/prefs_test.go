@@ -0,0 +1,141 @@
+package prefs
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/applejobs/telegram-remote-controller/internal/i18n"
+)
+
+func TestStorePersistsPreferences(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "preferences.json")
+	s, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if got := s.Get(7); got.Verbosity != VerbosityNormal || got.LongResponse != LongDocument || got.PlainText != PlainRun {
+		t.Errorf("Expected defaults for a new user, got %+v", got)
+	}
+
+	for _, set := range []struct {
+		key   Key
+		value string
+	}{
+		{KeyModel, "Gemini 3 Pro"},
+		{KeyLanguage, "en-US"},
+		{KeyVerbosity, "quiet"},
+		{KeyTimezone, "Asia/Taipei"},
+		{KeyLongResponse, "summary"},
+		{KeyPlainText, "notes"},
+	} {
+		if _, err := s.Set(7, set.key, set.value); err != nil {
+			t.Fatalf("Set(%s, %q) failed: %v", set.key, set.value, err)
+		}
+	}
+
+	reloaded, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	want := Prefs{
+		Model:        "Gemini 3 Pro",
+		Language:     i18n.En,
+		Verbosity:    VerbosityQuiet,
+		Timezone:     "Asia/Taipei",
+		LongResponse: LongSummary,
+		PlainText:    PlainNotes,
+	}
+	if got := reloaded.Get(7); got != want {
+		t.Errorf("Expected %+v after reload, got %+v", want, got)
+	}
+	if got := reloaded.Get(8); got.Model != "" {
+		t.Errorf("Other users should keep the defaults, got %+v", got)
+	}
+}
+
+func TestSetValidatesValues(t *testing.T) {
+	s := NewStore()
+
+	tests := []struct {
+		key   Key
+		value string
+		err   error
+	}{
+		{KeyVerbosity, "loud", ErrInvalidValue},
+		{KeyLongResponse, "pdf", ErrInvalidValue},
+		{KeyPlainText, "ask", ErrInvalidValue},
+		{KeyLanguage, "fr", ErrInvalidValue},
+		{KeyTimezone, "Mars/Olympus", ErrInvalidValue},
+		{"color", "blue", ErrUnknownKey},
+		{KeyVerbosity, "verbose", nil},
+	}
+	for _, tt := range tests {
+		if _, err := s.Set(1, tt.key, tt.value); !errors.Is(err, tt.err) {
+			t.Errorf("Set(%s, %q) = %v, want %v", tt.key, tt.value, err, tt.err)
+		}
+	}
+	if got := s.Get(1).Verbosity; got != VerbosityVerbose {
+		t.Errorf("Invalid values should not change preferences, got %s", got)
+	}
+}
+
+func TestSetEmptyRestoresDefault(t *testing.T) {
+	s := NewStore()
+	s.Set(1, KeyLongResponse, "chunk")
+	p, err := s.Set(1, KeyLongResponse, "")
+	if err != nil {
+		t.Fatalf("Set failed: %v", err)
+	}
+	if p.LongResponse != LongDocument {
+		t.Errorf("Expected the default after reset, got %s", p.LongResponse)
+	}
+}
+
+func TestLocation(t *testing.T) {
+	if loc := (Prefs{Timezone: "Asia/Tokyo"}).Location(); loc.String() != "Asia/Tokyo" {
+		t.Errorf("Unexpected location %s", loc)
+	}
+	if loc := (Prefs{}).Location(); loc != time.Local {
+		t.Errorf("Expected the server's zone without a preference, got %s", loc)
+	}
+}
+
+func TestImportLanguages(t *testing.T) {
+	dir := t.TempDir()
+	old := filepath.Join(dir, "languages.json")
+	if err := os.WriteFile(old, []byte(`{"7": "en", "8": "en", "9": "fr", "x": "en"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(dir, "preferences.json")
+	s, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if _, err := s.Set(8, KeyLanguage, "zh-TW"); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := s.ImportLanguages(old); err != nil || n != 1 {
+		t.Fatalf("ImportLanguages = %d, %v, want 1 import", n, err)
+	}
+
+	reloaded, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if got := reloaded.Get(7).Language; got != i18n.En {
+		t.Errorf("Expected the old choice to be kept, got %q", got)
+	}
+	if got := reloaded.Get(8).Language; got != i18n.ZhTW {
+		t.Errorf("A language set in preferences should win, got %q", got)
+	}
+	if _, err := os.Stat(old); !os.IsNotExist(err) {
+		t.Errorf("The old file should be moved aside, got %v", err)
+	}
+	if n, err := reloaded.ImportLanguages(old); err != nil || n != 0 {
+		t.Errorf("A second import should do nothing, got %d, %v", n, err)
+	}
+}
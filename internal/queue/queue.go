@@ -0,0 +1,548 @@
+package queue
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// State represents the lifecycle state of a job
+type State string
+
+const (
+	StateQueued    State = "queued"
+	StateRunning   State = "running"
+	StateWaiting   State = "waiting-response"
+	StateDone      State = "done"
+	StateFailed    State = "failed"
+	StateCancelled State = "cancelled"
+)
+
+const (
+	// DefaultJournalPath is where the job journal is kept
+	DefaultJournalPath = "/Users/applejobs/.gemini/antigravity/scratch/telegram-agent-controller/queue/jobs.jsonl"
+
+	// DefaultResponseTimeout is how long a submitted job waits for its response
+	DefaultResponseTimeout = 15 * time.Minute
+
+	// keepFinished is how many finished jobs are kept, in memory and in the journal
+	keepFinished = 50
+)
+
+// Errors
+var (
+	ErrJobNotFound   = errors.New("job not found")
+	ErrJobFinished   = errors.New("job already finished")
+	ErrJobNotRetried = errors.New("only failed or cancelled jobs can be retried")
+
+	// ErrNoResponse is returned by a Runner when no response will come,
+	// e.g. the prompt was pasted but not submitted; the job is done at once
+	ErrNoResponse = errors.New("no response expected")
+)
+
+// Job is a single prompt waiting for, or sent to, the IDE
+type Job struct {
+	ID        string `json:"id"`
+	ChatID    int64  `json:"chat_id"`
+	UserID    int64  `json:"user_id"`
+	MessageID int    `json:"message_id,omitempty"`
+	Prompt    string `json:"prompt"`
+	Model     string `json:"model"`
+	Route     string `json:"route,omitempty"` // Why the router picked Model, in the chat's language, if it did
+
+	// Per-run options from /run flags
+	IDE             string        `json:"ide,omitempty"`       // IDE profile to drive
+	App             string        `json:"app,omitempty"`       // App to drive instead of the profile's
+	Workspace       string        `json:"workspace,omitempty"` // Folder to open first
+	Timeout         time.Duration `json:"timeout,omitempty"`   // Overrides the response timeout
+	NewChat         bool          `json:"new_chat,omitempty"`
+	NoSubmit        bool          `json:"no_submit,omitempty"`
+	ScreenshotAfter bool          `json:"screenshot_after,omitempty"`
+
+	State      State     `json:"state"`
+	Error      string    `json:"error,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+	StartedAt  time.Time `json:"started_at"`
+	FinishedAt time.Time `json:"finished_at"`
+}
+
+// Finished reports whether the job is in a terminal state
+func (j Job) Finished() bool {
+	return j.State == StateDone || j.State == StateFailed || j.State == StateCancelled
+}
+
+// Runner executes a job against the IDE.
+// Returning nil moves the job to waiting-response until Complete is called;
+// returning ErrNoResponse finishes it.
+type Runner func(ctx context.Context, job Job) error
+
+// Queue serializes jobs so only one prompt is in flight at a time
+type Queue struct {
+	mu              sync.Mutex
+	journalPath     string
+	jobs            []*Job
+	nextID          int
+	runner          Runner
+	onChange        func(Job)
+	responseTimeout time.Duration
+	cancelRunning   context.CancelFunc
+	wake            chan struct{}
+}
+
+// NewQueue creates a queue backed by the journal at journalPath
+func NewQueue(journalPath string) *Queue {
+	os.MkdirAll(filepath.Dir(journalPath), 0755)
+
+	q := &Queue{
+		journalPath:     journalPath,
+		nextID:          1,
+		responseTimeout: DefaultResponseTimeout,
+		wake:            make(chan struct{}, 1),
+	}
+
+	// Replay the journal and compact it
+	q.load()
+
+	return q
+}
+
+// SetRunner sets the function that executes jobs
+func (q *Queue) SetRunner(runner Runner) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.runner = runner
+}
+
+// OnChange registers a callback invoked after every state change
+func (q *Queue) OnChange(fn func(Job)) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.onChange = fn
+}
+
+// SetResponseTimeout sets how long a job may wait for its response
+func (q *Queue) SetResponseTimeout(d time.Duration) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.responseTimeout = d
+}
+
+// Enqueue adds a job to the end of the queue and returns it with its ID assigned
+func (q *Queue) Enqueue(job Job) Job {
+	q.mu.Lock()
+	job.ID = strconv.Itoa(q.nextID)
+	q.nextID++
+	job.State = StateQueued
+	job.Error = ""
+	job.CreatedAt = time.Now()
+	job.StartedAt = time.Time{}
+	job.FinishedAt = time.Time{}
+
+	stored := job
+	q.jobs = append(q.jobs, &stored)
+	q.appendJournal(stored)
+	q.mu.Unlock()
+
+	log.Printf("Enqueued job %s from chat %d", job.ID, job.ChatID)
+	q.notify(job)
+	q.signal()
+	return job
+}
+
+// Cancel cancels a queued, running or waiting job
+func (q *Queue) Cancel(id string) (Job, error) {
+	q.mu.Lock()
+	job := q.find(id)
+	if job == nil {
+		q.mu.Unlock()
+		return Job{}, ErrJobNotFound
+	}
+	if job.Finished() {
+		q.mu.Unlock()
+		return *job, ErrJobFinished
+	}
+
+	if job.State == StateRunning && q.cancelRunning != nil {
+		q.cancelRunning()
+	}
+	snapshot := q.setState(job, StateCancelled, "")
+	q.mu.Unlock()
+
+	q.notify(snapshot)
+	q.signal()
+	return snapshot, nil
+}
+
+// Retry enqueues a copy of a failed or cancelled job
+func (q *Queue) Retry(id string) (Job, error) {
+	q.mu.Lock()
+	job := q.find(id)
+	if job == nil {
+		q.mu.Unlock()
+		return Job{}, ErrJobNotFound
+	}
+	if job.State != StateFailed && job.State != StateCancelled {
+		q.mu.Unlock()
+		return *job, ErrJobNotRetried
+	}
+	retry := *job
+	q.mu.Unlock()
+
+	return q.Enqueue(retry), nil
+}
+
+// Rerun enqueues a copy of a job whatever its state, e.g. to ask the same
+// prompt again after a response arrived
+func (q *Queue) Rerun(id string) (Job, error) {
+	q.mu.Lock()
+	job := q.find(id)
+	if job == nil {
+		q.mu.Unlock()
+		return Job{}, ErrJobNotFound
+	}
+	rerun := *job
+	q.mu.Unlock()
+
+	return q.Enqueue(rerun), nil
+}
+
+// Complete marks a job as done once its response arrived.
+// A failed job is also completed, since a late response means it actually ran.
+func (q *Queue) Complete(id string) (Job, bool) {
+	q.mu.Lock()
+	job := q.find(id)
+	if job == nil || (job.State != StateWaiting && job.State != StateFailed) {
+		q.mu.Unlock()
+		return Job{}, false
+	}
+	snapshot := q.setState(job, StateDone, "")
+	q.mu.Unlock()
+
+	q.notify(snapshot)
+	q.signal()
+	return snapshot, true
+}
+
+// Get returns a job by ID
+func (q *Queue) Get(id string) (Job, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if job := q.find(id); job != nil {
+		return *job, true
+	}
+	return Job{}, false
+}
+
+// List returns all unfinished jobs followed by the most recent finished ones
+func (q *Queue) List(recentFinished int) []Job {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	var active, finished []Job
+	for _, job := range q.jobs {
+		if job.Finished() {
+			finished = append(finished, *job)
+		} else {
+			active = append(active, *job)
+		}
+	}
+	if len(finished) > recentFinished {
+		finished = finished[len(finished)-recentFinished:]
+	}
+	return append(active, finished...)
+}
+
+// Pending returns the number of jobs ahead of a newly enqueued one
+func (q *Queue) Pending() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	count := 0
+	for _, job := range q.jobs {
+		if !job.Finished() {
+			count++
+		}
+	}
+	return count
+}
+
+// Run processes jobs one at a time until ctx is cancelled
+func (q *Queue) Run(ctx context.Context) {
+	log.Println("Job queue started")
+
+	for ctx.Err() == nil {
+		job := q.startNext()
+		if job == nil {
+			select {
+			case <-ctx.Done():
+				return
+			case <-q.wake:
+			}
+			continue
+		}
+
+		q.execute(ctx, job)
+	}
+}
+
+// startNext moves the oldest queued job to running
+func (q *Queue) startNext() *Job {
+	q.mu.Lock()
+	var next *Job
+	for _, job := range q.jobs {
+		if job.State == StateQueued {
+			next = job
+			break
+		}
+	}
+	if next == nil || q.runner == nil {
+		q.mu.Unlock()
+		return nil
+	}
+
+	snapshot := q.setState(next, StateRunning, "")
+	q.mu.Unlock()
+
+	q.notify(snapshot)
+	return next
+}
+
+// execute runs a job and waits for its response
+func (q *Queue) execute(ctx context.Context, job *Job) {
+	runCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	q.mu.Lock()
+	q.cancelRunning = cancel
+	runner := q.runner
+	snapshot := *job
+	q.mu.Unlock()
+
+	err := runner(runCtx, snapshot)
+
+	q.mu.Lock()
+	q.cancelRunning = nil
+	if job.State != StateRunning {
+		// Cancelled while running
+		q.mu.Unlock()
+		return
+	}
+	if errors.Is(err, ErrNoResponse) {
+		snapshot = q.setState(job, StateDone, "")
+		q.mu.Unlock()
+		q.notify(snapshot)
+		return
+	}
+	if err != nil {
+		snapshot = q.setState(job, StateFailed, err.Error())
+		q.mu.Unlock()
+		q.notify(snapshot)
+		return
+	}
+	snapshot = q.setState(job, StateWaiting, "")
+	timeout := q.responseTimeout
+	if job.Timeout > 0 {
+		timeout = job.Timeout
+	}
+	q.mu.Unlock()
+	q.notify(snapshot)
+
+	// Hold the queue until the response arrives, the job is cancelled or it times out
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	for {
+		q.mu.Lock()
+		waiting := job.State == StateWaiting
+		q.mu.Unlock()
+		if !waiting {
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-q.wake:
+		case <-timer.C:
+			q.mu.Lock()
+			if job.State != StateWaiting {
+				q.mu.Unlock()
+				return
+			}
+			snapshot = q.setState(job, StateFailed, fmt.Sprintf("no response after %v", timeout))
+			q.mu.Unlock()
+			q.notify(snapshot)
+			return
+		}
+	}
+}
+
+// setState updates a job and journals it. A finished job compacts the
+// journal, so neither it nor q.jobs grows without bound. Caller must hold q.mu.
+func (q *Queue) setState(job *Job, state State, errMsg string) Job {
+	now := time.Now()
+	job.State = state
+	job.Error = errMsg
+	switch state {
+	case StateRunning:
+		job.StartedAt = now
+	case StateDone, StateFailed, StateCancelled:
+		job.FinishedAt = now
+	}
+	if job.Finished() {
+		q.compact()
+	} else {
+		q.appendJournal(*job)
+	}
+	log.Printf("Job %s -> %s", job.ID, state)
+	return *job
+}
+
+// find returns a job by ID. Caller must hold q.mu.
+func (q *Queue) find(id string) *Job {
+	for _, job := range q.jobs {
+		if job.ID == id {
+			return job
+		}
+	}
+	return nil
+}
+
+func (q *Queue) notify(job Job) {
+	q.mu.Lock()
+	fn := q.onChange
+	q.mu.Unlock()
+	if fn != nil {
+		fn(job)
+	}
+}
+
+func (q *Queue) signal() {
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+// appendJournal writes a job snapshot to the journal. Caller must hold q.mu.
+func (q *Queue) appendJournal(job Job) {
+	data, err := json.Marshal(job)
+	if err != nil {
+		log.Printf("Error marshaling job: %v", err)
+		return
+	}
+
+	f, err := os.OpenFile(q.journalPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		log.Printf("Error opening job journal: %v", err)
+		return
+	}
+	defer f.Close()
+
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		log.Printf("Error writing job journal: %v", err)
+	}
+}
+
+// load replays the journal, fails interrupted jobs and compacts the file
+func (q *Queue) load() {
+	f, err := os.Open(q.journalPath)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("Error loading job journal: %v", err)
+		}
+		return
+	}
+
+	byID := make(map[string]*Job)
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	for scanner.Scan() {
+		var job Job
+		if err := json.Unmarshal(scanner.Bytes(), &job); err != nil {
+			log.Printf("Skipping bad journal line: %v", err)
+			continue
+		}
+		if existing, ok := byID[job.ID]; ok {
+			*existing = job
+			continue
+		}
+		stored := job
+		byID[job.ID] = &stored
+		q.jobs = append(q.jobs, &stored)
+
+		if n, err := strconv.Atoi(job.ID); err == nil && n >= q.nextID {
+			q.nextID = n + 1
+		}
+	}
+	f.Close()
+	if err := scanner.Err(); err != nil {
+		log.Printf("Error reading job journal: %v", err)
+	}
+
+	// A restart interrupts whatever was in flight
+	for _, job := range q.jobs {
+		if job.State == StateRunning || job.State == StateWaiting {
+			job.State = StateFailed
+			job.Error = "interrupted by restart"
+			job.FinishedAt = time.Now()
+		}
+	}
+
+	q.compact()
+	log.Printf("Loaded %d jobs from journal", len(q.jobs))
+}
+
+// compact rewrites the journal with one line per job, dropping finished
+// jobs beyond the most recent keepFinished. Caller must hold q.mu.
+func (q *Queue) compact() {
+	finished := 0
+	for _, job := range q.jobs {
+		if job.Finished() {
+			finished++
+		}
+	}
+
+	var kept []*Job
+	for _, job := range q.jobs {
+		if job.Finished() && finished > keepFinished {
+			finished--
+			continue
+		}
+		kept = append(kept, job)
+	}
+	q.jobs = kept
+
+	tmp := q.journalPath + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		log.Printf("Error compacting job journal: %v", err)
+		return
+	}
+	w := bufio.NewWriter(f)
+	for _, job := range q.jobs {
+		data, err := json.Marshal(job)
+		if err != nil {
+			continue
+		}
+		w.Write(append(data, '\n'))
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		log.Printf("Error compacting job journal: %v", err)
+		return
+	}
+	f.Close()
+
+	if err := os.Rename(tmp, q.journalPath); err != nil {
+		log.Printf("Error compacting job journal: %v", err)
+	}
+}
@@ -0,0 +1,255 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newTestQueue(t *testing.T) (*Queue, string) {
+	path := filepath.Join(t.TempDir(), "jobs.jsonl")
+	return NewQueue(path), path
+}
+
+func waitForState(t *testing.T, q *Queue, id string, state State) Job {
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if job, ok := q.Get(id); ok && job.State == state {
+			return job
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	job, _ := q.Get(id)
+	t.Fatalf("job %s: expected state %s, got %s", id, state, job.State)
+	return job
+}
+
+func TestEnqueueAssignsIDs(t *testing.T) {
+	q, _ := newTestQueue(t)
+
+	first := q.Enqueue(Job{ChatID: 1, Prompt: "a"})
+	second := q.Enqueue(Job{ChatID: 1, Prompt: "b"})
+
+	if first.ID != "1" || second.ID != "2" {
+		t.Errorf("Expected IDs 1 and 2, got %s and %s", first.ID, second.ID)
+	}
+	if first.State != StateQueued {
+		t.Errorf("Expected state queued, got %s", first.State)
+	}
+}
+
+func TestRunSerializesJobs(t *testing.T) {
+	q, _ := newTestQueue(t)
+
+	var mu sync.Mutex
+	var order []string
+	q.SetRunner(func(ctx context.Context, job Job) error {
+		mu.Lock()
+		order = append(order, job.ID)
+		mu.Unlock()
+		return nil
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go q.Run(ctx)
+
+	a := q.Enqueue(Job{Prompt: "a"})
+	b := q.Enqueue(Job{Prompt: "b"})
+
+	waitForState(t, q, a.ID, StateWaiting)
+	if job, _ := q.Get(b.ID); job.State != StateQueued {
+		t.Fatalf("Second job should stay queued while first waits, got %s", job.State)
+	}
+
+	if _, ok := q.Complete(a.ID); !ok {
+		t.Fatal("Complete should accept a waiting job")
+	}
+	waitForState(t, q, a.ID, StateDone)
+	waitForState(t, q, b.ID, StateWaiting)
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(order) != 2 || order[0] != a.ID || order[1] != b.ID {
+		t.Errorf("Unexpected run order: %v", order)
+	}
+}
+
+func TestRunnerErrorFailsJob(t *testing.T) {
+	q, _ := newTestQueue(t)
+	q.SetRunner(func(ctx context.Context, job Job) error {
+		return errors.New("paste failed")
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go q.Run(ctx)
+
+	job := q.Enqueue(Job{Prompt: "a"})
+	failed := waitForState(t, q, job.ID, StateFailed)
+	if failed.Error != "paste failed" {
+		t.Errorf("Expected error to be recorded, got %q", failed.Error)
+	}
+}
+
+func TestNoResponseFinishesJob(t *testing.T) {
+	q, _ := newTestQueue(t)
+	q.SetRunner(func(ctx context.Context, job Job) error {
+		if job.NoSubmit {
+			return ErrNoResponse
+		}
+		return nil
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go q.Run(ctx)
+
+	// A job that was not submitted must not hold up the next one
+	a := q.Enqueue(Job{Prompt: "a", NoSubmit: true})
+	b := q.Enqueue(Job{Prompt: "b"})
+	if done := waitForState(t, q, a.ID, StateDone); done.Error != "" {
+		t.Errorf("Expected no error, got %q", done.Error)
+	}
+	waitForState(t, q, b.ID, StateWaiting)
+}
+
+func TestResponseTimeout(t *testing.T) {
+	q, _ := newTestQueue(t)
+	q.SetResponseTimeout(20 * time.Millisecond)
+	q.SetRunner(func(ctx context.Context, job Job) error { return nil })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go q.Run(ctx)
+
+	job := q.Enqueue(Job{Prompt: "a"})
+	waitForState(t, q, job.ID, StateFailed)
+}
+
+func TestJobTimeoutOverridesDefault(t *testing.T) {
+	q, _ := newTestQueue(t)
+	q.SetResponseTimeout(time.Hour)
+	q.SetRunner(func(ctx context.Context, job Job) error { return nil })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go q.Run(ctx)
+
+	job := q.Enqueue(Job{Prompt: "a", Timeout: 20 * time.Millisecond})
+	waitForState(t, q, job.ID, StateFailed)
+}
+
+func TestCancelAndRetry(t *testing.T) {
+	q, _ := newTestQueue(t)
+	job := q.Enqueue(Job{ChatID: 42, Prompt: "a"})
+
+	cancelled, err := q.Cancel(job.ID)
+	if err != nil {
+		t.Fatalf("Cancel failed: %v", err)
+	}
+	if cancelled.State != StateCancelled {
+		t.Errorf("Expected cancelled, got %s", cancelled.State)
+	}
+
+	if _, err := q.Cancel(job.ID); err != ErrJobFinished {
+		t.Errorf("Expected ErrJobFinished, got %v", err)
+	}
+	if _, err := q.Cancel("999"); err != ErrJobNotFound {
+		t.Errorf("Expected ErrJobNotFound, got %v", err)
+	}
+
+	retried, err := q.Retry(job.ID)
+	if err != nil {
+		t.Fatalf("Retry failed: %v", err)
+	}
+	if retried.ID == job.ID || retried.ChatID != 42 || retried.State != StateQueued {
+		t.Errorf("Unexpected retried job: %+v", retried)
+	}
+
+	if _, ok := q.Complete(retried.ID); ok {
+		t.Error("Complete should not accept a queued job")
+	}
+	if _, err := q.Retry(retried.ID); err != ErrJobNotRetried {
+		t.Errorf("Expected ErrJobNotRetried, got %v", err)
+	}
+}
+
+func TestRerunCopiesAnyJob(t *testing.T) {
+	q, _ := newTestQueue(t)
+	job := q.Enqueue(Job{ChatID: 42, MessageID: 7, Prompt: "a", Model: "m"})
+
+	rerun, err := q.Rerun(job.ID)
+	if err != nil {
+		t.Fatalf("Rerun failed: %v", err)
+	}
+	if rerun.ID == job.ID || rerun.Prompt != "a" || rerun.Model != "m" || rerun.MessageID != 7 {
+		t.Errorf("Unexpected rerun job: %+v", rerun)
+	}
+	if _, err := q.Rerun("999"); err != ErrJobNotFound {
+		t.Errorf("Expected ErrJobNotFound, got %v", err)
+	}
+}
+
+func TestJournalSurvivesRestart(t *testing.T) {
+	q, path := newTestQueue(t)
+	q.SetRunner(func(ctx context.Context, job Job) error { return nil })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go q.Run(ctx)
+
+	running := q.Enqueue(Job{ChatID: 7, Prompt: "in flight"})
+	waitForState(t, q, running.ID, StateWaiting)
+	queued := q.Enqueue(Job{ChatID: 7, Prompt: "later"})
+	cancel()
+
+	reloaded := NewQueue(path)
+
+	job, ok := reloaded.Get(running.ID)
+	if !ok || job.State != StateFailed {
+		t.Errorf("In-flight job should fail after restart, got %+v", job)
+	}
+	job, ok = reloaded.Get(queued.ID)
+	if !ok || job.State != StateQueued || job.Prompt != "later" {
+		t.Errorf("Queued job should survive restart, got %+v", job)
+	}
+
+	next := reloaded.Enqueue(Job{Prompt: "new"})
+	if next.ID != "3" {
+		t.Errorf("Expected IDs to continue at 3, got %s", next.ID)
+	}
+}
+
+func TestFinishedJobsArePruned(t *testing.T) {
+	q, path := newTestQueue(t)
+	for i := 0; i < keepFinished+10; i++ {
+		job := q.Enqueue(Job{ChatID: 7, Prompt: "old"})
+		q.Cancel(job.ID)
+	}
+	pending := q.Enqueue(Job{ChatID: 7, Prompt: "pending"})
+
+	if got := len(q.List(1000)); got != keepFinished+1 {
+		t.Errorf("Expected %d jobs in memory, got %d", keepFinished+1, got)
+	}
+	if _, ok := q.Get("1"); ok {
+		t.Error("The oldest finished job should be pruned")
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Count(string(data), "\n"); lines != keepFinished+1 {
+		t.Errorf("Expected the journal to be compacted to %d lines, got %d", keepFinished+1, lines)
+	}
+
+	reloaded := NewQueue(path)
+	if job, ok := reloaded.Get(pending.ID); !ok || job.State != StateQueued {
+		t.Errorf("The pending job should survive, got %+v", job)
+	}
+}
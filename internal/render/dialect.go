@@ -0,0 +1,92 @@
+package render
+
+import "strings"
+
+// dialect writes the output syntax of one parse mode
+type dialect interface {
+	escape(text string) string
+	code(text string) string
+	pre(language, code string) string
+	bold(inner string) string
+	italic(inner string) string
+	strike(inner string) string
+	link(inner, url string) string
+	quote(inner string) string
+}
+
+// htmlDialect writes Telegram HTML
+type htmlDialect struct{}
+
+var htmlEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;")
+var attrEscaper = strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;", `"`, "&quot;")
+
+func (htmlDialect) escape(text string) string  { return htmlEscaper.Replace(text) }
+func (htmlDialect) code(text string) string    { return "<code>" + htmlEscaper.Replace(text) + "</code>" }
+func (htmlDialect) bold(inner string) string   { return "<b>" + inner + "</b>" }
+func (htmlDialect) italic(inner string) string { return "<i>" + inner + "</i>" }
+func (htmlDialect) strike(inner string) string { return "<s>" + inner + "</s>" }
+func (htmlDialect) quote(inner string) string  { return "<blockquote>" + inner + "</blockquote>" }
+
+func (htmlDialect) pre(language, code string) string {
+	if language == "" {
+		return "<pre>" + htmlEscaper.Replace(code) + "</pre>"
+	}
+	return `<pre><code class="language-` + language + `">` + htmlEscaper.Replace(code) + "</code></pre>"
+}
+
+func (htmlDialect) link(inner, url string) string {
+	return `<a href="` + attrEscaper.Replace(url) + `">` + inner + "</a>"
+}
+
+// markdownV2Dialect writes Telegram MarkdownV2
+type markdownV2Dialect struct{}
+
+// Every character MarkdownV2 reserves must be escaped in plain text
+var markdownV2Escaper = strings.NewReplacer(
+	`\`, `\\`, "_", `\_`, "*", `\*`, "[", `\[`, "]", `\]`, "(", `\(`, ")", `\)`,
+	"~", `\~`, "`", "\\`", ">", `\>`, "#", `\#`, "+", `\+`, "-", `\-`, "=", `\=`,
+	"|", `\|`, "{", `\{`, "}", `\}`, ".", `\.`, "!", `\!`,
+)
+var markdownV2CodeEscaper = strings.NewReplacer(`\`, `\\`, "`", "\\`")
+var markdownV2URLEscaper = strings.NewReplacer(`\`, `\\`, ")", `\)`)
+
+func (markdownV2Dialect) escape(text string) string { return markdownV2Escaper.Replace(text) }
+func (markdownV2Dialect) code(text string) string {
+	return "`" + markdownV2CodeEscaper.Replace(text) + "`"
+}
+func (markdownV2Dialect) bold(inner string) string   { return "*" + inner + "*" }
+func (markdownV2Dialect) italic(inner string) string { return "_" + inner + "_" }
+func (markdownV2Dialect) strike(inner string) string { return "~" + inner + "~" }
+
+func (markdownV2Dialect) pre(language, code string) string {
+	return "```" + language + "\n" + markdownV2CodeEscaper.Replace(code) + "\n```"
+}
+
+func (markdownV2Dialect) link(inner, url string) string {
+	return "[" + inner + "](" + markdownV2URLEscaper.Replace(url) + ")"
+}
+
+func (markdownV2Dialect) quote(inner string) string {
+	return ">" + strings.ReplaceAll(inner, "\n", "\n>")
+}
+
+// plainDialect drops all markup, keeping link targets visible
+type plainDialect struct{}
+
+func (plainDialect) escape(text string) string        { return text }
+func (plainDialect) code(text string) string          { return text }
+func (plainDialect) pre(language, code string) string { return code }
+func (plainDialect) bold(inner string) string         { return inner }
+func (plainDialect) italic(inner string) string       { return inner }
+func (plainDialect) strike(inner string) string       { return inner }
+
+func (plainDialect) link(inner, url string) string {
+	if inner == url {
+		return url
+	}
+	return inner + " (" + url + ")"
+}
+
+func (plainDialect) quote(inner string) string {
+	return "│ " + strings.ReplaceAll(inner, "\n", "\n│ ")
+}
@@ -0,0 +1,243 @@
+package render
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// inline renders the inline markup of one line: code spans, emphasis,
+// strikethrough, links and backslash escapes. Markup that is not closed
+// is kept as literal text.
+func inline(s string, d dialect) string {
+	var out, text strings.Builder
+	flush := func() {
+		out.WriteString(d.escape(text.String()))
+		text.Reset()
+	}
+
+	for i := 0; i < len(s); {
+		switch c := s[i]; c {
+		case '\\':
+			if i+1 < len(s) && isPunct(s[i+1]) {
+				text.WriteByte(s[i+1])
+				i += 2
+				continue
+			}
+
+		case '`':
+			n := runLength(s, i)
+			if end := findRun(s, i+n, '`', n); end >= 0 {
+				flush()
+				out.WriteString(d.code(trimCode(s[i+n : end])))
+				i = end + n
+				continue
+			}
+			text.WriteString(s[i : i+n])
+			i += n
+			continue
+
+		case '*', '_', '~':
+			if rendered, end, ok := emphasis(s, i, d); ok {
+				flush()
+				out.WriteString(rendered)
+				i = end
+				continue
+			}
+			n := runLength(s, i)
+			text.WriteString(s[i : i+n])
+			i += n
+			continue
+
+		case '[', '!':
+			if rendered, end, ok := link(s, i, d); ok {
+				flush()
+				out.WriteString(rendered)
+				i = end
+				continue
+			}
+
+		case '<':
+			if end := strings.IndexByte(s[i:], '>'); end > 0 {
+				if url := s[i+1 : i+end]; hasScheme(url) && !strings.ContainsAny(url, " <") {
+					flush()
+					out.WriteString(d.link(d.escape(url), url))
+					i += end + 1
+					continue
+				}
+			}
+		}
+
+		text.WriteByte(s[i])
+		i++
+	}
+
+	flush()
+	return out.String()
+}
+
+// emphasis renders *italic*, **bold**, ***both*** (or with _) and ~~strike~~
+// starting at s[i], returning the index just past the closing delimiter
+func emphasis(s string, i int, d dialect) (string, int, bool) {
+	c := s[i]
+	n := runLength(s, i)
+	if c == '~' && n != 2 {
+		return "", 0, false
+	}
+	// Underscores inside a word are literal, as in snake_case
+	if c == '_' && i > 0 && isWordByte(s, i-1) {
+		return "", 0, false
+	}
+
+	for k := min(n, 3); k >= 1; k-- {
+		start := i + k
+		end := findRun(s, start, c, k)
+		if end < 0 || end == start {
+			continue
+		}
+		inner := s[start:end]
+		if isSpaceAt(inner, 0) || isSpaceAt(inner, len(inner)-1) {
+			continue
+		}
+		if c == '_' && end+k < len(s) && isWordByte(s, end+k) {
+			continue
+		}
+
+		// Leftover delimiters of a longer opening run stay literal
+		rendered := d.escape(s[i : i+n-k])
+		body := inline(inner, d)
+		switch {
+		case c == '~':
+			rendered += d.strike(body)
+		case k == 1:
+			rendered += d.italic(body)
+		case k == 2:
+			rendered += d.bold(body)
+		default:
+			rendered += d.bold(d.italic(body))
+		}
+		return rendered, end + k, true
+	}
+	return "", 0, false
+}
+
+// link renders [text](url) or ![alt](url) starting at s[i]
+func link(s string, i int, d dialect) (string, int, bool) {
+	image := s[i] == '!'
+	open := i
+	if image {
+		if i+1 >= len(s) || s[i+1] != '[' {
+			return "", 0, false
+		}
+		open++
+	}
+
+	closeText := matching(s, open, '[', ']')
+	if closeText < 0 || closeText+1 >= len(s) || s[closeText+1] != '(' {
+		return "", 0, false
+	}
+	closeURL := matching(s, closeText+1, '(', ')')
+	if closeURL < 0 {
+		return "", 0, false
+	}
+
+	label := s[open+1 : closeText]
+	url := strings.TrimSpace(s[closeText+2 : closeURL])
+	if fields := strings.Fields(url); len(fields) > 0 {
+		url = fields[0] // Drop a "title"
+	}
+	url = strings.TrimSuffix(strings.TrimPrefix(url, "<"), ">")
+	if url == "" {
+		return "", 0, false
+	}
+
+	body := inline(label, d)
+	if label == "" {
+		body = d.escape(url)
+	}
+	// Telegram rejects relative links, so those keep only their text
+	if !hasScheme(url) {
+		return body, closeURL + 1, true
+	}
+	return d.link(body, url), closeURL + 1, true
+}
+
+// matching returns the index of the bracket closing the one at s[i]
+func matching(s string, i int, open, close byte) int {
+	depth := 0
+	for j := i; j < len(s); j++ {
+		switch s[j] {
+		case '\\':
+			j++
+		case open:
+			depth++
+		case close:
+			depth--
+			if depth == 0 {
+				return j
+			}
+		}
+	}
+	return -1
+}
+
+// findRun returns the index of the next run of exactly n c's at or after from
+func findRun(s string, from int, c byte, n int) int {
+	for j := from; j < len(s); {
+		if s[j] == '\\' {
+			j += 2
+			continue
+		}
+		if s[j] != c {
+			j++
+			continue
+		}
+		m := runLength(s, j)
+		if m == n {
+			return j
+		}
+		j += m
+	}
+	return -1
+}
+
+// runLength counts how many times s[i] repeats from i
+func runLength(s string, i int) int {
+	n := 1
+	for i+n < len(s) && s[i+n] == s[i] {
+		n++
+	}
+	return n
+}
+
+// trimCode strips the single space that pads a code span like “ `x` “
+func trimCode(code string) string {
+	if len(code) > 2 && code[0] == ' ' && code[len(code)-1] == ' ' && strings.TrimSpace(code) != "" {
+		return code[1 : len(code)-1]
+	}
+	return code
+}
+
+// hasScheme reports whether url is absolute, e.g. https://… or mailto:…
+func hasScheme(url string) bool {
+	return strings.Contains(url, "://") || strings.HasPrefix(url, "mailto:") || strings.HasPrefix(url, "tg:")
+}
+
+// isPunct reports whether c is ASCII punctuation, which a backslash escapes
+func isPunct(c byte) bool {
+	return c < utf8.RuneSelf && unicode.IsPunct(rune(c)) || strings.IndexByte("$+<=>^`|~", c) >= 0
+}
+
+// isWordByte reports whether the rune containing s[i] is a letter or digit
+func isWordByte(s string, i int) bool {
+	for i > 0 && !utf8.RuneStart(s[i]) {
+		i--
+	}
+	r, _ := utf8.DecodeRuneInString(s[i:])
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// isSpaceAt reports whether s has whitespace at byte i
+func isSpaceAt(s string, i int) bool {
+	return i >= 0 && i < len(s) && (s[i] == ' ' || s[i] == '\t')
+}
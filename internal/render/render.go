@@ -0,0 +1,162 @@
+package render
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Mode is a Telegram parse mode the renderer can target
+type Mode string
+
+const (
+	ModeHTML       Mode = "HTML"
+	ModeMarkdownV2 Mode = "MarkdownV2"
+	ModePlain      Mode = ""
+)
+
+// HTML converts CommonMark to Telegram HTML
+func HTML(markdown string) string {
+	return render(markdown, htmlDialect{})
+}
+
+// MarkdownV2 converts CommonMark to Telegram MarkdownV2
+func MarkdownV2(markdown string) string {
+	return render(markdown, markdownV2Dialect{})
+}
+
+// Plain strips CommonMark markup, for sending without a parse mode
+func Plain(markdown string) string {
+	return render(markdown, plainDialect{})
+}
+
+// EscapeHTML escapes plain text for use in a Telegram HTML message
+func EscapeHTML(text string) string {
+	return htmlEscaper.Replace(text)
+}
+
+// Render converts CommonMark for the given parse mode
+func Render(markdown string, mode Mode) string {
+	switch mode {
+	case ModeHTML:
+		return HTML(markdown)
+	case ModeMarkdownV2:
+		return MarkdownV2(markdown)
+	default:
+		return Plain(markdown)
+	}
+}
+
+var (
+	headingPattern = regexp.MustCompile(`^ {0,3}(#{1,6})(?:[ \t]+(.*?))?(?:[ \t]+#+)?[ \t]*$`)
+	listPattern    = regexp.MustCompile(`^([ \t]*)([-*+]|\d{1,9}[.)])[ \t]+(.*)$`)
+	rulePattern    = regexp.MustCompile(`^ {0,3}(?:(?:-[ \t]*){3,}|(?:\*[ \t]*){3,}|(?:_[ \t]*){3,})$`)
+	quotePattern   = regexp.MustCompile(`^ {0,3}>[ ]?`)
+)
+
+// horizontalRule replaces thematic breaks, which Telegram cannot show
+const horizontalRule = "──────────"
+
+// render converts markdown block by block. Line breaks are kept as they
+// are: chat messages read better that way than with paragraphs reflowed.
+func render(markdown string, d dialect) string {
+	lines := strings.Split(strings.ReplaceAll(markdown, "\r\n", "\n"), "\n")
+	out := make([]string, 0, len(lines))
+
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		trimmed := strings.TrimSpace(line)
+
+		if fence := fenceMarker(trimmed); fence != "" && len(line)-len(strings.TrimLeft(line, " ")) < 4 {
+			info := strings.TrimSpace(trimmed[len(fence):])
+			if fence[0] != '`' || !strings.Contains(info, "`") {
+				var code []string
+				for i++; i < len(lines) && !closesFence(fence, lines[i]); i++ {
+					code = append(code, lines[i])
+				}
+				out = append(out, d.pre(language(info), strings.Join(code, "\n")))
+				continue
+			}
+		}
+
+		switch {
+		case rulePattern.MatchString(line):
+			out = append(out, d.escape(horizontalRule))
+
+		case headingPattern.MatchString(line):
+			m := headingPattern.FindStringSubmatch(line)
+			if m[2] == "" {
+				out = append(out, "")
+			} else {
+				out = append(out, d.bold(inline(m[2], d)))
+			}
+
+		case quotePattern.MatchString(line):
+			var quoted []string
+			for ; i < len(lines) && quotePattern.MatchString(lines[i]); i++ {
+				quoted = append(quoted, quotePattern.ReplaceAllString(lines[i], ""))
+			}
+			i--
+			out = append(out, d.quote(render(strings.Join(quoted, "\n"), d)))
+
+		case listPattern.MatchString(line):
+			m := listPattern.FindStringSubmatch(line)
+			out = append(out, d.escape(m[1]+listMarker(m[2], &m[3]))+inline(m[3], d))
+
+		default:
+			out = append(out, inline(line, d))
+		}
+	}
+
+	return strings.Join(out, "\n")
+}
+
+// listMarker returns the bullet shown for a list item, consuming a task
+// checkbox from the start of its content
+func listMarker(marker string, content *string) string {
+	if marker[0] >= '0' && marker[0] <= '9' {
+		return marker[:len(marker)-1] + ". "
+	}
+	switch {
+	case strings.HasPrefix(*content, "[ ] "):
+		*content = (*content)[4:]
+		return "☐ "
+	case strings.HasPrefix(*content, "[x] "), strings.HasPrefix(*content, "[X] "):
+		*content = (*content)[4:]
+		return "☑ "
+	}
+	return "• "
+}
+
+// fenceMarker returns the leading run of ``` or ~~~ in a trimmed line
+func fenceMarker(trimmed string) string {
+	for _, ch := range []byte{'`', '~'} {
+		n := 0
+		for n < len(trimmed) && trimmed[n] == ch {
+			n++
+		}
+		if n >= 3 {
+			return trimmed[:n]
+		}
+	}
+	return ""
+}
+
+// closesFence reports whether line closes the code block opened by fence
+func closesFence(fence, line string) bool {
+	trimmed := strings.TrimSpace(line)
+	return len(trimmed) >= len(fence) && strings.Trim(trimmed, fence[:1]) == ""
+}
+
+// language returns the language hint of a fence's info string, if it is a
+// plain identifier Telegram will accept
+func language(info string) string {
+	if fields := strings.Fields(info); len(fields) > 0 {
+		for _, r := range fields[0] {
+			if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || strings.ContainsRune("+-_#.", r)) {
+				return ""
+			}
+		}
+		return fields[0]
+	}
+	return ""
+}
@@ -0,0 +1,84 @@
+package render
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite golden files")
+
+// TestGolden renders every testdata/*.md in each mode and compares the
+// output with its golden file. Run with -update to rewrite them.
+func TestGolden(t *testing.T) {
+	inputs, err := filepath.Glob(filepath.Join("testdata", "*.md"))
+	if err != nil || len(inputs) == 0 {
+		t.Fatalf("No golden inputs found: %v", err)
+	}
+
+	modes := []struct {
+		ext    string
+		render func(string) string
+	}{
+		{".html", HTML},
+		{".mdv2", MarkdownV2},
+		{".txt", Plain},
+	}
+
+	for _, input := range inputs {
+		source, err := os.ReadFile(input)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for _, mode := range modes {
+			golden := strings.TrimSuffix(input, ".md") + mode.ext
+			t.Run(filepath.Base(golden), func(t *testing.T) {
+				got := mode.render(string(source))
+				if *update {
+					if err := os.WriteFile(golden, []byte(got), 0644); err != nil {
+						t.Fatal(err)
+					}
+					return
+				}
+
+				want, err := os.ReadFile(golden)
+				if err != nil {
+					t.Fatalf("Missing golden file (run go test -update): %v", err)
+				}
+				if got != string(want) {
+					t.Errorf("Output differs from %s\n--- got ---\n%s\n--- want ---\n%s", golden, got, want)
+				}
+			})
+		}
+	}
+}
+
+func TestRenderMode(t *testing.T) {
+	tests := []struct {
+		mode     Mode
+		expected string
+	}{
+		{ModeHTML, "<b>a</b> &lt;b&gt;"},
+		{ModeMarkdownV2, `*a* <b\>`},
+		{ModePlain, "a <b>"},
+	}
+
+	for _, tt := range tests {
+		if got := Render("**a** <b>", tt.mode); got != tt.expected {
+			t.Errorf("Render(%q) = %q, want %q", tt.mode, got, tt.expected)
+		}
+	}
+}
+
+func TestMarkdownV2EscapesEveryReservedCharacter(t *testing.T) {
+	reserved := "_*[]()~`>#+-=|{}.!"
+	got := markdownV2Dialect{}.escape(reserved)
+	for _, c := range reserved {
+		if !strings.Contains(got, `\`+string(c)) {
+			t.Errorf("%q is not escaped in %q", c, got)
+		}
+	}
+}
@@ -0,0 +1,321 @@
+// Package router picks a model for prompts sent without -m, following
+// rules from a config file, and records why for each choice.
+package router
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// DefaultPath is where the routing rules are kept
+const DefaultPath = "/Users/applejobs/.gemini/antigravity/scratch/telegram-agent-controller/config/routing.json"
+
+// Rule picks a model when all of its conditions hold. Unset conditions
+// always hold; a rule without conditions matches every prompt.
+type Rule struct {
+	Name string `json:"name"` // Shown in explanations, e.g. "coding keywords"
+
+	// Model to use, or several to choose the cheapest from; aliases are allowed
+	Model  string   `json:"model,omitempty"`
+	Models []string `json:"models,omitempty"`
+
+	Keywords  []string `json:"keywords,omitempty"`   // Any of these, ignoring case
+	Pattern   string   `json:"pattern,omitempty"`    // Regular expression the prompt matches
+	MinLength int      `json:"min_length,omitempty"` // In characters
+	MaxLength int      `json:"max_length,omitempty"`
+	Chats     []int64  `json:"chats,omitempty"` // Only for these chats
+	Hours     string   `json:"hours,omitempty"` // Local time window, e.g. "09:00-18:00" or "22-6"
+
+	pattern *regexp.Regexp
+	from    int // Minutes after midnight the window opens
+	until   int // Minutes after midnight the window closes
+}
+
+// Config is the routing file's layout
+type Config struct {
+	Default string             `json:"default,omitempty"` // Used when no rule matches
+	Rules   []Rule             `json:"rules"`             // Tried in order; the first match wins
+	Costs   map[string]float64 `json:"costs,omitempty"`   // USD per million input tokens, by model
+}
+
+// Input is what a routing decision is based on
+type Input struct {
+	Prompt  string
+	ChatID  int64
+	Time    time.Time
+	Default string // Used instead of the configured default, e.g. a user's preference
+}
+
+// Decision is the chosen model and why
+type Decision struct {
+	Model   string
+	Rule    string   // Name of the matching rule; empty for the default
+	Reasons []Reason // The conditions that held
+	Tokens  int      // Rough prompt size in tokens
+	Cost    float64  // Estimated input cost in USD; 0 when unknown
+}
+
+// Reason is a condition that held, with the values it was checked against,
+// so callers can describe it in the user's language
+type Reason struct {
+	Kind ReasonKind
+	Args []any
+}
+
+// ReasonKind says which condition a Reason is about
+type ReasonKind string
+
+const (
+	ReasonKeywords  ReasonKind = "keywords"   // Args: the keywords found, comma separated
+	ReasonPattern   ReasonKind = "pattern"    // Args: the pattern
+	ReasonMinLength ReasonKind = "min_length" // Args: the length and the minimum
+	ReasonMaxLength ReasonKind = "max_length" // Args: the length and the maximum
+	ReasonChat      ReasonKind = "chat"       // Args: the chat ID
+	ReasonHours     ReasonKind = "hours"      // Args: the time and the window
+	ReasonCheapest  ReasonKind = "cheapest"   // Args: the models compared, comma separated
+)
+
+// Resolver expands a model alias to a model name
+type Resolver func(name string) (string, error)
+
+// Router applies routing rules
+type Router struct {
+	config  Config
+	resolve Resolver
+	costs   map[string]float64 // By resolved model name
+}
+
+// New creates a router for config, resolving model names with resolve.
+// Invalid rules, unknown models and bad regular expressions are errors.
+func New(config Config, defaultModel string, resolve Resolver) (*Router, error) {
+	if resolve == nil {
+		resolve = func(name string) (string, error) { return name, nil }
+	}
+	r := &Router{config: config, resolve: resolve, costs: make(map[string]float64)}
+
+	if r.config.Default == "" {
+		r.config.Default = defaultModel
+	}
+	def, err := resolve(r.config.Default)
+	if err != nil {
+		return nil, fmt.Errorf("default model: %w", err)
+	}
+	r.config.Default = def
+
+	for name, cost := range config.Costs {
+		model, err := resolve(name)
+		if err != nil {
+			return nil, fmt.Errorf("cost table: %w", err)
+		}
+		r.costs[model] = cost
+	}
+
+	r.config.Rules = make([]Rule, len(config.Rules))
+	for i, rule := range config.Rules {
+		if err := r.compile(&rule); err != nil {
+			return nil, fmt.Errorf("rule %d (%s): %w", i+1, rule.Name, err)
+		}
+		r.config.Rules[i] = rule
+	}
+	return r, nil
+}
+
+// Load reads routing rules from path; a missing file routes everything to defaultModel
+func Load(path, defaultModel string, resolve Resolver) (*Router, error) {
+	var config Config
+	data, err := os.ReadFile(path)
+	switch {
+	case os.IsNotExist(err):
+		log.Printf("No routing rules at %s, using %s for every prompt", path, defaultModel)
+	case err != nil:
+		return nil, fmt.Errorf("failed to read routing rules: %w", err)
+	default:
+		if err := json.Unmarshal(data, &config); err != nil {
+			return nil, fmt.Errorf("failed to parse routing rules %s: %w", path, err)
+		}
+	}
+	return New(config, defaultModel, resolve)
+}
+
+// compile checks a rule and prepares its pattern, time window and models
+func (r *Router) compile(rule *Rule) error {
+	if rule.Name == "" {
+		return fmt.Errorf("rule needs a name")
+	}
+
+	models := rule.Models
+	if rule.Model != "" {
+		models = append([]string{rule.Model}, models...)
+	}
+	if len(models) == 0 {
+		return fmt.Errorf("rule needs a model")
+	}
+	rule.Models = nil
+	for _, name := range models {
+		model, err := r.resolve(name)
+		if err != nil {
+			return err
+		}
+		rule.Models = append(rule.Models, model)
+	}
+	rule.Model = ""
+
+	if rule.Pattern != "" {
+		re, err := regexp.Compile(rule.Pattern)
+		if err != nil {
+			return fmt.Errorf("bad pattern: %w", err)
+		}
+		rule.pattern = re
+	}
+
+	if rule.Hours != "" {
+		from, until, ok := strings.Cut(rule.Hours, "-")
+		var err1, err2 error
+		rule.from, err1 = parseClock(from)
+		rule.until, err2 = parseClock(until)
+		if !ok || err1 != nil || err2 != nil {
+			return fmt.Errorf("bad hours %q, want e.g. 09:00-18:00", rule.Hours)
+		}
+	}
+	return nil
+}
+
+// parseClock parses "9", "09" or "09:30" as minutes after midnight
+func parseClock(s string) (int, error) {
+	s = strings.TrimSpace(s)
+	hour, minute, hasMinute := strings.Cut(s, ":")
+	h, err := strconv.Atoi(hour)
+	if err != nil || h < 0 || h > 24 {
+		return 0, fmt.Errorf("bad hour %q", s)
+	}
+	m := 0
+	if hasMinute {
+		if m, err = strconv.Atoi(minute); err != nil || m < 0 || m > 59 {
+			return 0, fmt.Errorf("bad minute %q", s)
+		}
+	}
+	return h*60 + m, nil
+}
+
+// Route picks the model for a prompt
+func (r *Router) Route(in Input) Decision {
+	if in.Time.IsZero() {
+		in.Time = time.Now()
+	}
+
+	d := Decision{Model: r.config.Default, Tokens: estimateTokens(in.Prompt)}
+	if in.Default != "" {
+		d.Model = in.Default
+	}
+	for _, rule := range r.config.Rules {
+		reasons, ok := rule.match(in)
+		if !ok {
+			continue
+		}
+		d.Rule = rule.Name
+		d.Reasons = reasons
+		d.Model = rule.Models[0]
+		if len(rule.Models) > 1 {
+			d.Model = r.cheapest(rule.Models)
+			d.Reasons = append(d.Reasons, Reason{ReasonCheapest, []any{strings.Join(rule.Models, ", ")}})
+		}
+		break
+	}
+
+	if cost, ok := r.costs[d.Model]; ok {
+		d.Cost = cost * float64(d.Tokens) / 1e6
+	}
+	return d
+}
+
+// cheapest returns the model with the lowest known cost; models without a
+// cost count as the most expensive
+func (r *Router) cheapest(models []string) string {
+	best := models[0]
+	for _, model := range models[1:] {
+		cost, ok := r.costs[model]
+		bestCost, bestOK := r.costs[best]
+		if ok && (!bestOK || cost < bestCost) {
+			best = model
+		}
+	}
+	return best
+}
+
+// match reports whether every condition of the rule holds, and describes them
+func (rule Rule) match(in Input) ([]Reason, bool) {
+	var reasons []Reason
+
+	if len(rule.Keywords) > 0 {
+		lower := strings.ToLower(in.Prompt)
+		var found []string
+		for _, kw := range rule.Keywords {
+			if strings.Contains(lower, strings.ToLower(kw)) {
+				found = append(found, kw)
+			}
+		}
+		if len(found) == 0 {
+			return nil, false
+		}
+		reasons = append(reasons, Reason{ReasonKeywords, []any{strings.Join(found, ", ")}})
+	}
+
+	if rule.pattern != nil {
+		if !rule.pattern.MatchString(in.Prompt) {
+			return nil, false
+		}
+		reasons = append(reasons, Reason{ReasonPattern, []any{rule.Pattern}})
+	}
+
+	length := utf8.RuneCountInString(in.Prompt)
+	if rule.MinLength > 0 {
+		if length < rule.MinLength {
+			return nil, false
+		}
+		reasons = append(reasons, Reason{ReasonMinLength, []any{length, rule.MinLength}})
+	}
+	if rule.MaxLength > 0 {
+		if length > rule.MaxLength {
+			return nil, false
+		}
+		reasons = append(reasons, Reason{ReasonMaxLength, []any{length, rule.MaxLength}})
+	}
+
+	if len(rule.Chats) > 0 {
+		found := false
+		for _, chat := range rule.Chats {
+			found = found || chat == in.ChatID
+		}
+		if !found {
+			return nil, false
+		}
+		reasons = append(reasons, Reason{ReasonChat, []any{in.ChatID}})
+	}
+
+	if rule.Hours != "" {
+		now := in.Time.Hour()*60 + in.Time.Minute()
+		inside := now >= rule.from && now < rule.until
+		if rule.from > rule.until {
+			// The window wraps past midnight
+			inside = now >= rule.from || now < rule.until
+		}
+		if !inside {
+			return nil, false
+		}
+		reasons = append(reasons, Reason{ReasonHours, []any{in.Time.Format("15:04"), rule.Hours}})
+	}
+
+	return reasons, true
+}
+
+// estimateTokens roughly sizes a prompt: about four bytes of text per token
+func estimateTokens(prompt string) int {
+	return max(1, (len(prompt)+3)/4)
+}
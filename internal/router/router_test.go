@@ -0,0 +1,142 @@
+package router
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// aliases stands in for the model catalog
+func resolve(name string) (string, error) {
+	aliases := map[string]string{"coding": "Gemini 3 Pro", "thinking": "Claude Opus 4.5 (Thinking)", "fast": "Gemini 3 Flash"}
+	if full, ok := aliases[name]; ok {
+		return full, nil
+	}
+	for _, full := range aliases {
+		if full == name {
+			return full, nil
+		}
+	}
+	return "", fmt.Errorf("unknown model %q", name)
+}
+
+func testRouter(t *testing.T) *Router {
+	r, err := New(Config{
+		Rules: []Rule{
+			{Name: "night owl", Model: "fast", Chats: []int64{99}, Hours: "22:00-06:00"},
+			{Name: "coding keywords", Model: "coding", Keywords: []string{"bug", "程式", "refactor"}},
+			{Name: "stack traces", Model: "thinking", Pattern: `(?m)^\s+at \S+\(`},
+			{Name: "long prompts", Model: "thinking", MinLength: 500},
+			{Name: "short questions", Models: []string{"thinking", "fast"}, MaxLength: 40},
+		},
+		Costs: map[string]float64{"thinking": 15, "fast": 0.3, "Gemini 3 Pro": 1.25},
+	}, "Claude Opus 4.5 (Thinking)", resolve)
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+	return r
+}
+
+func TestRoute(t *testing.T) {
+	r := testRouter(t)
+	noon := time.Date(2026, 1, 1, 12, 0, 0, 0, time.Local)
+	midnight := time.Date(2026, 1, 1, 23, 30, 0, 0, time.Local)
+
+	tests := []struct {
+		name  string
+		in    Input
+		model string
+		rule  string
+	}{
+		{"keywords", Input{Prompt: "please fix this BUG in the parser and explain what went wrong in detail", Time: noon}, "Gemini 3 Pro", "coding keywords"},
+		{"cjk keywords", Input{Prompt: "幫我看一下這段程式為什麼跑不動，順便整理一下結構和命名方式", Time: noon}, "Gemini 3 Pro", "coding keywords"},
+		{"regex", Input{Prompt: "Why does this crash?\n    at main.run(main.go:12)\n    at main.main(main.go:3)", Time: noon}, "Claude Opus 4.5 (Thinking)", "stack traces"},
+		{"length", Input{Prompt: strings.Repeat("很長的說明", 120), Time: noon}, "Claude Opus 4.5 (Thinking)", "long prompts"},
+		{"cheapest candidate", Input{Prompt: "What time is it?", Time: noon}, "Gemini 3 Flash", "short questions"},
+		{"chat and time", Input{Prompt: "fix the bug", ChatID: 99, Time: midnight}, "Gemini 3 Flash", "night owl"},
+		{"chat outside hours", Input{Prompt: "fix the bug", ChatID: 99, Time: noon}, "Gemini 3 Pro", "coding keywords"},
+		{"default", Input{Prompt: "Summarize yesterday's meeting notes and list the open questions for the team", Time: noon}, "Claude Opus 4.5 (Thinking)", ""},
+		{"user default", Input{Prompt: "Summarize yesterday's meeting notes and list the open questions for the team", Time: noon, Default: "Gemini 3 Flash"}, "Gemini 3 Flash", ""},
+		{"rules beat user default", Input{Prompt: "fix the bug", Time: noon, Default: "Gemini 3 Flash"}, "Gemini 3 Pro", "coding keywords"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			d := r.Route(tt.in)
+			if d.Model != tt.model || d.Rule != tt.rule {
+				t.Errorf("Route = %s via %q, want %s via %q (%s)", d.Model, d.Rule, tt.model, tt.rule, d.Reasons)
+			}
+		})
+	}
+}
+
+func TestReasons(t *testing.T) {
+	r := testRouter(t)
+	noon := time.Date(2026, 1, 1, 12, 0, 0, 0, time.Local)
+
+	d := r.Route(Input{Prompt: "this refactor introduced a bug somewhere in the scheduler code", Time: noon})
+	want := []Reason{{ReasonKeywords, []any{"bug, refactor"}}}
+	if d.Rule != "coding keywords" || !reflect.DeepEqual(d.Reasons, want) {
+		t.Errorf("Route = %q %v, want %q %v", d.Rule, d.Reasons, "coding keywords", want)
+	}
+	if d.Cost <= 0 || d.Tokens <= 0 {
+		t.Errorf("Expected a cost estimate, got %v for %d tokens", d.Cost, d.Tokens)
+	}
+
+	d = r.Route(Input{Prompt: "What time is it?", Time: noon})
+	want = []Reason{
+		{ReasonMaxLength, []any{16, 40}},
+		{ReasonCheapest, []any{"Claude Opus 4.5 (Thinking), Gemini 3 Flash"}},
+	}
+	if !reflect.DeepEqual(d.Reasons, want) {
+		t.Errorf("Reasons = %v, want %v", d.Reasons, want)
+	}
+}
+
+func TestNewRejectsBadRules(t *testing.T) {
+	tests := []struct {
+		rule Rule
+		err  string
+	}{
+		{Rule{Model: "coding"}, "needs a name"},
+		{Rule{Name: "x"}, "needs a model"},
+		{Rule{Name: "x", Model: "gpt-9"}, "unknown model"},
+		{Rule{Name: "x", Model: "coding", Pattern: "("}, "bad pattern"},
+		{Rule{Name: "x", Model: "coding", Hours: "late"}, "bad hours"},
+	}
+	for _, tt := range tests {
+		_, err := New(Config{Rules: []Rule{tt.rule}}, "coding", resolve)
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("New(%+v): expected error containing %q, got %v", tt.rule, tt.err, err)
+		}
+	}
+}
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+
+	r, err := Load(filepath.Join(dir, "missing.json"), "Gemini 3 Pro", resolve)
+	if err != nil {
+		t.Fatalf("Load of a missing file failed: %v", err)
+	}
+	if d := r.Route(Input{Prompt: "fix the bug"}); d.Model != "Gemini 3 Pro" || d.Rule != "" {
+		t.Errorf("Without rules everything should use the default, got %+v", d)
+	}
+
+	path := filepath.Join(dir, "routing.json")
+	os.WriteFile(path, []byte(`{"default": "fast", "rules": [{"name": "bugs", "model": "coding", "keywords": ["bug"]}]}`), 0644)
+	r, err = Load(path, "Gemini 3 Pro", resolve)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if d := r.Route(Input{Prompt: "hello"}); d.Model != "Gemini 3 Flash" {
+		t.Errorf("Expected the configured default, got %s", d.Model)
+	}
+	if d := r.Route(Input{Prompt: "a bug"}); d.Model != "Gemini 3 Pro" {
+		t.Errorf("Expected the rule to apply, got %s", d.Model)
+	}
+}
@@ -0,0 +1,364 @@
+// Package telegramtest provides a fake Telegram Bot API server for tests.
+// It records every call the bot makes and serves injected updates through
+// getUpdates, so the whole bot runs under go test without a network.
+package telegramtest
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	tgbotapi "github.com/go-telegram-bot-api/telegram-bot-api/v5"
+)
+
+// Token is the bot token the fake server accepts
+const Token = "123456:test-token"
+
+// BotID is the fake bot's user ID
+const BotID = 1
+
+// Call is one request the bot made
+type Call struct {
+	Method string
+	Params map[string]string // Form fields, including JSON-encoded ones such as reply_markup
+	Files  map[string]string // Uploaded file names by field
+}
+
+// Int returns a numeric parameter, or 0
+func (c Call) Int(key string) int64 {
+	v, _ := strconv.ParseInt(c.Params[key], 10, 64)
+	return v
+}
+
+// failure is an error response queued for a method
+type failure struct {
+	code        int
+	description string
+	retryAfter  int
+}
+
+// Server is a fake Bot API server
+type Server struct {
+	*httptest.Server
+
+	mu        sync.Mutex
+	calls     []Call
+	updates   []tgbotapi.Update
+	nextID    int // Next update ID
+	nextMsgID int // Next message ID handed out by send methods
+	failures  map[string][]failure
+	delays    map[string][]time.Duration
+	changed   chan struct{} // Closed and replaced whenever calls or updates change
+	closing   chan struct{}
+}
+
+// NewServer starts a fake Bot API server
+func NewServer() *Server {
+	s := &Server{
+		nextID:    1,
+		nextMsgID: 1000,
+		failures:  make(map[string][]failure),
+		delays:    make(map[string][]time.Duration),
+		changed:   make(chan struct{}),
+		closing:   make(chan struct{}),
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	return s
+}
+
+// Endpoint returns the API endpoint format string for bot.NewWithEndpoint
+func (s *Server) Endpoint() string {
+	return s.URL + "/bot%s/%s"
+}
+
+// Close ends pending long polls and shuts the server down
+func (s *Server) Close() {
+	s.mu.Lock()
+	select {
+	case <-s.closing:
+	default:
+		close(s.closing)
+	}
+	s.mu.Unlock()
+	s.Server.Close()
+}
+
+// PushUpdate queues an update for the next getUpdates call
+func (s *Server) PushUpdate(update tgbotapi.Update) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	update.UpdateID = s.nextID
+	s.nextID++
+	s.updates = append(s.updates, update)
+	s.notify()
+}
+
+// PushMessage queues a text message from userID in chatID and returns it
+func (s *Server) PushMessage(chatID, userID int64, text string) *tgbotapi.Message {
+	s.mu.Lock()
+	id := s.nextMsgID
+	s.nextMsgID++
+	s.mu.Unlock()
+
+	msg := &tgbotapi.Message{
+		MessageID: id,
+		From:      &tgbotapi.User{ID: userID, UserName: "user" + strconv.FormatInt(userID, 10)},
+		Chat:      &tgbotapi.Chat{ID: chatID, Type: "private"},
+		Date:      int(time.Now().Unix()),
+		Text:      text,
+	}
+	if strings.HasPrefix(text, "/") {
+		end := strings.IndexAny(text, " \n")
+		if end < 0 {
+			end = len(text)
+		}
+		msg.Entities = []tgbotapi.MessageEntity{{Type: "bot_command", Offset: 0, Length: end}}
+	}
+	s.PushUpdate(tgbotapi.Update{Message: msg})
+	return msg
+}
+
+// PushCallback queues a button press on message with data and returns the query ID
+func (s *Server) PushCallback(userID int64, message *tgbotapi.Message, data string) string {
+	s.mu.Lock()
+	id := "cb" + strconv.Itoa(s.nextID)
+	s.mu.Unlock()
+
+	s.PushUpdate(tgbotapi.Update{CallbackQuery: &tgbotapi.CallbackQuery{
+		ID:      id,
+		From:    &tgbotapi.User{ID: userID},
+		Message: message,
+		Data:    data,
+	}})
+	return id
+}
+
+// FailNext makes the next call to method fail with an API error
+func (s *Server) FailNext(method string, code int, description string) {
+	s.FailNextRetryAfter(method, code, description, 0)
+}
+
+// FailNextRetryAfter makes the next call to method fail with retry_after set
+func (s *Server) FailNextRetryAfter(method string, code int, description string, retryAfter int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.failures[method] = append(s.failures[method], failure{code, description, retryAfter})
+}
+
+// DelayNext makes the next call to method hang for d before it is answered
+func (s *Server) DelayNext(method string, d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.delays[method] = append(s.delays[method], d)
+}
+
+// Calls returns the recorded calls to method, or every call if method is empty
+func (s *Server) Calls(method string) []Call {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var calls []Call
+	for _, c := range s.calls {
+		if method == "" || c.Method == method {
+			calls = append(calls, c)
+		}
+	}
+	return calls
+}
+
+// WaitFor waits until a call to method satisfies match, and returns it
+func (s *Server) WaitFor(method string, timeout time.Duration, match func(Call) bool) (Call, bool) {
+	deadline := time.After(timeout)
+	seen := 0
+	for {
+		s.mu.Lock()
+		changed := s.changed
+		calls := s.calls[seen:]
+		seen = len(s.calls)
+		s.mu.Unlock()
+
+		for _, c := range calls {
+			if c.Method == method && (match == nil || match(c)) {
+				return c, true
+			}
+		}
+
+		select {
+		case <-changed:
+		case <-deadline:
+			return Call{}, false
+		}
+	}
+}
+
+// WaitForText waits for a sendMessage or editMessageText whose text contains substr
+func (s *Server) WaitForText(substr string, timeout time.Duration) (Call, bool) {
+	deadline := time.Now().Add(timeout)
+	for time.Now().Before(deadline) {
+		for _, c := range s.Calls("") {
+			if (c.Method == "sendMessage" || c.Method == "editMessageText") && strings.Contains(c.Params["text"], substr) {
+				return c, true
+			}
+		}
+		s.waitChange(time.Until(deadline))
+	}
+	return Call{}, false
+}
+
+// waitChange blocks until something changes or timeout passes
+func (s *Server) waitChange(timeout time.Duration) {
+	s.mu.Lock()
+	changed := s.changed
+	s.mu.Unlock()
+	select {
+	case <-changed:
+	case <-time.After(timeout):
+	}
+}
+
+// notify wakes waiters; s.mu must be held
+func (s *Server) notify() {
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
+
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+	prefix := "/bot" + Token + "/"
+	if !strings.HasPrefix(r.URL.Path, prefix) {
+		writeError(w, http.StatusUnauthorized, "Unauthorized", 0)
+		return
+	}
+	method := strings.TrimPrefix(r.URL.Path, prefix)
+
+	call := Call{Method: method, Params: make(map[string]string), Files: make(map[string]string)}
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/") {
+		if err := r.ParseMultipartForm(32 << 20); err == nil {
+			for field, headers := range r.MultipartForm.File {
+				call.Files[field] = headers[0].Filename
+			}
+		}
+	} else {
+		r.ParseForm()
+	}
+	for key, values := range r.Form {
+		call.Params[key] = values[0]
+	}
+
+	s.mu.Lock()
+	// getUpdates is polled continuously, so it is not recorded
+	if method != "getUpdates" {
+		s.calls = append(s.calls, call)
+		s.notify()
+	}
+	var fail *failure
+	if queued := s.failures[method]; len(queued) > 0 {
+		fail = &queued[0]
+		s.failures[method] = queued[1:]
+	}
+	var delay time.Duration
+	if queued := s.delays[method]; len(queued) > 0 {
+		delay = queued[0]
+		s.delays[method] = queued[1:]
+	}
+	s.mu.Unlock()
+
+	if delay > 0 {
+		select {
+		case <-time.After(delay):
+		case <-s.closing:
+			return
+		case <-r.Context().Done():
+			return
+		}
+	}
+
+	if fail != nil {
+		writeError(w, fail.code, fail.description, fail.retryAfter)
+		return
+	}
+
+	switch method {
+	case "getUpdates":
+		s.serveUpdates(w, r, call)
+	case "getMe":
+		writeResult(w, tgbotapi.User{ID: BotID, IsBot: true, FirstName: "Test", UserName: "test_bot"})
+	case "sendMessage", "sendPhoto", "sendDocument", "editMessageText":
+		writeResult(w, s.message(call))
+	default:
+		writeResult(w, true)
+	}
+}
+
+// serveUpdates answers getUpdates, long polling until an update is queued
+func (s *Server) serveUpdates(w http.ResponseWriter, r *http.Request, call Call) {
+	offset := int(call.Int("offset"))
+	timeout := time.Duration(call.Int("timeout")) * time.Second
+	deadline := time.After(timeout)
+
+	for {
+		s.mu.Lock()
+		var pending []tgbotapi.Update
+		for _, u := range s.updates {
+			if u.UpdateID >= offset {
+				pending = append(pending, u)
+			}
+		}
+		changed := s.changed
+		s.mu.Unlock()
+
+		if len(pending) > 0 || timeout == 0 {
+			writeResult(w, pending)
+			return
+		}
+
+		select {
+		case <-changed:
+		case <-deadline:
+			writeResult(w, []tgbotapi.Update{})
+			return
+		case <-s.closing:
+			writeResult(w, []tgbotapi.Update{})
+			return
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// message builds the Message a send or edit call returns
+func (s *Server) message(call Call) tgbotapi.Message {
+	s.mu.Lock()
+	id := int(call.Int("message_id"))
+	if id == 0 {
+		id = s.nextMsgID
+		s.nextMsgID++
+	}
+	s.mu.Unlock()
+
+	return tgbotapi.Message{
+		MessageID: id,
+		From:      &tgbotapi.User{ID: BotID, IsBot: true, UserName: "test_bot"},
+		Chat:      &tgbotapi.Chat{ID: call.Int("chat_id")},
+		Date:      int(time.Now().Unix()),
+		Text:      call.Params["text"],
+	}
+}
+
+func writeResult(w http.ResponseWriter, result interface{}) {
+	raw, _ := json.Marshal(result)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tgbotapi.APIResponse{Ok: true, Result: raw})
+}
+
+func writeError(w http.ResponseWriter, code int, description string, retryAfter int) {
+	resp := tgbotapi.APIResponse{Ok: false, ErrorCode: code, Description: description}
+	if retryAfter > 0 {
+		resp.Parameters = &tgbotapi.ResponseParameters{RetryAfter: retryAfter}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,385 @@
+// Package templates keeps named prompt templates with {{variables}}, and
+// expands them into the commands they stand for.
+package templates
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultPath is where templates are kept
+const DefaultPath = "/Users/applejobs/.gemini/antigravity/scratch/telegram-agent-controller/config/templates.json"
+
+// Errors
+var (
+	ErrInvalidName     = errors.New("template name must be letters, digits, - or _")
+	ErrEmptyTemplate   = errors.New("template is empty")
+	ErrUnknownTemplate = errors.New("unknown template")
+	ErrSyntax          = errors.New("bad variable")
+	ErrMissingVariable = errors.New("missing variable")
+	ErrUnknownVariable = errors.New("unknown variable")
+)
+
+var (
+	namePattern     = regexp.MustCompile(`^[A-Za-z0-9_-]{1,32}$`)
+	variablePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+)
+
+// Template is a saved prompt or macro
+type Template struct {
+	Name    string    `json:"name"`
+	Text    string    `json:"text"`
+	Updated time.Time `json:"updated"`
+}
+
+// Variable is a {{placeholder}} in a template
+type Variable struct {
+	Name     string
+	Default  string // From {{name=default}}
+	Required bool   // Written as {{name}}, without a default
+	Builtin  bool   // Filled in by the bot, e.g. {{date}}
+}
+
+// Builtins fill in variables such as {{date}} unless the user gives a
+// value. They are only called for variables a template uses.
+type Builtins map[string]func() (string, error)
+
+// part is literal text or a variable, in template order
+type part struct {
+	text     string
+	variable *Variable
+}
+
+// parse splits a template into text and variables
+func parse(text string, builtins Builtins) ([]part, error) {
+	var parts []part
+	for {
+		open := strings.Index(text, "{{")
+		if open < 0 {
+			break
+		}
+		end := strings.Index(text[open:], "}}")
+		if end < 0 {
+			return nil, fmt.Errorf("%w: unclosed %q", ErrSyntax, truncate(text[open:], 20))
+		}
+		inner := text[open+2 : open+end]
+
+		name, def, hasDefault := strings.Cut(inner, "=")
+		name = strings.TrimSpace(name)
+		if !variablePattern.MatchString(name) {
+			return nil, fmt.Errorf("%w: {{%s}}", ErrSyntax, inner)
+		}
+		_, builtin := builtins[name]
+
+		parts = append(parts, part{text: text[:open]}, part{variable: &Variable{
+			Name:     name,
+			Default:  def,
+			Required: !hasDefault && !builtin,
+			Builtin:  builtin,
+		}})
+		text = text[open+end+2:]
+	}
+	return append(parts, part{text: text}), nil
+}
+
+// Variables lists the variables a template uses, in order of first use
+func Variables(text string, builtins Builtins) ([]Variable, error) {
+	parts, err := parse(text, builtins)
+	if err != nil {
+		return nil, err
+	}
+	var vars []Variable
+	seen := make(map[string]int)
+	for _, p := range parts {
+		if p.variable == nil {
+			continue
+		}
+		if i, ok := seen[p.variable.Name]; ok {
+			// A default given anywhere makes the variable optional
+			if vars[i].Required && !p.variable.Required {
+				vars[i] = *p.variable
+			}
+			continue
+		}
+		seen[p.variable.Name] = len(vars)
+		vars = append(vars, *p.variable)
+	}
+	return vars, nil
+}
+
+// Expand fills in a template's variables from values, then defaults, then
+// builtins. Missing required variables and values the template does not use
+// are errors.
+func Expand(text string, values map[string]string, builtins Builtins) (string, error) {
+	if err := check(text, values, builtins); err != nil {
+		return "", err
+	}
+	return expand(text, values, builtins, make(map[string]string))
+}
+
+// ExpandSteps splits a template into the commands to run, as Steps does,
+// and then expands each one like Expand. Steps are found before values are
+// filled in, so a value that contains a line starting with "/" stays part
+// of its command and never runs as one of its own.
+func ExpandSteps(text string, values map[string]string, builtins Builtins) ([]string, error) {
+	if err := check(text, values, builtins); err != nil {
+		return nil, err
+	}
+	resolved := make(map[string]string)
+	var steps []string
+	for _, step := range Steps(text) {
+		expanded, err := expand(step, values, builtins, resolved)
+		if err != nil {
+			return nil, err
+		}
+		if expanded = strings.TrimSpace(expanded); expanded != "" {
+			steps = append(steps, expanded)
+		}
+	}
+	return steps, nil
+}
+
+// check makes sure values fit the variables a template uses
+func check(text string, values map[string]string, builtins Builtins) error {
+	if _, err := parse(text, builtins); err != nil {
+		return err
+	}
+	vars, _ := Variables(text, builtins)
+
+	used := make(map[string]bool)
+	var missing []string
+	for _, v := range vars {
+		used[v.Name] = true
+		if _, ok := values[v.Name]; !ok && v.Required {
+			missing = append(missing, v.Name)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("%w: %s", ErrMissingVariable, strings.Join(missing, ", "))
+	}
+	for name := range values {
+		if !used[name] {
+			return fmt.Errorf("%w: %s (template uses %s)", ErrUnknownVariable, name, variableNames(vars))
+		}
+	}
+	return nil
+}
+
+// expand fills in the variables of checked text. Builtins and defaults
+// are looked up once and kept in resolved, so every use of a variable,
+// across steps too, gets the same value.
+func expand(text string, values map[string]string, builtins Builtins, resolved map[string]string) (string, error) {
+	parts, err := parse(text, builtins)
+	if err != nil {
+		return "", err
+	}
+
+	var sb strings.Builder
+	for _, p := range parts {
+		if p.variable == nil {
+			sb.WriteString(p.text)
+			continue
+		}
+		name := p.variable.Name
+		value, ok := values[name]
+		if !ok {
+			value, ok = resolved[name]
+		}
+		if !ok && p.variable.Builtin {
+			if value, err = builtins[name](); err != nil {
+				return "", fmt.Errorf("{{%s}}: %w", name, err)
+			}
+			ok = true
+		}
+		if !ok {
+			value = p.variable.Default
+		}
+		resolved[name] = value
+		sb.WriteString(value)
+	}
+	return sb.String(), nil
+}
+
+// Steps splits template text into the commands to run. Text starting with
+// "/" is a macro: every line starting with "/" begins a command, and other
+// lines continue the one before. Anything else is a single /run prompt.
+func Steps(expanded string) []string {
+	text := strings.TrimSpace(expanded)
+	if text == "" {
+		return nil
+	}
+	if !strings.HasPrefix(text, "/") {
+		return []string{"/run " + text}
+	}
+
+	var steps []string
+	for _, line := range strings.Split(text, "\n") {
+		if strings.HasPrefix(strings.TrimSpace(line), "/") || len(steps) == 0 {
+			steps = append(steps, strings.TrimSpace(line))
+			continue
+		}
+		steps[len(steps)-1] += "\n" + line
+	}
+	for i := range steps {
+		steps[i] = strings.TrimSpace(steps[i])
+	}
+	return steps
+}
+
+func variableNames(vars []Variable) string {
+	if len(vars) == 0 {
+		return "none"
+	}
+	names := make([]string, len(vars))
+	for i, v := range vars {
+		names[i] = v.Name
+	}
+	return strings.Join(names, ", ")
+}
+
+func truncate(s string, n int) string {
+	if r := []rune(s); len(r) > n {
+		return string(r[:n]) + "…"
+	}
+	return s
+}
+
+// Store keeps templates in a JSON file
+type Store struct {
+	path string
+
+	mu        sync.RWMutex
+	templates map[string]Template // By lowercase name
+}
+
+// NewStore returns an empty store that is not saved anywhere
+func NewStore() *Store {
+	return &Store{templates: make(map[string]Template)}
+}
+
+// Load reads the templates at path; a missing file is an empty store
+func Load(path string) (*Store, error) {
+	s := NewStore()
+	s.path = path
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		log.Printf("No templates at %s yet", path)
+		return s, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read templates: %w", err)
+	}
+
+	var list []Template
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, fmt.Errorf("failed to parse templates %s: %w", path, err)
+	}
+	for _, t := range list {
+		s.templates[strings.ToLower(t.Name)] = t
+	}
+	return s, nil
+}
+
+// Save adds or replaces a template and saves the store
+func (s *Store) Save(name, text string) (Template, error) {
+	if !namePattern.MatchString(name) {
+		return Template{}, fmt.Errorf("%w: %q", ErrInvalidName, name)
+	}
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return Template{}, ErrEmptyTemplate
+	}
+	if _, err := Variables(text, nil); err != nil {
+		return Template{}, err
+	}
+
+	t := Template{Name: name, Text: text, Updated: time.Now()}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.templates[strings.ToLower(name)] = t
+	return t, s.save()
+}
+
+// Get finds a template by name, ignoring case
+func (s *Store) Get(name string) (Template, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	t, ok := s.templates[strings.ToLower(name)]
+	if !ok {
+		return Template{}, fmt.Errorf("%w: %s", ErrUnknownTemplate, name)
+	}
+	return t, nil
+}
+
+// List returns the templates sorted by name
+func (s *Store) List() []Template {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	list := make([]Template, 0, len(s.templates))
+	for _, t := range s.templates {
+		list = append(list, t)
+	}
+	sort.Slice(list, func(i, j int) bool { return strings.ToLower(list[i].Name) < strings.ToLower(list[j].Name) })
+	return list
+}
+
+// Remove deletes a template and saves the store
+func (s *Store) Remove(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := strings.ToLower(name)
+	if _, ok := s.templates[key]; !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownTemplate, name)
+	}
+	delete(s.templates, key)
+	return s.save()
+}
+
+// save writes the templates atomically; s.mu must be held
+func (s *Store) save() error {
+	if s.path == "" {
+		return nil
+	}
+
+	list := make([]Template, 0, len(s.templates))
+	for _, t := range s.templates {
+		list = append(list, t)
+	}
+	sort.Slice(list, func(i, j int) bool { return strings.ToLower(list[i].Name) < strings.ToLower(list[j].Name) })
+
+	data, err := json.MarshalIndent(list, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return fmt.Errorf("failed to create templates directory: %w", err)
+	}
+
+	tmp := s.path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return fmt.Errorf("failed to save templates: %w", err)
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to save templates: %w", err)
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to save templates: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed to save templates: %w", err)
+	}
+	return os.Rename(tmp, s.path)
+}
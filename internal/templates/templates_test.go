@@ -0,0 +1,150 @@
+package templates
+
+import (
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+var testBuiltins = Builtins{
+	"date":      func() (string, error) { return "2026-01-02", nil },
+	"clipboard": func() (string, error) { return "", errors.New("no clipboard") },
+}
+
+func TestExpand(t *testing.T) {
+	tests := []struct {
+		name   string
+		text   string
+		values map[string]string
+		want   string
+		err    error
+	}{
+		{"required", "review {{file}} please", map[string]string{"file": "main.go"}, "review main.go please", nil},
+		{"default", "explain in {{lang=English}}", nil, "explain in English", nil},
+		{"default overridden", "explain in {{ lang = English }}", map[string]string{"lang": "中文"}, "explain in 中文", nil},
+		{"repeated", "{{x}} and {{x}}", map[string]string{"x": "a"}, "a and a", nil},
+		{"builtin", "log for {{date}}", nil, "log for 2026-01-02", nil},
+		{"builtin overridden", "log for {{date}}", map[string]string{"date": "today"}, "log for today", nil},
+		{"missing", "review {{file}} in {{repo}}", nil, "", ErrMissingVariable},
+		{"unknown value", "hi", map[string]string{"x": "1"}, "", ErrUnknownVariable},
+		{"unclosed", "hi {{x", nil, "", ErrSyntax},
+		{"bad name", "hi {{1x}}", nil, "", ErrSyntax},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Expand(tt.text, tt.values, testBuiltins)
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("Expand error = %v, want %v", err, tt.err)
+			}
+			if got != tt.want {
+				t.Errorf("Expand = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExpandBuiltinErrors(t *testing.T) {
+	if _, err := Expand("paste {{clipboard}}", nil, testBuiltins); err == nil {
+		t.Error("A failing builtin should fail the expansion")
+	}
+	// Unused builtins are never called
+	if _, err := Expand("no clipboard here", nil, testBuiltins); err != nil {
+		t.Errorf("Expand failed: %v", err)
+	}
+}
+
+func TestVariables(t *testing.T) {
+	vars, err := Variables("{{a}} {{b=x}} {{date}} {{a=y}}", testBuiltins)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Variable{
+		{Name: "a", Default: "y"},
+		{Name: "b", Default: "x"},
+		{Name: "date", Required: false, Builtin: true},
+	}
+	if !reflect.DeepEqual(vars, want) {
+		t.Errorf("Variables = %+v, want %+v", vars, want)
+	}
+}
+
+func TestSteps(t *testing.T) {
+	tests := []struct {
+		text string
+		want []string
+	}{
+		{"explain this\nin detail", []string{"/run explain this\nin detail"}},
+		{"/run -m opus review\nthe diff\n/screenshot", []string{"/run -m opus review\nthe diff", "/screenshot"}},
+		{"  ", nil},
+	}
+	for _, tt := range tests {
+		if got := Steps(tt.text); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Steps(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestExpandStepsKeepsValuesInTheirStep(t *testing.T) {
+	builtins := Builtins{"last_response": func() (string, error) { return "done\n/stop\n/alias rm model x", nil }}
+	tests := []struct {
+		text   string
+		values map[string]string
+		want   []string
+	}{
+		{"/run summarize {{last_response}}\n/screenshot", nil, []string{"/run summarize done\n/stop\n/alias rm model x", "/screenshot"}},
+		{"review {{last_response}}", nil, []string{"/run review done\n/stop\n/alias rm model x"}},
+		{"/run {{task}}\n/run again {{task}}", map[string]string{"task": "a\n/cancel 1"}, []string{"/run a\n/cancel 1", "/run again a\n/cancel 1"}},
+	}
+	for _, tt := range tests {
+		got, err := ExpandSteps(tt.text, tt.values, builtins)
+		if err != nil {
+			t.Fatalf("ExpandSteps(%q) failed: %v", tt.text, err)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("ExpandSteps(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+
+	if _, err := ExpandSteps("/run {{a}}\n/run {{b}}", map[string]string{"a": "x"}, nil); !errors.Is(err, ErrMissingVariable) {
+		t.Errorf("Expected a missing variable error, got %v", err)
+	}
+}
+
+func TestStorePersists(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config", "templates.json")
+	s, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+
+	if _, err := s.Save("Review", "review {{file}}"); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	if _, err := s.Save("daily", "/run standup for {{date}}\n/screenshot"); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	if _, err := s.Save("bad name", "x"); !errors.Is(err, ErrInvalidName) {
+		t.Errorf("Expected ErrInvalidName, got %v", err)
+	}
+	if _, err := s.Save("broken", "{{x"); !errors.Is(err, ErrSyntax) {
+		t.Errorf("Expected ErrSyntax, got %v", err)
+	}
+	if err := s.Remove("daily"); err != nil {
+		t.Fatalf("Remove failed: %v", err)
+	}
+
+	reloaded, err := Load(path)
+	if err != nil {
+		t.Fatalf("Reload failed: %v", err)
+	}
+	if got, err := reloaded.Get("review"); err != nil || got.Text != "review {{file}}" {
+		t.Errorf("Get(review) = %+v, %v", got, err)
+	}
+	if _, err := reloaded.Get("daily"); !errors.Is(err, ErrUnknownTemplate) {
+		t.Errorf("Removed template should be gone, got %v", err)
+	}
+	if list := reloaded.List(); len(list) != 1 {
+		t.Errorf("List = %+v", list)
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"net/http"
 	"strings"
 
+	"github.com/applejobs/telegram-remote-controller/internal/i18n"
 	"github.com/applejobs/telegram-remote-controller/internal/notes"
 )
 
@@ -60,22 +61,49 @@ func (s *Server) handleHome(w http.ResponseWriter, r *http.Request) {
 		notesJSON = []byte("[]")
 	}
 
+	p := i18n.For(localeOf(r))
+	text := make(map[string]string, len(scriptText))
+	for _, id := range scriptText {
+		text[id] = p.T(id)
+	}
+
 	data := struct {
+		Lang         i18n.Locale
 		Columns      map[string][]notes.Note
 		StatusOrder  []string
 		AllNotesJSON template.JS
+		Text         map[string]string
 	}{
+		Lang:         p.Locale,
 		Columns:      grouped,
 		StatusOrder:  []string{"TODO", "DOING", "DONE"},
 		AllNotesJSON: template.JS(notesJSON),
+		Text:         text,
 	}
 
-	tmpl := template.Must(template.New("home").Parse(homeHTML))
+	tmpl := template.Must(template.New("home").Funcs(template.FuncMap{"t": p.T}).Parse(homeHTML))
 	if err := tmpl.Execute(w, data); err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 	}
 }
 
+// scriptText are the messages the page's script needs
+var scriptText = []string{"web.save", "web.cancel", "web.click_to_edit", "web.user", "web.add_comment_failed"}
+
+// localeOf picks the page language from ?lang=, then Accept-Language
+func localeOf(r *http.Request) i18n.Locale {
+	if locale, ok := i18n.Parse(r.URL.Query().Get("lang")); ok {
+		return locale
+	}
+	for _, tag := range strings.Split(r.Header.Get("Accept-Language"), ",") {
+		tag, _, _ = strings.Cut(strings.TrimSpace(tag), ";")
+		if locale, ok := i18n.Parse(tag); ok {
+			return locale
+		}
+	}
+	return i18n.Default
+}
+
 func (s *Server) handleAPI(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", "application/json")
 
@@ -172,11 +200,11 @@ func (s *Server) handleCommentsAPI(w http.ResponseWriter, r *http.Request) {
 }
 
 const homeHTML = `<!DOCTYPE html>
-<html lang="zh-TW">
+<html lang="{{.Lang}}">
 <head>
     <meta charset="UTF-8">
     <meta name="viewport" content="width=device-width, initial-scale=1.0">
-    <title>Jira-like Idea Board</title>
+    <title>{{t "web.title"}}</title>
     <style>
         /* Jira Dark Theme Variables */
         :root {
@@ -414,11 +442,11 @@ const homeHTML = `<!DOCTYPE html>
 <body>
     <header>
         <div>
-            <h1>Kanban Board</h1>
-            <div class="sub-header">All project updates</div>
+            <h1>{{t "web.heading"}}</h1>
+            <div class="sub-header">{{t "web.subheading"}}</div>
         </div>
         <div style="font-size:0.9em; color:#8c9bab;">
-            Drag to update • Click to view • Click text to edit
+            {{t "web.hint"}}
         </div>
     </header>
     
@@ -430,7 +458,7 @@ const homeHTML = `<!DOCTYPE html>
              ondrop="drop(event, '{{$status}}')" 
              ondragover="allowDrop(event)">
             <div class="column-header {{$status}}-header">
-                <span>{{$status}}</span>
+                <span>{{t (printf "web.status.%s" $status)}}</span>
                 <span class="badge">{{len $notes}}</span>
             </div>
             {{range $notes}}
@@ -455,17 +483,17 @@ const homeHTML = `<!DOCTYPE html>
     <div class="side-panel" id="sidePanel">
         <div class="panel-header">
             <div class="note-breadcrumbs">
-                <span class="breadcrumb-link">Projects</span>
+                <span class="breadcrumb-link">{{t "web.projects"}}</span>
                 <span>/</span>
-                <span class="breadcrumb-link">Idea Board</span>
+                <span class="breadcrumb-link">{{t "web.board"}}</span>
                 <span>/</span>
                 <span id="panelId" style="color: var(--text-primary);"></span>
             </div>
             <div style="display: flex; gap: 12px; align-items: center;">
                 <select id="panelStatus" class="status-badge-select" onchange="updateNoteStatusFromPanel()">
-                    <option value="TODO">TO DO</option>
-                    <option value="DOING">IN PROGRESS</option>
-                    <option value="DONE">DONE</option>
+                    <option value="TODO">{{t "web.status.TODO"}}</option>
+                    <option value="DOING">{{t "web.status.DOING"}}</option>
+                    <option value="DONE">{{t "web.status.DONE"}}</option>
                 </select>
                 <div style="width:1px; height:20px; background:var(--border-color);"></div>
                 <button class="btn-icon" onclick="closePanel()">✕</button>
@@ -474,19 +502,19 @@ const homeHTML = `<!DOCTYPE html>
         
         <div class="panel-content">
             <div id="descriptionContainer">
-                <div id="panelContent" class="note-full-content" onclick="editDescription()" title="Click to edit"></div>
+                <div id="panelContent" class="note-full-content" onclick="editDescription()" title="{{t "web.click_to_edit"}}"></div>
             </div>
             
-            <div class="section-title">Activity</div>
+            <div class="section-title">{{t "web.activity"}}</div>
             
             <div style="display:flex; gap: 12px;">
                 <div class="comment-avatar">U</div>
                 <div style="flex:1;">
                     <div class="comment-input-wrapper">
-                        <textarea id="newComment" class="comment-input" placeholder="Add a comment..." onkeydown="handleCommentKeydown(event)"></textarea>
+                        <textarea id="newComment" class="comment-input" placeholder="{{t "web.comment_placeholder"}}" onkeydown="handleCommentKeydown(event)"></textarea>
                         <div class="comment-actions">
-                            <span style="font-size:0.8em; color:#8c9bab; margin-right:auto; padding-top:6px;">Pro tip: press M to comment</span>
-                            <button class="btn-primary" onclick="addComment()">Save</button>
+                            <span style="font-size:0.8em; color:#8c9bab; margin-right:auto; padding-top:6px;">{{t "web.comment_tip"}}</span>
+                            <button class="btn-primary" onclick="addComment()">{{t "web.save"}}</button>
                         </div>
                     </div>
                 </div>
@@ -499,6 +527,7 @@ const homeHTML = `<!DOCTYPE html>
     <script>
         // Inject data
         const allNotesList = {{.AllNotesJSON}};
+        const text = {{.Text}};
         const notesData = {};
         if (allNotesList) {
             allNotesList.forEach(n => notesData[n.id] = n);
@@ -595,7 +624,7 @@ const homeHTML = `<!DOCTYPE html>
             const descContainer = document.getElementById('descriptionContainer');
             if (descContainer.querySelector('textarea')) {
                 // If editing, reverting to view is handled by next openPanel, but safer to clean:
-                descContainer.innerHTML = '<div id="panelContent" class="note-full-content" onclick="editDescription()" title="Click to edit"></div>';
+                descContainer.innerHTML = '<div id="panelContent" class="note-full-content" onclick="editDescription()" title="' + text['web.click_to_edit'] + '"></div>';
             }
         }
 
@@ -615,10 +644,10 @@ const homeHTML = `<!DOCTYPE html>
                     '<div class="comment-avatar">U</div>' +
                     '<div class="comment-body">' +
                         '<div class="comment-header">' +
-                            '<span class="comment-author">User</span>' +
+                            '<span class="comment-author">' + escapeHtml(text['web.user']) + '</span>' +
                             '<span class="comment-date">' + date + '</span>' +
                         '</div>' +
-                        '<div class="comment-text" onclick="editComment(\'' + c.id + '\')" title="Click to edit">' + escapeHtml(c.content) + '</div>' +
+                        '<div class="comment-text" onclick="editComment(\'' + c.id + '\')" title="' + text['web.click_to_edit'] + '">' + escapeHtml(c.content) + '</div>' +
                     '</div>';
                 container.appendChild(div);
             });
@@ -643,7 +672,7 @@ const homeHTML = `<!DOCTYPE html>
                 renderComments(notesData[currentNoteId].comments);
                 input.value = '';
             } catch (err) {
-                alert('Failed to add comment');
+                alert(text['web.add_comment_failed']);
             }
         }
 
@@ -656,8 +685,8 @@ const homeHTML = `<!DOCTYPE html>
             container.innerHTML = 
                 '<textarea id="editDescriptionInput" class="editable-textarea">' + escapeHtml(currentText) + '</textarea>' +
                 '<div class="edit-actions">' +
-                    '<button class="btn-primary" onclick="saveDescription()">Save</button>' +
-                    '<button class="btn-secondary" onclick="cancelDescription(\'' + escapeJs(currentText) + '\')">Cancel</button>' +
+                    '<button class="btn-primary" onclick="saveDescription()">' + text['web.save'] + '</button>' +
+                    '<button class="btn-secondary" onclick="cancelDescription(\'' + escapeJs(currentText) + '\')">' + text['web.cancel'] + '</button>' +
                 '</div>';
             
             document.getElementById('editDescriptionInput').focus();
@@ -668,12 +697,12 @@ const homeHTML = `<!DOCTYPE html>
             updateContent(currentNoteId, newText);
             // Restore UI
             const container = document.getElementById('descriptionContainer');
-            container.innerHTML = '<div id="panelContent" class="note-full-content" onclick="editDescription()" title="Click to edit">' + escapeHtml(newText) + '</div>';
+            container.innerHTML = '<div id="panelContent" class="note-full-content" onclick="editDescription()" title="' + text['web.click_to_edit'] + '">' + escapeHtml(newText) + '</div>';
         }
 
         function cancelDescription(originalText) {
             const container = document.getElementById('descriptionContainer');
-            container.innerHTML = '<div id="panelContent" class="note-full-content" onclick="editDescription()" title="Click to edit">' + escapeHtml(originalText) + '</div>';
+            container.innerHTML = '<div id="panelContent" class="note-full-content" onclick="editDescription()" title="' + text['web.click_to_edit'] + '">' + escapeHtml(originalText) + '</div>';
         }
 
         function editComment(commentId) {
@@ -686,8 +715,8 @@ const homeHTML = `<!DOCTYPE html>
                 '<div class="comment-edit-area" style="margin-top:8px;">' +
                     '<textarea class="editable-textarea" style="min-height:80px;">' + escapeHtml(currentText) + '</textarea>' +
                     '<div class="edit-actions">' +
-                        '<button class="btn-primary" onclick="saveComment(\'' + commentId + '\', this)">Save</button>' +
-                        '<button class="btn-secondary" onclick="renderComments(notesData[\'' + currentNoteId + '\'].comments)">Cancel</button>' +
+                        '<button class="btn-primary" onclick="saveComment(\'' + commentId + '\', this)">' + text['web.save'] + '</button>' +
+                        '<button class="btn-secondary" onclick="renderComments(notesData[\'' + currentNoteId + '\'].comments)">' + text['web.cancel'] + '</button>' +
                     '</div>' +
                 '</div>';
             